@@ -6,6 +6,7 @@ import (
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/models/cart"
 	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -69,3 +70,39 @@ func CreateOrder(w http.ResponseWriter, req *http.Request, params martini.Params
 
 	return encoding.Must(enc.Encode(o))
 }
+
+// UpdateOrder changes an order of the shop. Line items, when they're
+// sent, replace the order's and are priced again; when the fulfillment
+// status becomes "fulfilled" on an order placed with send_webhooks=true,
+// order.fulfilled is sent.
+func UpdateOrder(w http.ResponseWriter, req *http.Request, params martini.Params, enc encoding.Encoder, shop *cart.Shop) string {
+	orderId := params["id"]
+	if !bson.IsObjectIdHex(orderId) {
+		apierror.GenerateError("invalid order reference", nil, w, req)
+		return ""
+	}
+
+	var o cart.Order
+	defer req.Body.Close()
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		apierror.GenerateError(err.Error(), err, w, req)
+		return ""
+	}
+
+	if err := json.Unmarshal(data, &o); err != nil {
+		apierror.GenerateError(err.Error(), err, w, req)
+		return ""
+	}
+
+	o.Id = bson.ObjectIdHex(orderId)
+	o.ShopId = shop.Id
+
+	if err := o.Update(); err != nil {
+		apierror.GenerateError(err.Error(), err, w, req)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(o))
+}
@@ -8,47 +8,44 @@ import (
 	"strconv"
 	"time"
 
-	// "github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/apicontext"
 	"github.com/curt-labs/API/helpers/encoding"
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/models/cartIntegration"
-	"github.com/curt-labs/API/models/customer"
 	"github.com/go-martini/martini"
 )
 
-func setDB(r *http.Request) error {
-	brandID, err := strconv.Atoi(r.URL.Query().Get("brandID"))
-	if err != nil {
-		return err
+// checkBrand makes sure the request picked one of its key's brands with
+// brandID, since prices are kept per brand.
+func checkBrand(dtx *apicontext.DataContext) error {
+	if dtx.BrandID == 0 {
+		return errors.New("brandID is required")
 	}
-	cartIntegration.Brand_ID = brandID
 	return nil
 }
 
-func setCustomerId(r *http.Request) error {
-	c := customer.Customer{}
-	err := c.GetCustomerIdFromKey(r.URL.Query().Get("key"))
-	if err != nil {
-		return err
+// checkCustomer makes sure the request's key belongs to a customer.
+func checkCustomer(dtx *apicontext.DataContext) error {
+	if dtx.CustomerID == 0 {
+		return errors.New("no customer for this API key")
 	}
-	cartIntegration.Customer_ID = c.Id
 	return nil
 }
 
 // Requires APIKEY and brandID in header
-func GetPricing(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+func GetPricing(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
 	}
-	err = setCustomerId(r)
+	err = checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	prices, err := cartIntegration.GetCustomerPrices()
+	prices, err := cartIntegration.GetCustomerPrices(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting prices by customer ID", err, rw, r)
 		return ""
@@ -58,14 +55,14 @@ func GetPricing(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) s
 
 // Requires APIKEY and brandID in header
 // Requires count and page in params
-func GetPricingPaged(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params) string {
+func GetPricingPaged(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
 	}
-	err = setCustomerId(r)
+	err = checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
@@ -83,7 +80,7 @@ func GetPricingPaged(rw http.ResponseWriter, r *http.Request, enc encoding.Encod
 		return ""
 	}
 
-	prices, err := cartIntegration.GetPricingPaged(page, count)
+	prices, err := cartIntegration.GetPricingPaged(page, count, dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting prices for paged customer pricing", err, rw, r)
 		return ""
@@ -92,19 +89,19 @@ func GetPricingPaged(rw http.ResponseWriter, r *http.Request, enc encoding.Encod
 }
 
 //Returns int
-func GetPricingCount(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+func GetPricingCount(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
 	}
-	err = setCustomerId(r)
+	err = checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	count, err := cartIntegration.GetPricingCount()
+	count, err := cartIntegration.GetPricingCount(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting pricing count", err, rw, r)
 		return ""
@@ -113,9 +110,9 @@ func GetPricingCount(rw http.ResponseWriter, r *http.Request, enc encoding.Encod
 }
 
 //Returns Mfr Prices for a part
-func GetPartPricesByPartID(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params) string {
+func GetPartPricesByPartID(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
@@ -125,7 +122,7 @@ func GetPartPricesByPartID(rw http.ResponseWriter, r *http.Request, enc encoding
 		apierror.GenerateError("Trouble getting part number for part pricing", err, rw, r)
 		return ""
 	}
-	prices, err := cartIntegration.GetPartPricesByPartID(partNumber)
+	prices, err := cartIntegration.GetPartPricesByPartID(partNumber, dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting pricing", err, rw, r)
 		return ""
@@ -134,14 +131,14 @@ func GetPartPricesByPartID(rw http.ResponseWriter, r *http.Request, enc encoding
 }
 
 //Returns Mfr Prices
-func GetAllPartPrices(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params) string {
+func GetAllPartPrices(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
 	}
-	prices, err := cartIntegration.GetPartPrices()
+	prices, err := cartIntegration.GetPartPrices(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting pricing", err, rw, r)
 		return ""
@@ -149,9 +146,9 @@ func GetAllPartPrices(rw http.ResponseWriter, r *http.Request, enc encoding.Enco
 	return encoding.Must(enc.Encode(prices))
 }
 
-func CreatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+func CreatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
@@ -167,12 +164,12 @@ func CreatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder)
 		apierror.GenerateError("Trouble creating pricing", err, rw, r)
 		return ""
 	}
-	err = setCustomerId(r)
+	err = checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	price.CustID = cartIntegration.Customer_ID
+	price.CustID = dtx.CustomerID
 	err = validatePrice(price)
 	if err != nil {
 		apierror.GenerateError(err.Error(), err, rw, r)
@@ -180,7 +177,7 @@ func CreatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder)
 	}
 	err = price.Create()
 	if err != nil {
-		apierror.GenerateError("Trouble creating pricing", err, rw, r)
+		apierror.GenerateError("Trouble creating pricing", err, rw, r, priceStatus(err))
 		return ""
 	}
 	err = price.InsertCartIntegration()
@@ -191,9 +188,9 @@ func CreatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder)
 	return encoding.Must(enc.Encode(price))
 }
 
-func UpdatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+func UpdatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
@@ -209,12 +206,12 @@ func UpdatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder)
 		apierror.GenerateError("Trouble creating pricing", err, rw, r)
 		return ""
 	}
-	err = setCustomerId(r)
+	err = checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	price.CustID = cartIntegration.Customer_ID
+	price.CustID = dtx.CustomerID
 	err = validatePrice(price)
 	if err != nil {
 		apierror.GenerateError(err.Error(), err, rw, r)
@@ -222,7 +219,7 @@ func UpdatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder)
 	}
 	err = price.Update()
 	if err != nil {
-		apierror.GenerateError("Trouble updating price", err, rw, r)
+		apierror.GenerateError("Trouble updating price", err, rw, r, priceStatus(err))
 		return ""
 	}
 	if price.ReferenceID > 0 {
@@ -238,119 +235,61 @@ func UpdatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder)
 	return encoding.Must(enc.Encode(price))
 }
 
-//set all of a customer's prices to MAP
-func ResetAllToMap(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+//set all of a customer's prices to MAP; ?dryRun=true only returns the changes
+func ResetAllToMap(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
 	}
-	err = setCustomerId(r)
+	err = checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	custPrices, err := cartIntegration.GetCustomerPrices()
-	if err != nil {
-		apierror.GenerateError("Trouble getting prices by customer ID", err, rw, r)
-		return ""
-	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
 
-	//create map of MAP prices
-	prices, err := cartIntegration.GetMAPPartPrices()
+	job, err := cartIntegration.ResetAllToMap(dtx, dryRun)
 	if err != nil {
-		apierror.GenerateError("Trouble getting part prices", err, rw, r)
+		apierror.GenerateError("Trouble updating prices", err, rw, r)
 		return ""
 	}
-	priceMap := make(map[int]cartIntegration.Price)
-	for _, p := range prices {
-		priceMap[p.PartID] = p
-	}
-
-	//set to MAP
-	for i, _ := range custPrices {
-		custPrices[i].Price = priceMap[custPrices[i].PartID].Price
-		if custPrices[i].CustID == 0 {
-			custPrices[i].CustID = cartIntegration.Customer_ID
-		}
-		if custPrices[i].ID == 0 {
-			err = custPrices[i].Create()
-		} else {
-			err = custPrices[i].Update()
-		}
-		if err != nil {
-			apierror.GenerateError("Trouble updating price", err, rw, r)
-			return ""
-		}
-	}
-	return encoding.Must(enc.Encode(custPrices))
+	return encoding.Must(enc.Encode(job))
 }
 
-//sets all of a customer's prices to a percentage of the price type specified in params
-func Global(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params) string {
+//sets all of a customer's prices to a percentage of the price type specified in params; ?dryRun=true only returns the changes
+func Global(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
 	}
-	err = setCustomerId(r)
+	err = checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	priceType := params["type"]
 	percent, err := strconv.ParseFloat(params["percentage"], 64)
 	if err != nil {
 		apierror.GenerateError("Trouble parsing percentage", err, rw, r)
 		return ""
 	}
-	percent = percent / 100
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
 
-	//create partPriceMap
-	prices, err := cartIntegration.GetPartPrices()
+	job, err := cartIntegration.GlobalPercent(dtx, params["type"], percent, dryRun)
 	if err != nil {
-		apierror.GenerateError("Trouble getting part prices", err, rw, r)
+		apierror.GenerateError("Trouble updating prices", err, rw, r)
 		return ""
 	}
-	priceMap := make(map[string]float64)
-	for _, p := range prices {
-		key := strconv.Itoa(p.PartID) + p.Type
-		priceMap[key] = p.Price
-	}
-
-	//get CustPrices
-	custPrices, err := cartIntegration.GetCustomerPrices()
-	if err != nil {
-		apierror.GenerateError("Trouble getting prices by customer ID", err, rw, r)
-		return ""
-	}
-
-	//set to percentage
-	for i, _ := range custPrices {
-		if custPrices[i].CustID == 0 {
-			custPrices[i].CustID = cartIntegration.Customer_ID
-		}
-		custPrices[i].Price = priceMap[strconv.Itoa(custPrices[i].PartID)+priceType] * percent
-		if custPrices[i].ID == 0 {
-			err = custPrices[i].Create()
-		} else {
-			err = custPrices[i].Update()
-
-		}
-		if err != nil {
-			apierror.GenerateError("Trouble updating price", err, rw, r)
-			return ""
-		}
-	}
-	return encoding.Must(enc.Encode(custPrices))
+	return encoding.Must(enc.Encode(job))
 }
 
 //Get those price types
-func GetAllPriceTypes(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+func GetAllPriceTypes(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
 	var err error
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
@@ -3,62 +3,166 @@ package cartIntegration
 import (
 	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/curt-labs/API/helpers/apicontext"
 	"github.com/curt-labs/API/helpers/encoding"
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/models/cartIntegration"
+	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
 )
 
-//TODO - extremely untested
+// uploadTypes are the content types of the price files Upload takes.
+var uploadTypes = map[string]bool{
+	"text/comma-separated-values": true,
+	"text/csv":                    true,
+	"application/csv":             true,
+	"application/excel":           true,
+	"application/vnd.ms-excel":    true,
+	"application/vnd.msexcel":     true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
+	"application/octet-stream": true,
+}
 
-func Upload(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
-	err := setCustomerId(r)
+// Upload queues a CSV or XLSX price file for import and returns the
+// upload job. An optional "mapping" form field holds the JSON column
+// mapping of the file's layout.
+func Upload(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	err := checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
 	}
-	key := r.URL.Query().Get("key")
 	file, fileHeader, err := r.FormFile("file")
 	if err != nil {
-		apierror.GenerateError("Error getting file from form", err, rw, r)
+		apierror.GenerateError("Error getting file from form", err, rw, r, http.StatusBadRequest)
 		return ""
 	}
+	defer file.Close()
 
+	var fileName string
 	if fileHeader != nil {
+		fileName = fileHeader.Filename
 		contentType := fileHeader.Header.Get("Content-Type")
 
-		if contentType != "text/comma-separated-values" && contentType != "text/csv" &&
-			contentType != "application/csv" && contentType != "application/excel" &&
-			contentType != "application/vnd.ms-excel" && contentType != "application/vnd.msexcel" {
-			err = errors.New("The file you tried uploading was not a valid CSV file. Please try again using a valid CSV file.")
-			apierror.GenerateError("Error uploading file", err, rw, r)
+		if !uploadTypes[contentType] {
+			err = errors.New("The file you tried uploading was not a valid CSV or XLSX file. Please try again using a valid CSV or XLSX file.")
+			apierror.GenerateError("Error uploading file", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
+	var mapping *cartIntegration.ColumnMapping
+	if m := r.FormValue("mapping"); m != "" {
+		mapping = &cartIntegration.ColumnMapping{}
+		if err = json.Unmarshal([]byte(m), mapping); err != nil {
+			apierror.GenerateError("Trouble reading column mapping", err, rw, r, http.StatusBadRequest)
 			return ""
 		}
 	}
 
-	go cartIntegration.UploadFile(file, key)
+	job, err := cartIntegration.NewUpload(dtx, fileName, file, mapping)
+	if err != nil {
+		apierror.GenerateError("Error uploading file", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	rw.WriteHeader(http.StatusAccepted)
+	return encoding.Must(enc.Encode(job))
+}
+
+// GetUploads returns the customer's latest price file uploads
+func GetUploads(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	err := checkCustomer(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
+		return ""
+	}
+	jobs, err := cartIntegration.Uploads(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price uploads", err, rw, r)
+		return ""
+	}
+	return encoding.Must(enc.Encode(jobs))
+}
+
+// GetUpload returns a price file upload and its progress
+func GetUpload(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
+	id, err := uploadID(params, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price upload", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	job, err := cartIntegration.GetUpload(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price upload", err, rw, r, uploadStatus(err))
+		return ""
+	}
+	return encoding.Must(enc.Encode(job))
+}
+
+// UploadErrors returns the rows of a price file upload that weren't
+// imported, as a CSV report
+func UploadErrors(rw http.ResponseWriter, r *http.Request, params martini.Params, dtx *apicontext.DataContext) string {
+	id, err := uploadID(params, dtx)
 	if err != nil {
-		apierror.GenerateError("Error uploading file", err, rw, r)
+		apierror.GenerateError("Trouble getting price upload errors", err, rw, r, http.StatusBadRequest)
 		return ""
 	}
+	rowErrs, err := cartIntegration.UploadErrors(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price upload errors", err, rw, r, uploadStatus(err))
+		return ""
+	}
+
+	b := &bytes.Buffer{}
+	wr := csv.NewWriter(b)
+	wr.Write([]string{"Row", "Part Number", "Column", "Error", "Values"})
+	for _, e := range rowErrs {
+		wr.Write(append([]string{strconv.Itoa(e.Row), e.PartNumber, e.Column, e.Message}, e.Values...))
+	}
+	wr.Flush()
+
+	rw.Header().Set("Content-Type", "text/csv")
+	rw.Header().Set("Content-Disposition", "attachment;filename=upload-"+id.Hex()+"-errors.csv")
+	rw.Write(b.Bytes())
 	return ""
 }
 
-func Download(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
-	err := setCustomerId(r)
+func uploadID(params martini.Params, dtx *apicontext.DataContext) (bson.ObjectId, error) {
+	if err := checkCustomer(dtx); err != nil {
+		return "", err
+	}
+	if !bson.IsObjectIdHex(params["id"]) {
+		return "", errors.New("invalid price upload ID")
+	}
+	return bson.ObjectIdHex(params["id"]), nil
+}
+
+func uploadStatus(err error) int {
+	if err == cartIntegration.ErrUploadNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func Download(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	err := checkCustomer(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
 		return ""
 	}
-	err = setDB(r)
+	err = checkBrand(dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
 		return ""
@@ -67,14 +171,14 @@ func Download(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) str
 	b := &bytes.Buffer{}
 	wr := csv.NewWriter(b)
 
-	customerPrices, err := cartIntegration.GetCustomerPrices()
+	customerPrices, err := cartIntegration.GetCustomerPrices(dtx)
 	if err != nil {
 		apierror.GenerateError("Error getting customer prices ", err, rw, r)
 		return ""
 	}
 
 	//Price map
-	prices, err := cartIntegration.GetPartPrices()
+	prices, err := cartIntegration.GetPartPrices(dtx)
 	if err != nil {
 		apierror.GenerateError("Error getting part prices ", err, rw, r)
 		return ""
@@ -128,3 +232,55 @@ func Download(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) str
 
 	return ""
 }
+
+// GetExportFormats lists the cart formats prices can be exported in
+func GetExportFormats(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+	return encoding.Must(enc.Encode(cartIntegration.Formats()))
+}
+
+// Export returns the customer's prices and part content as the product
+// import file of a cart. With ?delta=true only parts that changed since
+// the last export in that format are included. Parts since dropped get
+// rows removing them from the cart.
+func Export(rw http.ResponseWriter, r *http.Request, params martini.Params, dtx *apicontext.DataContext) string {
+	err := checkCustomer(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
+		return ""
+	}
+	err = checkBrand(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
+		return ""
+	}
+	if _, ok := cartIntegration.GetFormatter(params["format"]); !ok {
+		apierror.GenerateError("Trouble exporting prices", errors.New("unknown cart format "+params["format"]), rw, r, http.StatusNotFound)
+		return ""
+	}
+	qs := r.URL.Query()
+	delta, _ := strconv.ParseBool(qs.Get("delta"))
+
+	b := &bytes.Buffer{}
+	res, err := cartIntegration.Export(dtx, params["format"], delta, qs.Get("units"), b)
+	if err != nil {
+		apierror.GenerateError("Trouble exporting prices", err, rw, r)
+		return ""
+	}
+
+	name := res.Format
+	if delta {
+		name += "-delta"
+	}
+	rw.Header().Set("Content-Type", "text/csv")
+	rw.Header().Set("Content-Disposition", "attachment;filename="+name+"-"+time.Now().Format(cartIntegration.DATE_FORMAT)+".csv")
+	rw.Header().Set("X-Export-Parts", strconv.Itoa(res.Parts))
+	rw.Header().Set("X-Export-Removed", strconv.Itoa(res.Removed))
+	if _, err = rw.Write(b.Bytes()); err != nil {
+		return ""
+	}
+	// only a file that went out whole is the base of the next delta
+	if err = res.Commit(); err != nil {
+		log.Printf("failed to save cart export of customer %d: %s", dtx.CustomerID, err.Error())
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package cartIntegration
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/cartIntegration"
+	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GetJobs returns the customer's latest bulk price jobs
+func GetJobs(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	err := checkCustomer(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
+		return ""
+	}
+	jobs, err := cartIntegration.Jobs(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price jobs", err, rw, r)
+		return ""
+	}
+	return encoding.Must(enc.Encode(jobs))
+}
+
+// GetJob returns a bulk price job with its changes
+func GetJob(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
+	id, err := jobID(params, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price job", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	job, err := cartIntegration.GetJob(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price job", err, rw, r, jobStatus(err))
+		return ""
+	}
+	return encoding.Must(enc.Encode(job))
+}
+
+// RevertJob restores the prices a bulk price job replaced
+func RevertJob(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
+	id, err := jobID(params, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble reverting price job", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	job, err := cartIntegration.RevertJob(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble reverting price job", err, rw, r, jobStatus(err))
+		return ""
+	}
+	return encoding.Must(enc.Encode(job))
+}
+
+func jobID(params martini.Params, dtx *apicontext.DataContext) (bson.ObjectId, error) {
+	if err := checkCustomer(dtx); err != nil {
+		return "", err
+	}
+	if !bson.IsObjectIdHex(params["id"]) {
+		return "", errors.New("invalid price job ID")
+	}
+	return bson.ObjectIdHex(params["id"]), nil
+}
+
+func jobStatus(err error) int {
+	switch err {
+	case cartIntegration.ErrJobNotFound:
+		return http.StatusNotFound
+	case cartIntegration.ErrJobReverted:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,144 @@
+package cartIntegration
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/cartIntegration"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GetMAPViolations reports the customer's prices below enforced MAP for
+// the brand. Internal users may report on another customer with
+// ?customer=, or on every customer with ?customer=0; everyone else only
+// gets their own. ?asOf= checks prices as of a date instead of now.
+func GetMAPViolations(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	err := checkBrand(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting brandID from query string", err, rw, r)
+		return ""
+	}
+
+	custID := dtx.CustomerID
+	if qs := r.URL.Query().Get("customer"); qs != "" && authorize.IsStaff(dtx) {
+		if custID, err = strconv.Atoi(qs); err != nil {
+			apierror.GenerateError("Trouble getting customer ID", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	} else if err = checkCustomer(dtx); err != nil {
+		apierror.GenerateError("Trouble getting customer from api key", err, rw, r)
+		return ""
+	}
+
+	at := time.Now()
+	if qs := r.URL.Query().Get("asOf"); qs != "" {
+		if at, err = time.ParseInLocation(cartIntegration.DATE_FORMAT, qs, time.Local); err != nil {
+			apierror.GenerateError("Trouble parsing asOf date", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
+	report, err := cartIntegration.MAPViolations(dtx.BrandID, custID, at)
+	if err != nil {
+		apierror.GenerateError("Trouble getting MAP violations", err, rw, r)
+		return ""
+	}
+	return encoding.Must(enc.Encode(report))
+}
+
+// GetMAPExemptions returns the MAP exemptions of the brand, or of every
+// brand without ?brandID=.
+func GetMAPExemptions(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+	exemptions, err := pricing.Exemptions(dtx.BrandID)
+	if err != nil {
+		apierror.GenerateError("Trouble getting MAP exemptions", err, rw, r)
+		return ""
+	}
+	return encoding.Must(enc.Encode(exemptions))
+}
+
+// SaveMAPExemption creates a MAP exemption, or replaces the one of :id.
+func SaveMAPExemption(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var e pricing.Exemption
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		apierror.GenerateError("Trouble reading request body for MAP exemption", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	e.ID = ""
+	if id, ok := params["id"]; ok {
+		if !bson.IsObjectIdHex(id) {
+			apierror.GenerateError("Trouble getting MAP exemption ID", errors.New("invalid MAP exemption ID"), rw, r, http.StatusBadRequest)
+			return ""
+		}
+		e.ID = bson.ObjectIdHex(id)
+	}
+	e.UserID = dtx.UserID
+
+	if err := e.Save(); err != nil {
+		code := http.StatusBadRequest
+		if err == pricing.ErrExemptionNotFound {
+			code = http.StatusNotFound
+		}
+		apierror.GenerateError("Trouble saving MAP exemption", err, rw, r, code)
+		return ""
+	}
+	return encoding.Must(enc.Encode(e))
+}
+
+// DeleteMAPExemption removes a MAP exemption.
+func DeleteMAPExemption(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+	if !bson.IsObjectIdHex(params["id"]) {
+		apierror.GenerateError("Trouble getting MAP exemption ID", errors.New("invalid MAP exemption ID"), rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	e := pricing.Exemption{ID: bson.ObjectIdHex(params["id"])}
+	if err := e.Delete(); err != nil {
+		code := http.StatusInternalServerError
+		if err == pricing.ErrExemptionNotFound {
+			code = http.StatusNotFound
+		}
+		apierror.GenerateError("Trouble deleting MAP exemption", err, rw, r, code)
+		return ""
+	}
+	return encoding.Must(enc.Encode(e))
+}
+
+// priceStatus answers prices below enforced MAP with a 400, unknown
+// prices with a 404, sales that overlap another with a 409, and other
+// errors with a 500.
+func priceStatus(err error) int {
+	if err == cartIntegration.ErrCustomerPriceNotFound {
+		return http.StatusNotFound
+	}
+	switch err.(type) {
+	case *pricing.Violation:
+		return http.StatusBadRequest
+	case *pricing.SaleOverlap:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
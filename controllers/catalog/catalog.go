@@ -0,0 +1,80 @@
+package catalog_ctlr
+
+import (
+	"net/http"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/catalog"
+	"github.com/go-martini/martini"
+)
+
+// SyncStatus is the state of the catalog sync.
+type SyncStatus struct {
+	Current *catalog.Run  `json:"current" xml:"current"`
+	Recent  []catalog.Run `json:"recent" xml:"recent>run"`
+}
+
+// Sync starts a full or incremental rebuild of the Mongo catalog from
+// MySQL.
+func Sync(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = catalog.Incremental
+	}
+
+	run, err := catalog.Start(mode)
+	if err == catalog.ErrRunning {
+		apierror.GenerateError("Trouble starting catalog sync", err, rw, r, http.StatusConflict)
+		return ""
+	}
+	if err != nil {
+		apierror.GenerateError("Trouble starting catalog sync", err, rw, r)
+		return ""
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+	return encoding.Must(enc.Encode(run))
+}
+
+// Status returns the run in progress and the most recent runs.
+func Status(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	runs, err := catalog.Runs(10)
+	if err != nil {
+		apierror.GenerateError("Trouble getting catalog sync runs", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(SyncStatus{
+		Current: catalog.Current(),
+		Recent:  runs,
+	}))
+}
+
+// Run returns the progress and errors of a single sync run.
+func Run(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	run, err := catalog.GetRun(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting catalog sync run", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(run))
+}
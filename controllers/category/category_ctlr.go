@@ -2,11 +2,13 @@ package category_ctlr
 
 import (
 	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
 	"github.com/curt-labs/API/helpers/encoding"
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/models/category"
 	"github.com/go-martini/martini"
 
+	"encoding/json"
 	"net/http"
 	"strconv"
 )
@@ -31,9 +33,9 @@ func GetCategory(rw http.ResponseWriter, r *http.Request, params martini.Params,
 		count, _ = strconv.Atoi(ct)
 	}
 
-	err = c.Get(page, count)
+	err = c.Get(page, count, dtx)
 	if err != nil || c.CategoryID == 0 {
-		apierror.GenerateError("Trouble getting category", err, rw, r)
+		apierror.GenerateError("Trouble getting category", err, rw, r, status(err))
 		return ""
 	}
 
@@ -68,7 +70,7 @@ func GetCategoryParts(rw http.ResponseWriter, r *http.Request, params martini.Pa
 		count, _ = strconv.Atoi(ct)
 	}
 
-	parts, err := category.GetCategoryParts(catId, page, count)
+	parts, err := category.GetCategoryParts(catId, page, count, dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble getting parts", err, rw, r)
 		return ""
@@ -76,3 +78,223 @@ func GetCategoryParts(rw http.ResponseWriter, r *http.Request, params martini.Pa
 
 	return encoding.Must(enc.Encode(parts))
 }
+
+// GetAncestors lists the categories above a category, top-level first.
+func GetAncestors(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting category identifier", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	cats, err := category.Ancestors(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting category ancestors", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(cats))
+}
+
+// GetDescendants lists the subcategories of a category, down to the
+// optional depth.
+func GetDescendants(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting category identifier", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	depth := 0
+	if d := r.URL.Query().Get("depth"); d != "" {
+		if depth, err = strconv.Atoi(d); err != nil || depth < 0 {
+			apierror.GenerateError("Trouble getting depth", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
+	cats, err := category.Descendants(id, depth, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting category descendants", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(cats))
+}
+
+// GetCategoryByPath gets a category by its path of title slugs, like
+// GetCategory.
+func GetCategoryByPath(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	c, err := category.GetByPath(params["_1"], dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting category", err, rw, r, status(err))
+		return ""
+	}
+
+	qs := r.URL.Query()
+	page := 1
+	count := 50
+	if pg := qs.Get("page"); pg != "" {
+		page, _ = strconv.Atoi(pg)
+	}
+	if ct := qs.Get("count"); ct != "" {
+		count, _ = strconv.Atoi(ct)
+	}
+
+	if err = c.Get(page, count, dtx); err != nil {
+		apierror.GenerateError("Trouble getting category", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(c))
+}
+
+// CreateCategory adds a category from the JSON body.
+func CreateCategory(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var c category.Category
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		apierror.GenerateError("Trouble reading category", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	if err := c.Create(dtx); err != nil {
+		apierror.GenerateError("Trouble creating category", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(c))
+}
+
+// MoveCategory moves a category and its subcategories under the
+// parent_id of the JSON body, 0 for the root.
+func MoveCategory(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting category identifier", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	var body struct {
+		ParentID *int `json:"parent_id"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil || body.ParentID == nil {
+		apierror.GenerateError("Trouble reading parent_id", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	c, err := category.Move(id, *body.ParentID, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble moving category", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(c))
+}
+
+// SortCategories orders the children of a category, or the root
+// categories for id 0, by the ids of the JSON body.
+func SortCategories(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting category identifier", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	var body struct {
+		IDs []int `json:"ids"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.GenerateError("Trouble reading category order", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	if err = category.Reorder(id, body.IDs, dtx); err != nil {
+		apierror.GenerateError("Trouble sorting categories", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(body))
+}
+
+// AttachParts adds the part_ids of the JSON body to a category.
+func AttachParts(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	return changeParts(rw, r, params, enc, dtx, category.AttachParts)
+}
+
+// DetachParts removes the part_ids of the JSON body from a category.
+func DetachParts(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	return changeParts(rw, r, params, enc, dtx, category.DetachParts)
+}
+
+func changeParts(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext, change func(int, []int, *apicontext.DataContext) (*category.Category, error)) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting category identifier", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	var body struct {
+		PartIDs []int `json:"part_ids"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.GenerateError("Trouble reading part_ids", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	c, err := change(id, body.PartIDs, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble changing category parts", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(c))
+}
+
+// DeleteCategory removes a category and its subcategories.
+func DeleteCategory(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting category identifier", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	c, err := category.Delete(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble deleting category", err, rw, r, status(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(c))
+}
+
+func status(err error) int {
+	if err == category.ErrNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/curt-labs/API/helpers/encoding"
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/models/customer"
+	"github.com/curt-labs/API/models/pricing"
 	"github.com/curt-labs/API/models/products"
 	"github.com/go-martini/martini"
 
@@ -123,13 +124,41 @@ func GetCustomerPrice(rw http.ResponseWriter, r *http.Request, enc encoding.Enco
 		return ""
 	}
 
-	var price float64
-	if price, err = customer.GetCustomerPrice(dtx, p.ID); err != nil {
+	if err = p.Get(dtx); err != nil {
+		apierror.GenerateError("Trouble getting part", err, rw, r)
+		return ""
+	}
+
+	explain, _ := strconv.ParseBool(r.FormValue("explain"))
+	res, err := products.ResolvePrices([]products.Part{p}, dtx, explain)
+	if err != nil || len(res) == 0 {
 		apierror.GenerateError("Trouble getting price", err, rw, r)
 		return ""
 	}
 
-	return encoding.Must(enc.Encode(price))
+	if qs := r.FormValue("qty"); qs != "" {
+		qty, err := strconv.Atoi(qs)
+		if err != nil || qty < 1 {
+			apierror.GenerateError("Trouble getting quantity", errors.New("qty must be a positive number"), rw, r, http.StatusBadRequest)
+			return ""
+		}
+		tiers, err := pricing.LoadTiers(dtx.CustomerID, p.ID)
+		if err != nil {
+			apierror.GenerateError("Trouble getting quantity breaks", err, rw, r)
+			return ""
+		}
+		res[0] = tiers.Apply(res[0], qty)
+	}
+
+	if res, err = products.ConvertPrices(res, dtx); err != nil {
+		apierror.GenerateError("Trouble converting price", err, rw, r, currencyStatus(err))
+		return ""
+	}
+
+	if explain || res[0].Quantity > 0 {
+		return encoding.Must(enc.Encode(res[0]))
+	}
+	return encoding.Must(enc.Encode(res[0].Price))
 }
 
 func GetCustomerCartReference(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params, dtx *apicontext.DataContext) string {
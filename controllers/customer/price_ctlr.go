@@ -6,10 +6,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/curt-labs/API/helpers/apicontext"
 	"github.com/curt-labs/API/helpers/encoding"
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/helpers/sortutil"
 	"github.com/curt-labs/API/models/customer"
+	"github.com/curt-labs/API/models/pricing"
 	"github.com/go-martini/martini"
 )
 
@@ -147,7 +149,14 @@ func CreateUpdatePrice(rw http.ResponseWriter, r *http.Request, enc encoding.Enc
 		if w.ID > 0 {
 			msg = "Trouble updating customer price"
 		}
-		apierror.GenerateError(msg, err, rw, r)
+		code := http.StatusInternalServerError
+		switch err.(type) {
+		case *pricing.Violation:
+			code = http.StatusBadRequest
+		case *pricing.SaleOverlap:
+			code = http.StatusConflict
+		}
+		apierror.GenerateError(msg, err, rw, r, code)
 		return ""
 	}
 
@@ -248,6 +257,36 @@ func GetSales(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, par
 	return encoding.Must(enc.Encode(ps))
 }
 
+// GetSaleCalendar lists the sales of the customer of the API key that
+// are on or start between ?from= and ?to=, today and 90 days out by
+// default, flagging sales that overlap.
+func GetSaleCalendar(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	var err error
+	y, m, d := time.Now().Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 0, 90)
+
+	if qs := r.FormValue("from"); qs != "" {
+		if from, err = time.ParseInLocation(inputTimeFormat, qs, time.Local); err != nil {
+			apierror.GenerateError("Trouble getting calendar start date", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+	if qs := r.FormValue("to"); qs != "" {
+		if to, err = time.ParseInLocation(inputTimeFormat, qs, time.Local); err != nil {
+			apierror.GenerateError("Trouble getting calendar end date", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
+	entries, err := customer.SaleCalendar(dtx.CustomerID, from, to)
+	if err != nil {
+		apierror.GenerateError("Trouble getting sale calendar", err, rw, r)
+		return ""
+	}
+	return encoding.Must(enc.Encode(entries))
+}
+
 func GetPriceByCustomer(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, params martini.Params) string {
 	var err error
 	var ps customer.CustomerPrices
@@ -0,0 +1,72 @@
+package customer_ctlr
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/pricelist"
+)
+
+// GetPriceList generates the key's customer's price list as a PDF, or an
+// XLSX spreadsheet with ?format=xlsx, of every category or the one given
+// by ?category=, with the prices in effect on ?asOf=.
+func GetPriceList(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	var err error
+	var categoryID int
+	if qs := r.FormValue("category"); qs != "" {
+		if categoryID, err = strconv.Atoi(qs); err != nil {
+			apierror.GenerateError("Trouble getting category ID", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+	var asOf time.Time
+	if qs := r.FormValue("asOf"); qs != "" {
+		if asOf, err = time.ParseInLocation(inputTimeFormat, qs, time.Local); err != nil {
+			apierror.GenerateError("Trouble getting price list date", err, rw, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "xlsx" && format != "json" {
+		apierror.GenerateError("Trouble generating price list", fmt.Errorf("unknown price list format %q, use pdf, xlsx or json", format), rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	pl, err := pricelist.Generate(dtx, categoryID, asOf)
+	if err != nil {
+		apierror.GenerateError("Trouble generating price list", err, rw, r, currencyStatus(err))
+		return ""
+	}
+
+	b := &bytes.Buffer{}
+	name := "price-list-" + pl.AsOf.Format("2006-01-02") + "." + format
+	switch format {
+	case "json":
+		return encoding.Must(enc.Encode(pl))
+	case "xlsx":
+		err = pl.WriteXLSX(b)
+		rw.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	default:
+		err = pl.WritePDF(b)
+		rw.Header().Set("Content-Type", "application/pdf")
+	}
+	if err != nil {
+		apierror.GenerateError("Trouble writing price list", err, rw, r)
+		return ""
+	}
+
+	rw.Header().Set("Content-Disposition", "attachment;filename="+name)
+	rw.Write(b.Bytes())
+	return ""
+}
@@ -0,0 +1,137 @@
+package customer_ctlr
+
+import (
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var errInvalidTierID = errors.New("invalid price tier ID")
+
+// GetPriceTiers returns the quantity breaks of the key's customer and
+// the defaults of its dealer tier.
+func GetPriceTiers(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	tiers, err := pricing.CustomerTiers(dtx.CustomerID)
+	if err != nil {
+		apierror.GenerateError("Trouble getting price tiers", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(tiers))
+}
+
+// SavePriceTier creates quantity breaks for a part of the key's
+// customer, or replaces the tier with the ID in the route. Tiers with a
+// dealer_tier_id are dealer tier defaults, which only internal staff set.
+func SavePriceTier(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	var tier pricing.Tier
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&tier); err != nil {
+		apierror.GenerateError("Trouble reading request body for price tier", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	tier.ID = ""
+	if id := params["id"]; id != "" {
+		existing, err := getPriceTier(id)
+		if err != nil {
+			apierror.GenerateError("Trouble getting price tier", err, rw, r, tierStatus(err, http.StatusInternalServerError))
+			return ""
+		}
+		if err = canManageTier(existing, dtx); err != nil {
+			denyTier(err, rw, r)
+			return ""
+		}
+		tier.ID = existing.ID
+	}
+	if tier.DealerTierID == 0 {
+		tier.CustomerID = dtx.CustomerID
+	} else {
+		tier.CustomerID = 0
+	}
+	if err := canManageTier(&tier, dtx); err != nil {
+		denyTier(err, rw, r)
+		return ""
+	}
+
+	if err := tier.Save(); err != nil {
+		apierror.GenerateError("Trouble saving price tier", err, rw, r, tierStatus(err, http.StatusBadRequest))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(tier))
+}
+
+// DeletePriceTier removes quantity breaks of the key's customer, or
+// dealer tier defaults for internal staff.
+func DeletePriceTier(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	tier, err := getPriceTier(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting price tier", err, rw, r, tierStatus(err, http.StatusInternalServerError))
+		return ""
+	}
+	if err = canManageTier(tier, dtx); err != nil {
+		denyTier(err, rw, r)
+		return ""
+	}
+
+	if err = tier.Delete(); err != nil {
+		apierror.GenerateError("Trouble deleting price tier", err, rw, r, tierStatus(err, http.StatusInternalServerError))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(tier))
+}
+
+func getPriceTier(id string) (*pricing.Tier, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, errInvalidTierID
+	}
+	return pricing.GetTier(bson.ObjectIdHex(id))
+}
+
+// canManageTier lets a customer's private keys change its own quantity
+// breaks, and internal staff dealer tier defaults.
+func canManageTier(tier *pricing.Tier, dtx *apicontext.DataContext) error {
+	if tier.CustomerID == 0 {
+		return authorize.Staff(dtx)
+	}
+	if tier.CustomerID != dtx.CustomerID {
+		// as if it didn't exist, so other customers' tiers aren't told
+		return pricing.ErrTierNotFound
+	}
+	return authorize.PrivateKey(dtx)
+}
+
+// denyTier answers another customer's tier with a 404, keys that aren't
+// staff's with a 403 and keys that aren't private with a 401.
+func denyTier(err error, rw http.ResponseWriter, r *http.Request) {
+	switch err {
+	case pricing.ErrTierNotFound:
+		apierror.GenerateError("Trouble getting price tier", err, rw, r, http.StatusNotFound)
+	case authorize.ErrStaff:
+		apierror.GenerateError("Forbidden", err, rw, r, http.StatusForbidden)
+	default:
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+	}
+}
+
+// tierStatus answers missing tiers with a 404, bad IDs with a 400 and
+// other errors with code.
+func tierStatus(err error, code int) int {
+	switch {
+	case err == pricing.ErrTierNotFound:
+		return http.StatusNotFound
+	case err == errInvalidTierID:
+		return http.StatusBadRequest
+	}
+	return code
+}
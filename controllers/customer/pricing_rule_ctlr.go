@@ -0,0 +1,153 @@
+package customer_ctlr
+
+import (
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/products"
+	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// GetPricingRules returns the pricing rules of the key's customer.
+func GetPricingRules(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	rules, err := pricing.CustomerRules(dtx.CustomerID)
+	if err != nil {
+		apierror.GenerateError("Trouble getting pricing rules", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(rules))
+}
+
+// GetPricingRule returns one of the key's customer's pricing rules.
+func GetPricingRule(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if !bson.IsObjectIdHex(params["id"]) {
+		apierror.GenerateError("Trouble getting pricing rule ID", errors.New("invalid rule ID"), rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	rule := pricing.Rule{ID: bson.ObjectIdHex(params["id"]), CustomerID: dtx.CustomerID}
+	if err := rule.Get(); err != nil {
+		apierror.GenerateError("Trouble getting pricing rule", err, rw, r, ruleStatus(err, http.StatusInternalServerError))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(rule))
+}
+
+// SavePricingRule creates a pricing rule for the key's customer, or
+// replaces the one with the ID in the route.
+func SavePricingRule(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var rule pricing.Rule
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		apierror.GenerateError("Trouble reading request body for pricing rule", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	rule.ID = ""
+	if id := params["id"]; id != "" {
+		if !bson.IsObjectIdHex(id) {
+			apierror.GenerateError("Trouble getting pricing rule ID", errors.New("invalid rule ID"), rw, r, http.StatusBadRequest)
+			return ""
+		}
+		rule.ID = bson.ObjectIdHex(id)
+	}
+	rule.CustomerID = dtx.CustomerID
+
+	if err := rule.Save(); err != nil {
+		apierror.GenerateError("Trouble saving pricing rule", err, rw, r, ruleStatus(err, http.StatusBadRequest))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(rule))
+}
+
+// DeletePricingRule removes one of the key's customer's pricing rules.
+func DeletePricingRule(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	if !bson.IsObjectIdHex(params["id"]) {
+		apierror.GenerateError("Trouble getting pricing rule ID", errors.New("invalid rule ID"), rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	rule := pricing.Rule{ID: bson.ObjectIdHex(params["id"]), CustomerID: dtx.CustomerID}
+	if err := rule.Delete(); err != nil {
+		apierror.GenerateError("Trouble deleting pricing rule", err, rw, r, ruleStatus(err, http.StatusInternalServerError))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(rule))
+}
+
+// CalculatePrices resolves the key's customer's prices for the parts
+// listed in the body, or for every part of a category and its
+// subcategories. With "explain" each price carries how it was found.
+func CalculatePrices(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	var req struct {
+		PartIDs    []int `json:"part_ids"`
+		CategoryID int   `json:"category_id"`
+		Explain    bool  `json:"explain"`
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.GenerateError("Trouble reading request body for price calculation", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	if len(req.PartIDs) == 0 && req.CategoryID == 0 {
+		apierror.GenerateError("Trouble calculating prices", errors.New("part_ids or category_id is required"), rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	parts, err := products.PricedParts(req.PartIDs, req.CategoryID, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting parts", err, rw, r)
+		return ""
+	}
+
+	res, err := products.ResolvePrices(parts, dtx, req.Explain)
+	if err != nil {
+		apierror.GenerateError("Trouble calculating prices", err, rw, r)
+		return ""
+	}
+	if res, err = products.ConvertPrices(res, dtx); err != nil {
+		apierror.GenerateError("Trouble converting prices", err, rw, r, currencyStatus(err))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(res))
+}
+
+// ruleStatus answers missing rules with a 404, and other errors with
+// code.
+func ruleStatus(err error, code int) int {
+	if err == pricing.ErrNotFound {
+		return http.StatusNotFound
+	}
+	return code
+}
+
+// currencyStatus answers currencies without an exchange rate with a
+// 400, and other errors with a 500.
+func currencyStatus(err error) int {
+	if err == pricing.ErrUnknownCurrency {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,89 @@
+package customer_ctlr
+
+import (
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/customer"
+	"github.com/go-martini/martini"
+
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// GetVisibility returns the catalog visibility rules of a customer. The
+// rules decide what a customer may see, so only internal staff manage
+// them.
+func GetVisibility(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var rules customer.VisibilityRules
+	var err error
+	if rules.CustomerID, err = strconv.Atoi(params["id"]); err != nil {
+		apierror.GenerateError("Trouble getting customer ID", err, rw, r)
+		return ""
+	}
+
+	if err = rules.Get(); err != nil {
+		apierror.GenerateError("Trouble getting visibility rules", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(rules))
+}
+
+// SaveVisibility replaces the catalog visibility rules of a customer.
+func SaveVisibility(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting customer ID", err, rw, r)
+		return ""
+	}
+
+	var rules customer.VisibilityRules
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		apierror.GenerateError("Trouble reading request body for visibility rules", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	rules.CustomerID = id
+
+	if err = rules.Save(); err != nil {
+		apierror.GenerateError("Trouble saving visibility rules", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(rules))
+}
+
+// DeleteVisibility removes the catalog visibility rules of a customer.
+func DeleteVisibility(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var rules customer.VisibilityRules
+	var err error
+	if rules.CustomerID, err = strconv.Atoi(params["id"]); err != nil {
+		apierror.GenerateError("Trouble getting customer ID", err, rw, r)
+		return ""
+	}
+
+	if err = rules.Delete(); err != nil {
+		apierror.GenerateError("Trouble deleting visibility rules", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(rules))
+}
@@ -0,0 +1,60 @@
+package interchange_ctlr
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/interchange"
+	"github.com/go-martini/martini"
+)
+
+// Competitors lists the competitor brands we have interchanges for.
+func Competitors(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	comps, err := interchange.Competitors(dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting competitors", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(comps))
+}
+
+// Lookup returns our parts that interchange with a competitor's part.
+func Lookup(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	ics, err := interchange.Lookup(params["brand"], params["part"], dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting interchange", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(ics))
+}
+
+// Import loads interchanges from the CSV in the "file" form field.
+func Import(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, rw, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		apierror.GenerateError("Error getting file from form", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+	defer file.Close()
+
+	replace, _ := strconv.ParseBool(r.FormValue("replace"))
+
+	res, err := interchange.Import(file, replace)
+	if err != nil {
+		apierror.GenerateError("Trouble importing interchange", err, rw, r, http.StatusBadRequest)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(res))
+}
@@ -18,7 +18,7 @@ import (
 )
 
 var (
-	ExcusedRoutes = []string{"/status", "/customer/auth", "/customer/user", "/new/customer/auth", "/customer/user/register", "/customer/user/resetPassword", "/cartIntegration/priceTypes", "/cartIntegration", "/cache"}
+	ExcusedRoutes = []string{"/status", "/customer/auth", "/customer/user", "/new/customer/auth", "/customer/user/register", "/customer/user/resetPassword", "/cache"}
 )
 
 func Meddler() martini.Handler {
@@ -70,6 +70,12 @@ func Meddler() martini.Handler {
 				apierror.GenerateError("Trouble processing the data context", err, res, r, http.StatusUnauthorized)
 				return
 			}
+			// the key is fine, but without its rules the customer could
+			// see parts hidden from it
+			if dataContext.Visibility, err = customer.GetVisibility(dataContext.CustomerID); err != nil {
+				apierror.GenerateError("Trouble getting catalog visibility rules", err, res, r, http.StatusServiceUnavailable)
+				return
+			}
 			c.Map(dataContext)
 		}
 
@@ -203,6 +209,7 @@ func processDataContext(r *http.Request, c martini.Context) (*apicontext.DataCon
 		UserID:     user.Id, //current authenticated user
 		CustomerID: user.CustomerID,
 		Globals:    nil,
+		Currency:   strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency"))),
 	}
 	err = dtx.GetBrandsArrayAndString(apiKey, brandID)
 	if err != nil {
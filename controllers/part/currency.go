@@ -0,0 +1,72 @@
+package part_ctlr
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/go-martini/martini"
+)
+
+// Currencies returns the exchange rates prices are converted at, in how
+// much of each currency one US dollar buys.
+func Currencies(w http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+	return encoding.Must(enc.Encode(pricing.Rates()))
+}
+
+// CurrencyPrices returns the price list of a currency, of every part or
+// of the one given by ?part=.
+func CurrencyPrices(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder) string {
+	currency := strings.ToUpper(params["currency"])
+	if _, ok := pricing.Rates()[currency]; !ok {
+		apierror.GenerateError("Trouble getting currency prices", pricing.ErrUnknownCurrency, w, r, http.StatusNotFound)
+		return ""
+	}
+
+	var ids []int
+	if qs := r.URL.Query().Get("part"); qs != "" {
+		id, err := strconv.Atoi(qs)
+		if err != nil {
+			apierror.GenerateError("Trouble getting part ID", err, w, r, http.StatusBadRequest)
+			return ""
+		}
+		ids = append(ids, id)
+	}
+
+	prices, err := pricing.CurrencyPrices(currency, ids...)
+	if err != nil {
+		apierror.GenerateError("Trouble getting currency prices", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(prices))
+}
+
+// SaveCurrencyPrices sets prices in the price lists of currencies; a
+// price of 0 takes it off the list.
+func SaveCurrencyPrices(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var prices []pricing.CurrencyPrice
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&prices); err != nil {
+		apierror.GenerateError("Trouble reading request body for currency prices", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	if err := pricing.SaveCurrencyPrices(prices); err != nil {
+		apierror.GenerateError("Trouble saving currency prices", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(prices))
+}
@@ -13,8 +13,13 @@ import (
 	"github.com/curt-labs/API/helpers/encoding"
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/helpers/rest"
+	"github.com/curt-labs/API/models/compare"
 	"github.com/curt-labs/API/models/customer"
+	"github.com/curt-labs/API/models/history"
+	"github.com/curt-labs/API/models/interchange"
+	"github.com/curt-labs/API/models/pricing"
 	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/recommendation"
 	"github.com/curt-labs/API/models/vehicle"
 	"github.com/go-martini/martini"
 	"github.com/stinkyfingers/analytics-go"
@@ -108,6 +113,9 @@ func All(w http.ResponseWriter, r *http.Request, params martini.Params, enc enco
 		apierror.GenerateError("Trouble getting all parts", err, w, r)
 		return ""
 	}
+	if !convertParts(parts, dtx, w, r) {
+		return ""
+	}
 
 	//Format the response in JSON format if so desired, includes the
 	//total number of elements that results from the query
@@ -159,6 +167,9 @@ func Featured(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx
 		apierror.GenerateError("Trouble getting featured parts", err, w, r)
 		return ""
 	}
+	if !convertParts(parts, dtx, w, r) {
+		return ""
+	}
 
 	return encoding.Must(enc.Encode(parts))
 }
@@ -192,6 +203,9 @@ func Latest(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *a
 		apierror.GenerateError("Trouble getting latest parts", err, w, r)
 		return ""
 	}
+	if !convertParts(parts, dtx, w, r) {
+		return ""
+	}
 
 	return encoding.Must(enc.Encode(parts))
 }
@@ -211,8 +225,12 @@ func Get(w http.ResponseWriter, r *http.Request, params martini.Params, enc enco
 		apierror.GenerateError("Trouble getting part", err, w, r)
 		return ""
 	}
+	parts := []products.Part{p}
+	if !convertParts(parts, dtx, w, r) {
+		return ""
+	}
 
-	return encoding.Must(enc.Encode(p))
+	return encoding.Must(enc.Encode(parts[0]))
 }
 
 func GetMulti(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
@@ -229,10 +247,34 @@ func GetMulti(w http.ResponseWriter, r *http.Request, params martini.Params, enc
 		apierror.GenerateError("Trouble getting part", err, w, r)
 		return ""
 	}
+	if !convertParts(parts, dtx, w, r) {
+		return ""
+	}
 
 	return encoding.Must(enc.Encode(parts))
 }
 
+// Compare aligns the attributes of the comma separated part numbers in
+// the ids query parameter.
+func Compare(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	qs := r.URL.Query()
+
+	var ids []string
+	for _, id := range strings.Split(qs.Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	cmp, err := compare.Parts(ids, qs.Get("units"), dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble comparing parts", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(cmp))
+}
+
 func GetRelated(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
 	id, _ := strconv.Atoi(params["part"])
 	p := products.Part{
@@ -247,6 +289,93 @@ func GetRelated(w http.ResponseWriter, r *http.Request, params martini.Params, e
 	return encoding.Must(enc.Encode(parts))
 }
 
+func Recommendations(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	id, err := strconv.Atoi(params["part"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting part ID", err, w, r)
+		return ""
+	}
+
+	count := 10
+	if ct := r.URL.Query().Get("count"); ct != "" {
+		if count, err = strconv.Atoi(ct); err != nil || count > 50 {
+			apierror.GenerateError(fmt.Sprintf("count must be a number no greater than 50, you requested: %s", ct), err, w, r)
+			return ""
+		}
+	}
+
+	recs, err := recommendation.ForPart(id, count, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting part recommendations", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(recs))
+}
+
+// History returns the recorded changes for a part, newest first.
+func History(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	id, err := strconv.Atoi(params["part"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting part ID", err, w, r)
+		return ""
+	}
+
+	changes, err := history.ForPart(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting part history", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(changes))
+}
+
+// Interchange returns the competitor parts that interchange with a
+// part.
+func Interchange(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	id, err := strconv.Atoi(params["part"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting part ID", err, w, r)
+		return ""
+	}
+
+	ics, err := interchange.ForPart(id, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting part interchange", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(ics))
+}
+
+// Changes is a feed of catalog changes after the ISO8601 since date, for
+// clients that poll instead of downloading every part.
+func Changes(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	qs := r.URL.Query()
+
+	since, err := time.Parse(time.RFC3339, qs.Get("since"))
+	if err != nil {
+		apierror.GenerateError("'since' could not be converted to ISO8601 datetime format", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	count := 100
+	if ct := qs.Get("count"); ct != "" {
+		if count, err = strconv.Atoi(ct); err != nil || count < 1 || count > 500 {
+			apierror.GenerateError(fmt.Sprintf("count must be between 1 and 500, you requested: %s", ct), err, w, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
+	feed, err := history.Since(since, qs.Get("after"), count, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting part changes", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(feed))
+}
+
 func GetWithVehicle(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder) string {
 	var err error
 	err = errors.New("Not Implemented")
@@ -341,7 +470,7 @@ func Attributes(w http.ResponseWriter, r *http.Request, params martini.Params, e
 		return ""
 	}
 
-	return encoding.Must(enc.Encode(p.Attributes))
+	return encoding.Must(enc.Encode(products.Attributes(p.Attributes).In(r.URL.Query().Get("units"))))
 }
 
 //Redundant
@@ -496,6 +625,14 @@ func Prices(w http.ResponseWriter, r *http.Request, params martini.Params, enc e
 		ID: id,
 	}
 
+	var asOf time.Time
+	if qs := r.URL.Query().Get("asOf"); qs != "" {
+		if asOf, err = parseDate(qs); err != nil {
+			apierror.GenerateError("'asOf' could not be converted to a date", err, w, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
 	priceChan := make(chan int)
 	custChan := make(chan int)
 
@@ -521,6 +658,18 @@ func Prices(w http.ResponseWriter, r *http.Request, params martini.Params, enc e
 		return ""
 	}
 
+	if !asOf.IsZero() {
+		if err = p.PricingAsOf(asOf); err != nil {
+			apierror.GenerateError("Trouble getting part prices", err, w, r)
+			return ""
+		}
+	}
+	parts := []products.Part{p}
+	if !convertParts(parts, dtx, w, r) {
+		return ""
+	}
+	p = parts[0]
+
 	return encoding.Must(enc.Encode(p.Pricing))
 }
 
@@ -539,6 +688,25 @@ func PartNumber(rw http.ResponseWriter, r *http.Request, params martini.Params,
 		apierror.GenerateError("Trouble getting part by old part number", err, rw, r)
 		return ""
 	}
+	parts := []products.Part{p}
+	if !convertParts(parts, dtx, rw, r) {
+		return ""
+	}
+	p = parts[0]
 
 	return encoding.Must(enc.Encode(p))
 }
+
+// convertParts converts the prices of parts to the ?currency= of the
+// request, answering currencies without an exchange rate with a 400.
+func convertParts(parts []products.Part, dtx *apicontext.DataContext, w http.ResponseWriter, r *http.Request) bool {
+	if err := products.ConvertParts(parts, dtx); err != nil {
+		code := http.StatusInternalServerError
+		if err == pricing.ErrUnknownCurrency {
+			code = http.StatusBadRequest
+		}
+		apierror.GenerateError("Trouble converting prices", err, w, r, code)
+		return false
+	}
+	return true
+}
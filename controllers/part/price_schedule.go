@@ -0,0 +1,112 @@
+package part_ctlr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PriceHistory returns the replaced and pending list, MAP and jobber
+// prices of a part.
+func PriceHistory(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder) string {
+	id, err := strconv.Atoi(params["part"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting part ID", err, w, r)
+		return ""
+	}
+
+	t, err := pricing.PartTimeline(id)
+	if err != nil {
+		apierror.GenerateError("Trouble getting part price history", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(t))
+}
+
+// ScheduledPrices returns the pending price changes, of every part or of
+// the one given by ?part=.
+func ScheduledPrices(w http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+	var id int
+	if qs := r.URL.Query().Get("part"); qs != "" {
+		var err error
+		if id, err = strconv.Atoi(qs); err != nil {
+			apierror.GenerateError("Trouble getting part ID", err, w, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+
+	prices, err := pricing.Pending(id)
+	if err != nil {
+		apierror.GenerateError("Trouble getting scheduled prices", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(prices))
+}
+
+// SchedulePrices takes a list of price changes to apply at later dates.
+func SchedulePrices(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var prices []pricing.ScheduledPrice
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&prices); err != nil {
+		apierror.GenerateError("Trouble reading request body for scheduled prices", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	if err := pricing.SchedulePrices(prices); err != nil {
+		apierror.GenerateError("Trouble scheduling prices", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(prices))
+}
+
+// CancelScheduledPrice keeps a pending price change from being applied.
+func CancelScheduledPrice(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.Staff(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	if !bson.IsObjectIdHex(params["id"]) {
+		apierror.GenerateError("Trouble getting scheduled price ID", errors.New("invalid scheduled price ID"), w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	id := bson.ObjectIdHex(params["id"])
+	if err := pricing.CancelScheduled(id); err != nil {
+		code := http.StatusInternalServerError
+		if err == pricing.ErrNotFound {
+			code = http.StatusNotFound
+		}
+		apierror.GenerateError("Trouble canceling scheduled price", err, w, r, code)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(id))
+}
+
+// parseDate takes an ISO8601 datetime or a plain date, which is read as
+// the start of that day.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
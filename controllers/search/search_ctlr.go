@@ -8,18 +8,26 @@ import (
 	"github.com/curt-labs/API/helpers/encoding"
 	"github.com/curt-labs/API/helpers/error"
 	"github.com/curt-labs/API/models/search"
+	"github.com/curt-labs/API/models/search/facet"
 	"github.com/go-martini/martini"
 )
 
 func Search(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
-	terms := params["term"]
 	qs := r.URL.Query()
-	page, _ := strconv.Atoi(qs.Get("page"))
-	count, _ := strconv.Atoi(qs.Get("count"))
-	brand, _ := strconv.Atoi(qs.Get("brand"))
-	rawPartNumber := qs.Get("raw")
+	q := search.Query{
+		Term:          params["term"],
+		RawPartNumber: qs.Get("raw"),
+		Filters:       facet.ParseFilters(qs),
+	}
+	q.Facets, _ = strconv.ParseBool(qs.Get("facets"))
+	q.Page, _ = strconv.Atoi(qs.Get("page"))
+	q.Count, _ = strconv.Atoi(qs.Get("count"))
+	if len(qs["brand"]) == 1 {
+		// several brands are a facet selection
+		q.Brand, _ = strconv.Atoi(qs.Get("brand"))
+	}
 
-	res, err := search.Dsl(terms, page, count, brand, dtx, rawPartNumber)
+	res, err := search.Search(q, dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble searching", err, rw, r)
 		return ""
@@ -29,13 +37,21 @@ func Search(rw http.ResponseWriter, r *http.Request, params martini.Params, enc
 }
 
 func SearchExactAndClose(rw http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
-	terms := params["term"]
 	qs := r.URL.Query()
-	page, _ := strconv.Atoi(qs.Get("page"))
-	count, _ := strconv.Atoi(qs.Get("count"))
-	brand, _ := strconv.Atoi(qs.Get("brand"))
+	q := search.Query{
+		Term:    params["term"],
+		Exact:   true,
+		Filters: facet.ParseFilters(qs),
+	}
+	q.Facets, _ = strconv.ParseBool(qs.Get("facets"))
+	q.Page, _ = strconv.Atoi(qs.Get("page"))
+	q.Count, _ = strconv.Atoi(qs.Get("count"))
+	if len(qs["brand"]) == 1 {
+		// several brands are a facet selection
+		q.Brand, _ = strconv.Atoi(qs.Get("brand"))
+	}
 
-	res, err := search.ExactAndCloseDsl(terms, page, count, brand, dtx)
+	res, err := search.Search(q, dtx)
 	if err != nil {
 		apierror.GenerateError("Trouble searching", err, rw, r)
 		return ""
@@ -43,3 +59,16 @@ func SearchExactAndClose(rw http.ResponseWriter, r *http.Request, params martini
 
 	return encoding.Must(enc.Encode(res))
 }
+
+func Suggest(rw http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	qs := r.URL.Query()
+	count, _ := strconv.Atoi(qs.Get("count"))
+
+	res, err := search.Suggest(qs.Get("q"), count, dtx)
+	if err != nil {
+		apierror.GenerateError("Trouble getting search suggestions", err, rw, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(res))
+}
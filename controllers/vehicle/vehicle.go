@@ -88,7 +88,7 @@ func Query(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *ap
 		case parts := <-partChan:
 			if len(parts) > 0 {
 				l.Parts = parts
-				l.Filter, _ = apifilter.PartFilter(l.Parts, nil)
+				l.Filter, _ = apifilter.PartFilter(l.Parts, nil, qs.Get("units"))
 			}
 		case <-time.After(5 * time.Second):
 
@@ -0,0 +1,201 @@
+package webhook_ctlr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/authorize"
+	"github.com/curt-labs/API/helpers/encoding"
+	"github.com/curt-labs/API/helpers/error"
+	"github.com/curt-labs/API/models/webhook"
+	"github.com/go-martini/martini"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var errInvalidID = errors.New("invalid webhook ID")
+
+// Events lists the event types that can be subscribed to.
+func Events(w http.ResponseWriter, r *http.Request, enc encoding.Encoder) string {
+	return encoding.Must(enc.Encode(webhook.Events))
+}
+
+// GetSubscriptions returns the webhooks of the key's customer, without
+// their secrets.
+func GetSubscriptions(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	subs, err := webhook.Subscriptions(dtx.CustomerID)
+	if err != nil {
+		apierror.GenerateError("Trouble getting webhooks", err, w, r)
+		return ""
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	return encoding.Must(enc.Encode(subs))
+}
+
+// SaveSubscription registers a webhook for the key's customer, or
+// replaces the one with the ID in the route. The secret deliveries are
+// signed with is returned when it's generated or changed.
+func SaveSubscription(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	var sub webhook.Subscription
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		apierror.GenerateError("Trouble reading request body for webhook", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+
+	sub.ID = ""
+	if id := params["id"]; id != "" {
+		var err error
+		if sub.ID, err = objectID(id); err != nil {
+			apierror.GenerateError("Trouble getting webhook", err, w, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+	secret := sub.Secret
+	sub.CustomerID = dtx.CustomerID
+	sub.BrandIDs = dtx.BrandArray
+	if dtx.BrandID != 0 {
+		sub.BrandIDs = []int{dtx.BrandID}
+	}
+
+	if err := sub.Save(); err != nil {
+		apierror.GenerateError("Trouble saving webhook", err, w, r, status(err, http.StatusBadRequest))
+		return ""
+	}
+	if params["id"] != "" && secret == "" {
+		sub.Secret = ""
+	}
+
+	return encoding.Must(enc.Encode(sub))
+}
+
+// DeleteSubscription removes a webhook of the key's customer.
+func DeleteSubscription(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := objectID(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting webhook", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+	sub, err := webhook.GetSubscription(id, dtx.CustomerID)
+	if err != nil {
+		apierror.GenerateError("Trouble getting webhook", err, w, r, status(err, http.StatusInternalServerError))
+		return ""
+	}
+
+	if err = sub.Delete(); err != nil {
+		apierror.GenerateError("Trouble deleting webhook", err, w, r, status(err, http.StatusInternalServerError))
+		return ""
+	}
+	sub.Secret = ""
+
+	return encoding.Must(enc.Encode(sub))
+}
+
+// GetDeliveries returns the delivery log of the key's customer, newest
+// first, filtered by ?subscription= and ?status= and paged by ?page=
+// and ?count=.
+func GetDeliveries(w http.ResponseWriter, r *http.Request, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	qs := r.URL.Query()
+	var subID bson.ObjectId
+	if id := qs.Get("subscription"); id != "" {
+		var err error
+		if subID, err = objectID(id); err != nil {
+			apierror.GenerateError("Trouble getting webhook", err, w, r, http.StatusBadRequest)
+			return ""
+		}
+	}
+	page, _ := strconv.Atoi(qs.Get("page"))
+	count, _ := strconv.Atoi(qs.Get("count"))
+
+	deliveries, err := webhook.Deliveries(dtx.CustomerID, subID, qs.Get("status"), page, count)
+	if err != nil {
+		apierror.GenerateError("Trouble getting webhook deliveries", err, w, r)
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(deliveries))
+}
+
+// GetDelivery returns a delivery of the key's customer with its
+// attempts.
+func GetDelivery(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := objectID(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting webhook delivery", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+	d, err := webhook.GetDelivery(id, dtx.CustomerID)
+	if err != nil {
+		apierror.GenerateError("Trouble getting webhook delivery", err, w, r, status(err, http.StatusInternalServerError))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(d))
+}
+
+// ReplayDelivery sends the event of a delivery again as a new one.
+func ReplayDelivery(w http.ResponseWriter, r *http.Request, params martini.Params, enc encoding.Encoder, dtx *apicontext.DataContext) string {
+	if err := authorize.PrivateKey(dtx); err != nil {
+		apierror.GenerateError("Unauthorized", err, w, r, http.StatusUnauthorized)
+		return ""
+	}
+
+	id, err := objectID(params["id"])
+	if err != nil {
+		apierror.GenerateError("Trouble getting webhook delivery", err, w, r, http.StatusBadRequest)
+		return ""
+	}
+	d, err := webhook.Replay(id, dtx.CustomerID)
+	if err != nil {
+		apierror.GenerateError("Trouble replaying webhook delivery", err, w, r, status(err, http.StatusInternalServerError))
+		return ""
+	}
+
+	return encoding.Must(enc.Encode(d))
+}
+
+func objectID(id string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(id) {
+		return "", errInvalidID
+	}
+	return bson.ObjectIdHex(id), nil
+}
+
+// status answers missing webhooks and deliveries with a 404 and other
+// errors with code.
+func status(err error, code int) int {
+	if err == webhook.ErrNotFound || err == webhook.ErrDeliveryNotFound {
+		return http.StatusNotFound
+	}
+	return code
+}
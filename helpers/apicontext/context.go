@@ -17,6 +17,10 @@ type DataContext struct {
 	Globals     map[string]interface{}
 	BrandArray  []int
 	BrandString string
+	Visibility  *Visibility
+	// Currency is the currency prices are wanted in, from ?currency=;
+	// empty for USD.
+	Currency string
 }
 
 var (
@@ -0,0 +1,167 @@
+package apicontext
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Visibility narrows the catalog a customer sees within its brands.
+// Categories include or exclude everything beneath them. A part listed
+// in ExcludeParts is always hidden and one in IncludeParts is always
+// shown; any other part needs a visible class and, when categories are
+// included, a visible category.
+type Visibility struct {
+	IncludeCategories []int    `bson:"include_categories" json:"include_categories" xml:"include_categories>id"`
+	ExcludeCategories []int    `bson:"exclude_categories" json:"exclude_categories" xml:"exclude_categories>id"`
+	IncludeClasses    []string `bson:"include_classes" json:"include_classes" xml:"include_classes>class"`
+	ExcludeClasses    []string `bson:"exclude_classes" json:"exclude_classes" xml:"exclude_classes>class"`
+	IncludeParts      []int    `bson:"include_parts" json:"include_parts" xml:"include_parts>id"`
+	ExcludeParts      []int    `bson:"exclude_parts" json:"exclude_parts" xml:"exclude_parts>id"`
+}
+
+// Empty reports whether there are no rules, so everything is visible.
+func (v *Visibility) Empty() bool {
+	return v == nil || len(v.IncludeCategories) == 0 && len(v.ExcludeCategories) == 0 &&
+		len(v.IncludeClasses) == 0 && len(v.ExcludeClasses) == 0 &&
+		len(v.IncludeParts) == 0 && len(v.ExcludeParts) == 0
+}
+
+// CategoryVisible reports whether a category can be seen, given the ids
+// of its path from the top-level category down to itself. Categories
+// above an included one stay visible so it can be navigated to; pass
+// the ids of a category's descendants as below to allow for that.
+func (v *Visibility) CategoryVisible(path []int, below ...int) bool {
+	if v.Empty() {
+		return true
+	}
+	if anyOf(path, v.ExcludeCategories) {
+		return false
+	}
+	return len(v.IncludeCategories) == 0 || anyOf(path, v.IncludeCategories) || anyOf(below, v.IncludeCategories)
+}
+
+// PartVisible reports whether a part can be seen, given its class and
+// the paths of the categories it is in.
+func (v *Visibility) PartVisible(id int, class string, categories [][]int) bool {
+	if v.Empty() {
+		return true
+	}
+	if hasInt(v.ExcludeParts, id) {
+		return false
+	}
+	if hasInt(v.IncludeParts, id) {
+		return true
+	}
+
+	if hasString(v.ExcludeClasses, class) {
+		return false
+	}
+	if len(v.IncludeClasses) > 0 && !hasString(v.IncludeClasses, class) {
+		return false
+	}
+
+	if len(v.IncludeCategories) == 0 && len(v.ExcludeCategories) == 0 {
+		return true
+	}
+	if len(categories) == 0 {
+		return len(v.IncludeCategories) == 0
+	}
+	for _, path := range categories {
+		if !anyOf(path, v.ExcludeCategories) && (len(v.IncludeCategories) == 0 || anyOf(path, v.IncludeCategories)) {
+			return true
+		}
+	}
+	return false
+}
+
+// PartQuery is the Mongo condition for the parts PartVisible allows,
+// matched against the class and category breadcrumbs of part documents.
+// It is nil when there are no rules.
+func (v *Visibility) PartQuery() bson.M {
+	if v.Empty() {
+		return nil
+	}
+
+	var rules []bson.M
+	if len(v.IncludeClasses) > 0 {
+		rules = append(rules, bson.M{"class.name": bson.M{"$in": patterns(v.IncludeClasses)}})
+	}
+	if len(v.ExcludeClasses) > 0 {
+		rules = append(rules, bson.M{"class.name": bson.M{"$nin": patterns(v.ExcludeClasses)}})
+	}
+
+	if len(v.IncludeCategories) > 0 || len(v.ExcludeCategories) > 0 {
+		// categories synced without breadcrumbs only know their parent
+		var match []bson.M
+		if len(v.IncludeCategories) > 0 {
+			match = append(match, bson.M{"$or": []bson.M{
+				{"id": bson.M{"$in": v.IncludeCategories}},
+				{"parent_id": bson.M{"$in": v.IncludeCategories}},
+				{"breadcrumbs.id": bson.M{"$in": v.IncludeCategories}},
+			}})
+		}
+		if len(v.ExcludeCategories) > 0 {
+			match = append(match,
+				bson.M{"id": bson.M{"$nin": v.ExcludeCategories}},
+				bson.M{"parent_id": bson.M{"$nin": v.ExcludeCategories}},
+				bson.M{"breadcrumbs.id": bson.M{"$nin": v.ExcludeCategories}},
+			)
+		}
+		cats := bson.M{"categories": bson.M{"$elemMatch": bson.M{"$and": match}}}
+		if len(v.IncludeCategories) == 0 {
+			// parts without categories aren't excluded by any
+			cats = bson.M{"$or": []bson.M{cats, {"categories.0": bson.M{"$exists": false}}}}
+		}
+		rules = append(rules, cats)
+	}
+
+	qry := bson.M{}
+	if len(rules) > 0 {
+		qry["$and"] = rules
+	}
+	if len(v.IncludeParts) > 0 {
+		qry = bson.M{"$or": []bson.M{{"id": bson.M{"$in": v.IncludeParts}}, qry}}
+	}
+	if len(v.ExcludeParts) > 0 {
+		qry = bson.M{"$and": []bson.M{{"id": bson.M{"$nin": v.ExcludeParts}}, qry}}
+	}
+	return qry
+}
+
+// patterns matches class names ignoring case.
+func patterns(names []string) []interface{} {
+	out := make([]interface{}, 0, len(names))
+	for _, n := range names {
+		out = append(out, bson.RegEx{Pattern: "^" + regexp.QuoteMeta(n) + "$", Options: "i"})
+	}
+	return out
+}
+
+func anyOf(ids, set []int) bool {
+	for _, id := range ids {
+		if hasInt(set, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasInt(set []int, id int) bool {
+	for _, s := range set {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+func hasString(set []string, s string) bool {
+	for _, v := range set {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -18,7 +18,10 @@ var (
 																where canFilter = 0`
 )
 
-func PartFilter(parts []products.Part, specs []interface{}) ([]Options, error) {
+// PartFilter builds the filter options for a list of parts. Measurement
+// attributes are shown in the given unit system ("imperial" or "metric");
+// any other value keeps them as entered.
+func PartFilter(parts []products.Part, specs []interface{}, system string) ([]Options, error) {
 
 	var filtered FilteredOptions
 
@@ -27,7 +30,7 @@ func PartFilter(parts []products.Part, specs []interface{}) ([]Options, error) {
 	catChan := make(chan error)
 	classChan := make(chan error)
 	go func() {
-		filtered = append(filtered, filtered.partAttributes(parts)...)
+		filtered = append(filtered, filtered.partAttributes(parts, system)...)
 		attrChan <- nil
 	}()
 	go func() {
@@ -61,13 +64,13 @@ func PartFilter(parts []products.Part, specs []interface{}) ([]Options, error) {
 	return filtered, nil
 }
 
-func (filtered FilteredOptions) partAttributes(parts []products.Part) FilteredOptions {
+func (filtered FilteredOptions) partAttributes(parts []products.Part, system string) FilteredOptions {
 
 	excludedAttributes := getExcludedAttributeTypes()
 
 	attributeDefinitions := make(map[string]Options, 0)
 	for _, part := range parts {
-		for _, attr := range part.Attributes {
+		for _, attr := range products.Attributes(part.Attributes).In(system) {
 
 			// Check Excluded attributes
 			exclude := false
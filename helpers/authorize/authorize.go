@@ -0,0 +1,55 @@
+// Package authorize decides whether the API key of a request may perform
+// privileged operations.
+package authorize
+
+import (
+	"errors"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/customer"
+)
+
+var (
+	// ErrPrivateKey is returned when the request was not made with a
+	// private API key.
+	ErrPrivateKey = errors.New("A private API key is required for this operation.")
+	// ErrStaff is returned when the private API key does not belong to
+	// internal staff.
+	ErrStaff = errors.New("You do not have sufficient permissions to perform this operation.")
+)
+
+// PrivateKey requires the private API key of an active user. It says
+// nothing about which customer's data may be touched, so handlers using
+// it must limit themselves to dtx.CustomerID.
+func PrivateKey(dtx *apicontext.DataContext) error {
+	private, _, err := customer.PrivateKeyAccess(dtx.APIKey)
+	if err != nil {
+		return err
+	}
+	if !private {
+		return ErrPrivateKey
+	}
+	return nil
+}
+
+// Staff requires the private API key of an internal user, for operations
+// on the catalog or across customers. A customer's super user is only an
+// administrator of that customer, so it does not qualify.
+func Staff(dtx *apicontext.DataContext) error {
+	private, staff, err := customer.PrivateKeyAccess(dtx.APIKey)
+	if err != nil {
+		return err
+	}
+	if !private {
+		return ErrPrivateKey
+	}
+	if !staff {
+		return ErrStaff
+	}
+	return nil
+}
+
+// IsStaff reports whether Staff allows the request.
+func IsStaff(dtx *apicontext.DataContext) bool {
+	return Staff(dtx) == nil
+}
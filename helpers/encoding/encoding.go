@@ -2,8 +2,10 @@ package encoding
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/go-martini/martini"
 	"net/http"
@@ -68,9 +70,38 @@ func (_ TextEncoder) Encode(v ...interface{}) (string, error) {
 	return buf.String(), nil
 }
 
+// CsvMarshaler is implemented by responses that can be rendered as rows
+// of a CSV file.
+type CsvMarshaler interface {
+	MarshalCSV() ([][]string, error)
+}
+
+type CsvEncoder struct{}
+
+// CsvEncoder is an Encoder that produces CSV-formatted responses for
+// values implementing CsvMarshaler.
+func (_ CsvEncoder) Encode(v ...interface{}) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, v := range v {
+		m, ok := v.(CsvMarshaler)
+		if !ok {
+			return "", errors.New("this resource can't be rendered as csv")
+		}
+		records, err := m.MarshalCSV()
+		if err != nil {
+			return "", err
+		}
+		if err := w.WriteAll(records); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
 //
 
-var rxAccept = regexp.MustCompile(`(?:xml|html|plain|json)\/?$`)
+var rxAccept = regexp.MustCompile(`(?:xml|html|plain|json|csv)\/?$`)
 
 func MapEncoder(c martini.Context, w http.ResponseWriter, r *http.Request) {
 	accept := r.Header.Get("Accept")
@@ -88,6 +119,9 @@ func MapEncoder(c martini.Context, w http.ResponseWriter, r *http.Request) {
 
 		c.MapTo(XmlEncoder{}, (*Encoder)(nil))
 		w.Header().Set("Content-Type", "application/xml")
+	case "csv":
+		c.MapTo(CsvEncoder{}, (*Encoder)(nil))
+		w.Header().Set("Content-Type", "text/csv")
 	case "plain":
 		c.MapTo(TextEncoder{}, (*Encoder)(nil))
 		w.Header().Set("Content-Type", "text/plain")
@@ -0,0 +1,293 @@
+// Package pdf writes simple PDF documents of text, lines and filled
+// rectangles in the standard Helvetica fonts, which every reader has, so
+// no fonts are embedded.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Font is one of the standard fonts.
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+// Size is the size of a page in points, 72 to the inch.
+type Size struct {
+	Width  float64
+	Height float64
+}
+
+var (
+	Letter = Size{612, 792}
+	A4     = Size{595.28, 841.89}
+)
+
+// Color is an RGB color.
+type Color struct {
+	R, G, B uint8
+}
+
+var (
+	Black = Color{0, 0, 0}
+	White = Color{255, 255, 255}
+)
+
+// ParseColor reads a hex color like "#c41230" or "c41230".
+func ParseColor(s string) (Color, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return Color{}, false
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return Color{}, false
+	}
+	return Color{uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+}
+
+// Document is a PDF document of pages of one size.
+type Document struct {
+	Title string
+	size  Size
+	pages []*Page
+}
+
+// New starts a document with pages of a size.
+func New(size Size) *Document {
+	return &Document{size: size}
+}
+
+// Size is the size of the document's pages.
+func (d *Document) Size() Size {
+	return d.size
+}
+
+// Pages is the number of pages added so far.
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// Page returns a page added before, to draw more on.
+func (d *Document) Page(i int) *Page {
+	return d.pages[i]
+}
+
+// AddPage adds a blank page to draw on.
+func (d *Document) AddPage() *Page {
+	p := &Page{height: d.size.Height, font: Helvetica, fontSize: 12}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Page is drawn on with coordinates in points from its top left corner;
+// text is placed by its baseline.
+type Page struct {
+	content  bytes.Buffer
+	height   float64
+	font     Font
+	fontSize float64
+}
+
+// SetFont sets the font of the text drawn next.
+func (p *Page) SetFont(f Font, size float64) {
+	p.font, p.fontSize = f, size
+}
+
+// SetFill sets the color of the text and rectangles drawn next.
+func (p *Page) SetFill(c Color) {
+	fmt.Fprintf(&p.content, "%s %s %s rg\n", component(c.R), component(c.G), component(c.B))
+}
+
+// SetStroke sets the color of the lines drawn next.
+func (p *Page) SetStroke(c Color) {
+	fmt.Fprintf(&p.content, "%s %s %s RG\n", component(c.R), component(c.G), component(c.B))
+}
+
+// Text draws text with its baseline starting at x, y.
+func (p *Page) Text(x, y float64, s string) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td (", p.font+1, num(p.fontSize), num(x), num(p.height-y))
+	escape(&p.content, encode(s))
+	p.content.WriteString(") Tj ET\n")
+}
+
+// TextRight draws text with its baseline ending at x, y.
+func (p *Page) TextRight(x, y float64, s string) {
+	p.Text(x-Width(p.font, p.fontSize, s), y, s)
+}
+
+// Rect fills a rectangle whose top left corner is at x, y.
+func (p *Page) Rect(x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "%s %s %s %s re f\n", num(x), num(p.height-y-h), num(w), num(h))
+}
+
+// Line draws a line of a width in points.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n", num(width), num(x1), num(p.height-y1), num(x2), num(p.height-y2))
+}
+
+// Width is how wide text is in a font, in points.
+func Width(f Font, size float64, s string) float64 {
+	w := 0
+	for _, c := range encode(s) {
+		w += charWidth(f, c)
+	}
+	return float64(w) * size / 1000
+}
+
+// Truncate shortens text to fit a width, ending it with "...".
+func Truncate(f Font, size float64, s string, width float64) string {
+	if Width(f, size, s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && Width(f, size, string(r)+"...") > width {
+		r = r[:len(r)-1]
+	}
+	return strings.TrimSpace(string(r)) + "..."
+}
+
+// WriteTo writes the document.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	pw := &writer{w: cw}
+
+	pw.header()
+	pages := make([]string, len(d.pages))
+	for i := range d.pages {
+		pages[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	pw.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	pw.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %s %s] >>", strings.Join(pages, " "), len(pages), num(d.size.Width), num(d.size.Height)))
+	pw.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	pw.object(4, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	var info bytes.Buffer
+	info.WriteString("<< /Title (")
+	escape(&info, encode(d.Title))
+	info.WriteString(") /CreationDate (D:" + time.Now().Format("20060102150405") + ") >>")
+	pw.object(5, info.String())
+
+	for i, p := range d.pages {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(p.content.Bytes())
+		zw.Close()
+
+		n := firstPage + 2*i
+		pw.object(n, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", n+1))
+		pw.stream(n+1, z.Bytes())
+	}
+	pw.trailer(firstPage+2*len(d.pages), 5)
+
+	if pw.err == nil {
+		pw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, pw.err
+}
+
+// firstPage is the object number of the first page; the catalog, page
+// tree, fonts and info come before it.
+const firstPage = 6
+
+// writer writes numbered objects, keeping their offsets for the cross
+// reference table.
+type writer struct {
+	w       *countingWriter
+	offsets []int64
+	err     error
+}
+
+func (pw *writer) printf(format string, args ...interface{}) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+func (pw *writer) header() {
+	// the binary comment marks the file as binary to transfer programs
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+}
+
+func (pw *writer) begin(n int) {
+	for len(pw.offsets) < n {
+		pw.offsets = append(pw.offsets, 0)
+	}
+	pw.offsets[n-1] = pw.w.n
+	pw.printf("%d 0 obj\n", n)
+}
+
+func (pw *writer) object(n int, dict string) {
+	pw.begin(n)
+	pw.printf("%s\nendobj\n", dict)
+}
+
+func (pw *writer) stream(n int, data []byte) {
+	pw.begin(n)
+	pw.printf("<< /Length %d /Filter /FlateDecode >>\nstream\n", len(data))
+	if pw.err == nil {
+		_, pw.err = pw.w.Write(data)
+	}
+	pw.printf("\nendstream\nendobj\n")
+}
+
+func (pw *writer) trailer(size, info int) {
+	start := pw.w.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", size)
+	for _, off := range pw.offsets {
+		pw.printf("%010d 00000 n \n", off)
+	}
+	pw.printf("trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, info, start)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// escape writes text as the inside of a PDF string.
+func escape(b *bytes.Buffer, s []byte) {
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+}
+
+// num writes a coordinate or size to the hundredth of a point.
+func num(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" || s == "" {
+		return "0"
+	}
+	return s
+}
+
+func component(c uint8) string {
+	return strconv.FormatFloat(float64(c)/255, 'f', 3, 64)
+}
@@ -0,0 +1,144 @@
+package units
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	Weight = "weight"
+	Length = "length"
+
+	Imperial = "imperial"
+	Metric   = "metric"
+)
+
+// Unit describes a unit of measure and how to convert it to the
+// canonical unit of its dimension (pounds for weight, inches for length).
+type Unit struct {
+	Symbol    string
+	Dimension string
+	System    string
+	ToBase    float64
+}
+
+// Quantity is a numeric value with a unit parsed from a free-form
+// attribute string.
+type Quantity struct {
+	Value float64
+	Unit  Unit
+}
+
+var (
+	Pound      = Unit{Symbol: "lbs", Dimension: Weight, System: Imperial, ToBase: 1}
+	Kilogram   = Unit{Symbol: "kg", Dimension: Weight, System: Metric, ToBase: 2.20462262}
+	Inch       = Unit{Symbol: "in", Dimension: Length, System: Imperial, ToBase: 1}
+	Foot       = Unit{Symbol: "ft", Dimension: Length, System: Imperial, ToBase: 12}
+	Millimeter = Unit{Symbol: "mm", Dimension: Length, System: Metric, ToBase: 1 / 25.4}
+	Centimeter = Unit{Symbol: "cm", Dimension: Length, System: Metric, ToBase: 1 / 2.54}
+
+	// aliases maps the spellings found in attribute values to units.
+	aliases = map[string]Unit{
+		"lb": Pound, "lbs": Pound, "pound": Pound, "pounds": Pound, "#": Pound,
+		"kg": Kilogram, "kgs": Kilogram, "kilogram": Kilogram, "kilograms": Kilogram,
+		"in": Inch, "inch": Inch, "inches": Inch, "\"": Inch, "''": Inch,
+		"ft": Foot, "foot": Foot, "feet": Foot, "'": Foot,
+		"mm": Millimeter, "millimeter": Millimeter, "millimeters": Millimeter,
+		"cm": Centimeter, "centimeter": Centimeter, "centimeters": Centimeter,
+	}
+
+	// display is the unit each dimension is shown in for a unit system.
+	display = map[string]map[string]Unit{
+		Imperial: {Weight: Pound, Length: Inch},
+		Metric:   {Weight: Kilogram, Length: Millimeter},
+	}
+
+	rxQuantity = regexp.MustCompile(`^\s*(-?[0-9][0-9,]*(?:\.[0-9]+)?|-?\.[0-9]+)(?:\s+([0-9]+)/([0-9]+))?\s*([a-zA-Z"'#]*)\.?\s*$`)
+)
+
+// Parse reads strings like "5,000 lbs.", "2 1/2 in" or "63.5mm". It
+// returns false when the value isn't a single number with a known unit.
+func Parse(s string) (Quantity, bool) {
+	m := rxQuantity.FindStringSubmatch(s)
+	if m == nil {
+		return Quantity{}, false
+	}
+
+	val, err := strconv.ParseFloat(strings.Replace(m[1], ",", "", -1), 64)
+	if err != nil {
+		return Quantity{}, false
+	}
+	if m[2] != "" {
+		num, _ := strconv.ParseFloat(m[2], 64)
+		den, _ := strconv.ParseFloat(m[3], 64)
+		if den == 0 {
+			return Quantity{}, false
+		}
+		if val < 0 {
+			val -= num / den
+		} else {
+			val += num / den
+		}
+	}
+
+	u, ok := Lookup(m[4])
+	if !ok {
+		return Quantity{}, false
+	}
+
+	return Quantity{Value: val, Unit: u}, true
+}
+
+// Base returns the quantity converted to the canonical unit of its
+// dimension.
+func (q Quantity) Base() Quantity {
+	return Quantity{Value: q.Value * q.Unit.ToBase, Unit: canonical(q.Unit.Dimension)}
+}
+
+// To converts the quantity to the given unit. Units of different
+// dimensions can't be converted, so the quantity is returned unchanged.
+func (q Quantity) To(u Unit) Quantity {
+	if u.Dimension != q.Unit.Dimension || u.ToBase == 0 {
+		return q
+	}
+	return Quantity{Value: q.Value * q.Unit.ToBase / u.ToBase, Unit: u}
+}
+
+// In converts the quantity to the display unit of the given system
+// (imperial or metric).
+func (q Quantity) In(system string) Quantity {
+	if units, ok := display[system]; ok {
+		if u, ok := units[q.Unit.Dimension]; ok {
+			return q.To(u)
+		}
+	}
+	return q
+}
+
+func (q Quantity) String() string {
+	return fmt.Sprintf("%s %s", strconv.FormatFloat(round(q.Value), 'f', -1, 64), q.Unit.Symbol)
+}
+
+// Lookup returns the unit for a symbol or spelling such as "lbs" or
+// "millimeters".
+func Lookup(symbol string) (Unit, bool) {
+	u, ok := aliases[strings.ToLower(strings.TrimSpace(symbol))]
+	return u, ok
+}
+
+// ValidSystem reports whether s names a supported unit system.
+func ValidSystem(s string) bool {
+	_, ok := display[s]
+	return ok
+}
+
+func canonical(dimension string) Unit {
+	return display[Imperial][dimension]
+}
+
+func round(v float64) float64 {
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'f', 2, 64), 64)
+	return r
+}
@@ -0,0 +1,330 @@
+// Package xlsx reads the rows of the first worksheet of an Office Open
+// XML spreadsheet, and writes single worksheet spreadsheets, the way
+// encoding/csv reads and writes records.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrNoSheet = errors.New("xlsx: the workbook has no worksheets")
+
+// Reader returns the cell values of one row of a worksheet at a time.
+// Empty cells are returned as empty strings, so a row's values line up
+// with its columns; rows are not padded to a common length.
+type Reader struct {
+	zr      *zip.Reader
+	sheet   io.ReadCloser
+	dec     *xml.Decoder
+	strings []string
+	row     int
+	pending []string
+	ahead   int
+}
+
+// NewReader opens a workbook of size bytes and positions the reader at
+// the first row of its first worksheet.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	x := &Reader{zr: zr}
+
+	if x.strings, err = x.sharedStrings(); err != nil {
+		return nil, err
+	}
+
+	name, err := x.firstSheet()
+	if err != nil {
+		return nil, err
+	}
+	f := x.file(name)
+	if f == nil {
+		return nil, ErrNoSheet
+	}
+	if x.sheet, err = f.Open(); err != nil {
+		return nil, err
+	}
+	x.dec = xml.NewDecoder(x.sheet)
+	return x, nil
+}
+
+// Read returns the next row. Rows missing from the sheet, which Excel
+// leaves out when they're blank, are returned as empty rows. At the end
+// of the sheet it returns io.EOF.
+func (x *Reader) Read() ([]string, error) {
+	if x.ahead > 0 {
+		x.ahead--
+		x.row++
+		if x.ahead == 0 {
+			row := x.pending
+			x.pending = nil
+			return row, nil
+		}
+		return []string{}, nil
+	}
+
+	for {
+		tok, err := x.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		num := x.row + 1
+		if r := attr(start, "r"); r != "" {
+			if n, err := strconv.Atoi(r); err == nil && n > num {
+				num = n
+			}
+		}
+		row, err := x.readRow()
+		if err != nil {
+			return nil, err
+		}
+
+		if gap := num - x.row - 1; gap > 0 {
+			x.pending = row
+			x.ahead = gap
+			x.row++
+			return []string{}, nil
+		}
+		x.row = num
+		return row, nil
+	}
+}
+
+// Close releases the worksheet.
+func (x *Reader) Close() error {
+	if x.sheet == nil {
+		return nil
+	}
+	return x.sheet.Close()
+}
+
+// readRow reads the cells of a <row> up to its end.
+func (x *Reader) readRow() ([]string, error) {
+	var row []string
+	for {
+		tok, err := x.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return row, nil
+			}
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			col := len(row)
+			if ref := attr(t, "r"); ref != "" {
+				if c, ok := Column(ref); ok {
+					col = c
+				}
+			}
+			val, err := x.readCell(t)
+			if err != nil {
+				return nil, err
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			row[col] = val
+		}
+	}
+}
+
+// readCell reads the value of a <c> up to its end.
+func (x *Reader) readCell(c xml.StartElement) (string, error) {
+	var val, inline bytes.Buffer
+	var inValue, inText bool
+	for {
+		tok, err := x.dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inValue = t.Name.Local == "v"
+			inText = t.Name.Local == "t"
+		case xml.CharData:
+			if inValue {
+				val.Write(t)
+			} else if inText {
+				inline.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v":
+				inValue = false
+			case "t":
+				inText = false
+			case "c":
+				switch attr(c, "t") {
+				case "s":
+					i, err := strconv.Atoi(strings.TrimSpace(val.String()))
+					if err != nil || i < 0 || i >= len(x.strings) {
+						return "", errors.New("xlsx: bad shared string index " + val.String())
+					}
+					return x.strings[i], nil
+				case "inlineStr":
+					return inline.String(), nil
+				case "b":
+					if val.String() == "1" {
+						return "TRUE", nil
+					}
+					return "FALSE", nil
+				}
+				return val.String(), nil
+			}
+		}
+	}
+}
+
+// sharedStrings loads the strings table cells of type "s" point into.
+func (x *Reader) sharedStrings() ([]string, error) {
+	f := x.file("xl/sharedStrings.xml")
+	if f == nil {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var table []string
+	var cur bytes.Buffer
+	var inText, inPhonetic bool
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				cur.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				cur.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				table = append(table, cur.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		}
+	}
+}
+
+// firstSheet finds the path of the workbook's first worksheet.
+func (x *Reader) firstSheet() (string, error) {
+	var wb struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := x.decode("xl/workbook.xml", &wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", ErrNoSheet
+	}
+
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := x.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, r := range rels.Rels {
+		if r.ID != wb.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(r.Target, "/") {
+			return strings.TrimPrefix(r.Target, "/"), nil
+		}
+		return path.Join("xl", r.Target), nil
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func (x *Reader) decode(name string, v interface{}) error {
+	f := x.file(name)
+	if f == nil {
+		return errors.New("xlsx: missing " + name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+func (x *Reader) file(name string) *zip.File {
+	for _, f := range x.zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Column gives the zero based column of a cell reference like "AB12",
+// or of a bare column like "AB".
+func Column(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return col - 1, true
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Style is how a cell is formatted.
+type Style int
+
+const (
+	Plain Style = iota
+	Bold
+	// Heading is bold and larger, for titles.
+	Heading
+	// Money has two decimals and its thousands grouped.
+	Money
+)
+
+var ErrClosed = errors.New("xlsx: write after Close")
+
+// Cell is a value of a row: text, or a number when Numeric is set.
+type Cell struct {
+	Text    string
+	Number  float64
+	Numeric bool
+	Style   Style
+}
+
+// String is a text cell.
+func String(s string, style Style) Cell {
+	return Cell{Text: s, Style: style}
+}
+
+// Number is a numeric cell.
+func Number(f float64, style Style) Cell {
+	return Cell{Number: f, Numeric: true, Style: style}
+}
+
+// Writer writes the rows of one worksheet and, on Close, the workbook
+// holding it. Rows are kept in memory until then.
+type Writer struct {
+	w      io.Writer
+	sheet  string
+	widths []float64
+	rows   bytes.Buffer
+	row    int
+	closed bool
+}
+
+// NewWriter returns a writer of a workbook with one worksheet named
+// sheet to w.
+func NewWriter(w io.Writer, sheet string) *Writer {
+	return &Writer{w: w, sheet: sheetName(sheet)}
+}
+
+// SetWidths sets the widths of the first columns, in characters.
+func (x *Writer) SetWidths(widths ...float64) {
+	x.widths = widths
+}
+
+// Write writes a row of plain text cells.
+func (x *Writer) Write(record []string) error {
+	cells := make([]Cell, len(record))
+	for i, s := range record {
+		cells[i] = String(s, Plain)
+	}
+	return x.WriteCells(cells)
+}
+
+// WriteCells writes a row. A nil or empty row leaves a blank line.
+func (x *Writer) WriteCells(cells []Cell) error {
+	if x.closed {
+		return ErrClosed
+	}
+	x.row++
+	r := strconv.Itoa(x.row)
+
+	b := &x.rows
+	b.WriteString(`<row r="` + r + `">`)
+	for i, c := range cells {
+		if !c.Numeric && c.Text == "" && c.Style == Plain {
+			continue
+		}
+		b.WriteString(`<c r="` + columnName(i) + r + `"`)
+		if c.Style != Plain {
+			b.WriteString(` s="` + strconv.Itoa(int(c.Style)) + `"`)
+		}
+		if c.Numeric {
+			b.WriteString(`><v>` + strconv.FormatFloat(c.Number, 'f', -1, 64) + `</v></c>`)
+			continue
+		}
+		b.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(b, []byte(c.Text))
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+	return nil
+}
+
+// Close writes the workbook. It doesn't close the underlying writer.
+func (x *Writer) Close() error {
+	if x.closed {
+		return ErrClosed
+	}
+	x.closed = true
+
+	zw := zip.NewWriter(x.w)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", x.workbook()},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/styles.xml", styles},
+		{"xl/worksheets/sheet1.xml", x.worksheet()},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (x *Writer) workbook() string {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="`)
+	xml.EscapeText(&b, []byte(x.sheet))
+	b.WriteString(`" sheetId="1" r:id="rId1"/></sheets></workbook>`)
+	return b.String()
+}
+
+func (x *Writer) worksheet() string {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(x.widths) > 0 {
+		b.WriteString(`<cols>`)
+		for i, w := range x.widths {
+			n := strconv.Itoa(i + 1)
+			b.WriteString(`<col min="` + n + `" max="` + n + `" width="` + strconv.FormatFloat(w, 'f', -1, 64) + `" customWidth="1"/>`)
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	b.Write(x.rows.Bytes())
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// columnName is the letters of a zero based column, e.g. "AB" for 27.
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// sheetName makes a valid worksheet name: at most 31 characters, none of
+// them []:*?/\.
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		return "Sheet1"
+	}
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+	return name
+}
+
+const (
+	contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+
+	rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+
+	// styles are indexed by Style; Money uses the built in "#,##0.00".
+	styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="3">` +
+		`<font><sz val="11"/><name val="Calibri"/></font>` +
+		`<font><b/><sz val="11"/><name val="Calibri"/></font>` +
+		`<font><b/><sz val="14"/><name val="Calibri"/></font>` +
+		`</fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="4">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		`<xf numFmtId="0" fontId="2" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`</cellXfs>` +
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+		`</styleSheet>`
+)
@@ -10,6 +10,7 @@ import (
 	"github.com/curt-labs/API/controllers/cache"
 	"github.com/curt-labs/API/controllers/cart"
 	"github.com/curt-labs/API/controllers/cartIntegration"
+	"github.com/curt-labs/API/controllers/catalog"
 	"github.com/curt-labs/API/controllers/category"
 	"github.com/curt-labs/API/controllers/contact"
 	"github.com/curt-labs/API/controllers/customer"
@@ -17,6 +18,7 @@ import (
 	"github.com/curt-labs/API/controllers/faq"
 	"github.com/curt-labs/API/controllers/forum"
 	"github.com/curt-labs/API/controllers/geography"
+	"github.com/curt-labs/API/controllers/interchange"
 	"github.com/curt-labs/API/controllers/landingPages"
 	"github.com/curt-labs/API/controllers/luverne"
 	"github.com/curt-labs/API/controllers/middleware"
@@ -33,7 +35,17 @@ import (
 	"github.com/curt-labs/API/controllers/vinLookup"
 	"github.com/curt-labs/API/controllers/warranty"
 	"github.com/curt-labs/API/controllers/webProperty"
+	"github.com/curt-labs/API/controllers/webhook"
 	"github.com/curt-labs/API/helpers/encoding"
+	cartIntegrationModel "github.com/curt-labs/API/models/cartIntegration"
+	"github.com/curt-labs/API/models/catalog"
+	"github.com/curt-labs/API/models/compare"
+	"github.com/curt-labs/API/models/history"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/recommendation"
+	"github.com/curt-labs/API/models/search"
+	"github.com/curt-labs/API/models/webhook"
 	"github.com/go-martini/martini"
 	"github.com/martini-contrib/cors"
 	// "github.com/martini-contrib/gzip"
@@ -45,7 +57,20 @@ import (
 )
 
 var (
-	listenAddr = flag.String("http", ":8080", "http listen address")
+	listenAddr      = flag.String("http", ":8080", "http listen address")
+	compareSynonyms = flag.String("compare-synonyms", "", "path to a JSON file of attribute name synonyms used by part comparisons")
+	recommendHour   = flag.Int("recommend-hour", -1, "hour of the day to run the nightly recommendation batch, -1 disables it")
+	historyInterval = flag.Duration("history-interval", 0, "how often to scan the catalog for part changes, e.g. 15m; 0 disables it")
+	syncInterval    = flag.Duration("sync-interval", 0, "how often to run an incremental MySQL to Mongo catalog sync, e.g. 1h; 0 disables it")
+	searchBackend   = flag.String("search-backend", "", "search backend, elastic or local; defaults to elastic when ELASTICSEARCH_IP is set")
+	searchReindex   = flag.Duration("search-reindex", time.Hour, "how often to rebuild the search index and part number lookups, e.g. 30m; 0 builds them once at startup")
+	priceInterval   = flag.Duration("price-interval", 0, "how often to apply scheduled list, MAP and jobber prices that are due, e.g. 15m; 0 disables it")
+	parseAttributes = flag.Bool("parse-attributes", false, "parse measurement attributes stored in Mongo into typed values on startup")
+	currencyRates   = flag.String("currency-rates", "", "path to a JSON file of exchange rates from US dollars, e.g. {\"CAD\": 1.3612}")
+	webhookWorkers  = flag.Int("webhook-workers", 4, "how many workers send webhook deliveries, from RabbitMQ when AMQP_HOST is set; 0 disables them")
+	stockInterval   = flag.Duration("inventory-interval", 0, "how often to check for parts running low on inventory for inventory.low webhooks, e.g. 30m; 0 disables it")
+	stockLow        = flag.Int("inventory-low", 5, "total availability at or below which a part is low on inventory")
+	uploadRecovery  = flag.Duration("upload-recovery", 5*time.Minute, "how often to fail price uploads whose imports were interrupted, e.g. by a restart; 0 disables it")
 )
 
 /**
@@ -56,6 +81,72 @@ var (
 func main() {
 	flag.Parse()
 
+	if *compareSynonyms != "" {
+		if err := compare.LoadSynonyms(*compareSynonyms); err != nil {
+			log.Fatalf("failed to load comparison synonyms: %s", err.Error())
+		}
+	}
+	if *currencyRates != "" {
+		if err := pricing.LoadRates(*currencyRates); err != nil {
+			log.Fatalf("failed to load exchange rates: %s", err.Error())
+		}
+	}
+	if *recommendHour >= 0 {
+		go recommendation.Schedule(*recommendHour)
+	}
+	if *historyInterval > 0 {
+		go history.Schedule(*historyInterval)
+	}
+	if *syncInterval > 0 {
+		go catalog.Schedule(*syncInterval)
+	}
+	if err := search.SetBackend(*searchBackend); err != nil {
+		log.Fatal(err)
+	}
+	go search.Schedule(*searchReindex)
+	if *priceInterval > 0 {
+		// the index holds part prices, for price facets
+		pricing.OnApplied(func(partIDs []int) {
+			if err := search.RefreshParts(partIDs); err != nil {
+				log.Printf("failed to refresh search index after price changes: %s", err.Error())
+			}
+		})
+		go pricing.Schedule(*priceInterval)
+	}
+	webhook.SetAudience(products.Audience)
+	history.OnChange(func(c history.Change) {
+		if err := webhook.PublishPart(webhook.PartUpdated, c.PartID, c); err != nil {
+			log.Printf("failed to publish part change webhooks: %s", err.Error())
+		}
+	})
+	pricing.OnApplied(func(partIDs []int) {
+		for _, id := range partIDs {
+			if err := webhook.PublishPart(webhook.PriceChanged, id, webhook.PriceChange{PartID: id, Source: webhook.SourceSchedule}); err != nil {
+				log.Printf("failed to publish price change webhooks: %s", err.Error())
+				return
+			}
+		}
+	})
+	if *webhookWorkers > 0 {
+		webhook.Start(*webhookWorkers)
+	}
+	if *stockInterval > 0 {
+		go webhook.WatchInventory(*stockInterval, *stockLow)
+	}
+	if *uploadRecovery > 0 {
+		go cartIntegrationModel.ScheduleRecovery(*uploadRecovery)
+	}
+	if *parseAttributes {
+		go func() {
+			n, err := products.ParseAttributes()
+			if err != nil {
+				log.Printf("failed to parse part attributes: %s", err.Error())
+				return
+			}
+			log.Printf("parsed attributes for %d parts", n)
+		}()
+	}
+
 	m := martini.Classic()
 	// gorelic.InitNewrelicAgent("5fbc49f51bd658d47b4d5517f7a9cb407099c08c", "API", false)
 	// m.Use(gorelic.Handler)
@@ -106,10 +197,25 @@ func main() {
 		r.Delete("/:id", brand_ctlr.DeleteBrand)
 	})
 
+	m.Group("/catalog/sync", func(r martini.Router) {
+		r.Get("", catalog_ctlr.Status)
+		r.Post("", catalog_ctlr.Sync)
+		r.Get("/:id", catalog_ctlr.Run)
+	})
+
 	m.Group("/category", func(r martini.Router) {
+		r.Get("/by-path/**", category_ctlr.GetCategoryByPath)
+		r.Get("/:id/ancestors", category_ctlr.GetAncestors)
+		r.Get("/:id/descendants", category_ctlr.GetDescendants)
 		r.Get("/:id/parts", category_ctlr.GetCategoryParts)
+		r.Post("/:id/parts", category_ctlr.AttachParts)
+		r.Delete("/:id/parts", category_ctlr.DetachParts)
+		r.Put("/:id/parent", category_ctlr.MoveCategory)
+		r.Put("/:id/children", category_ctlr.SortCategories)
 		r.Get("/:id", category_ctlr.GetCategory)
+		r.Delete("/:id", category_ctlr.DeleteCategory)
 		r.Get("", category_ctlr.GetCategoryTree)
+		r.Post("", category_ctlr.CreateCategory)
 	})
 
 	m.Group("/contact", func(r martini.Router) {
@@ -159,6 +265,7 @@ func main() {
 	m.Group("/shopify/order", func(r martini.Router) {
 		// Orders
 		r.Post("/order", cart_ctlr.CreateOrder)
+		r.Put("/order/:id", cart_ctlr.UpdateOrder)
 	})
 
 	m.Group("/shopify/account", func(r martini.Router) {
@@ -182,6 +289,19 @@ func main() {
 		r.Get("/part", cartIntegration.GetAllPartPrices)
 		r.Get("/count", cartIntegration.GetPricingCount)
 		r.Get("", cartIntegration.GetPricing)
+		r.Get("/jobs", cartIntegration.GetJobs)
+		r.Get("/jobs/:id", cartIntegration.GetJob)
+		r.Post("/jobs/:id/revert", cartIntegration.RevertJob)
+		r.Get("/uploads", cartIntegration.GetUploads)
+		r.Get("/uploads/:id", cartIntegration.GetUpload)
+		r.Get("/uploads/:id/errors", cartIntegration.UploadErrors)
+		r.Get("/export", cartIntegration.GetExportFormats)
+		r.Get("/export/:format", cartIntegration.Export)
+		r.Get("/map/violations", cartIntegration.GetMAPViolations)
+		r.Get("/map/exemptions", cartIntegration.GetMAPExemptions)
+		r.Post("/map/exemptions", cartIntegration.SaveMAPExemption)
+		r.Put("/map/exemptions/:id", cartIntegration.SaveMAPExemption)
+		r.Delete("/map/exemptions/:id", cartIntegration.DeleteMAPExemption)
 		r.Get("/:page/:count", cartIntegration.GetPricingPaged)
 		r.Post("/part", cartIntegration.CreatePrice)
 		r.Put("/part", cartIntegration.UpdatePrice)
@@ -240,7 +360,7 @@ func main() {
 		r.Get("/locations", customer_ctlr.GetLocations)
 		r.Post("/locations", customer_ctlr.GetLocations)
 
-		r.Get("/price/:id", customer_ctlr.GetCustomerPrice)           //{part id}
+		r.Get("/price/:id", customer_ctlr.GetCustomerPrice)           //{part id}; {qty} optional
 		r.Get("/cartRef/:id", customer_ctlr.GetCustomerCartReference) //{part id}
 
 		// Customer CMS endpoints
@@ -269,6 +389,8 @@ func main() {
 		//Customer prices
 		r.Get("/prices/part/:id", customer_ctlr.GetPricesByPart)         //{id}; id refers to partId
 		r.Post("/prices/sale", customer_ctlr.GetSales)                   //{start}{end}{id} -all required params; id refers to customerId
+		r.Get("/prices/calendar", customer_ctlr.GetSaleCalendar)         //active and upcoming sales of the key's customer; {from}{to} optional
+		r.Get("/prices/list", customer_ctlr.GetPriceList)                //printable price list of the key's customer; {format}{category}{asOf}{currency} optional
 		r.Get("/prices/:id", customer_ctlr.GetPrice)                     //{id}; id refers to {id} refers to customerPriceId
 		r.Get("/prices", customer_ctlr.GetAllPrices)                     //returns all {sort=field&direction=dir}
 		r.Put("/prices/:id", customer_ctlr.CreateUpdatePrice)            //updates when an id is present; otherwise, creates; {id} refers to customerPriceId
@@ -276,6 +398,25 @@ func main() {
 		r.Delete("/prices/:id", customer_ctlr.DeletePrice)               //{id} refers to customerPriceId
 		r.Get("/pricesByCustomer/:id", customer_ctlr.GetPriceByCustomer) //{id} refers to customerId; returns CustomerPrices
 
+		//Customer pricing rules
+		r.Get("/pricing/rules", customer_ctlr.GetPricingRules)
+		r.Post("/pricing/rules", customer_ctlr.SavePricingRule)
+		r.Get("/pricing/rules/:id", customer_ctlr.GetPricingRule)       //{id} refers to the rule's ObjectId
+		r.Put("/pricing/rules/:id", customer_ctlr.SavePricingRule)      //{id} refers to the rule's ObjectId
+		r.Delete("/pricing/rules/:id", customer_ctlr.DeletePricingRule) //{id} refers to the rule's ObjectId
+		r.Post("/pricing/calculate", customer_ctlr.CalculatePrices)
+
+		//Customer quantity breaks
+		r.Get("/pricing/tiers", customer_ctlr.GetPriceTiers)
+		r.Post("/pricing/tiers", customer_ctlr.SavePriceTier)
+		r.Put("/pricing/tiers/:id", customer_ctlr.SavePriceTier)      //{id} refers to the tier's ObjectId
+		r.Delete("/pricing/tiers/:id", customer_ctlr.DeletePriceTier) //{id} refers to the tier's ObjectId
+
+		//Customer catalog visibility
+		r.Get("/visibility/:id", customer_ctlr.GetVisibility)       //{id} refers to customerId
+		r.Put("/visibility/:id", customer_ctlr.SaveVisibility)      //{id} refers to customerId
+		r.Delete("/visibility/:id", customer_ctlr.DeleteVisibility) //{id} refers to customerId
+
 		r.Post("/:id", customer_ctlr.SaveCustomer)
 		r.Delete("/:id", customer_ctlr.DeleteCustomer)
 		r.Put("", customer_ctlr.SaveCustomer)
@@ -336,6 +477,12 @@ func main() {
 		r.Get("/countrystates", geography.GetAllCountriesAndStates)
 	})
 
+	m.Group("/interchange", func(r martini.Router) {
+		r.Get("", interchange_ctlr.Competitors)
+		r.Post("/import", interchange_ctlr.Import)
+		r.Get("/:brand/:part", interchange_ctlr.Lookup)
+	})
+
 	m.Group("/news", func(r martini.Router) {
 		r.Get("", news_controller.GetAll)           //get all news; takes optional sort param {sort=title||lead||content||startDate||endDate||active||slug} to sort by question
 		r.Get("/titles", news_controller.GetTitles) //get titles!{page, results} - all parameters are optional
@@ -352,6 +499,14 @@ func main() {
 		r.Get("/featured", part_ctlr.Featured)
 		r.Get("/latest", part_ctlr.Latest)
 		r.Post("/multi", part_ctlr.GetMulti)
+		r.Get("/compare", part_ctlr.Compare)
+		r.Get("/changes", part_ctlr.Changes)
+		r.Get("/pricing/scheduled", part_ctlr.ScheduledPrices)
+		r.Post("/pricing/scheduled", part_ctlr.SchedulePrices)
+		r.Delete("/pricing/scheduled/:id", part_ctlr.CancelScheduledPrice)
+		r.Get("/pricing/currencies", part_ctlr.Currencies)
+		r.Get("/pricing/currency/:currency", part_ctlr.CurrencyPrices)
+		r.Post("/pricing/currency", part_ctlr.SaveCurrencyPrices)
 		r.Get("/:part/vehicles", part_ctlr.Vehicles)
 		r.Get("/:part/attributes", part_ctlr.Attributes)
 		r.Get("/:part/reviews", part_ctlr.ActiveApprovedReviews)
@@ -361,7 +516,11 @@ func main() {
 		r.Get("/:part((.*?)\\.(PDF|pdf)$)", part_ctlr.InstallSheet)
 		r.Get("/:part/packages", part_ctlr.Packaging)
 		r.Get("/:part/pricing", part_ctlr.Prices)
+		r.Get("/:part/pricing/history", part_ctlr.PriceHistory)
 		r.Get("/:part/related", part_ctlr.GetRelated)
+		r.Get("/:part/recommendations", part_ctlr.Recommendations)
+		r.Get("/:part/history", part_ctlr.History)
+		r.Get("/:part/interchange", part_ctlr.Interchange)
 		r.Get("/:part/videos", part_ctlr.Videos)
 		r.Get("/:part/:year/:make/:model", part_ctlr.GetWithVehicle)
 		r.Get("/:part/:year/:make/:model/:submodel", part_ctlr.GetWithVehicle)
@@ -380,6 +539,7 @@ func main() {
 		r.Delete("/:id", salesrep.DeleteSalesRep)
 	})
 
+	m.Get("/search/suggest", search_ctlr.Suggest)
 	m.Get("/search/:term", search_ctlr.Search)
 	m.Get("/searchExactAndClose/:term", search_ctlr.SearchExactAndClose)
 
@@ -522,6 +682,17 @@ func main() {
 		r.Get("/:id", videos_ctlr.Get)
 	})
 
+	m.Group("/webhooks", func(r martini.Router) {
+		r.Get("", webhook_ctlr.GetSubscriptions)
+		r.Post("", webhook_ctlr.SaveSubscription)
+		r.Get("/events", webhook_ctlr.Events)
+		r.Get("/deliveries", webhook_ctlr.GetDeliveries)
+		r.Get("/deliveries/:id", webhook_ctlr.GetDelivery)
+		r.Post("/deliveries/:id/replay", webhook_ctlr.ReplayDelivery)
+		r.Put("/:id", webhook_ctlr.SaveSubscription)
+		r.Delete("/:id", webhook_ctlr.DeleteSubscription)
+	})
+
 	m.Group("/vin", func(r martini.Router) {
 		//option 1 - two calls - ultimately returns parts
 		r.Get("/configs/:vin", vinLookup.GetConfigs)                    //returns vehicles - user must call vin/vehicle with vehicleID to get parts
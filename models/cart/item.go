@@ -1,6 +1,7 @@
 package cart
 
 import (
+	"github.com/curt-labs/API/models/pricing"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -22,4 +23,10 @@ type LineItem struct {
 	GiftCard            bool          `json:"gift_cart" xml:"gift_cart,attr" bson:"gift_cart"`
 	Taxable             bool          `json:"taxable" xml:"taxable,attr" bson:"taxable"`
 	TaxLines            []TaxLine     `json:"tax_lines" xml:"tax_lines" bson:"tax_lines"`
+	// LinePrice is Price times Quantity. When a quantity break of the
+	// shop's customer lowered Price, QuantityBreak is that break and
+	// UnitPrice the price of a single one.
+	LinePrice     float64        `json:"line_price" xml:"line_price,attr" bson:"line_price"`
+	UnitPrice     float64        `json:"unit_price,omitempty" xml:"unit_price,attr,omitempty" bson:"unit_price,omitempty"`
+	QuantityBreak *pricing.Break `json:"quantity_break,omitempty" xml:"quantity_break,omitempty" bson:"quantity_break,omitempty"`
 }
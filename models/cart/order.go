@@ -3,6 +3,9 @@ package cart
 import (
 	"fmt"
 	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/webhook"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"net/url"
@@ -110,6 +113,10 @@ func (o *Order) Create() error {
 	}
 	o.OrderNumber = count + 1
 
+	if err := o.priceLineItems(); err != nil {
+		return err
+	}
+
 	o.bindCustomer()
 
 	if o.Id.Hex() == "" {
@@ -123,13 +130,28 @@ func (o *Order) Create() error {
 	defer sess.Close()
 
 	col := sess.DB("CurtCart").C("order")
-	_, err = col.UpsertId(o.Id, o)
+	if _, err = col.UpsertId(o.Id, o); err != nil {
+		return err
+	}
 
-	return err
+	if o.SendWebhooks {
+		go o.publish(webhook.OrderCreated)
+	}
+	return nil
 }
 
 func (o *Order) Get() error {
-	return fmt.Errorf("error: %s", "not implemented")
+	if !o.Id.Valid() {
+		return fmt.Errorf("error: %s", "invalid order identifier")
+	}
+
+	sess, err := mgo.DialWithInfo(database.MongoConnectionString())
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	return sess.DB("CurtCart").C("order").FindId(o.Id).One(o)
 }
 
 func (o *Order) Update() error {
@@ -139,19 +161,35 @@ func (o *Order) Update() error {
 
 	o.UpdatedAt = time.Now()
 
-	if err := o.validate(); err != nil {
-		return err
+	// updates without line items leave the stored ones and their totals
+	// alone; sent ones are priced by the server, whatever the client sent
+	items := len(o.LineItems) > 0
+	if items {
+		if err := o.validate(); err != nil {
+			return err
+		}
 	}
 
 	o.bindCustomer()
 
+	if items {
+		if err := o.priceLineItems(); err != nil {
+			return err
+		}
+	}
+
 	sess, err := mgo.DialWithInfo(database.MongoConnectionString())
 	if err != nil {
 		return err
 	}
 	defer sess.Close()
 
-	updateDoc, err := o.mapUpdate()
+	prev := Order{Id: o.Id}
+	if err := prev.Get(); err != nil {
+		return err
+	}
+
+	updateDoc, err := o.mapUpdate(&prev)
 	if err != nil {
 		return err
 	}
@@ -164,19 +202,26 @@ func (o *Order) Update() error {
 	}
 
 	_, err = sess.DB("CurtCart").C("order").Find(bson.M{"_id": o.Id, "shop_id": o.ShopId}).Apply(change, o)
+	if err != nil {
+		return err
+	}
 
-	return err
-}
-
-func (o *Order) mapUpdate() (*map[string]interface{}, error) {
-	tmp := Order{
-		Id: o.Id,
+	if o.SendWebhooks && o.FulfillmentStatus == "fulfilled" && prev.FulfillmentStatus != "fulfilled" {
+		go o.publish(webhook.OrderFulfilled)
 	}
+	return nil
+}
 
-	if err := tmp.Get(); err != nil {
-		return nil, err
+// publish sends an order event to the webhooks of the shop's customer.
+func (o *Order) publish(event string) {
+	sh := Shop{Id: o.ShopId}
+	if err := sh.Get(); err != nil || sh.CustomerID == 0 {
+		return
 	}
+	webhook.Publish(event, sh.CustomerID, o)
+}
 
+func (o *Order) mapUpdate(tmp *Order) (*map[string]interface{}, error) {
 	doc := make(map[string]interface{})
 
 	if !o.BillingAddress.deepEqual(tmp.BillingAddress) {
@@ -194,8 +239,20 @@ func (o *Order) mapUpdate() (*map[string]interface{}, error) {
 	if !o.ClientDetails.equal(&tmp.ClientDetails) {
 		doc["client_details"] = o.ClientDetails
 	}
-	if o.Currency != tmp.Currency {
-		doc["currency"] = o.Currency
+	if o.FulfillmentStatus != tmp.FulfillmentStatus {
+		doc["fulfillment_status"] = o.FulfillmentStatus
+	}
+
+	// the currency goes with the prices, which are only worked out again
+	// when line items are sent
+	if len(o.LineItems) > 0 {
+		if o.Currency != tmp.Currency {
+			doc["currency"] = o.Currency
+		}
+		doc["line_items"] = o.LineItems
+		doc["total_line_items_price"] = o.TotalLineItemsPrice
+		doc["subtotal_price"] = o.SubtotalPrice
+		doc["total_price"] = o.TotalPrice
 	}
 
 	// TODO - finish writing deep equal validation
@@ -229,6 +286,97 @@ func (o *Order) bindCustomer() error {
 	return nil
 }
 
+// priceLineItems prices the line items, whose variant is the part, at
+// the price the shop's customer sells the part for, with its quantity
+// breaks, and totals the order. Without a customer, or a price or rule
+// of the customer's for the part, a line item keeps the price it was
+// sent with, and so do variants that aren't parts.
+func (o *Order) priceLineItems() error {
+	sh := Shop{Id: o.ShopId}
+	if err := sh.Get(); err != nil {
+		return err
+	}
+
+	if o.Currency == "" {
+		o.Currency = sh.Currency
+	}
+	if o.Currency == "" {
+		o.Currency = pricing.BaseCurrency
+	}
+	ids := make([]int, 0, len(o.LineItems))
+	for _, item := range o.LineItems {
+		ids = append(ids, item.VariantId)
+	}
+
+	// prices are in US dollars, line items in the order's currency
+	conv, err := pricing.NewConverter(o.Currency, ids...)
+	if err != nil {
+		return err
+	}
+
+	var resolved map[int]pricing.Resolution
+	var tiers *pricing.Tiers
+	if sh.CustomerID > 0 {
+		if resolved, err = products.CustomerPartPrices(sh.CustomerID, ids); err != nil {
+			return err
+		}
+		if tiers, err = pricing.LoadTiers(sh.CustomerID, ids...); err != nil {
+			return err
+		}
+		tiers = conv.Tiers(tiers)
+	}
+
+	o.total(customerPrices(resolved, conv), tiers)
+	return nil
+}
+
+// customerPrices are the unit prices, in the order's currency, of the
+// parts a customer has a price or rule for.
+func customerPrices(resolved map[int]pricing.Resolution, conv *pricing.Converter) map[int]float64 {
+	prices := make(map[int]float64, len(resolved))
+	for id, res := range resolved {
+		if res.Source == pricing.SourceNone {
+			continue
+		}
+		prices[id] = conv.Resolution(res).Price
+	}
+	return prices
+}
+
+// total prices the line items at their unit prices in prices, or at
+// their own when prices doesn't have them, and their quantities, and
+// works out the line item, subtotal and total prices of the order.
+func (o *Order) total(prices map[int]float64, tiers *pricing.Tiers) {
+	var lines, shipping float64
+	for i := range o.LineItems {
+		item := &o.LineItems[i]
+		unit, ok := prices[item.VariantId]
+		if !ok {
+			unit = item.Price
+			if item.QuantityBreak != nil && item.UnitPrice > 0 {
+				unit = item.UnitPrice
+			}
+		}
+		item.Price, item.UnitPrice, item.QuantityBreak = unit, 0, nil
+		if price, brk := tiers.Price(item.VariantId, unit, item.Quantity); brk != nil {
+			item.UnitPrice, item.Price, item.QuantityBreak = unit, price, brk
+		}
+		item.LinePrice = pricing.RoundCurrency(o.Currency, item.Price*float64(item.Quantity))
+		lines += item.LinePrice
+	}
+	for _, line := range o.ShippingLines {
+		shipping += line.Price
+	}
+
+	o.TotalLineItemsPrice = pricing.RoundCurrency(o.Currency, lines)
+	o.SubtotalPrice = pricing.RoundCurrency(o.Currency, o.TotalLineItemsPrice-o.TotalDiscounts)
+	o.TotalPrice = o.SubtotalPrice + shipping
+	if !o.TaxesIncluded {
+		o.TotalPrice += o.TotalTax
+	}
+	o.TotalPrice = pricing.RoundCurrency(o.Currency, o.TotalPrice)
+}
+
 func getOrderCount(shopId bson.ObjectId) (int, error) {
 	sess, err := mgo.DialWithInfo(database.MongoConnectionString())
 	if err != nil {
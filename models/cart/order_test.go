@@ -1,6 +1,7 @@
 package cart
 
 import (
+	"github.com/curt-labs/API/models/pricing"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 	"os"
@@ -134,3 +135,75 @@ func TestCreate(t *testing.T) {
 		}
 	})
 }
+
+func TestOrderTotals(t *testing.T) {
+	Convey("Testing total()", t, func() {
+		o := Order{
+			LineItems: []LineItem{
+				{VariantId: 1000, Price: 10, Quantity: 3},
+				{VariantId: 1001, Price: 19.99, Quantity: 2},
+			},
+			ShippingLines:  []ShippingLine{{Price: 5}},
+			TotalDiscounts: 2,
+			TotalTax:       1.5,
+		}
+		o.total(nil, nil)
+		So(o.LineItems[0].LinePrice, ShouldEqual, 30.0)
+		So(o.LineItems[1].LinePrice, ShouldEqual, 39.98)
+		So(o.LineItems[1].QuantityBreak, ShouldBeNil)
+		So(o.TotalLineItemsPrice, ShouldEqual, 69.98)
+		So(o.SubtotalPrice, ShouldEqual, 67.98)
+		So(o.TotalPrice, ShouldEqual, 74.48)
+
+		o.TaxesIncluded = true
+		o.total(nil, nil)
+		So(o.TotalPrice, ShouldEqual, 72.98)
+
+		// the server's price wins over the client's, save after save
+		o.LineItems[0].Price = 1
+		o.total(map[int]float64{1000: 12.5}, nil)
+		So(o.LineItems[0].Price, ShouldEqual, 12.5)
+		So(o.LineItems[0].LinePrice, ShouldEqual, 37.5)
+		So(o.TotalLineItemsPrice, ShouldEqual, 77.48)
+		o.total(map[int]float64{1000: 12.5}, nil)
+		So(o.TotalLineItemsPrice, ShouldEqual, 77.48)
+	})
+}
+
+func TestPriceLineItems(t *testing.T) {
+	clearMongo()
+	Convey("Testing priceLineItems() for a shop with no customer", t, func() {
+		if id := InsertTestData(); id != nil {
+			o := Order{
+				ShopId:    *id,
+				LineItems: []LineItem{{VariantId: 1000, Price: 10, Quantity: 3}},
+			}
+			So(o.priceLineItems(), ShouldBeNil)
+			So(o.LineItems[0].Price, ShouldEqual, 10.0)
+			So(o.TotalLineItemsPrice, ShouldEqual, 30.0)
+		}
+	})
+
+	Convey("Testing customerPrices()", t, func() {
+		resolved := map[int]pricing.Resolution{
+			1000: {PartID: 1000, Price: 12.5, Source: pricing.SourceCustomer},
+			1001: {PartID: 1001, Source: pricing.SourceNone},
+		}
+		prices := customerPrices(resolved, nil)
+		So(prices, ShouldResemble, map[int]float64{1000: 12.5})
+		So(customerPrices(nil, nil), ShouldBeEmpty)
+
+		// a part with no customer price and a variant that isn't a part
+		// keep the prices they were sent with
+		o := Order{LineItems: []LineItem{
+			{VariantId: 1000, Price: 1, Quantity: 2},
+			{VariantId: 1001, Price: 19.99, Quantity: 1},
+			{VariantId: 99999, Price: 5, Quantity: 1},
+		}}
+		o.total(prices, nil)
+		So(o.LineItems[0].Price, ShouldEqual, 12.5)
+		So(o.LineItems[1].Price, ShouldEqual, 19.99)
+		So(o.LineItems[2].Price, ShouldEqual, 5.0)
+		So(o.TotalLineItemsPrice, ShouldEqual, 49.99)
+	})
+}
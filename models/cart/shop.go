@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/curt-labs/API/helpers/database"
 	"github.com/curt-labs/API/helpers/geocoding"
+	"github.com/curt-labs/API/models/pricing"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"net/url"
@@ -39,6 +40,9 @@ type Shop struct {
 	Timezone                string        `json:"timezone" xml:"timezone,attr" bson:"timezone"`
 	Zip                     string        `json:"zip" xml:"zip,attr" bson:"zip"`
 	HasStorefront           bool          `json:"has_storefront" xml:"has_storefront,attr" bson:"has_storefront"`
+	// CustomerID is the customer (cust_id) whose quantity breaks apply to
+	// the shop's orders.
+	CustomerID int `json:"customer_id,omitempty" xml:"customer_id,attr,omitempty" bson:"customer_id,omitempty"`
 }
 
 func (sh *Shop) Get() error {
@@ -58,6 +62,20 @@ func (sh *Shop) Get() error {
 	return nil
 }
 
+// FormatMoney formats an amount in the shop's currency with its money
+// format, or its money with currency format.
+func (sh *Shop) FormatMoney(amount float64, withCurrency bool) string {
+	format := sh.MoneyFormat
+	if withCurrency {
+		format = sh.MoneyWithCurrencyFormat
+	}
+	currency := sh.Currency
+	if currency == "" {
+		currency = pricing.BaseCurrency
+	}
+	return pricing.FormatMoney(format, currency, amount)
+}
+
 // This method is used explicitly for generating test data
 // DO NOT EXPOSE
 func InsertTestData() *bson.ObjectId {
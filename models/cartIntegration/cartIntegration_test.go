@@ -1,6 +1,7 @@
 package cartIntegration
 
 import (
+	"github.com/curt-labs/API/helpers/apicontext"
 	"github.com/curt-labs/API/helpers/database"
 	_ "github.com/go-sql-driver/mysql"
 
@@ -10,15 +11,16 @@ import (
 	"encoding/csv"
 	"mime/multipart"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCartIntegration(t *testing.T) {
 	var err error
-	Brand_ID = 1
-	Customer_ID = 1
-
 	key, _ := getCustomerKey()
+	dtx := &apicontext.DataContext{BrandID: 1, CustomerID: 1, APIKey: key}
 
 	Convey("Testing CustomerPrices", t, func() {
 		cp := CustomerPrice{
@@ -35,27 +37,27 @@ func TestCartIntegration(t *testing.T) {
 		err = cp.Update()
 		So(err, ShouldBeNil)
 
-		custprices, err := GetCustomerPrices()
+		custprices, err := GetCustomerPrices(dtx)
 		So(err, ShouldBeNil)
 		So(len(custprices), ShouldBeGreaterThan, 0)
 
-		custprices, err = GetPricingPaged(1, 1)
+		custprices, err = GetPricingPaged(1, 1, dtx)
 		So(err, ShouldBeNil)
 		So(len(custprices), ShouldBeGreaterThan, 0)
 
-		count, err := GetPricingCount()
+		count, err := GetPricingCount(dtx)
 		So(err, ShouldBeNil)
 		So(count, ShouldBeGreaterThan, 0)
 
-		prices, err := GetPartPrices()
+		prices, err := GetPartPrices(dtx)
 		So(err, ShouldBeNil)
 		So(len(prices), ShouldBeGreaterThan, 0)
 
-		prices, err = GetPartPricesByPartID(cp.PartID)
+		prices, err = GetPartPricesByPartID(strconv.Itoa(cp.PartID), dtx)
 		So(err, ShouldBeNil)
 		So(len(prices), ShouldBeGreaterThanOrEqualTo, 1)
 
-		prices, err = GetMAPPartPrices()
+		prices, err = GetMAPPartPrices(dtx)
 		So(err, ShouldBeNil)
 		So(len(prices), ShouldBeGreaterThanOrEqualTo, 1)
 
@@ -78,7 +80,7 @@ func TestCartIntegration(t *testing.T) {
 		err = cp.UpdateCartIntegration()
 		So(err, ShouldBeNil)
 
-		custprices, err := GetCustomerCartIntegrations(key)
+		custprices, err := GetCustomerCartIntegrations(dtx)
 		So(err, ShouldBeNil)
 		So(len(custprices), ShouldBeGreaterThanOrEqualTo, 0)
 
@@ -95,15 +97,76 @@ func TestCartIntegration(t *testing.T) {
 	Convey("Testing FileIO", t, func() {
 		file, err := newfileUploadRequest()
 		So(err, ShouldBeNil)
-		t.Log(file.Read(nil))
+		defer os.Remove("test.csv") //cleanup
 
-		err = UploadFile(file, key)
+		job, err := NewUpload(dtx, "test.csv", file, nil)
 		So(err, ShouldBeNil)
+		So(job.Format, ShouldEqual, CSV)
+		So(job.Status, ShouldEqual, UploadQueued)
 
-		os.Remove("test.csv") //cleanup
+		for i := 0; i < 50 && (job.Status == UploadQueued || job.Status == UploadProcessing); i++ {
+			time.Sleep(100 * time.Millisecond)
+			job, err = GetUpload(job.ID, dtx)
+			So(err, ShouldBeNil)
+		}
+		So(job.Status, ShouldEqual, UploadCompleted)
+		So(job.TotalRows, ShouldEqual, 2)
+		So(job.ProcessedRows, ShouldEqual, 2)
 
+		rowErrs, err := UploadErrors(job.ID, dtx)
+		So(err, ShouldBeNil)
+		So(len(rowErrs), ShouldEqual, job.Failed)
 	})
+}
+
+func TestConcurrentCustomers(t *testing.T) {
+	Convey("Testing concurrent requests of different customers", t, func() {
+		dtxs := []*apicontext.DataContext{
+			{BrandID: 1, CustomerID: 1},
+			{BrandID: 1, CustomerID: 2},
+		}
+		cps := []CustomerPrice{
+			{CustID: 1, PartID: 11000, Price: 101},
+			{CustID: 2, PartID: 11000, Price: 202},
+		}
+		for i := range cps {
+			So(cps[i].Create(), ShouldBeNil)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan string, 100)
+		for n := 0; n < 50; n++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				prices, err := GetCustomerPrices(dtxs[i])
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				for _, p := range prices {
+					if p.CustID != 0 && p.CustID != dtxs[i].CustomerID {
+						errs <- "got a price of customer " + strconv.Itoa(p.CustID)
+					}
+					if p.PartID == cps[i].PartID && p.Price != cps[i].Price {
+						errs <- "got the price of another customer for part " + strconv.Itoa(p.PartID)
+					}
+				}
+			}(n % len(dtxs))
+		}
+		wg.Wait()
+		close(errs)
 
+		var failures []string
+		for e := range errs {
+			failures = append(failures, e)
+		}
+		So(failures, ShouldBeEmpty)
+
+		for i := range cps {
+			So(cps[i].Delete(), ShouldBeNil)
+		}
+	})
 }
 
 func newfileUploadRequest() (multipart.File, error) {
@@ -118,7 +181,8 @@ func newfileUploadRequest() (multipart.File, error) {
 		return nil, err
 	}
 
-	return file, nil
+	_, err = file.Seek(0, 0)
+	return file, err
 }
 
 func getCustomerKey() (string, error) {
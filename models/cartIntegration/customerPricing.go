@@ -1,10 +1,14 @@
 package cartIntegration
 
 import (
+	"github.com/curt-labs/API/helpers/apicontext"
 	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/webhook"
 	_ "github.com/go-sql-driver/mysql"
 
 	"database/sql"
+	"errors"
 	"time"
 )
 
@@ -30,6 +34,8 @@ type Price struct {
 }
 
 var (
+	ErrCustomerPriceNotFound = errors.New("customer price not found")
+
 	getPricing = `SELECT distinct cp.cust_price_id, cp.cust_id, p.partID, p.oldPartNumber, ci.referenceID, ci.custPartID, cp.price, cp.isSale, cp.sale_start, cp.sale_end, pr.priceType, pr.price FROM Part p
 		LEFT JOIN CustomerPricing cp ON cp.partID = p.partID AND cp.cust_id = ?
 		LEFT JOIN CartIntegration ci ON ci.partID = p.partID AND ci.custID = ?
@@ -61,9 +67,11 @@ var (
 		JOIN Part as p ON pr.partID = p.partID
 		WHERE p.status != 999 && p.brandID = ? && pr.priceType = 'Map'
 		ORDER by p.oldPartNumber, pr.priceType`
-	updateCustomerPrice = `UPDATE CustomerPricing SET price = ?, isSale = ?, sale_start = ?, sale_end = ? WHERE cust_id = ? AND partID = ?`
+	updateCustomerPrice = `UPDATE CustomerPricing SET price = ?, isSale = ?, sale_start = ?, sale_end = ? WHERE cust_price_id = ? AND cust_id = ?`
 	insertCustomerPrice = `INSERT INTO CustomerPricing(cust_id, partID, price, isSale, sale_start, sale_end) VALUES(?, ?, ?, ?, ?, ?)`
 	deleteCustomerPrice = `delete from CustomerPricing where cust_price_id = ?`
+	getCustomerPricePart = `select partID from CustomerPricing where cust_price_id = ? and cust_id = ?`
+	getCustomerPartRows = `select cust_price_id, partID, price, isSale, sale_start, sale_end from CustomerPricing where cust_id = ? and partID = ?`
 	// Cart Integrations
 	getCustomerCartIntegrations = `select c.referenceID, c.partID, p.oldPartNumber, c.custPartID, c.custID from CartIntegration as c
 		join CustomerUser as cu on cu.cust_id = c.custID
@@ -80,11 +88,6 @@ var (
 	getPartIDfromPartNumber = `select p.partID from Part as p where p.oldPartNumber = ?`
 )
 
-var (
-	Brand_ID    int
-	Customer_ID int
-)
-
 func initDB() (*sql.DB, error) {
 	connStr := database.ConnectionString()
 	db, err := sql.Open("mysql", connStr)
@@ -94,8 +97,8 @@ func initDB() (*sql.DB, error) {
 	return db, err
 }
 
-//Get all of a single customer's prices
-func GetCustomerPrices() ([]CustomerPrice, error) {
+//Get all of a single customer's prices, for the customer and brand of dtx
+func GetCustomerPrices(dtx *apicontext.DataContext) ([]CustomerPrice, error) {
 	var cps []CustomerPrice
 	db, err := initDB()
 	if err != nil {
@@ -107,7 +110,7 @@ func GetCustomerPrices() ([]CustomerPrice, error) {
 		return cps, err
 	}
 	defer stmt.Close()
-	res, err := stmt.Query(Customer_ID, Customer_ID, Brand_ID)
+	res, err := stmt.Query(dtx.CustomerID, dtx.CustomerID, dtx.BrandID)
 	if err != nil {
 		return cps, err
 	}
@@ -123,7 +126,7 @@ func GetCustomerPrices() ([]CustomerPrice, error) {
 }
 
 //Get a customers prices - paged/limited
-func GetPricingPaged(page int, count int) ([]CustomerPrice, error) {
+func GetPricingPaged(page int, count int, dtx *apicontext.DataContext) ([]CustomerPrice, error) {
 	var cps []CustomerPrice
 	db, err := initDB()
 	if err != nil {
@@ -136,7 +139,7 @@ func GetPricingPaged(page int, count int) ([]CustomerPrice, error) {
 		return cps, err
 	}
 	defer stmt.Close()
-	res, err := stmt.Query(Customer_ID, Customer_ID, Brand_ID, (page-1)*count, count)
+	res, err := stmt.Query(dtx.CustomerID, dtx.CustomerID, dtx.BrandID, (page-1)*count, count)
 	if err != nil {
 		return cps, err
 	}
@@ -152,7 +155,7 @@ func GetPricingPaged(page int, count int) ([]CustomerPrice, error) {
 }
 
 //Returns the number of prices that a customer has
-func GetPricingCount() (int, error) {
+func GetPricingCount(dtx *apicontext.DataContext) (int, error) {
 	var count int
 	db, err := initDB()
 	if err != nil {
@@ -164,7 +167,7 @@ func GetPricingCount() (int, error) {
 		return count, err
 	}
 	defer stmt.Close()
-	err = stmt.QueryRow(Customer_ID, Customer_ID, Brand_ID).Scan(&count)
+	err = stmt.QueryRow(dtx.CustomerID, dtx.CustomerID, dtx.BrandID).Scan(&count)
 	if err != nil {
 		return count, err
 	}
@@ -172,7 +175,7 @@ func GetPricingCount() (int, error) {
 }
 
 //Returns Price for a part
-func GetPartPricesByPartID(partNumber string) ([]Price, error) {
+func GetPartPricesByPartID(partNumber string, dtx *apicontext.DataContext) ([]Price, error) {
 	var ps []Price
 	db, err := initDB()
 	if err != nil {
@@ -184,7 +187,7 @@ func GetPartPricesByPartID(partNumber string) ([]Price, error) {
 		return ps, err
 	}
 	defer stmt.Close()
-	res, err := stmt.Query(Brand_ID, partNumber)
+	res, err := stmt.Query(dtx.BrandID, partNumber)
 	if err != nil {
 		return ps, err
 	}
@@ -199,7 +202,7 @@ func GetPartPricesByPartID(partNumber string) ([]Price, error) {
 }
 
 //Returns all Prices
-func GetPartPrices() ([]Price, error) {
+func GetPartPrices(dtx *apicontext.DataContext) ([]Price, error) {
 	var ps []Price
 	db, err := initDB()
 	if err != nil {
@@ -211,7 +214,7 @@ func GetPartPrices() ([]Price, error) {
 		return ps, err
 	}
 	defer stmt.Close()
-	res, err := stmt.Query(Brand_ID)
+	res, err := stmt.Query(dtx.BrandID)
 	if err != nil {
 		return ps, err
 	}
@@ -226,7 +229,7 @@ func GetPartPrices() ([]Price, error) {
 }
 
 //Returns Map Price for every part
-func GetMAPPartPrices() ([]Price, error) {
+func GetMAPPartPrices(dtx *apicontext.DataContext) ([]Price, error) {
 	var ps []Price
 	db, err := initDB()
 	if err != nil {
@@ -238,7 +241,7 @@ func GetMAPPartPrices() ([]Price, error) {
 		return ps, err
 	}
 	defer stmt.Close()
-	res, err := stmt.Query(Brand_ID)
+	res, err := stmt.Query(dtx.BrandID)
 	if err != nil {
 		return ps, err
 	}
@@ -253,6 +256,8 @@ func GetMAPPartPrices() ([]Price, error) {
 }
 
 //CRUD
+
+// Update changes the customer's price of ID, which stays on its part.
 func (c *CustomerPrice) Update() error {
 	db, err := initDB()
 	if err != nil {
@@ -264,14 +269,24 @@ func (c *CustomerPrice) Update() error {
 		return err
 	}
 	defer stmt.Close()
-	if c.PartID == 0 {
-		c.PartID, err = GetPartIDfromOldPartNumber(c.PartNumber)
-		if c.PartID == 0 || err != nil {
-			return err
-		}
+	err = db.QueryRow(getCustomerPricePart, c.ID, c.CustID).Scan(&c.PartID)
+	if err == sql.ErrNoRows {
+		return ErrCustomerPriceNotFound
 	}
-	_, err = stmt.Exec(c.Price, c.IsSale, c.SaleStart, c.SaleEnd, c.CustID, c.PartID)
-	return err
+	if err != nil {
+		return err
+	}
+	if err = c.checkMAP(); err != nil {
+		return err
+	}
+	if err = c.checkSale(db); err != nil {
+		return err
+	}
+	if _, err = stmt.Exec(c.Price, c.IsSale, c.SaleStart, c.SaleEnd, c.ID, c.CustID); err != nil {
+		return err
+	}
+	go webhook.Publish(webhook.PriceChanged, c.CustID, c.change())
+	return nil
 }
 
 func (c *CustomerPrice) Create() error {
@@ -291,6 +306,12 @@ func (c *CustomerPrice) Create() error {
 			return err
 		}
 	}
+	if err = c.checkMAP(); err != nil {
+		return err
+	}
+	if err = c.checkSale(db); err != nil {
+		return err
+	}
 	res, err := stmt.Exec(c.CustID, c.PartID, c.Price, c.IsSale, c.SaleStart, c.SaleEnd)
 	if err != nil {
 		return err
@@ -300,9 +321,44 @@ func (c *CustomerPrice) Create() error {
 		return err
 	}
 	c.ID = int(id)
+	go webhook.Publish(webhook.PriceChanged, c.CustID, c.change())
 	return nil
 }
 
+// change is the price.changed event data of the price.
+func (c *CustomerPrice) change() webhook.PriceChange {
+	return webhook.PriceChange{PartID: c.PartID, CustomerID: c.CustID, Source: webhook.SourceCustomer, Price: c.Price, Sale: c.IsSale == 1}
+}
+
+// checkSale rejects a sale whose dates overlap another sale the
+// customer has on the part, with a *pricing.SaleOverlap.
+func (c *CustomerPrice) checkSale(db *sql.DB) error {
+	sale := pricing.CustomerPrice{ID: c.ID, CustomerID: c.CustID, PartID: c.PartID, Price: c.Price, IsSale: c.IsSale == 1, SaleStart: c.SaleStart, SaleEnd: c.SaleEnd}
+	if !sale.Sale() {
+		return nil
+	}
+	rows, err := db.Query(getCustomerPartRows, c.CustID, c.PartID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var prices []pricing.CustomerPrice
+	for rows.Next() {
+		cp := pricing.CustomerPrice{CustomerID: c.CustID}
+		var isSale *int
+		if err = rows.Scan(&cp.ID, &cp.PartID, &cp.Price, &isSale, &cp.SaleStart, &cp.SaleEnd); err != nil {
+			return err
+		}
+		cp.IsSale = isSale != nil && *isSale == 1
+		prices = append(prices, cp)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return pricing.CheckSale(sale, prices)
+}
+
 func (c *CustomerPrice) Delete() error {
 	db, err := initDB()
 	if err != nil {
@@ -319,7 +375,7 @@ func (c *CustomerPrice) Delete() error {
 }
 
 //CartIntegration
-func GetCustomerCartIntegrations(key string) ([]CustomerPrice, error) {
+func GetCustomerCartIntegrations(dtx *apicontext.DataContext) ([]CustomerPrice, error) {
 	var cps []CustomerPrice
 	db, err := initDB()
 	if err != nil {
@@ -331,7 +387,7 @@ func GetCustomerCartIntegrations(key string) ([]CustomerPrice, error) {
 		return cps, err
 	}
 	defer stmt.Close()
-	res, err := stmt.Query(key, Brand_ID)
+	res, err := stmt.Query(dtx.APIKey, dtx.BrandID)
 	if err != nil {
 		return cps, err
 	}
@@ -0,0 +1,417 @@
+package cartIntegration
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/helpers/units"
+	"github.com/curt-labs/API/models/products"
+	"gopkg.in/mgo.v2"
+)
+
+// ExportCollectionName holds what was last exported to each customer's
+// cart, per brand and format, for delta exports.
+const ExportCollectionName = "cart_exports"
+
+var (
+	formatters     = make(map[string]Formatter)
+	formatterMutex sync.RWMutex
+)
+
+// Formatter lays out parts as the product import file of a shopping
+// cart. Rows returns one or more rows per part, matching Header, which
+// gets the unit system of the items' weights. Remove returns the rows
+// that take a part the customer no longer sells off their store; its
+// item only has the part's ID, number, cart reference, title and brand.
+type Formatter interface {
+	Header(system string) []string
+	Rows(item ExportItem) [][]string
+	Remove(item ExportItem) [][]string
+}
+
+// ExportItem is a part as a customer sells it: their price and cart
+// reference with the part's content.
+type ExportItem struct {
+	PartID        int
+	PartNumber    string
+	CartReference int
+	Title         string
+	Description   string
+	Bullets       []string
+	Brand         string
+	Category      string
+	// Price is the customer's price, or the MAP or list price of parts
+	// they haven't priced. With sale dates it's a sale price and
+	// ListPrice the regular one.
+	Price     float64
+	ListPrice float64
+	SaleStart *time.Time
+	SaleEnd   *time.Time
+	UPC       string
+	// Weight is in pounds, and written in the units of System,
+	// units.Imperial or units.Metric.
+	Weight float64
+	System string
+	Images []string
+}
+
+// OnSale tells whether the price is a sale price.
+func (i ExportItem) OnSale() bool {
+	return i.SaleStart != nil || i.SaleEnd != nil
+}
+
+// ExportResult says what an export wrote.
+type ExportResult struct {
+	Format  string     `json:"format" xml:"format"`
+	Delta   bool       `json:"delta" xml:"delta"`
+	Since   *time.Time `json:"since,omitempty" xml:"since,omitempty"`
+	Parts   int        `json:"parts" xml:"parts"`
+	Removed int        `json:"removed" xml:"removed"`
+	Rows    int        `json:"rows" xml:"rows"`
+
+	next *export
+}
+
+// export is the last export of a format to a customer's cart: a hash of
+// each part's rows, and what's needed to remove the part later.
+type export struct {
+	ID         string               `bson:"_id"`
+	CustomerID int                  `bson:"customer_id"`
+	BrandID    int                  `bson:"brand_id"`
+	Format     string               `bson:"format"`
+	ExportedAt time.Time            `bson:"exported_at"`
+	Hashes     map[string]string    `bson:"hashes"`
+	Refs       map[string]exportRef `bson:"refs"`
+}
+
+// exportRef is what an export remembers of a part to remove it from the
+// customer's cart once it's no longer exported.
+type exportRef struct {
+	PartNumber    string `bson:"part_number"`
+	CartReference int    `bson:"cart_reference,omitempty"`
+	Title         string `bson:"title"`
+	Brand         string `bson:"brand"`
+}
+
+// RegisterFormatter makes a cart format available to Export by name.
+func RegisterFormatter(name string, f Formatter) {
+	formatterMutex.Lock()
+	defer formatterMutex.Unlock()
+	formatters[strings.ToLower(name)] = f
+}
+
+// GetFormatter returns the formatter of a cart format.
+func GetFormatter(name string) (Formatter, bool) {
+	formatterMutex.RLock()
+	defer formatterMutex.RUnlock()
+	f, ok := formatters[strings.ToLower(name)]
+	return f, ok
+}
+
+// Formats lists the names of the cart formats.
+func Formats() []string {
+	formatterMutex.RLock()
+	defer formatterMutex.RUnlock()
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export writes the import file of a cart format with the prices of
+// dtx's customer for dtx's brand to w, with weights in a unit system.
+// With delta only the parts that are new or changed since the last
+// export in that format are written. Parts exported last time that no
+// longer are get rows removing them either way. The export is only
+// remembered, for the next delta, once the result is committed.
+func Export(dtx *apicontext.DataContext, format string, delta bool, system string, w io.Writer) (*ExportResult, error) {
+	f, ok := GetFormatter(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown cart format %q, use one of %s", format, strings.Join(Formats(), ", "))
+	}
+	if !units.ValidSystem(system) {
+		system = units.Imperial
+	}
+	res := &ExportResult{Format: strings.ToLower(format), Delta: delta}
+
+	items, err := exportItems(dtx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].System = system
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(ExportCollectionName)
+
+	last := export{ID: fmt.Sprintf("%d:%d:%s", dtx.CustomerID, dtx.BrandID, res.Format)}
+	if err = col.FindId(last.ID).One(&last); err == nil {
+		if delta {
+			res.Since = &last.ExportedAt
+		}
+	} else if err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	next := &export{
+		ID:         last.ID,
+		CustomerID: dtx.CustomerID,
+		BrandID:    dtx.BrandID,
+		Format:     res.Format,
+		ExportedAt: time.Now(),
+		Refs:       make(map[string]exportRef, len(items)),
+	}
+	unchanged := last.Hashes
+	if !delta {
+		unchanged = nil
+	}
+	rows, hashes := changedRows(f, items, unchanged)
+	next.Hashes = hashes
+	for _, item := range items {
+		next.Refs[strconv.Itoa(item.PartID)] = exportRef{
+			PartNumber:    item.PartNumber,
+			CartReference: item.CartReference,
+			Title:         item.Title,
+			Brand:         item.Brand,
+		}
+	}
+	removed := removedRows(f, &last, hashes)
+
+	wr := csv.NewWriter(w)
+	wr.Write(f.Header(system))
+	for _, r := range rows {
+		res.Parts++
+		res.Rows += len(r)
+		wr.WriteAll(r)
+	}
+	for _, r := range removed {
+		res.Removed++
+		res.Rows += len(r)
+		wr.WriteAll(r)
+	}
+	wr.Flush()
+	if err = wr.Error(); err != nil {
+		return nil, err
+	}
+
+	res.next = next
+	return res, nil
+}
+
+// Commit remembers the export, so the next delta export is of the parts
+// changed since and the parts it removed aren't removed again. It should
+// only be called once the file was delivered in full.
+func (res *ExportResult) Commit() error {
+	if res.next == nil {
+		return nil
+	}
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	_, err = session.DB(database.ProductDatabase).C(ExportCollectionName).UpsertId(res.next.ID, res.next)
+	return err
+}
+
+// changedRows formats items, leaving out those whose rows hash the same
+// as in last, and returns the hashes of all of them.
+func changedRows(f Formatter, items []ExportItem, last map[string]string) ([][][]string, map[string]string) {
+	hashes := make(map[string]string, len(items))
+	changed := make([][][]string, 0, len(items))
+	for _, item := range items {
+		rows := f.Rows(item)
+		h := sha1.New()
+		for _, r := range rows {
+			io.WriteString(h, strings.Join(r, "\x1f")+"\x1e")
+		}
+		key := strconv.Itoa(item.PartID)
+		hashes[key] = hex.EncodeToString(h.Sum(nil))
+		if last != nil && last[key] == hashes[key] {
+			continue
+		}
+		changed = append(changed, rows)
+	}
+	return changed, hashes
+}
+
+// removedRows formats the removal of the parts of last that aren't in
+// hashes, by part ID. Parts exported before their references were kept
+// can't be removed and are left out.
+func removedRows(f Formatter, last *export, hashes map[string]string) [][][]string {
+	ids := make([]int, 0)
+	for key := range last.Hashes {
+		if _, ok := hashes[key]; ok {
+			continue
+		}
+		if _, ok := last.Refs[key]; !ok {
+			continue
+		}
+		if id, err := strconv.Atoi(key); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	removed := make([][][]string, 0, len(ids))
+	for _, id := range ids {
+		ref := last.Refs[strconv.Itoa(id)]
+		removed = append(removed, f.Remove(ExportItem{
+			PartID:        id,
+			PartNumber:    ref.PartNumber,
+			CartReference: ref.CartReference,
+			Title:         ref.Title,
+			Brand:         ref.Brand,
+		}))
+	}
+	return removed
+}
+
+// exportItems combines the customer prices of dtx's brand with the
+// content of their parts. Parts without any price are left out.
+func exportItems(dtx *apicontext.DataContext) ([]ExportItem, error) {
+	custPrices, err := GetCustomerPrices(dtx)
+	if err != nil {
+		return nil, err
+	}
+	maps, err := GetMAPPartPrices(dtx)
+	if err != nil {
+		return nil, err
+	}
+	mapPrices := make(map[int]float64)
+	for _, p := range maps {
+		mapPrices[p.PartID] = p.Price
+	}
+
+	ids := make([]int, 0, len(custPrices))
+	for _, cp := range custPrices {
+		ids = append(ids, cp.PartID)
+	}
+	parts, err := products.ExportParts(ids, dtx)
+	if err != nil {
+		return nil, err
+	}
+	content := make(map[int]products.Part, len(parts))
+	for _, p := range parts {
+		content[p.ID] = p
+	}
+
+	items := make([]ExportItem, 0, len(parts))
+	for _, cp := range custPrices {
+		p, ok := content[cp.PartID]
+		if !ok {
+			continue
+		}
+		item := newExportItem(cp, p)
+		if item.Price == 0 {
+			item.Price = mapPrices[cp.PartID]
+		}
+		if item.Price == 0 {
+			item.Price = item.ListPrice
+		}
+		if item.Price > 0 {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func newExportItem(cp CustomerPrice, p products.Part) ExportItem {
+	item := ExportItem{
+		PartID:        cp.PartID,
+		PartNumber:    cp.PartNumber,
+		CartReference: cp.CustomerPartID,
+		Title:         p.ShortDesc,
+		Brand:         p.Brand.Name,
+		Price:         cp.Price,
+		ListPrice:     cp.ListPrice.Price,
+		UPC:           p.UPC,
+	}
+	if cp.Price > 0 {
+		item.SaleStart, item.SaleEnd = cp.SaleStart, cp.SaleEnd
+	}
+	if item.PartNumber == "" {
+		item.PartNumber = p.PartNumber
+	}
+	if item.Title == "" {
+		item.Title = item.PartNumber
+	}
+	if len(p.Categories) > 0 {
+		item.Category = p.Categories[0].Title
+	}
+
+	contents := make([]products.Content, len(p.Content))
+	copy(contents, p.Content)
+	sort.Stable(contentBySort(contents))
+	for _, c := range contents {
+		typ := strings.ToLower(c.ContentType.Type)
+		switch {
+		case strings.Contains(typ, "bullet"):
+			item.Bullets = append(item.Bullets, c.Text)
+		case strings.Contains(typ, "description") && item.Description == "":
+			item.Description = c.Text
+		}
+	}
+
+	if len(p.Packages) > 0 {
+		item.Weight = pounds(p.Packages[0].Weight, p.Packages[0].WeightUnit)
+	}
+
+	// the widest of each image, in order
+	widest := make(map[string]products.Image)
+	var order []string
+	for _, img := range p.Images {
+		if img.Path == nil {
+			continue
+		}
+		cur, ok := widest[img.Sort]
+		if !ok {
+			order = append(order, img.Sort)
+		}
+		if !ok || img.Width > cur.Width {
+			widest[img.Sort] = img
+		}
+	}
+	sort.Strings(order)
+	for _, s := range order {
+		item.Images = append(item.Images, widest[s].Path.String())
+	}
+	return item
+}
+
+// pounds converts a package weight to pounds.
+func pounds(weight float64, unit string) float64 {
+	switch u := strings.ToUpper(strings.TrimSpace(unit)); {
+	case strings.HasPrefix(u, "K"):
+		return weight * 2.20462
+	case strings.HasPrefix(u, "OZ") || strings.HasPrefix(u, "OUNCE"):
+		return weight / 16
+	case strings.HasPrefix(u, "G"):
+		return weight / 453.592
+	}
+	return weight
+}
+
+type contentBySort []products.Content
+
+func (s contentBySort) Len() int           { return len(s) }
+func (s contentBySort) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s contentBySort) Less(i, j int) bool { return s[i].Sort < s[j].Sort }
@@ -0,0 +1,255 @@
+package cartIntegration
+
+import (
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/units"
+)
+
+func init() {
+	RegisterFormatter("shopify", Shopify{})
+	RegisterFormatter("bigcommerce", BigCommerce{})
+	RegisterFormatter("woocommerce", WooCommerce{})
+	RegisterFormatter("magento", Magento{})
+}
+
+var handleChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Shopify lays out the product CSV of the Shopify admin. Products are
+// matched on their handle, made from the part number; images after the
+// first go on rows of their own. Weights are in grams either way.
+type Shopify struct{}
+
+func (Shopify) Header(system string) []string {
+	return []string{
+		"Handle", "Title", "Body (HTML)", "Vendor", "Type", "Tags", "Published",
+		"Option1 Name", "Option1 Value", "Variant SKU", "Variant Grams",
+		"Variant Inventory Policy", "Variant Fulfillment Service",
+		"Variant Price", "Variant Compare At Price", "Variant Requires Shipping",
+		"Variant Taxable", "Variant Barcode", "Image Src", "Image Position", "Status",
+	}
+}
+
+func (Shopify) Rows(item ExportItem) [][]string {
+	handle := strings.Trim(handleChars.ReplaceAllString(strings.ToLower(item.PartNumber), "-"), "-")
+	var compareAt string
+	if item.ListPrice > item.Price {
+		compareAt = money(item.ListPrice)
+	}
+	var grams string
+	if item.Weight > 0 {
+		grams = strconv.Itoa(int(item.Weight*453.592 + 0.5))
+	}
+
+	rows := [][]string{{
+		handle, item.Title, bodyHTML(item), item.Brand, item.Category, "", "TRUE",
+		"Title", "Default Title", item.PartNumber, grams,
+		"deny", "manual",
+		money(item.Price), compareAt, "TRUE",
+		"TRUE", item.UPC, image(item.Images, 0), position(item.Images, 0), "active",
+	}}
+	for i := 1; i < len(item.Images); i++ {
+		row := make([]string, 21)
+		row[0], row[18], row[19] = handle, item.Images[i], strconv.Itoa(i+1)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Remove archives the product and unpublishes it.
+func (Shopify) Remove(item ExportItem) [][]string {
+	row := make([]string, 21)
+	row[0] = strings.Trim(handleChars.ReplaceAllString(strings.ToLower(item.PartNumber), "-"), "-")
+	row[1], row[3], row[6], row[9], row[20] = item.Title, item.Brand, "FALSE", item.PartNumber, "archived"
+	return [][]string{row}
+}
+
+// BigCommerce lays out the product import CSV of BigCommerce. Products
+// are matched on Product ID, the customer's cart reference, or on SKU.
+type BigCommerce struct{}
+
+// bigCommerceImages is how many image columns the BigCommerce file has.
+const bigCommerceImages = 5
+
+func (BigCommerce) Header(system string) []string {
+	h := []string{
+		"Item Type", "Product ID", "Product Name", "Product Type", "Product Code/SKU",
+		"Brand Name", "Product Description", "Price", "Retail Price", "Sale Price",
+		"Product Weight", "Product UPC/EAN", "Category", "Product Visible?",
+	}
+	for i := 1; i <= bigCommerceImages; i++ {
+		h = append(h, "Product Image URL - "+strconv.Itoa(i))
+	}
+	return h
+}
+
+func (BigCommerce) Rows(item ExportItem) [][]string {
+	price, retail, sale := money(item.Price), money(item.ListPrice), ""
+	if item.OnSale() && item.ListPrice > 0 {
+		price, sale = money(item.ListPrice), money(item.Price)
+	}
+	row := []string{
+		"Product", reference(item), item.Title, "P", item.PartNumber,
+		item.Brand, bodyHTML(item), price, retail, sale,
+		weight(item), item.UPC, item.Category, "Y",
+	}
+	for i := 0; i < bigCommerceImages; i++ {
+		row = append(row, image(item.Images, i))
+	}
+	return [][]string{row}
+}
+
+// Remove hides the product from the storefront.
+func (BigCommerce) Remove(item ExportItem) [][]string {
+	row := make([]string, 14+bigCommerceImages)
+	row[0], row[1], row[2], row[3], row[4] = "Product", reference(item), item.Title, "P", item.PartNumber
+	row[5], row[13] = item.Brand, "N"
+	return [][]string{row}
+}
+
+// WooCommerce lays out the CSV of WooCommerce's product importer.
+// Products are matched on ID, the customer's cart reference, or on SKU.
+type WooCommerce struct{}
+
+func (WooCommerce) Header(system string) []string {
+	unit := units.Pound
+	if system == units.Metric {
+		unit = units.Kilogram
+	}
+	return []string{
+		"ID", "Type", "SKU", "GTIN, UPC, EAN, or ISBN", "Name", "Published",
+		"Short description", "Description", "Date sale price starts", "Date sale price ends",
+		"Regular price", "Sale price", "Categories", "Brands", "Weight (" + unit.Symbol + ")", "Images",
+	}
+}
+
+func (WooCommerce) Rows(item ExportItem) [][]string {
+	regular, sale := money(item.Price), ""
+	if item.OnSale() && item.ListPrice > 0 {
+		regular, sale = money(item.ListPrice), money(item.Price)
+	}
+	return [][]string{{
+		reference(item), "simple", item.PartNumber, item.UPC, item.Title, "1",
+		item.Title, bodyHTML(item), date(item.SaleStart), date(item.SaleEnd),
+		regular, sale, item.Category, item.Brand, weight(item), strings.Join(item.Images, ", "),
+	}}
+}
+
+// Remove sets the product back to a draft.
+func (WooCommerce) Remove(item ExportItem) [][]string {
+	row := make([]string, 16)
+	row[0], row[1], row[2], row[4], row[5], row[13] = reference(item), "simple", item.PartNumber, item.Title, "-1", item.Brand
+	return [][]string{row}
+}
+
+// Magento lays out the catalog product import CSV of Magento 2, which
+// matches products on SKU. The UPC goes in a "upc" attribute, which the
+// store has to have.
+type Magento struct{}
+
+func (Magento) Header(system string) []string {
+	return []string{
+		"sku", "store_view_code", "attribute_set_code", "product_type", "categories",
+		"product_websites", "name", "description", "short_description", "weight",
+		"product_online", "visibility", "price", "special_price",
+		"special_price_from_date", "special_price_to_date", "url_key",
+		"base_image", "small_image", "thumbnail_image", "additional_images",
+		"additional_attributes",
+	}
+}
+
+func (Magento) Rows(item ExportItem) [][]string {
+	price, special := money(item.Price), ""
+	if item.OnSale() && item.ListPrice > 0 {
+		price, special = money(item.ListPrice), money(item.Price)
+	}
+	var categories, additional, attributes string
+	if item.Category != "" {
+		categories = "Default Category/" + item.Category
+	}
+	if len(item.Images) > 1 {
+		additional = strings.Join(item.Images[1:], ",")
+	}
+	if item.UPC != "" {
+		attributes = "upc=" + item.UPC
+	}
+	base := image(item.Images, 0)
+	return [][]string{{
+		item.PartNumber, "", "Default", "simple", categories,
+		"base", item.Title, bodyHTML(item), item.Title, weight(item),
+		"1", "Catalog, Search", price, special,
+		date(item.SaleStart), date(item.SaleEnd), strings.Trim(handleChars.ReplaceAllString(strings.ToLower(item.Brand+" "+item.PartNumber), "-"), "-"),
+		base, base, base, additional,
+		attributes,
+	}}
+}
+
+// Remove disables the product.
+func (Magento) Remove(item ExportItem) [][]string {
+	row := make([]string, 22)
+	row[0], row[2], row[3], row[6], row[10] = item.PartNumber, "Default", "simple", item.Title, "0"
+	return [][]string{row}
+}
+
+// bodyHTML is the description followed by the bullets as a list.
+func bodyHTML(item ExportItem) string {
+	body := html.EscapeString(item.Description)
+	if body != "" {
+		body = "<p>" + body + "</p>"
+	}
+	if len(item.Bullets) > 0 {
+		body += "<ul>"
+		for _, b := range item.Bullets {
+			body += "<li>" + html.EscapeString(b) + "</li>"
+		}
+		body += "</ul>"
+	}
+	return body
+}
+
+func reference(item ExportItem) string {
+	if item.CartReference == 0 {
+		return ""
+	}
+	return strconv.Itoa(item.CartReference)
+}
+
+func money(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+// weight is the item's weight in its unit system: pounds or kilograms,
+// as the store is set up in.
+func weight(item ExportItem) string {
+	if item.Weight == 0 {
+		return ""
+	}
+	w := units.Quantity{Value: item.Weight, Unit: units.Pound}.In(item.System).Value
+	return strconv.FormatFloat(math.Floor(w*100+0.5)/100, 'f', -1, 64)
+}
+
+func date(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(DATE_FORMAT)
+}
+
+func image(images []string, i int) string {
+	if i >= len(images) {
+		return ""
+	}
+	return images[i]
+}
+
+func position(images []string, i int) string {
+	if i >= len(images) {
+		return ""
+	}
+	return strconv.Itoa(i + 1)
+}
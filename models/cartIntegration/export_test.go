@@ -0,0 +1,137 @@
+package cartIntegration
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/curt-labs/API/helpers/units"
+	"github.com/curt-labs/API/models/brand"
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExport(t *testing.T) {
+	img := func(sort string, width int) products.Image {
+		u, _ := url.Parse("https://images.example.com/" + sort + "/" + strconv.Itoa(width) + ".jpg")
+		return products.Image{Sort: sort, Width: width, Path: u}
+	}
+	start, end := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 7, 31, 0, 0, 0, 0, time.UTC)
+
+	part := products.Part{
+		ID:         11000,
+		PartNumber: "11000",
+		ShortDesc:  "Class 3 Trailer Hitch",
+		Brand:      brand.Brand{Name: "CURT"},
+		UPC:        "012345678905",
+		Categories: []products.Category{{Title: "Trailer Hitches"}},
+		Content: []products.Content{
+			{Text: "Second", ContentType: products.ContentType{Type: "Bullet"}, Sort: 2},
+			{Text: "Fits <most> trucks", ContentType: products.ContentType{Type: "Marketing Description"}, Sort: 0},
+			{Text: "First", ContentType: products.ContentType{Type: "Bullet"}, Sort: 1},
+		},
+		Images:   []products.Image{img("b", 300), img("a", 1000), img("a", 300)},
+		Packages: []products.Package{{Weight: 10, WeightUnit: "KG"}},
+	}
+	cp := CustomerPrice{PartID: 11000, PartNumber: "11000", CustomerPartID: 42, Price: 199.99, SaleStart: &start, SaleEnd: &end, ListPrice: Price{Price: 249.99}}
+
+	Convey("Testing export items", t, func() {
+		item := newExportItem(cp, part)
+		So(item.Title, ShouldEqual, "Class 3 Trailer Hitch")
+		So(item.Description, ShouldEqual, "Fits <most> trucks")
+		So(item.Bullets, ShouldResemble, []string{"First", "Second"})
+		So(item.Images, ShouldResemble, []string{"https://images.example.com/a/1000.jpg", "https://images.example.com/b/300.jpg"})
+		So(item.Weight, ShouldAlmostEqual, 22.0462, 0.0001)
+		So(item.OnSale(), ShouldBeTrue)
+		So(bodyHTML(item), ShouldEqual, "<p>Fits &lt;most&gt; trucks</p><ul><li>First</li><li>Second</li></ul>")
+	})
+
+	Convey("Testing cart formats", t, func() {
+		So(Formats(), ShouldResemble, []string{"bigcommerce", "magento", "shopify", "woocommerce"})
+		item := newExportItem(cp, part)
+
+		for _, name := range Formats() {
+			f, ok := GetFormatter(name)
+			So(ok, ShouldBeTrue)
+			for _, row := range f.Rows(item) {
+				So(len(row), ShouldEqual, len(f.Header(units.Imperial)))
+			}
+			for _, row := range f.Remove(item) {
+				So(len(row), ShouldEqual, len(f.Header(units.Imperial)))
+			}
+		}
+
+		rows := Shopify{}.Rows(item)
+		So(len(rows), ShouldEqual, 2)
+		So(rows[0][0], ShouldEqual, "11000")
+		So(rows[0][13], ShouldEqual, "199.99")
+		So(rows[0][14], ShouldEqual, "249.99")
+		So(rows[0][10], ShouldEqual, "10000")
+		So(rows[1][18], ShouldEqual, item.Images[1])
+		So(rows[1][19], ShouldEqual, "2")
+
+		row := WooCommerce{}.Rows(item)[0]
+		So(row[0], ShouldEqual, "42")
+		So(row[8], ShouldEqual, "2026-07-01")
+		So(row[10], ShouldEqual, "249.99")
+		So(row[11], ShouldEqual, "199.99")
+
+		row = Magento{}.Rows(item)[0]
+		So(row[12], ShouldEqual, "249.99")
+		So(row[13], ShouldEqual, "199.99")
+		So(row[16], ShouldEqual, "curt-11000")
+		So(row[21], ShouldEqual, "upc=012345678905")
+
+		item.SaleStart, item.SaleEnd = nil, nil
+		row = BigCommerce{}.Rows(item)[0]
+		So(row[1], ShouldEqual, "42")
+		So(row[7], ShouldEqual, "199.99")
+		So(row[9], ShouldEqual, "")
+		So(row[10], ShouldEqual, "22.05")
+	})
+
+	Convey("Testing metric cart exports", t, func() {
+		item := newExportItem(cp, part)
+		item.System = units.Metric
+		So(WooCommerce{}.Header(units.Metric)[14], ShouldEqual, "Weight (kg)")
+		So(WooCommerce{}.Rows(item)[0][14], ShouldEqual, "10")
+		So(Shopify{}.Rows(item)[0][10], ShouldEqual, "10000")
+	})
+
+	Convey("Testing delta exports", t, func() {
+		other := cp
+		other.PartID, other.PartNumber = 11001, "11001"
+		items := []ExportItem{newExportItem(cp, part), newExportItem(other, part)}
+
+		rows, hashes := changedRows(Shopify{}, items, nil)
+		So(len(rows), ShouldEqual, 2)
+		So(len(hashes), ShouldEqual, 2)
+
+		rows, _ = changedRows(Shopify{}, items, hashes)
+		So(rows, ShouldBeEmpty)
+
+		items[1].Price = 189.99
+		rows, next := changedRows(Shopify{}, items, hashes)
+		So(len(rows), ShouldEqual, 1)
+		So(rows[0][0][9], ShouldEqual, "11001")
+		So(next["11000"], ShouldEqual, hashes["11000"])
+		So(next["11001"], ShouldNotEqual, hashes["11001"])
+
+		// parts no longer exported are removed once, and only when
+		// their references were kept
+		last := &export{
+			Hashes: hashes,
+			Refs:   map[string]exportRef{"11001": {PartNumber: "11001", CartReference: 43, Title: "Hitch"}},
+		}
+		_, next = changedRows(Shopify{}, items[:1], hashes)
+		removed := removedRows(WooCommerce{}, last, next)
+		So(len(removed), ShouldEqual, 1)
+		So(removed[0][0][0], ShouldEqual, "43")
+		So(removed[0][0][2], ShouldEqual, "11001")
+		So(removed[0][0][5], ShouldEqual, "-1")
+		So(removedRows(WooCommerce{}, last, hashes), ShouldBeEmpty)
+		last.Refs = nil
+		So(removedRows(WooCommerce{}, last, next), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,395 @@
+package cartIntegration
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/webhook"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// JobCollectionName holds an audit record of every bulk price job.
+	JobCollectionName = "cart_price_jobs"
+
+	ResetToMap       = "resetToMap"
+	GlobalPercentage = "global"
+
+	JobApplied  = "applied"
+	JobReverted = "reverted"
+)
+
+var (
+	ErrJobNotFound = errors.New("price job not found")
+	ErrJobReverted = errors.New("price job was already reverted")
+
+	setCustomerPrice = `UPDATE CustomerPricing SET price = ? WHERE cust_price_id = ?`
+	// the revert statements only touch prices the job left as they are
+	revertCustomerPrice = `UPDATE CustomerPricing SET price = ? WHERE cust_price_id = ? AND ROUND(price, 2) = ROUND(?, 2)`
+	revertCreatedPrice  = `DELETE FROM CustomerPricing WHERE cust_price_id = ? AND ROUND(price, 2) = ROUND(?, 2)`
+)
+
+// Job is a change to many of a customer's prices at once. Dry runs
+// return one without storing or applying it.
+type Job struct {
+	ID         bson.ObjectId `bson:"_id,omitempty" json:"id,omitempty" xml:"id,omitempty"`
+	Type       string        `bson:"type" json:"type" xml:"type"`
+	CustomerID int           `bson:"customer_id" json:"custId" xml:"custId"`
+	BrandID    int           `bson:"brand_id" json:"brandId" xml:"brandId"`
+	UserID     string        `bson:"user_id" json:"userId,omitempty" xml:"userId,omitempty"`
+	PriceType  string        `bson:"price_type,omitempty" json:"priceType,omitempty" xml:"priceType,omitempty"`
+	Percentage float64       `bson:"percentage,omitempty" json:"percentage,omitempty" xml:"percentage,omitempty"`
+	DryRun     bool          `bson:"-" json:"dryRun,omitempty" xml:"dryRun,omitempty"`
+	Status     string        `bson:"status" json:"status,omitempty" xml:"status,omitempty"`
+	CreatedAt  time.Time     `bson:"created_at" json:"createdAt" xml:"createdAt"`
+	RevertedAt *time.Time    `bson:"reverted_at,omitempty" json:"revertedAt,omitempty" xml:"revertedAt,omitempty"`
+	Violations int           `bson:"violations" json:"mapViolations" xml:"mapViolations"`
+	Changes    []PriceChange `bson:"changes,omitempty" json:"changes,omitempty" xml:"changes>change,omitempty"`
+	// Rejected are the changes left out for going below an enforced MAP
+	// price the customer isn't exempt from.
+	Rejected []PriceChange `bson:"rejected,omitempty" json:"rejected,omitempty" xml:"rejected>change,omitempty"`
+	// Skipped are the changes a revert left alone, because the price
+	// was changed again or removed after the job.
+	Skipped []PriceChange `bson:"skipped,omitempty" json:"skipped,omitempty" xml:"skipped>change,omitempty"`
+}
+
+// PriceChange is what a job does to the price of one part. Created
+// prices didn't exist before and are removed again on revert.
+type PriceChange struct {
+	PartID          int     `bson:"part_id" json:"partId" xml:"partId"`
+	PartNumber      string  `bson:"part_number" json:"partNumber" xml:"partNumber"`
+	CustomerPriceID int     `bson:"customer_price_id" json:"customerPriceId,omitempty" xml:"customerPriceId,omitempty"`
+	Created         bool    `bson:"created" json:"created,omitempty" xml:"created,omitempty"`
+	OldPrice        float64 `bson:"old_price" json:"oldPrice" xml:"oldPrice"`
+	NewPrice        float64 `bson:"new_price" json:"newPrice" xml:"newPrice"`
+	Delta           float64 `bson:"delta" json:"delta" xml:"delta"`
+	MapPrice        float64 `bson:"map_price,omitempty" json:"mapPrice,omitempty" xml:"mapPrice,omitempty"`
+	MapViolation    bool    `bson:"map_violation,omitempty" json:"mapViolation,omitempty" xml:"mapViolation,omitempty"`
+}
+
+// ResetAllToMap sets every price of dtx's customer to the part's MAP
+// price.
+func ResetAllToMap(dtx *apicontext.DataContext, dryRun bool) (*Job, error) {
+	job := newJob(ResetToMap, dtx, dryRun)
+	err := job.run(dtx, func(cp CustomerPrice, maps map[int]float64) float64 {
+		return maps[cp.PartID]
+	})
+	return job, err
+}
+
+// GlobalPercent sets every price of dtx's customer to a percentage of
+// the part's price of a type, e.g. 90 percent of "List".
+func GlobalPercent(dtx *apicontext.DataContext, priceType string, percent float64, dryRun bool) (*Job, error) {
+	prices, err := GetPartPrices(dtx)
+	if err != nil {
+		return nil, err
+	}
+	base := make(map[int]float64)
+	for _, p := range prices {
+		if strings.EqualFold(p.Type, priceType) {
+			base[p.PartID] = p.Price
+		}
+	}
+
+	job := newJob(GlobalPercentage, dtx, dryRun)
+	job.PriceType = priceType
+	job.Percentage = percent
+	err = job.run(dtx, func(cp CustomerPrice, _ map[int]float64) float64 {
+		return pricing.Round(base[cp.PartID] * percent / 100)
+	})
+	return job, err
+}
+
+// Jobs returns the latest bulk price jobs of dtx's customer, without
+// their changes.
+func Jobs(dtx *apicontext.DataContext) ([]Job, error) {
+	jobs := make([]Job, 0)
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return jobs, err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(JobCollectionName).Find(bson.M{"customer_id": dtx.CustomerID}).Select(bson.M{"changes": 0}).Sort("-created_at").Limit(100).All(&jobs)
+	return jobs, err
+}
+
+// GetJob loads a bulk price job of dtx's customer.
+func GetJob(id bson.ObjectId, dtx *apicontext.DataContext) (*Job, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var job Job
+	err = session.DB(database.ProductDatabase).C(JobCollectionName).Find(bson.M{"_id": id, "customer_id": dtx.CustomerID}).One(&job)
+	if err == mgo.ErrNotFound {
+		return nil, ErrJobNotFound
+	}
+	return &job, err
+}
+
+// RevertJob restores the prices a job replaced and removes the ones it
+// created, in one transaction. Prices that no longer are what the job
+// set them to were changed since, by a later job or by hand, and are
+// left alone and listed in Skipped.
+func RevertJob(id bson.ObjectId, dtx *apicontext.DataContext) (*Job, error) {
+	job, err := GetJob(id, dtx)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == JobReverted {
+		return job, ErrJobReverted
+	}
+
+	db, err := initDB()
+	if err != nil {
+		return job, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return job, err
+	}
+	var skipped []PriceChange
+	for _, c := range job.Changes {
+		var res sql.Result
+		if c.Created {
+			res, err = tx.Exec(revertCreatedPrice, c.CustomerPriceID, c.NewPrice)
+		} else {
+			res, err = tx.Exec(revertCustomerPrice, c.OldPrice, c.CustomerPriceID, c.NewPrice)
+		}
+		if err != nil {
+			tx.Rollback()
+			return job, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			skipped = append(skipped, c)
+		}
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		tx.Rollback()
+		return job, err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(JobCollectionName)
+
+	// the status only changes from applied once, so a job can't be
+	// reverted twice at the same time
+	now := time.Now()
+	err = col.Update(bson.M{"_id": job.ID, "status": JobApplied}, bson.M{"$set": bson.M{"status": JobReverted, "reverted_at": now, "skipped": skipped}})
+	if err != nil {
+		tx.Rollback()
+		if err == mgo.ErrNotFound {
+			return job, ErrJobReverted
+		}
+		return job, err
+	}
+	if err = tx.Commit(); err != nil {
+		col.Update(bson.M{"_id": job.ID}, bson.M{"$set": bson.M{"status": JobApplied}, "$unset": bson.M{"reverted_at": "", "skipped": ""}})
+		return job, err
+	}
+
+	job.Status = JobReverted
+	job.RevertedAt = &now
+	job.Skipped = skipped
+	go publishPrices(job.published())
+	return job, nil
+}
+
+func newJob(typ string, dtx *apicontext.DataContext, dryRun bool) *Job {
+	return &Job{
+		Type:       typ,
+		CustomerID: dtx.CustomerID,
+		BrandID:    dtx.BrandID,
+		UserID:     dtx.UserID,
+		DryRun:     dryRun,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// run works out the job's changes with target, which gives the new
+// price of a part, and unless it's a dry run applies and records them.
+func (j *Job) run(dtx *apicontext.DataContext, target func(CustomerPrice, map[int]float64) float64) error {
+	custPrices, err := GetCustomerPrices(dtx)
+	if err != nil {
+		return err
+	}
+	prices, err := GetMAPPartPrices(dtx)
+	if err != nil {
+		return err
+	}
+	maps := make(map[int]float64)
+	for _, p := range prices {
+		maps[p.PartID] = p.Price
+	}
+
+	policy, err := pricing.LoadMAPPolicy(dtx.BrandID)
+	if err != nil {
+		return err
+	}
+	j.Changes, j.Rejected = enforce(plan(custPrices, maps, func(cp CustomerPrice) float64 {
+		return target(cp, maps)
+	}), custPrices, policy, j.CustomerID, time.Now())
+	for _, c := range j.Changes {
+		if c.MapViolation {
+			j.Violations++
+		}
+	}
+	if j.DryRun {
+		return nil
+	}
+	return j.apply()
+}
+
+// plan lists the price changes to make. Parts without a new price are
+// left alone, as are prices that wouldn't change.
+func plan(custPrices []CustomerPrice, maps map[int]float64, target func(CustomerPrice) float64) []PriceChange {
+	changes := make([]PriceChange, 0)
+	for _, cp := range custPrices {
+		price := target(cp)
+		if price <= 0 || (cp.ID > 0 && price == cp.Price) {
+			continue
+		}
+		c := PriceChange{
+			PartID:          cp.PartID,
+			PartNumber:      cp.PartNumber,
+			CustomerPriceID: cp.ID,
+			Created:         cp.ID == 0,
+			OldPrice:        cp.Price,
+			NewPrice:        price,
+			Delta:           pricing.Round(price - cp.Price),
+			MapPrice:        maps[cp.PartID],
+		}
+		c.MapViolation = c.MapPrice > 0 && c.NewPrice < c.MapPrice
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// enforce splits changes into those the MAP policy allows and those it
+// rejects, checking each new price over the sale dates of its price.
+func enforce(changes []PriceChange, custPrices []CustomerPrice, policy mapChecker, customerID int, now time.Time) ([]PriceChange, []PriceChange) {
+	byPart := make(map[int]CustomerPrice)
+	for _, cp := range custPrices {
+		byPart[cp.PartID] = cp
+	}
+
+	allowed := make([]PriceChange, 0, len(changes))
+	var rejected []PriceChange
+	for _, c := range changes {
+		cp := byPart[c.PartID]
+		if policy.Check(customerID, c.PartID, c.NewPrice, cp.SaleStart, cp.SaleEnd, now) != nil {
+			rejected = append(rejected, c)
+			continue
+		}
+		allowed = append(allowed, c)
+	}
+	return allowed, rejected
+}
+
+// apply writes the job's changes in a transaction and records the job,
+// so a job is only kept when its changes were made.
+func (j *Job) apply() error {
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for i := range j.Changes {
+		c := &j.Changes[i]
+		if !c.Created {
+			if _, err = tx.Exec(setCustomerPrice, c.NewPrice, c.CustomerPriceID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			continue
+		}
+
+		res, err := tx.Exec(insertCustomerPrice, j.CustomerID, c.PartID, c.NewPrice, 0, nil, nil)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		c.CustomerPriceID = int(id)
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(JobCollectionName)
+
+	j.ID = bson.NewObjectId()
+	j.Status = JobApplied
+	if err = col.Insert(j); err != nil {
+		tx.Rollback()
+		j.ID, j.Status = "", ""
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		col.RemoveId(j.ID)
+		j.ID, j.Status = "", ""
+		return err
+	}
+	go publishPrices(j.published())
+	return nil
+}
+
+// published is the price.changed data of the prices the job set, or of
+// those it put back when it was reverted, at 0 where it removed them.
+func (j *Job) published() []webhook.PriceChange {
+	skipped := make(map[int]bool, len(j.Skipped))
+	for _, c := range j.Skipped {
+		skipped[c.CustomerPriceID] = true
+	}
+	changes := make([]webhook.PriceChange, 0, len(j.Changes))
+	for _, c := range j.Changes {
+		if skipped[c.CustomerPriceID] {
+			continue
+		}
+		price := c.NewPrice
+		if j.Status == JobReverted {
+			price = c.OldPrice
+			if c.Created {
+				price = 0
+			}
+		}
+		changes = append(changes, webhook.PriceChange{PartID: c.PartID, CustomerID: j.CustomerID, Source: webhook.SourceCustomer, Price: price})
+	}
+	return changes
+}
+
+// publishPrices sends price.changed for prices written together one
+// after another, rather than all at once.
+func publishPrices(changes []webhook.PriceChange) {
+	for _, c := range changes {
+		if err := webhook.Publish(webhook.PriceChanged, c.CustomerID, c); err != nil {
+			log.Printf("failed to publish price change webhooks: %s", err.Error())
+			return
+		}
+	}
+}
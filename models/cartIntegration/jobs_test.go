@@ -0,0 +1,71 @@
+package cartIntegration
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPlan(t *testing.T) {
+	custPrices := []CustomerPrice{
+		{ID: 1, PartID: 11000, PartNumber: "11000", Price: 150},
+		{ID: 2, PartID: 11001, PartNumber: "11001", Price: 90},
+		{PartID: 11002, PartNumber: "11002"},
+		{ID: 3, PartID: 11003, PartNumber: "11003", Price: 40},
+	}
+	maps := map[int]float64{11000: 120, 11001: 90, 11002: 60}
+
+	Convey("Testing plan", t, func() {
+		changes := plan(custPrices, maps, func(cp CustomerPrice) float64 {
+			return maps[cp.PartID]
+		})
+
+		// 11001 is already at MAP and 11003 has no MAP price
+		So(len(changes), ShouldEqual, 2)
+		So(changes[0].PartID, ShouldEqual, 11000)
+		So(changes[0].OldPrice, ShouldEqual, 150.0)
+		So(changes[0].NewPrice, ShouldEqual, 120.0)
+		So(changes[0].Delta, ShouldEqual, -30.0)
+		So(changes[0].Created, ShouldBeFalse)
+		So(changes[1].PartID, ShouldEqual, 11002)
+		So(changes[1].Created, ShouldBeTrue)
+		So(changes[1].MapViolation, ShouldBeFalse)
+
+		changes = plan(custPrices, maps, func(cp CustomerPrice) float64 {
+			return maps[cp.PartID] * 0.9
+		})
+		So(len(changes), ShouldEqual, 3)
+		for _, c := range changes {
+			So(c.MapViolation, ShouldBeTrue)
+			So(c.MapPrice, ShouldEqual, maps[c.PartID])
+		}
+	})
+	Convey("Testing enforce", t, func() {
+		changes := plan(custPrices, maps, func(cp CustomerPrice) float64 {
+			return maps[cp.PartID] * 0.9
+		})
+		allowed, rejected := enforce(changes, custPrices, fakeMAP{11000: 120}, 1, time.Now())
+		So(len(allowed), ShouldEqual, 2)
+		So(len(rejected), ShouldEqual, 1)
+		So(rejected[0].PartID, ShouldEqual, 11000)
+	})
+	Convey("Testing published", t, func() {
+		j := Job{CustomerID: 1, Status: JobApplied, Changes: []PriceChange{
+			{PartID: 11000, CustomerPriceID: 1, OldPrice: 150, NewPrice: 120},
+			{PartID: 11002, CustomerPriceID: 4, Created: true, NewPrice: 60},
+		}}
+		changes := j.published()
+		So(len(changes), ShouldEqual, 2)
+		So(changes[0].CustomerID, ShouldEqual, 1)
+		So(changes[0].Price, ShouldEqual, 120.0)
+		So(changes[1].Price, ShouldEqual, 60.0)
+
+		j.Status = JobReverted
+		j.Skipped = []PriceChange{j.Changes[1]}
+		changes = j.published()
+		So(len(changes), ShouldEqual, 1)
+		So(changes[0].PartID, ShouldEqual, 11000)
+		So(changes[0].Price, ShouldEqual, 150.0)
+	})
+}
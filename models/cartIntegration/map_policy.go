@@ -0,0 +1,102 @@
+package cartIntegration
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/curt-labs/API/models/pricing"
+)
+
+var getBrandCustomerPrices = `select cp.cust_price_id, cp.cust_id, c.name, p.partID, p.oldPartNumber, cp.price, cp.sale_start, cp.sale_end from CustomerPricing as cp
+	join Part as p on p.partID = cp.partID
+	left join Customer as c on c.cust_id = cp.cust_id
+	where p.brandID = ? && (? = 0 || cp.cust_id = ?)
+	order by cp.cust_id, p.oldPartNumber`
+
+// mapChecker checks prices against MAP; a *pricing.MAPPolicy is one.
+type mapChecker interface {
+	Check(customerID, partID int, price float64, start, end *time.Time, now time.Time) *pricing.Violation
+}
+
+// CustomerViolations are the customer prices of a brand below their
+// part's enforced MAP price.
+type CustomerViolations struct {
+	CustomerID int            `json:"custId" xml:"custId"`
+	Name       string         `json:"name" xml:"name"`
+	BrandID    int            `json:"brandId" xml:"brandId"`
+	Violations []MAPViolation `json:"violations" xml:"violations>violation"`
+}
+
+// MAPViolation is a customer price below MAP and when it is.
+type MAPViolation struct {
+	CustomerPriceID int        `json:"customerPriceId" xml:"customerPriceId"`
+	PartID          int        `json:"partId" xml:"partId"`
+	PartNumber      string     `json:"partNumber" xml:"partNumber"`
+	Price           float64    `json:"price" xml:"price"`
+	MapPrice        float64    `json:"mapPrice" xml:"mapPrice"`
+	Shortfall       float64    `json:"shortfall" xml:"shortfall"`
+	EffectiveAt     time.Time  `json:"effectiveAt" xml:"effectiveAt"`
+	SaleStart       *time.Time `json:"saleStart,omitempty" xml:"saleStart,omitempty"`
+	SaleEnd         *time.Time `json:"saleEnd,omitempty" xml:"saleEnd,omitempty"`
+}
+
+// checkMAP returns the violation of the price, as an error, when it's
+// below its part's enforced MAP price at the time it takes effect.
+func (c *CustomerPrice) checkMAP() error {
+	policy, err := pricing.LoadMAPPolicy(0, c.PartID)
+	if err != nil {
+		return err
+	}
+	if v := policy.Check(c.CustID, c.PartID, c.Price, c.SaleStart, c.SaleEnd, time.Now()); v != nil {
+		return v
+	}
+	return nil
+}
+
+// MAPViolations reports the prices of a brand's parts below enforced MAP
+// at, or when they take effect after at, by customer. A customerID of 0
+// reports every customer.
+func MAPViolations(brandID, customerID int, at time.Time) ([]CustomerViolations, error) {
+	report := make([]CustomerViolations, 0)
+	policy, err := pricing.LoadMAPPolicy(brandID)
+	if err != nil {
+		return report, err
+	}
+
+	db, err := initDB()
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(getBrandCustomerPrices, brandID, customerID, customerID)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var custID int
+		var name sql.NullString
+		var v MAPViolation
+		if err = rows.Scan(&v.CustomerPriceID, &custID, &name, &v.PartID, &v.PartNumber, &v.Price, &v.SaleStart, &v.SaleEnd); err != nil {
+			return report, err
+		}
+		// sales that are over are no longer in effect
+		if v.SaleEnd != nil && v.SaleEnd.Before(at) {
+			continue
+		}
+		mv := policy.Check(custID, v.PartID, v.Price, v.SaleStart, v.SaleEnd, at)
+		if mv == nil {
+			continue
+		}
+		v.MapPrice, v.Shortfall, v.EffectiveAt = mv.MapPrice, mv.Shortfall, mv.EffectiveAt
+
+		if n := len(report); n == 0 || report[n-1].CustomerID != custID {
+			report = append(report, CustomerViolations{CustomerID: custID, Name: name.String, BrandID: brandID})
+		}
+		cv := &report[len(report)-1]
+		cv.Violations = append(cv.Violations, v)
+	}
+	return report, rows.Err()
+}
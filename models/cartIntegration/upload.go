@@ -0,0 +1,763 @@
+package cartIntegration
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/helpers/xlsx"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/webhook"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// UploadCollectionName holds the price file uploads and their
+	// progress, UploadErrorCollectionName the rows they couldn't import.
+	UploadCollectionName      = "cart_upload_jobs"
+	UploadErrorCollectionName = "cart_upload_errors"
+
+	CSV  = "csv"
+	XLSX = "xlsx"
+
+	UploadQueued     = "queued"
+	UploadProcessing = "processing"
+	UploadCompleted  = "completed"
+	UploadFailed     = "failed"
+
+	// progressInterval is how many rows are processed between saves of
+	// an upload's progress and row errors.
+	progressInterval = 100
+
+	// staleUpload is how long a queued or processing upload can go
+	// without saving its progress before it's taken as interrupted.
+	staleUpload = 15 * time.Minute
+)
+
+var (
+	ErrUploadNotFound    = errors.New("price upload not found")
+	ErrUploadInterrupted = errors.New("the upload was interrupted before it finished; upload the file again")
+
+	getBrandParts = `select partId, oldPartNumber from Part where brandID = ?`
+
+	// DefaultMapping is the layout of the price file download: part
+	// number, customer part ID, price, sale start and sale end, without
+	// a header row.
+	DefaultMapping = ColumnMapping{
+		PartNumber:     "A",
+		CustomerPartID: "B",
+		Price:          "C",
+		SaleStart:      "D",
+		SaleEnd:        "E",
+	}
+)
+
+// UploadJob is a price file being imported in the background.
+type UploadJob struct {
+	ID            bson.ObjectId `bson:"_id" json:"id" xml:"id"`
+	CustomerID    int           `bson:"customer_id" json:"custId" xml:"custId"`
+	BrandID       int           `bson:"brand_id" json:"brandId" xml:"brandId"`
+	UserID        string        `bson:"user_id" json:"userId,omitempty" xml:"userId,omitempty"`
+	FileName      string        `bson:"file_name" json:"fileName" xml:"fileName"`
+	Format        string        `bson:"format" json:"format" xml:"format"`
+	Mapping       ColumnMapping `bson:"mapping" json:"mapping" xml:"mapping"`
+	Status        string        `bson:"status" json:"status" xml:"status"`
+	TotalRows     int           `bson:"total_rows" json:"totalRows" xml:"totalRows"`
+	ProcessedRows int           `bson:"processed_rows" json:"processedRows" xml:"processedRows"`
+	Imported      int           `bson:"imported" json:"imported" xml:"imported"`
+	Failed        int           `bson:"failed" json:"failed" xml:"failed"`
+	CreatedAt     time.Time     `bson:"created_at" json:"createdAt" xml:"createdAt"`
+	StartedAt     *time.Time    `bson:"started_at,omitempty" json:"startedAt,omitempty" xml:"startedAt,omitempty"`
+	FinishedAt    *time.Time    `bson:"finished_at,omitempty" json:"finishedAt,omitempty" xml:"finishedAt,omitempty"`
+	UpdatedAt     time.Time     `bson:"updated_at" json:"updatedAt" xml:"updatedAt"`
+	Error         string        `bson:"error,omitempty" json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// RowError is why a row of an upload wasn't imported. Row counts from
+// 1 and includes the header row, so it matches the dealer's file.
+type RowError struct {
+	JobID      bson.ObjectId `bson:"job_id" json:"-" xml:"-"`
+	Row        int           `bson:"row" json:"row" xml:"row"`
+	PartNumber string        `bson:"part_number" json:"partNumber" xml:"partNumber"`
+	Column     string        `bson:"column,omitempty" json:"column,omitempty" xml:"column,omitempty"`
+	Message    string        `bson:"message" json:"message" xml:"message"`
+	Values     []string      `bson:"values" json:"values" xml:"values>value"`
+}
+
+// ColumnMapping says which column of a price file holds which value.
+// Columns are letters, or with Header set the names in the first row,
+// compared without case. Part number and price are required.
+type ColumnMapping struct {
+	PartNumber     string `bson:"part_number" json:"partNumber" xml:"partNumber"`
+	CustomerPartID string `bson:"customer_part_id,omitempty" json:"customerPartId,omitempty" xml:"customerPartId,omitempty"`
+	Price          string `bson:"price" json:"price" xml:"price"`
+	SaleStart      string `bson:"sale_start,omitempty" json:"saleStart,omitempty" xml:"saleStart,omitempty"`
+	SaleEnd        string `bson:"sale_end,omitempty" json:"saleEnd,omitempty" xml:"saleEnd,omitempty"`
+	Header         bool   `bson:"header" json:"header" xml:"header"`
+}
+
+// columns are the indexes of a mapping's columns, -1 when not mapped.
+type columns struct {
+	partNumber, customerPartID, price, saleStart, saleEnd int
+}
+
+// rowReader reads a price file a row at a time; csv.Reader and
+// xlsx.Reader both are one.
+type rowReader interface {
+	Read() ([]string, error)
+}
+
+// lookups are what rows are checked against and matched to.
+type lookups struct {
+	customerID   int
+	parts        map[string]int // part number to part ID
+	policy       mapChecker
+	now          time.Time
+	prices       map[int]int // part ID to customer price ID
+	integrations map[int]int // part ID to customer part ID
+	seen         map[string]int
+	published    []webhook.PriceChange // prices saved, for price.changed
+}
+
+// NewUpload queues a price file for import and returns its job. The file
+// is copied, so r only needs to last for the call.
+func NewUpload(dtx *apicontext.DataContext, fileName string, r io.Reader, mapping *ColumnMapping) (*UploadJob, error) {
+	if mapping == nil {
+		m := DefaultMapping
+		mapping = &m
+	}
+	if mapping.PartNumber == "" || mapping.Price == "" {
+		return nil, errors.New("the column mapping needs a part number and a price column")
+	}
+	if !mapping.Header {
+		if _, err := mapping.columns(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	job := &UploadJob{
+		ID:         bson.NewObjectId(),
+		CustomerID: dtx.CustomerID,
+		BrandID:    dtx.BrandID,
+		UserID:     dtx.UserID,
+		FileName:   fileName,
+		Format:     CSV,
+		Mapping:    *mapping,
+		Status:     UploadQueued,
+		CreatedAt:  time.Now(),
+	}
+	job.UpdatedAt = job.CreatedAt
+
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(4); string(magic) == "PK\x03\x04" || strings.EqualFold(filepath.Ext(fileName), ".xlsx") {
+		job.Format = XLSX
+	}
+
+	tmp, err := ioutil.TempFile("", "cart-upload-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(tmp, br); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	tmp.Close()
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	defer session.Close()
+
+	if err = session.DB(database.ProductDatabase).C(UploadCollectionName).Insert(job); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	// the request's context is gone by the time the import runs
+	ctx := &apicontext.DataContext{
+		CustomerID: dtx.CustomerID,
+		BrandID:    dtx.BrandID,
+		UserID:     dtx.UserID,
+		APIKey:     dtx.APIKey,
+	}
+	// the import works on its own copy, so the job returned isn't
+	// changed under the caller
+	j := *job
+	go j.process(ctx, tmp.Name())
+
+	return job, nil
+}
+
+// Uploads returns the latest price file uploads of dtx's customer.
+func Uploads(dtx *apicontext.DataContext) ([]UploadJob, error) {
+	jobs := make([]UploadJob, 0)
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return jobs, err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(UploadCollectionName).Find(bson.M{"customer_id": dtx.CustomerID}).Sort("-created_at").Limit(100).All(&jobs)
+	return jobs, err
+}
+
+// GetUpload loads a price file upload of dtx's customer, with its
+// progress so far.
+func GetUpload(id bson.ObjectId, dtx *apicontext.DataContext) (*UploadJob, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var job UploadJob
+	err = session.DB(database.ProductDatabase).C(UploadCollectionName).Find(bson.M{"_id": id, "customer_id": dtx.CustomerID}).One(&job)
+	if err == mgo.ErrNotFound {
+		return nil, ErrUploadNotFound
+	}
+	return &job, err
+}
+
+// UploadErrors returns the rows of a price file upload that weren't
+// imported, in file order.
+func UploadErrors(id bson.ObjectId, dtx *apicontext.DataContext) ([]RowError, error) {
+	errs := make([]RowError, 0)
+	if _, err := GetUpload(id, dtx); err != nil {
+		return errs, err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return errs, err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(UploadErrorCollectionName).Find(bson.M{"job_id": id}).Sort("row").All(&errs)
+	return errs, err
+}
+
+// process imports the file at path, saving the job's progress and the
+// rows it can't import as it goes, and removes the file when done.
+func (j *UploadJob) process(dtx *apicontext.DataContext, path string) {
+	defer os.Remove(path)
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		// the job can only be failed through another session; when
+		// that can't be had either, RecoverUploads fails it later
+		failUpload(j.ID, err)
+		return
+	}
+	defer session.Close()
+	jobs := session.DB(database.ProductDatabase).C(UploadCollectionName)
+	rowErrors := session.DB(database.ProductDatabase).C(UploadErrorCollectionName)
+
+	fail := func(err error) {
+		now := time.Now()
+		j.Status = UploadFailed
+		j.Error = err.Error()
+		j.FinishedAt = &now
+		j.UpdatedAt = now
+		if err := jobs.UpdateId(j.ID, j); err != nil {
+			log.Printf("failed to save failed price upload %s: %s", j.ID.Hex(), err.Error())
+		}
+	}
+
+	now := time.Now()
+	j.Status = UploadProcessing
+	j.StartedAt = &now
+	if j.TotalRows, err = j.count(path); err != nil {
+		fail(err)
+		return
+	}
+	j.UpdatedAt = time.Now()
+	if err = jobs.UpdateId(j.ID, j); err != nil {
+		fail(err)
+		return
+	}
+
+	lk, err := load(dtx)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer func() {
+		go publishPrices(lk.published)
+	}()
+
+	db, err := initDB()
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer db.Close()
+
+	rr, closer, err := openRows(path, j.Format)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer closer.Close()
+
+	var cols columns
+	if !j.Mapping.Header {
+		cols, _ = j.Mapping.columns(nil)
+	}
+
+	var pending []interface{}
+	flush := func() error {
+		if len(pending) > 0 {
+			if err := rowErrors.Insert(pending...); err != nil {
+				return err
+			}
+			pending = pending[:0]
+		}
+		j.UpdatedAt = time.Now()
+		return jobs.UpdateId(j.ID, bson.M{"$set": bson.M{"processed_rows": j.ProcessedRows, "imported": j.Imported, "failed": j.Failed, "updated_at": j.UpdatedAt}})
+	}
+
+	row := 0
+	for {
+		values, err := rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		row++
+
+		if j.Mapping.Header && row == 1 {
+			if cols, err = j.Mapping.columns(values); err != nil {
+				fail(err)
+				return
+			}
+			continue
+		}
+		if blank(values) {
+			continue
+		}
+
+		cp, errs := lk.check(row, values, cols)
+		if len(errs) == 0 {
+			cp.CustID = j.CustomerID
+			if err = lk.save(db, &cp, cols.customerPartID >= 0 && cell(values, cols.customerPartID) != ""); err != nil {
+				errs = append(errs, RowError{Row: row, PartNumber: cell(values, cols.partNumber), Message: err.Error(), Values: values})
+			}
+		}
+
+		j.ProcessedRows++
+		if len(errs) == 0 {
+			j.Imported++
+		} else {
+			j.Failed++
+			for _, e := range errs {
+				e.JobID = j.ID
+				pending = append(pending, e)
+			}
+		}
+
+		if j.ProcessedRows%progressInterval == 0 {
+			if err = flush(); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		fail(err)
+		return
+	}
+	now = time.Now()
+	j.Status = UploadCompleted
+	j.FinishedAt = &now
+	j.UpdatedAt = now
+	if err = jobs.UpdateId(j.ID, j); err != nil {
+		log.Printf("failed to save completed price upload %s: %s", j.ID.Hex(), err.Error())
+	}
+}
+
+// failUpload records why an upload stopped, on a session of its own.
+func failUpload(id bson.ObjectId, cause error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		log.Printf("failed to save failed price upload %s: %s", id.Hex(), err.Error())
+		return
+	}
+	defer session.Close()
+
+	now := time.Now()
+	err = session.DB(database.ProductDatabase).C(UploadCollectionName).UpdateId(id, bson.M{"$set": bson.M{
+		"status":      UploadFailed,
+		"error":       cause.Error(),
+		"finished_at": now,
+		"updated_at":  now,
+	}})
+	if err != nil {
+		log.Printf("failed to save failed price upload %s: %s", id.Hex(), err.Error())
+	}
+}
+
+// RecoverUploads fails the queued and processing uploads that haven't
+// saved their progress since before now less staleUpload; their imports
+// were lost, e.g. to a restart. It returns how many were failed.
+func RecoverUploads(now time.Time) (int, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	cutoff := now.Add(-staleUpload)
+	info, err := session.DB(database.ProductDatabase).C(UploadCollectionName).UpdateAll(bson.M{
+		"status": bson.M{"$in": []string{UploadQueued, UploadProcessing}},
+		"$or": []bson.M{
+			{"updated_at": bson.M{"$lt": cutoff}},
+			// uploads from before updated_at was saved
+			{"updated_at": bson.M{"$exists": false}, "created_at": bson.M{"$lt": cutoff}},
+		},
+	}, bson.M{"$set": bson.M{
+		"status":      UploadFailed,
+		"error":       ErrUploadInterrupted.Error(),
+		"finished_at": now,
+		"updated_at":  now,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Updated, nil
+}
+
+// ScheduleRecovery runs RecoverUploads on the given interval. It blocks,
+// so it should be started in its own goroutine.
+func ScheduleRecovery(interval time.Duration) {
+	for {
+		if n, err := RecoverUploads(time.Now()); err != nil {
+			log.Printf("recovering interrupted price uploads failed: %s\n", err.Error())
+		} else if n > 0 {
+			log.Printf("failed %d interrupted price uploads\n", n)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// count gives the number of non-blank rows to import.
+func (j *UploadJob) count(path string) (int, error) {
+	rr, closer, err := openRows(path, j.Format)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+
+	n := 0
+	for {
+		values, err := rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !blank(values) {
+			n++
+		}
+	}
+	if j.Mapping.Header && n > 0 {
+		n--
+	}
+	return n, nil
+}
+
+func openRows(path, format string) (rowReader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format != XLSX {
+		rr := csv.NewReader(f)
+		rr.FieldsPerRecord = -1
+		rr.TrimLeadingSpace = true
+		return rr, f, nil
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	rr, err := xlsx.NewReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return rr, f, nil
+}
+
+// columns finds the mapping's columns, by letter or in the header row.
+func (m ColumnMapping) columns(header []string) (columns, error) {
+	find := func(name string, col string, required bool) (int, error) {
+		col = strings.TrimSpace(col)
+		if col == "" {
+			if required {
+				return -1, fmt.Errorf("the column mapping needs a %s column", name)
+			}
+			return -1, nil
+		}
+		if !m.Header {
+			i, ok := xlsx.Column(col)
+			if !ok || strings.TrimLeft(strings.ToUpper(col), "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+				return -1, fmt.Errorf("%q isn't a column letter for the %s", col, name)
+			}
+			return i, nil
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), col) {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("there's no %q column in the header row for the %s", col, name)
+	}
+
+	var c columns
+	var err error
+	if c.partNumber, err = find("part number", m.PartNumber, true); err != nil {
+		return c, err
+	}
+	if c.customerPartID, err = find("customer part ID", m.CustomerPartID, false); err != nil {
+		return c, err
+	}
+	if c.price, err = find("price", m.Price, true); err != nil {
+		return c, err
+	}
+	if c.saleStart, err = find("sale start", m.SaleStart, false); err != nil {
+		return c, err
+	}
+	c.saleEnd, err = find("sale end", m.SaleEnd, false)
+	return c, err
+}
+
+// load gets the parts, MAP policy and customer prices rows are checked
+// against.
+func load(dtx *apicontext.DataContext) (*lookups, error) {
+	lk := &lookups{
+		customerID:   dtx.CustomerID,
+		now:          time.Now(),
+		prices:       make(map[int]int),
+		integrations: make(map[int]int),
+		seen:         make(map[string]int),
+	}
+
+	var err error
+	if lk.parts, err = getPartMap(dtx.BrandID); err != nil {
+		return nil, err
+	}
+
+	custPrices, err := GetCustomerPrices(dtx)
+	if err != nil {
+		return nil, err
+	}
+	for _, cp := range custPrices {
+		if cp.ID > 0 && cp.CustID == dtx.CustomerID {
+			lk.prices[cp.PartID] = cp.ID
+		}
+	}
+
+	integrations, err := GetCustomerCartIntegrations(dtx)
+	if err != nil {
+		return nil, err
+	}
+	for _, ci := range integrations {
+		if ci.CustID == dtx.CustomerID {
+			lk.integrations[ci.PartID] = ci.CustomerPartID
+		}
+	}
+
+	if lk.policy, err = pricing.LoadMAPPolicy(dtx.BrandID); err != nil {
+		return nil, err
+	}
+	return lk, nil
+}
+
+// check turns a row into the price to save, or says everything that's
+// wrong with it.
+func (lk *lookups) check(row int, values []string, cols columns) (CustomerPrice, []RowError) {
+	var cp CustomerPrice
+	var errs []RowError
+	partNumber := cell(values, cols.partNumber)
+	bad := func(col int, format string, args ...interface{}) {
+		e := RowError{Row: row, PartNumber: partNumber, Message: fmt.Sprintf(format, args...), Values: values}
+		if col >= 0 {
+			e.Column = columnName(col)
+		}
+		errs = append(errs, e)
+	}
+
+	switch id, ok := lk.parts[partNumber]; {
+	case partNumber == "":
+		bad(cols.partNumber, "missing part number")
+	case !ok:
+		bad(cols.partNumber, "unknown part number %s", partNumber)
+	default:
+		cp.PartID = id
+		cp.PartNumber = partNumber
+		if first, dup := lk.seen[partNumber]; dup {
+			bad(cols.partNumber, "duplicate of row %d", first)
+		} else {
+			lk.seen[partNumber] = row
+		}
+	}
+
+	if s := cell(values, cols.customerPartID); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			bad(cols.customerPartID, "customer part ID %q isn't a whole number", s)
+		}
+		cp.CustomerPartID = id
+	}
+
+	s := strings.Replace(strings.Replace(cell(values, cols.price), "$", "", -1), ",", "", -1)
+	price, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	switch {
+	case err != nil:
+		bad(cols.price, "price %q isn't a number", cell(values, cols.price))
+	case price <= 0:
+		bad(cols.price, "price must be more than zero")
+	default:
+		cp.Price = price
+	}
+
+	if s := cell(values, cols.saleStart); s != "" {
+		t, err := parseUploadDate(s)
+		if err != nil {
+			bad(cols.saleStart, "sale start %q isn't a date", s)
+		} else {
+			cp.SaleStart = &t
+		}
+	}
+	if s := cell(values, cols.saleEnd); s != "" {
+		t, err := parseUploadDate(s)
+		if err != nil {
+			bad(cols.saleEnd, "sale end %q isn't a date", s)
+		} else {
+			cp.SaleEnd = &t
+		}
+	}
+	if cp.SaleStart != nil && cp.SaleEnd != nil && cp.SaleEnd.Before(*cp.SaleStart) {
+		bad(cols.saleEnd, "sale ends before it starts")
+	}
+
+	if cp.PartID > 0 && cp.Price > 0 {
+		if v := lk.policy.Check(lk.customerID, cp.PartID, cp.Price, cp.SaleStart, cp.SaleEnd, lk.now); v != nil {
+			bad(cols.price, "price %.2f is below the enforced MAP price of %.2f on %s", v.Price, v.MapPrice, v.EffectiveAt.Format(DATE_FORMAT))
+		}
+	}
+
+	return cp, errs
+}
+
+// save creates or updates the customer's price of a checked row and, when
+// the row has one, their part ID for it.
+func (lk *lookups) save(db *sql.DB, cp *CustomerPrice, integrate bool) error {
+	if id, ok := lk.prices[cp.PartID]; ok {
+		cp.ID = id
+	}
+	if err := cp.checkSale(db); err != nil {
+		return err
+	}
+	if cp.ID > 0 {
+		if _, err := db.Exec(updateCustomerPrice, cp.Price, cp.IsSale, cp.SaleStart, cp.SaleEnd, cp.ID, cp.CustID); err != nil {
+			return err
+		}
+	} else {
+		res, err := db.Exec(insertCustomerPrice, cp.CustID, cp.PartID, cp.Price, cp.IsSale, cp.SaleStart, cp.SaleEnd)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		cp.ID = int(id)
+		lk.prices[cp.PartID] = cp.ID
+	}
+	lk.published = append(lk.published, cp.change())
+
+	if !integrate {
+		return nil
+	}
+	current, ok := lk.integrations[cp.PartID]
+	if ok && current == cp.CustomerPartID {
+		return nil
+	}
+	var err error
+	if ok {
+		_, err = db.Exec(updateCartIntegration, cp.CustomerPartID, cp.PartID, cp.CustID)
+	} else {
+		_, err = db.Exec(insertCartIntegration, cp.PartID, cp.CustomerPartID, cp.CustID)
+	}
+	if err == nil {
+		lk.integrations[cp.PartID] = cp.CustomerPartID
+	}
+	return err
+}
+
+// parseUploadDate reads a date as written by the download, as a US
+// date, or as an Excel date serial, which is what XLSX files hold.
+func parseUploadDate(s string) (time.Time, error) {
+	for _, layout := range []string{DATE_FORMAT, "1/2/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	serial, err := strconv.ParseFloat(s, 64)
+	if err != nil || serial < 1 || serial > 2958465 {
+		return time.Time{}, errors.New("not a date")
+	}
+	// Excel counts days from 1899-12-30, the day before its fictional
+	// 1900-02-29 included
+	return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(math.Floor(serial))), nil
+}
+
+func cell(values []string, col int) string {
+	if col < 0 || col >= len(values) {
+		return ""
+	}
+	return strings.TrimSpace(values[col])
+}
+
+func blank(values []string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// columnName gives the letters of a zero based column, e.g. 27 is "AB".
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
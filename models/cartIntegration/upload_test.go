@@ -0,0 +1,146 @@
+package cartIntegration
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/curt-labs/API/helpers/xlsx"
+	"github.com/curt-labs/API/models/pricing"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUploadRows(t *testing.T) {
+	Convey("Testing ColumnMapping", t, func() {
+		cols, err := DefaultMapping.columns(nil)
+		So(err, ShouldBeNil)
+		So(cols, ShouldResemble, columns{0, 1, 2, 3, 4})
+
+		m := ColumnMapping{PartNumber: "sku", Price: "Our Price", SaleEnd: "ends", Header: true}
+		cols, err = m.columns([]string{"Ends", "SKU", "Description", " our price "})
+		So(err, ShouldBeNil)
+		So(cols, ShouldResemble, columns{1, -1, 3, -1, 0})
+
+		_, err = m.columns([]string{"SKU", "Price"})
+		So(err, ShouldNotBeNil)
+
+		_, err = ColumnMapping{PartNumber: "A1", Price: "B"}.columns(nil)
+		So(err, ShouldNotBeNil)
+		_, err = ColumnMapping{PartNumber: "A"}.columns(nil)
+		So(err, ShouldNotBeNil)
+
+		So(columnName(0), ShouldEqual, "A")
+		So(columnName(27), ShouldEqual, "AB")
+	})
+
+	Convey("Testing row checks", t, func() {
+		lk := &lookups{
+			customerID: 1,
+			parts:      map[string]int{"11000": 1, "11001": 2},
+			policy:     fakeMAP{2: 50},
+			seen:       make(map[string]int),
+		}
+		cols, _ := DefaultMapping.columns(nil)
+
+		cp, errs := lk.check(1, []string{"11000", "201", "$1,100.00", "2020-01-01", "1/31/2020"}, cols)
+		So(errs, ShouldBeEmpty)
+		So(cp.PartID, ShouldEqual, 1)
+		So(cp.CustomerPartID, ShouldEqual, 201)
+		So(cp.Price, ShouldEqual, 1100.0)
+		So(*cp.SaleEnd, ShouldResemble, time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC))
+
+		_, errs = lk.check(2, []string{"11000", "", "90"}, cols)
+		So(len(errs), ShouldEqual, 1)
+		So(errs[0].Message, ShouldEqual, "duplicate of row 1")
+		So(errs[0].Column, ShouldEqual, "A")
+
+		_, errs = lk.check(3, []string{"99999", "x", "0"}, cols)
+		So(len(errs), ShouldEqual, 3)
+		So(errs[0].Column, ShouldEqual, "A")
+		So(errs[1].Column, ShouldEqual, "B")
+		So(errs[2].Column, ShouldEqual, "C")
+
+		_, errs = lk.check(4, []string{"11001", "", "49.99", "2020-02-01", "2020-01-01"}, cols)
+		So(len(errs), ShouldEqual, 2)
+		So(errs[0].Message, ShouldEqual, "sale ends before it starts")
+		So(errs[0].Column, ShouldEqual, "E")
+		So(errs[0].Row, ShouldEqual, 4)
+		So(errs[1].Message, ShouldContainSubstring, "enforced MAP")
+		So(errs[1].Column, ShouldEqual, "C")
+	})
+
+	Convey("Testing upload dates", t, func() {
+		d, err := parseUploadDate("43831")
+		So(err, ShouldBeNil)
+		So(d, ShouldResemble, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		_, err = parseUploadDate("next week")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Testing XLSX rows", t, func() {
+		b := testWorkbook()
+		rr, err := xlsx.NewReader(bytes.NewReader(b), int64(len(b)))
+		So(err, ShouldBeNil)
+		defer rr.Close()
+
+		var rows [][]string
+		for {
+			row, err := rr.Read()
+			if err == io.EOF {
+				break
+			}
+			So(err, ShouldBeNil)
+			rows = append(rows, row)
+		}
+		So(rows, ShouldResemble, [][]string{
+			{"Part", "Price"},
+			{"11000", "", "inline"},
+			{},
+			{"", "99.5"},
+		})
+	})
+}
+
+// fakeMAP is a MAP policy of enforced MAP prices by part, without
+// scheduled prices or exemptions.
+type fakeMAP map[int]float64
+
+func (f fakeMAP) Check(customerID, partID int, price float64, start, end *time.Time, now time.Time) *pricing.Violation {
+	if m, ok := f[partID]; ok && price < m {
+		return &pricing.Violation{CustomerID: customerID, PartID: partID, Price: price, MapPrice: m, EffectiveAt: now}
+	}
+	return nil
+}
+
+// testWorkbook builds a one sheet workbook with shared and inline strings,
+// a skipped cell and a missing row.
+func testWorkbook() []byte {
+	files := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Prices" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>Part</t></si><si><r><t>Pri</t></r><r><t>ce</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2"><v>11000</v></c><c r="C2" t="inlineStr"><is><t>inline</t></is></c></row>
+<row r="4"><c r="B4"><v>99.5</v></c></row>
+</sheetData></worksheet>`,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(body))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
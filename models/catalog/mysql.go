@@ -0,0 +1,420 @@
+package catalog
+
+import (
+	"database/sql"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/models/brand"
+	"github.com/curt-labs/API/models/products"
+)
+
+var (
+	allPartsStmt      = `select partID from Part order by partID`
+	modifiedPartsStmt = `select partID from Part where dateModified > ? order by partID`
+	partsStmt         = `select p.partID, p.status, p.dateAdded, p.dateModified, p.shortDesc, p.oldPartNumber, p.priceCode, p.featured, p.ACESPartTypeID, p.brandID, pc.classID, pc.class, pc.image
+						from Part as p
+						left join Class as pc on p.classID = pc.classID
+						where p.partID in (%s)`
+	partAttributesStmt = `select partID, field, value, sort from PartAttribute
+						where partID in (%s)
+						order by partID, sort`
+	partPricesStmt = `select priceID, partID, priceType, price, enforced, dateModified from Price
+						where partID in (%s)`
+	partCategoriesStmt = `select partID, catID from CatPart
+						where partID in (%s)`
+	partRelatedStmt = `select partID, relatedID from RelatedPart
+						where partID in (%s)`
+	partContentStmt = `select cb.partID, con.text, ct.cTypeID, ct.type, ct.allowHTML from ContentBridge as cb
+						join Content as con on cb.contentID = con.contentID
+						join ContentType as ct on con.cTypeID = ct.cTypeID
+						where cb.partID in (%s) && con.deleted = 0`
+	categoriesStmt = `select catID, parentID, sort, dateAdded, catTitle, shortDesc, longDesc, image, icon, isLifestyle, vehicleSpecific, vehicleRequired, metaTitle, metaDesc, metaKeywords, brandID
+						from Categories`
+	categoryPartsStmt = `select catID, partID from CatPart order by catID, partID`
+)
+
+// tree is the category hierarchy loaded from MySQL.
+type tree struct {
+	categories map[int]products.Category
+	children   map[int][]int
+}
+
+func newTree(cats []products.Category) *tree {
+	t := &tree{
+		categories: make(map[int]products.Category),
+		children:   make(map[int][]int),
+	}
+	for _, c := range cats {
+		t.categories[c.CategoryID] = c
+	}
+	for _, c := range cats {
+		if c.ParentID != c.CategoryID {
+			t.children[c.ParentID] = append(t.children[c.ParentID], c.CategoryID)
+		}
+	}
+	for parent, ids := range t.children {
+		sort.Sort(bySort{ids, t.categories})
+		t.children[parent] = ids
+	}
+	return t
+}
+
+// documents returns every category with its subtree of children, the
+// shape categories are stored in Mongo.
+func (t *tree) documents() []products.Category {
+	var ids []int
+	for id := range t.categories {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	docs := make([]products.Category, 0, len(ids))
+	for _, id := range ids {
+		docs = append(docs, t.subtree(id, make(map[int]bool)))
+	}
+	return docs
+}
+
+// subtree builds a category with its children. The visited set guards
+// against parent cycles in the source data.
+func (t *tree) subtree(id int, visited map[int]bool) products.Category {
+	c := t.categories[id]
+	visited[id] = true
+	c.Children = nil
+	for _, child := range t.children[id] {
+		if visited[child] {
+			continue
+		}
+		c.Children = append(c.Children, t.subtree(child, visited))
+	}
+	return c
+}
+
+// summary is a category as it is embedded on a part, with its
+// breadcrumbs.
+func (t *tree) summary(id int) (products.Category, bool) {
+	c, ok := t.categories[id]
+	c.Children = nil
+	c.PartIDs = nil
+	if ok {
+		c.Breadcrumbs = t.breadcrumbs(id)
+	}
+	return c, ok
+}
+
+// breadcrumbs walks up from a category to its top-level category.
+func (t *tree) breadcrumbs(id int) []products.Breadcrumb {
+	var crumbs []products.Breadcrumb
+	visited := make(map[int]bool)
+	for c, ok := t.categories[id]; ok && !visited[c.CategoryID]; c, ok = t.categories[c.ParentID] {
+		visited[c.CategoryID] = true
+		crumbs = append([]products.Breadcrumb{{
+			ID:    c.CategoryID,
+			Title: c.Title,
+			Slug:  products.CategorySlug(c.Title),
+		}}, crumbs...)
+	}
+	return crumbs
+}
+
+type bySort struct {
+	ids  []int
+	cats map[int]products.Category
+}
+
+func (s bySort) Len() int      { return len(s.ids) }
+func (s bySort) Swap(i, j int) { s.ids[i], s.ids[j] = s.ids[j], s.ids[i] }
+func (s bySort) Less(i, j int) bool {
+	a, b := s.cats[s.ids[i]], s.cats[s.ids[j]]
+	if a.Sort == b.Sort {
+		return a.CategoryID < b.CategoryID
+	}
+	return a.Sort < b.Sort
+}
+
+func modifiedParts(db *sql.DB, since time.Time) ([]int, error) {
+	var rows *sql.Rows
+	var err error
+	if since.IsZero() {
+		rows, err = db.Query(allPartsStmt)
+	} else {
+		rows, err = db.Query(modifiedPartsStmt, since)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func loadCategories(db *sql.DB, brands map[int]brand.Brand) (*tree, error) {
+	rows, err := db.Query(categoriesStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cats []products.Category
+	for rows.Next() {
+		var c products.Category
+		var shortDesc, longDesc, image, icon, metaTitle, metaDesc, metaKeywords *string
+		var brandID int
+		err = rows.Scan(
+			&c.CategoryID,
+			&c.ParentID,
+			&c.Sort,
+			&c.DateAdded,
+			&c.Title,
+			&shortDesc,
+			&longDesc,
+			&image,
+			&icon,
+			&c.IsLifestyle,
+			&c.VehicleSpecific,
+			&c.VehicleRequired,
+			&metaTitle,
+			&metaDesc,
+			&metaKeywords,
+			&brandID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.ShortDesc = deref(shortDesc)
+		c.LongDesc = deref(longDesc)
+		c.Image = parseURL(image)
+		c.Icon = parseURL(icon)
+		c.MetaTitle = deref(metaTitle)
+		c.MetaDescription = deref(metaDesc)
+		c.MetaKeywords = deref(metaKeywords)
+		c.Brand = brands[brandID]
+		cats = append(cats, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	partRows, err := db.Query(categoryPartsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer partRows.Close()
+
+	partIDs := make(map[int][]int)
+	for partRows.Next() {
+		var catID, partID int
+		if err = partRows.Scan(&catID, &partID); err != nil {
+			return nil, err
+		}
+		partIDs[catID] = append(partIDs[catID], partID)
+	}
+	for i := range cats {
+		cats[i].PartIDs = partIDs[cats[i].CategoryID]
+	}
+
+	return newTree(cats), partRows.Err()
+}
+
+// loadParts builds the MySQL owned fields of the given parts.
+func loadParts(db *sql.DB, ids []int, brands map[int]brand.Brand, cats *tree) ([]products.Part, error) {
+	in, args := placeholders(ids)
+
+	rows, err := db.Query(strings.Replace(partsStmt, "%s", in, 1), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := make(map[int]*products.Part)
+	var order []int
+	for rows.Next() {
+		var p products.Part
+		var shortDesc, priceCode, className, classImage *string
+		var classID *int
+		var brandID int
+		err = rows.Scan(
+			&p.ID,
+			&p.Status,
+			&p.DateAdded,
+			&p.DateModified,
+			&shortDesc,
+			&p.PartNumber,
+			&priceCode,
+			&p.Featured,
+			&p.AcesPartTypeID,
+			&brandID,
+			&classID,
+			&className,
+			&classImage,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.ShortDesc = deref(shortDesc)
+		if priceCode != nil {
+			p.PriceCode, _ = strconv.Atoi(*priceCode)
+		}
+		if classID != nil {
+			p.Class = products.Class{ID: *classID, Name: deref(className), Image: deref(classImage)}
+		}
+		p.Brand = brands[brandID]
+		p.Attributes = make([]products.Attribute, 0)
+		p.Pricing = make([]products.Price, 0)
+		p.Content = make([]products.Content, 0)
+		p.Categories = make([]products.Category, 0)
+		p.Related = make([]int, 0)
+
+		parts[p.ID] = &p
+		order = append(order, p.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = eachRow(db, partAttributesStmt, in, args, func(rows *sql.Rows) error {
+		var id int
+		var a products.Attribute
+		if err := rows.Scan(&id, &a.Key, &a.Value, &a.Sort); err != nil {
+			return err
+		}
+		if p, ok := parts[id]; ok {
+			a.Parse()
+			p.Attributes = append(p.Attributes, a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(db, partPricesStmt, in, args, func(rows *sql.Rows) error {
+		var pr products.Price
+		var modified *time.Time
+		if err := rows.Scan(&pr.Id, &pr.PartId, &pr.Type, &pr.Price, &pr.Enforced, &modified); err != nil {
+			return err
+		}
+		if modified != nil {
+			pr.DateModified = *modified
+		}
+		if p, ok := parts[pr.PartId]; ok {
+			p.Pricing = append(p.Pricing, pr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(db, partCategoriesStmt, in, args, func(rows *sql.Rows) error {
+		var id, catID int
+		if err := rows.Scan(&id, &catID); err != nil {
+			return err
+		}
+		p, ok := parts[id]
+		if !ok {
+			return nil
+		}
+		if c, ok := cats.summary(catID); ok {
+			p.Categories = append(p.Categories, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(db, partRelatedStmt, in, args, func(rows *sql.Rows) error {
+		var id, related int
+		if err := rows.Scan(&id, &related); err != nil {
+			return err
+		}
+		if p, ok := parts[id]; ok {
+			p.Related = append(p.Related, related)
+			p.RelatedCount = len(p.Related)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(db, partContentStmt, in, args, func(rows *sql.Rows) error {
+		var id int
+		var text *string
+		var c products.Content
+		if err := rows.Scan(&id, &text, &c.ContentType.Id, &c.ContentType.Type, &c.ContentType.AllowsHTML); err != nil {
+			return err
+		}
+		c.Text = deref(text)
+		if p, ok := parts[id]; ok {
+			c.Sort = len(p.Content)
+			p.Content = append(p.Content, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]products.Part, 0, len(order))
+	for _, id := range order {
+		list = append(list, *parts[id])
+	}
+	return list, nil
+}
+
+func eachRow(db *sql.DB, stmt, in string, args []interface{}, fn func(*sql.Rows) error) error {
+	rows, err := db.Query(strings.Replace(stmt, "%s", in, 1), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func placeholders(ids []int) (string, []interface{}) {
+	marks := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		marks[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(marks, ","), args
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func parseURL(s *string) *url.URL {
+	if s == nil || *s == "" {
+		return nil
+	}
+	u, err := url.Parse(*s)
+	if err != nil {
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,361 @@
+package catalog
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/brand"
+	"github.com/curt-labs/API/models/category"
+	"github.com/curt-labs/API/models/history"
+	"github.com/curt-labs/API/models/products"
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// RunCollectionName holds a document per sync run with its progress.
+	RunCollectionName = "catalog_sync_runs"
+
+	Full        = "full"
+	Incremental = "incremental"
+
+	Running   = "running"
+	Completed = "completed"
+	Failed    = "failed"
+
+	// batchSize is the number of parts loaded from MySQL and written to
+	// Mongo at a time.
+	batchSize = 500
+
+	// maxErrors caps the errors kept on a run so a broken source doesn't
+	// produce an unbounded document.
+	maxErrors = 100
+)
+
+var (
+	// ErrRunning is returned when a sync is requested while one is in
+	// progress.
+	ErrRunning = errors.New("a catalog sync is already running")
+
+	current *Run
+	mutex   sync.Mutex
+)
+
+// Run is a single execution of the catalog sync.
+type Run struct {
+	ID            bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	Mode          string        `bson:"mode" json:"mode" xml:"mode,attr"`
+	Since         time.Time     `bson:"since,omitempty" json:"since,omitempty" xml:"since,attr,omitempty"`
+	Status        string        `bson:"status" json:"status" xml:"status,attr"`
+	StartedAt     time.Time     `bson:"started_at" json:"started_at" xml:"started_at,attr"`
+	FinishedAt    time.Time     `bson:"finished_at,omitempty" json:"finished_at,omitempty" xml:"finished_at,attr,omitempty"`
+	TotalParts    int           `bson:"total_parts" json:"total_parts" xml:"total_parts,attr"`
+	SyncedParts   int           `bson:"synced_parts" json:"synced_parts" xml:"synced_parts,attr"`
+	Categories    int           `bson:"categories" json:"categories" xml:"categories,attr"`
+	ChangedParts  int           `bson:"changed_parts" json:"changed_parts" xml:"changed_parts,attr"`
+	Errors        []string      `bson:"errors" json:"errors" xml:"errors>error"`
+	ErrorCount    int           `bson:"error_count" json:"error_count" xml:"error_count,attr"`
+	FailureReason string        `bson:"failure_reason,omitempty" json:"failure_reason,omitempty" xml:"failure_reason,omitempty"`
+}
+
+// Start begins a sync in the background and returns the run so that its
+// progress can be followed. An incremental run only rebuilds the parts
+// modified since the last completed run; categories are always rebuilt.
+func Start(mode string) (*Run, error) {
+	if mode != Full && mode != Incremental {
+		return nil, fmt.Errorf("invalid sync mode %q, must be %s or %s", mode, Full, Incremental)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if current != nil {
+		return nil, ErrRunning
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{
+		ID:        bson.NewObjectId(),
+		Mode:      mode,
+		Status:    Running,
+		StartedAt: time.Now(),
+		Errors:    make([]string, 0),
+	}
+	if mode == Incremental {
+		var last Run
+		err = session.DB(database.ProductDatabase).C(RunCollectionName).Find(bson.M{"status": Completed}).Sort("-started_at").One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			session.Close()
+			return nil, err
+		}
+		// without a previous run there is nothing to be incremental to
+		if err == mgo.ErrNotFound {
+			run.Mode = Full
+		} else {
+			run.Since = last.StartedAt
+		}
+	}
+
+	if err = session.DB(database.ProductDatabase).C(RunCollectionName).Insert(run); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	current = run
+	snapshot := *run
+	go func() {
+		defer session.Close()
+		run.execute(session)
+
+		mutex.Lock()
+		current = nil
+		mutex.Unlock()
+	}()
+
+	return &snapshot, nil
+}
+
+// Current returns the run in progress, or nil when the sync is idle.
+func Current() *Run {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if current == nil {
+		return nil
+	}
+	r := *current
+	r.Errors = append([]string{}, current.Errors...)
+	return &r
+}
+
+// GetRun loads a run by its identifier.
+func GetRun(id string) (Run, error) {
+	var run Run
+	if !bson.IsObjectIdHex(id) {
+		return run, errors.New("invalid sync run identifier")
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return run, err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(RunCollectionName).FindId(bson.ObjectIdHex(id)).One(&run)
+	return run, err
+}
+
+// Runs returns the most recent runs, newest first.
+func Runs(count int) ([]Run, error) {
+	runs := make([]Run, 0)
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return runs, err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(RunCollectionName).Find(bson.M{}).Sort("-started_at").Limit(count).All(&runs)
+	return runs, err
+}
+
+// Schedule starts an incremental sync on the given interval. It blocks,
+// so it should be started in its own goroutine.
+func Schedule(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if _, err := Start(Incremental); err != nil && err != ErrRunning {
+			log.Printf("catalog sync failed to start: %s\n", err.Error())
+		}
+	}
+}
+
+func (r *Run) execute(session *mgo.Session) {
+	err := r.sync(session)
+
+	mutex.Lock()
+	r.FinishedAt = time.Now()
+	r.Status = Completed
+	if err != nil {
+		r.Status = Failed
+		r.FailureReason = err.Error()
+	}
+	mutex.Unlock()
+
+	r.save(session)
+}
+
+func (r *Run) sync(session *mgo.Session) error {
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	brands, err := brand.GetAllBrands()
+	if err != nil {
+		return err
+	}
+	brandMap := make(map[int]brand.Brand)
+	for _, b := range brands {
+		brandMap[b.ID] = b
+	}
+
+	cats, err := loadCategories(db, brandMap)
+	if err != nil {
+		return err
+	}
+
+	ids, err := modifiedParts(db, r.Since)
+	if err != nil {
+		return err
+	}
+	r.progress(func() { r.TotalParts = len(ids) })
+	r.save(session)
+
+	col := session.DB(database.ProductDatabase).C(database.ProductCollectionName)
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		parts, err := loadParts(db, ids[start:end], brandMap, cats)
+		if err != nil {
+			r.fail(fmt.Sprintf("parts %d-%d: %s", ids[start], ids[end-1], err.Error()))
+			continue
+		}
+
+		var synced []int
+		for _, p := range parts {
+			if _, err := col.Upsert(bson.M{"id": p.ID}, bson.M{"$set": partDocument(p)}); err != nil {
+				r.fail(fmt.Sprintf("part %d: %s", p.ID, err.Error()))
+				continue
+			}
+			synced = append(synced, p.ID)
+		}
+
+		// track the merged documents so fields kept in Mongo don't show
+		// up as removed
+		var merged []products.Part
+		var changes []history.Change
+		err = col.Find(bson.M{"id": bson.M{"$in": synced}}).All(&merged)
+		if err == nil {
+			changes, err = history.Track(merged, "sync")
+		}
+		if err != nil {
+			r.fail(fmt.Sprintf("history for parts %d-%d: %s", ids[start], ids[end-1], err.Error()))
+		}
+
+		r.progress(func() {
+			r.SyncedParts += len(synced)
+			r.ChangedParts += len(changes)
+		})
+		r.save(session)
+	}
+
+	catCol := session.DB(database.ProductDatabase).C(database.CategoryCollectionName)
+	for _, c := range cats.documents() {
+		update := bson.M{
+			"$set": categoryDocument(c),
+			// deletes are soft in Mongo, keep them when the category is rebuilt
+			"$setOnInsert": bson.M{"isdeleted": false},
+		}
+		if _, err := catCol.Upsert(bson.M{"id": c.CategoryID}, update); err != nil {
+			r.fail(fmt.Sprintf("category %d: %s", c.CategoryID, err.Error()))
+			continue
+		}
+		r.progress(func() { r.Categories++ })
+	}
+
+	// the children written above don't know which were deleted in Mongo
+	if err := category.RebuildChildren(); err != nil {
+		r.fail(fmt.Sprintf("category children: %s", err.Error()))
+	}
+
+	return nil
+}
+
+func (r *Run) progress(fn func()) {
+	mutex.Lock()
+	fn()
+	mutex.Unlock()
+}
+
+func (r *Run) fail(msg string) {
+	r.progress(func() {
+		r.ErrorCount++
+		if len(r.Errors) < maxErrors {
+			r.Errors = append(r.Errors, msg)
+		}
+	})
+}
+
+func (r *Run) save(session *mgo.Session) {
+	mutex.Lock()
+	doc := *r
+	doc.Errors = append([]string{}, r.Errors...)
+	mutex.Unlock()
+
+	if err := session.DB(database.ProductDatabase).C(RunCollectionName).UpdateId(doc.ID, doc); err != nil {
+		log.Printf("failed to save catalog sync run %s: %s\n", doc.ID.Hex(), err.Error())
+	}
+}
+
+// partDocument lists the fields of a part document that MySQL is the
+// source of truth for. Fitment, images and other data maintained in
+// Mongo are left alone.
+func partDocument(p products.Part) bson.M {
+	return bson.M{
+		"id":                p.ID,
+		"part_number":       p.PartNumber,
+		"brand":             p.Brand,
+		"status":            p.Status,
+		"price_code":        p.PriceCode,
+		"date_added":        p.DateAdded,
+		"date_modified":     p.DateModified,
+		"short_description": p.ShortDesc,
+		"class":             p.Class,
+		"featured":          p.Featured,
+		"acesPartTypeId":    p.AcesPartTypeID,
+		"attributes":        p.Attributes,
+		"pricing":           p.Pricing,
+		"content":           p.Content,
+		"categories":        p.Categories,
+		"related":           p.Related,
+		"related_count":     p.RelatedCount,
+	}
+}
+
+func categoryDocument(c products.Category) bson.M {
+	return bson.M{
+		"id":                c.CategoryID,
+		"parent_id":         c.ParentID,
+		"sort":              c.Sort,
+		"date_added":        c.DateAdded,
+		"title":             c.Title,
+		"short_description": c.ShortDesc,
+		"long_description":  c.LongDesc,
+		"image":             c.Image,
+		"icon":              c.Icon,
+		"lifestyle":         c.IsLifestyle,
+		"is_lifestyle":      c.IsLifestyle,
+		"vehicle_specific":  c.VehicleSpecific,
+		"vehicle_required":  c.VehicleRequired,
+		"meta_title":        c.MetaTitle,
+		"meta_description":  c.MetaDescription,
+		"meta_keywords":     c.MetaKeywords,
+		"brand":             c.Brand,
+		"part_ids":          c.PartIDs,
+		"children":          c.Children,
+		"content":           c.Content,
+	}
+}
@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTree(t *testing.T) {
+	cats := []products.Category{
+		{CategoryID: 1, Title: "Hitches", PartIDs: []int{11000}},
+		{CategoryID: 2, ParentID: 1, Sort: 2, Title: "Class 2"},
+		{CategoryID: 3, ParentID: 1, Sort: 1, Title: "Class 1"},
+		{CategoryID: 4, ParentID: 3, Title: "Custom Class 1"},
+		// a cycle in the source data shouldn't recurse forever
+		{CategoryID: 5, ParentID: 6, Title: "Loop A"},
+		{CategoryID: 6, ParentID: 5, Title: "Loop B"},
+	}
+
+	Convey("Testing category documents", t, func() {
+		docs := newTree(cats).documents()
+		So(len(docs), ShouldEqual, 6)
+
+		root := docs[0]
+		So(root.CategoryID, ShouldEqual, 1)
+		So(len(root.Children), ShouldEqual, 2)
+		So(root.Children[0].Title, ShouldEqual, "Class 1")
+		So(root.Children[0].Children[0].CategoryID, ShouldEqual, 4)
+		So(root.Children[1].Title, ShouldEqual, "Class 2")
+
+		So(len(docs[4].Children), ShouldEqual, 1)
+		So(docs[4].Children[0].Children, ShouldBeNil)
+	})
+
+	Convey("Testing category summary", t, func() {
+		c, ok := newTree(cats).summary(1)
+		So(ok, ShouldBeTrue)
+		So(c.Title, ShouldEqual, "Hitches")
+		So(c.Children, ShouldBeNil)
+		So(c.PartIDs, ShouldBeNil)
+
+		c, _ = newTree(cats).summary(4)
+		So(len(c.Breadcrumbs), ShouldEqual, 3)
+		So(c.Breadcrumbs[0].Slug, ShouldEqual, "hitches")
+		So(c.Breadcrumbs[2].ID, ShouldEqual, 4)
+		So(c.Breadcrumbs[2].Slug, ShouldEqual, "custom-class-1")
+
+		c, _ = newTree(cats).summary(5)
+		So(len(c.Breadcrumbs), ShouldEqual, 2)
+
+		_, ok = newTree(cats).summary(99)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Testing placeholders", t, func() {
+		in, args := placeholders([]int{1, 2, 3})
+		So(in, ShouldEqual, "?,?,?")
+		So(len(args), ShouldEqual, 3)
+	})
+}
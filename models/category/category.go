@@ -40,12 +40,16 @@ type Category struct {
 	MetaTitle          string                            `bson:"meta_title" json:"meta_title" xml:"meta_title"`
 	MetaDescription    string                            `bson:"meta_description" json:"meta_description" xml:"meta_description"`
 	MetaKeywords       string                            `bson:"meta_keywords" json:"meta_keywords" xml:"meta_keywords"`
-	ProductListing     *products.PaginatedProductListing `json:"product_listing,omitempty" xml:"product_listing,omitempty"`
+	ProductListing     *products.PaginatedProductListing `bson:"-" json:"product_listing,omitempty" xml:"product_listing,omitempty"`
 	Content            []Content                         `bson:"content" json:"content" xml:"content"`
 	Videos             []video.Video                     `bson:"videos" json:"videos" xml:"videos"`
 	Brand              brand.Brand                       `bson:"brand" json:"brand" xml:"brand"`
 	ProductIdentifiers []int                             `bson:"part_ids" json:"part_identifiers" xml:"part_identifiers"`
 	IsDeleted          bool                              `bson:"isdeleted" json:"-" xml:"-"`
+	Path               string                            `bson:"path" json:"path" xml:"path,attr"`
+	AncestorIDs        []int                             `bson:"ancestor_ids" json:"ancestor_ids" xml:"ancestor_ids"`
+	Depth              int                               `bson:"depth" json:"depth" xml:"depth,attr"`
+	Breadcrumbs        []products.Breadcrumb             `bson:"breadcrumbs" json:"breadcrumbs" xml:"breadcrumbs>breadcrumb"`
 	PDFpath            *url.URL                          `bson:"pdf_path" json:"pdf_path" xml:"pdf_path"`
 	XLSpath            *url.URL                          `bson:"xls_path" json:"xls_path" xml:"xls_path"`
 }
@@ -69,10 +73,12 @@ func GetCategoryTree(dtx *apicontext.DataContext) ([]Category, error) {
 	for i, _ := range cats {
 		cats[i].removeDeletedChildren()
 	}
-	return cats, err
+	return visibleCategories(cats, nil, dtx.Visibility), err
 }
 
-func (c *Category) Get(page, count int) error {
+// Get loads a category of the caller's brands that its visibility rules
+// let it see, with the visible children and a page of its visible parts.
+func (c *Category) Get(page, count int, dtx *apicontext.DataContext) error {
 
 	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
 	if err != nil {
@@ -80,11 +86,18 @@ func (c *Category) Get(page, count int) error {
 	}
 	defer session.Close()
 
-	err = session.DB(database.ProductDatabase).C(database.CategoryCollectionName).Find(bson.M{"id": c.CategoryID, "isdeleted": false}).One(&c)
+	err = session.DB(database.ProductDatabase).C(database.CategoryCollectionName).Find(bson.M{"id": c.CategoryID, "isdeleted": false, "brand.id": bson.M{"$in": dtx.BrandArray}}).One(&c)
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
 	c.removeDeletedChildren()
+	if !dtx.Visibility.CategoryVisible(c.pathIDs(), c.descendantIDs()...) {
+		return ErrNotFound
+	}
+	c.Children = visibleCategories(c.Children, c.pathIDs(), dtx.Visibility)
 
 	c.ProductListing = &products.PaginatedProductListing{
 		Page:    page,
@@ -92,12 +105,13 @@ func (c *Category) Get(page, count int) error {
 		Parts:   []products.Part{},
 	}
 
-	c.ProductListing.TotalItems, err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(bson.M{"id": bson.M{"$in": c.ProductIdentifiers}}).Count()
+	listing := products.VisibleQuery(bson.M{"id": bson.M{"$in": c.ProductIdentifiers}}, dtx)
+	c.ProductListing.TotalItems, err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(listing).Count()
 	if err != nil {
 		c.ProductListing.TotalItems = 1
 	}
 
-	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(bson.M{"id": bson.M{"$in": c.ProductIdentifiers}}).Sort("id").Skip((page - 1) * count).Limit(count).All(&c.ProductListing.Parts)
+	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(listing).Sort("id").Skip((page - 1) * count).Limit(count).All(&c.ProductListing.Parts)
 	if err != nil {
 		return err
 	}
@@ -108,7 +122,7 @@ func (c *Category) Get(page, count int) error {
 	return nil
 }
 
-func GetCategoryParts(catId, page, count int) (PartResponse, error) {
+func GetCategoryParts(catId, page, count int, dtx *apicontext.DataContext) (PartResponse, error) {
 	var parts PartResponse
 
 	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
@@ -143,6 +157,7 @@ func GetCategoryParts(catId, page, count int) (PartResponse, error) {
 			"$in": statuses,
 		},
 	}
+	query = products.VisibleQuery(query, dtx)
 
 	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(query).Limit(count).Skip((page - 1) * count).All(&parts.Parts)
 	if err != nil {
@@ -165,3 +180,40 @@ func (c *Category) removeDeletedChildren() {
 	}
 	c.Children = newChildren
 }
+
+// visibleCategories drops the categories, and children of categories,
+// that v hides. path holds the ids of the categories above cats.
+func visibleCategories(cats []Category, path []int, v *apicontext.Visibility) []Category {
+	if v.Empty() {
+		return cats
+	}
+	var visible []Category
+	for _, c := range cats {
+		at := append(append([]int{}, path...), c.CategoryID)
+		if !v.CategoryVisible(at, c.descendantIDs()...) {
+			continue
+		}
+		c.Children = visibleCategories(c.Children, at, v)
+		visible = append(visible, c)
+	}
+	return visible
+}
+
+// pathIDs is the ids of the categories from the top-level one down to
+// c. Categories saved before paths were kept only know their parent.
+func (c *Category) pathIDs() []int {
+	ids := append([]int{}, c.AncestorIDs...)
+	if len(ids) == 0 && c.ParentID > 0 {
+		ids = append(ids, c.ParentID)
+	}
+	return append(ids, c.CategoryID)
+}
+
+func (c *Category) descendantIDs() []int {
+	var ids []int
+	for i := range c.Children {
+		ids = append(ids, c.Children[i].CategoryID)
+		ids = append(ids, c.Children[i].descendantIDs()...)
+	}
+	return ids
+}
@@ -0,0 +1,896 @@
+package category
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/brand"
+	"github.com/curt-labs/API/models/products"
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	createCategory = `insert into Categories (dateAdded, parentID, catTitle, shortDesc, longDesc, image, icon, isLifestyle, vehicleSpecific, vehicleRequired, metaTitle, metaDesc, metaKeywords, sort, brandID)
+						values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	moveCategory = `update Categories set parentID = ?, sort = ? where catID = ?`
+	lockCategory = `select parentID from Categories where catID = ? for update`
+	sortCategory = `update Categories set sort = ? where catID = ?`
+	attachPart   = `insert into CatPart (catID, partID)
+						select ?, ? from dual
+						where not exists (select 1 from CatPart where catID = ? && partID = ?)`
+	detachPart          = `delete from CatPart where catID = ? && partID = ?`
+	deleteCategoryParts = `delete from CatPart where catID in (%s)`
+	deleteCategories    = `delete from Categories where catID in (%s)`
+
+	// ErrNotFound is returned when a category doesn't exist or belongs to
+	// another brand.
+	ErrNotFound = errors.New("category not found")
+
+	// manage serializes this process's changes to the Mongo tree, which is
+	// read, changed and written back as a whole. Checks that must hold
+	// across processes are made in the MySQL transaction instead.
+	manage sync.Mutex
+)
+
+// node is a category as stored on its own in Mongo. The document is kept
+// whole so that saving it doesn't drop fields this package doesn't know.
+type node struct {
+	Identifier bson.ObjectId `bson:"_id"`
+	ID         int           `bson:"id"`
+	ParentID   int           `bson:"parent_id"`
+	Sort       int           `bson:"sort"`
+	Title      string        `bson:"title"`
+	IsDeleted  bool          `bson:"isdeleted"`
+	PartIDs    []int         `bson:"part_ids"`
+	Brand      struct {
+		ID int `bson:"id"`
+	} `bson:"brand"`
+
+	doc bson.M
+}
+
+// tree is the category hierarchy as stored in Mongo, without the copies
+// of each category embedded in its ancestors.
+type tree struct {
+	nodes    map[int]*node
+	children map[int][]int
+}
+
+func loadTree(session *mgo.Session) (*tree, error) {
+	var nodes []*node
+	iter := session.DB(database.ProductDatabase).C(database.CategoryCollectionName).Find(nil).Select(bson.M{"children": 0}).Iter()
+	var raw bson.Raw
+	for iter.Next(&raw) {
+		n := &node{}
+		if err := raw.Unmarshal(n); err != nil {
+			return nil, err
+		}
+		if err := raw.Unmarshal(&n.doc); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return newTree(nodes), nil
+}
+
+func newTree(nodes []*node) *tree {
+	t := &tree{
+		nodes:    make(map[int]*node, len(nodes)),
+		children: make(map[int][]int),
+	}
+	for _, n := range nodes {
+		t.nodes[n.ID] = n
+	}
+	for _, n := range t.nodes {
+		if n.ParentID != n.ID {
+			t.children[n.ParentID] = append(t.children[n.ParentID], n.ID)
+		}
+	}
+	for parent := range t.children {
+		t.sortChildren(parent)
+	}
+	return t
+}
+
+func (t *tree) sortChildren(parent int) {
+	sort.Sort(bySort{t.children[parent], t.nodes})
+}
+
+// ancestors returns the parents of a category, nearest first.
+func (t *tree) ancestors(id int) []int {
+	var ids []int
+	seen := map[int]bool{id: true}
+	for n, ok := t.nodes[id]; ok && n.ParentID != 0 && !seen[n.ParentID]; n, ok = t.nodes[n.ParentID] {
+		seen[n.ParentID] = true
+		ids = append(ids, n.ParentID)
+	}
+	return ids
+}
+
+// within reports whether id is ancestor or one of its descendants.
+func (t *tree) within(id, ancestor int) bool {
+	if id == ancestor {
+		return true
+	}
+	for _, a := range t.ancestors(id) {
+		if a == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// descendants returns the subcategories of a category at every level.
+func (t *tree) descendants(id int) []int {
+	var ids []int
+	visited := map[int]bool{id: true}
+	queue := []int{id}
+	for len(queue) > 0 {
+		for _, child := range t.children[queue[0]] {
+			if !visited[child] {
+				visited[child] = true
+				ids = append(ids, child)
+				queue = append(queue, child)
+			}
+		}
+		queue = queue[1:]
+	}
+	return ids
+}
+
+// breadcrumbs is the path from a top-level category down to id.
+func (t *tree) breadcrumbs(id int) []products.Breadcrumb {
+	ids := append([]int{id}, t.ancestors(id)...)
+	crumbs := make([]products.Breadcrumb, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		n := t.nodes[ids[i]]
+		crumbs = append(crumbs, products.Breadcrumb{
+			ID:    n.ID,
+			Title: n.Title,
+			Slug:  products.CategorySlug(n.Title),
+		})
+	}
+	return crumbs
+}
+
+// subtree is a category document with its children, the shape
+// categories are stored in Mongo.
+func (t *tree) subtree(id int, visited map[int]bool) bson.M {
+	n := t.nodes[id]
+	visited[id] = true
+
+	doc := make(bson.M, len(n.doc)+1)
+	for k, v := range n.doc {
+		doc[k] = v
+	}
+	doc["parent_id"] = n.ParentID
+	delete(doc, "parent_identifier")
+	if p, ok := t.nodes[n.ParentID]; ok {
+		doc["parent_identifier"] = p.Identifier
+	}
+	doc["sort"] = n.Sort
+	doc["isdeleted"] = n.IsDeleted
+	doc["part_ids"] = n.PartIDs
+
+	// the materialized path the category is looked up by
+	crumbs := t.breadcrumbs(id)
+	slugs := make([]string, 0, len(crumbs))
+	ancestors := make([]int, 0, len(crumbs)-1)
+	for i, b := range crumbs {
+		slugs = append(slugs, b.Slug)
+		if i < len(crumbs)-1 {
+			ancestors = append(ancestors, b.ID)
+		}
+	}
+	doc["breadcrumbs"] = crumbs
+	doc["path"] = strings.Join(slugs, "/")
+	doc["ancestor_ids"] = ancestors
+	doc["depth"] = len(ancestors)
+
+	children := make([]bson.M, 0, len(t.children[id]))
+	for _, child := range t.children[id] {
+		if !visited[child] {
+			children = append(children, t.subtree(child, visited))
+		}
+	}
+	doc["children"] = children
+	return doc
+}
+
+// setParent moves a category to the end of its new parent's children.
+func (t *tree) setParent(id, parent int) {
+	n := t.nodes[id]
+	t.detach(id)
+	n.ParentID = parent
+	n.Sort = t.nextSort(parent)
+	t.children[parent] = append(t.children[parent], id)
+}
+
+// detach takes a category out of its parent's children.
+func (t *tree) detach(id int) {
+	n := t.nodes[id]
+	siblings := t.children[n.ParentID]
+	for i, s := range siblings {
+		if s == id {
+			t.children[n.ParentID] = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+}
+
+// remove drops categories from the tree.
+func (t *tree) remove(ids []int) {
+	for _, id := range ids {
+		if _, ok := t.nodes[id]; !ok {
+			continue
+		}
+		t.detach(id)
+		delete(t.nodes, id)
+		delete(t.children, id)
+	}
+}
+
+func (t *tree) nextSort(parent int) int {
+	max := 0
+	for _, id := range t.children[parent] {
+		if s := t.nodes[id].Sort; s > max {
+			max = s
+		}
+	}
+	return max + 1
+}
+
+// save writes the changed categories, and the copies of them embedded in
+// their ancestors, back to Mongo.
+func (t *tree) save(session *mgo.Session, ids ...int) error {
+	update := make(map[int]bool)
+	for _, id := range ids {
+		if _, ok := t.nodes[id]; !ok {
+			continue
+		}
+		update[id] = true
+		for _, a := range t.ancestors(id) {
+			update[a] = true
+		}
+	}
+
+	col := session.DB(database.ProductDatabase).C(database.CategoryCollectionName)
+	for id := range update {
+		doc := t.subtree(id, make(map[int]bool))
+		if err := col.Update(bson.M{"id": id}, doc); err != nil {
+			return fmt.Errorf("category %d: %s", id, err.Error())
+		}
+	}
+	return nil
+}
+
+// find returns a category of one of the caller's brands.
+func (t *tree) find(id int, dtx *apicontext.DataContext) (*node, error) {
+	n, ok := t.nodes[id]
+	if !ok || !inBrands(n.Brand.ID, dtx) {
+		return nil, ErrNotFound
+	}
+	return n, nil
+}
+
+func inBrands(brandID int, dtx *apicontext.DataContext) bool {
+	for _, b := range dtx.BrandArray {
+		if b == brandID {
+			return true
+		}
+	}
+	return false
+}
+
+// write runs the MySQL side of a change in a transaction and the Mongo
+// side before committing it. When the Mongo side fails the transaction
+// is rolled back, and undo reverts what the Mongo side wrote, as it does
+// when the commit fails, so the two stores don't drift apart.
+func write(mysql func(*sql.Tx) error, mongo func() error, undo func() error) error {
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = mysql(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = mongo(); err != nil {
+		tx.Rollback()
+		revert(undo)
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		revert(undo)
+		return err
+	}
+	return nil
+}
+
+func revert(undo func() error) {
+	if err := undo(); err != nil {
+		log.Printf("reverting category change in mongo failed, run a catalog sync to reconcile: %s\n", err.Error())
+	}
+}
+
+// checkParent walks up from parent to the root in MySQL, locking each
+// category on the way, and fails when it passes id. The locks keep a
+// concurrent move, from this or another process, from closing a cycle
+// before the transaction commits.
+func checkParent(tx *sql.Tx, id, parent int) error {
+	var p int
+	if err := tx.QueryRow(lockCategory, id).Scan(&p); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	seen := make(map[int]bool)
+	for cur := parent; cur != 0 && !seen[cur]; cur = p {
+		if cur == id {
+			return fmt.Errorf("can't move category %d under itself or one of its subcategories", id)
+		}
+		seen[cur] = true
+		if err := tx.QueryRow(lockCategory, cur).Scan(&p); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("parent %d: %s", parent, ErrNotFound.Error())
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func args(ids []int) []interface{} {
+	out := make([]interface{}, len(ids))
+	for i, id := range ids {
+		out[i] = id
+	}
+	return out
+}
+
+// fetch reads a category back after it has been changed.
+func fetch(session *mgo.Session, id int) (*Category, error) {
+	var c Category
+	err := session.DB(database.ProductDatabase).C(database.CategoryCollectionName).Find(bson.M{"id": id}).One(&c)
+	return &c, err
+}
+
+// RebuildChildren rewrites the children embedded in every category from
+// the categories stored on their own, keeping deleted children flagged,
+// and the paths categories are looked up by.
+func RebuildChildren() error {
+	manage.Lock()
+	defer manage.Unlock()
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	t, err := loadTree(session)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for id := range t.nodes {
+		ids = append(ids, id)
+	}
+	return t.save(session, ids...)
+}
+
+// Create adds a category under ParentID, or at the root when it's 0, at
+// the end of its siblings. Categories under a parent take its brand;
+// root categories use Brand.ID, defaulting to the caller's brand.
+func (c *Category) Create(dtx *apicontext.DataContext) error {
+	if c.Title == "" {
+		return errors.New("a category needs a title")
+	}
+
+	manage.Lock()
+	defer manage.Unlock()
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	t, err := loadTree(session)
+	if err != nil {
+		return err
+	}
+
+	c.ParentIdentifier = ""
+	if c.ParentID != 0 {
+		parent, err := t.find(c.ParentID, dtx)
+		if err != nil {
+			return fmt.Errorf("parent %d: %s", c.ParentID, err.Error())
+		}
+		var doc struct {
+			Brand brand.Brand `bson:"brand"`
+		}
+		if err = session.DB(database.ProductDatabase).C(database.CategoryCollectionName).Find(bson.M{"id": c.ParentID}).Select(bson.M{"brand": 1}).One(&doc); err != nil {
+			return err
+		}
+		c.Brand = doc.Brand
+		c.ParentIdentifier = parent.Identifier
+	} else {
+		if c.Brand.ID == 0 {
+			c.Brand.ID = dtx.BrandID
+		}
+		if !inBrands(c.Brand.ID, dtx) {
+			return fmt.Errorf("brand %d isn't one of yours", c.Brand.ID)
+		}
+	}
+	c.Sort = t.nextSort(c.ParentID)
+	c.DateAdded = time.Now()
+	c.Children = []Category{}
+	c.ProductIdentifiers = []int{}
+	c.IsDeleted = false
+	c.Identifier = bson.NewObjectId()
+
+	col := session.DB(database.ProductDatabase).C(database.CategoryCollectionName)
+	return write(func(tx *sql.Tx) error {
+		res, err := tx.Exec(createCategory, c.DateAdded, c.ParentID, c.Title, c.ShortDesc, c.LongDesc, urlString(c.Image), urlString(c.Icon),
+			c.IsLifestyle, c.VehicleSpecific, c.VehicleRequired, c.MetaTitle, c.MetaDescription, c.MetaKeywords, c.Sort, c.Brand.ID)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		c.CategoryID = int(id)
+		return nil
+	}, func() error {
+		if err := col.Insert(c); err != nil {
+			return err
+		}
+		// embed it in its ancestors
+		t, err := loadTree(session)
+		if err != nil {
+			return err
+		}
+		return t.save(session, c.CategoryID)
+	}, func() error {
+		if err := col.Remove(bson.M{"_id": c.Identifier}); err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		t, err := loadTree(session)
+		if err != nil {
+			return err
+		}
+		return t.save(session, c.ParentID)
+	})
+}
+
+// Move makes a category, with its subcategories, the last child of
+// parent, or a root category when parent is 0. A category can't be
+// moved under itself or one of its subcategories, or to another brand.
+func Move(id, parent int, dtx *apicontext.DataContext) (*Category, error) {
+	manage.Lock()
+	defer manage.Unlock()
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	t, err := loadTree(session)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := t.find(id, dtx)
+	if err != nil {
+		return nil, err
+	}
+	if parent != 0 {
+		p, err := t.find(parent, dtx)
+		if err != nil {
+			return nil, fmt.Errorf("parent %d: %s", parent, err.Error())
+		}
+		if t.within(parent, id) {
+			return nil, fmt.Errorf("can't move category %d under itself or one of its subcategories", id)
+		}
+		if p.Brand.ID != n.Brand.ID {
+			return nil, errors.New("can't move a category to another brand")
+		}
+	}
+	if n.ParentID == parent {
+		return fetch(session, id)
+	}
+
+	old, oldSort := n.ParentID, n.Sort
+	t.setParent(id, parent)
+	moved := append([]int{id}, t.descendants(id)...)
+
+	err = write(func(tx *sql.Tx) error {
+		// the tree above was read from Mongo without a lock, check again
+		// where the change is made
+		if err := checkParent(tx, id, parent); err != nil {
+			return err
+		}
+		_, err := tx.Exec(moveCategory, n.ParentID, n.Sort, id)
+		return err
+	}, func() error {
+		return saveMove(session, t, moved, old)
+	}, func() error {
+		t.setParent(id, old)
+		n.Sort = oldSort
+		t.sortChildren(old)
+		return saveMove(session, t, moved, parent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fetch(session, id)
+}
+
+// saveMove writes moved categories, and the parent they left, to Mongo
+// along with the category summaries of their parts.
+func saveMove(session *mgo.Session, t *tree, moved []int, from int) error {
+	if err := t.save(session, append(moved, from)...); err != nil {
+		return err
+	}
+
+	// parts carry a summary of their categories
+	parts := session.DB(database.ProductDatabase).C(database.ProductCollectionName)
+	for _, cid := range moved {
+		_, err := parts.UpdateAll(
+			bson.M{"categories.id": cid},
+			bson.M{"$set": bson.M{
+				"categories.$.parent_id":   t.nodes[cid].ParentID,
+				"categories.$.breadcrumbs": t.breadcrumbs(cid),
+			}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reorder sorts the children of parent (0 for the root categories) in
+// the order of ids, which must list each of them once.
+func Reorder(parent int, ids []int, dtx *apicontext.DataContext) error {
+	manage.Lock()
+	defer manage.Unlock()
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	t, err := loadTree(session)
+	if err != nil {
+		return err
+	}
+
+	if parent != 0 {
+		if _, err = t.find(parent, dtx); err != nil {
+			return err
+		}
+	}
+
+	// root categories of other brands aren't the caller's to reorder
+	var siblings []int
+	for _, s := range t.children[parent] {
+		if inBrands(t.nodes[s].Brand.ID, dtx) {
+			siblings = append(siblings, s)
+		}
+	}
+	if err = sameSet(siblings, ids); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		t.nodes[id].Sort = i + 1
+		if _, err = tx.Exec(sortCategory, i+1, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	t.sortChildren(parent)
+	return t.save(session, ids...)
+}
+
+// AttachParts adds parts to a category, ignoring those already in it.
+func AttachParts(id int, partIDs []int, dtx *apicontext.DataContext) (*Category, error) {
+	return changeParts(id, partIDs, true, dtx)
+}
+
+// DetachParts removes parts from a category.
+func DetachParts(id int, partIDs []int, dtx *apicontext.DataContext) (*Category, error) {
+	return changeParts(id, partIDs, false, dtx)
+}
+
+func changeParts(id int, partIDs []int, attach bool, dtx *apicontext.DataContext) (*Category, error) {
+	partIDs = unique(partIDs)
+	if len(partIDs) == 0 {
+		return nil, errors.New("no parts given")
+	}
+
+	manage.Lock()
+	defer manage.Unlock()
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	t, err := loadTree(session)
+	if err != nil {
+		return nil, err
+	}
+	n, err := t.find(id, dtx)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := session.DB(database.ProductDatabase).C(database.ProductCollectionName)
+	if attach {
+		count, err := parts.Find(bson.M{"id": bson.M{"$in": partIDs}}).Count()
+		if err != nil {
+			return nil, err
+		}
+		if count != len(partIDs) {
+			return nil, errors.New("some of the parts don't exist")
+		}
+	}
+
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range partIDs {
+		if attach {
+			_, err = tx.Exec(attachPart, id, p, id, p)
+		} else {
+			_, err = tx.Exec(detachPart, id, p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if attach {
+		n.PartIDs = unique(append(n.PartIDs, partIDs...))
+	} else {
+		n.PartIDs = without(n.PartIDs, partIDs)
+	}
+	if err = t.save(session, id); err != nil {
+		return nil, err
+	}
+
+	// parts carry a summary of their categories
+	if attach {
+		var summary products.Category
+		err = session.DB(database.ProductDatabase).C(database.CategoryCollectionName).Find(bson.M{"id": id}).One(&summary)
+		if err != nil {
+			return nil, err
+		}
+		summary.Children = nil
+		summary.PartIDs = nil
+		_, err = parts.UpdateAll(
+			bson.M{"id": bson.M{"$in": partIDs}, "categories.id": bson.M{"$ne": id}},
+			bson.M{"$push": bson.M{"categories": summary}},
+		)
+	} else {
+		_, err = parts.UpdateAll(
+			bson.M{"id": bson.M{"$in": partIDs}},
+			bson.M{"$pull": bson.M{"categories": bson.M{"id": id}}},
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fetch(session, id)
+}
+
+// Delete removes a category and its subcategories, with their part
+// assignments, from MySQL and Mongo, and returns the category as it was.
+func Delete(id int, dtx *apicontext.DataContext) (*Category, error) {
+	manage.Lock()
+	defer manage.Unlock()
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	t, err := loadTree(session)
+	if err != nil {
+		return nil, err
+	}
+	n, err := t.find(id, dtx)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := fetch(session, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := append([]int{id}, t.descendants(id)...)
+	removed := make([]*node, 0, len(ids))
+	for _, cid := range ids {
+		removed = append(removed, t.nodes[cid])
+	}
+
+	// the parts' summaries are put back if the delete has to be undone
+	var affected []struct {
+		ID         int      `bson:"id"`
+		Categories []bson.M `bson:"categories"`
+	}
+	parts := session.DB(database.ProductDatabase).C(database.ProductCollectionName)
+	if err = parts.Find(bson.M{"categories.id": bson.M{"$in": ids}}).Select(bson.M{"id": 1, "categories": 1}).All(&affected); err != nil {
+		return nil, err
+	}
+
+	cats := session.DB(database.ProductDatabase).C(database.CategoryCollectionName)
+	err = write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(fmt.Sprintf(deleteCategoryParts, placeholders(len(ids))), args(ids)...); err != nil {
+			return err
+		}
+		_, err := tx.Exec(fmt.Sprintf(deleteCategories, placeholders(len(ids))), args(ids)...)
+		return err
+	}, func() error {
+		if _, err := cats.RemoveAll(bson.M{"id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+		_, err := parts.UpdateAll(
+			bson.M{"categories.id": bson.M{"$in": ids}},
+			bson.M{"$pull": bson.M{"categories": bson.M{"id": bson.M{"$in": ids}}}},
+		)
+		if err != nil {
+			return err
+		}
+		t.remove(ids)
+		return t.save(session, n.ParentID)
+	}, func() error {
+		for _, r := range removed {
+			if _, err := cats.Upsert(bson.M{"id": r.ID}, r.doc); err != nil {
+				return err
+			}
+		}
+		for _, p := range affected {
+			if err := parts.Update(bson.M{"id": p.ID}, bson.M{"$set": bson.M{"categories": p.Categories}}); err != nil {
+				return err
+			}
+		}
+		t, err := loadTree(session)
+		if err != nil {
+			return err
+		}
+		return t.save(session, ids...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// sameSet checks that ids lists each of want once.
+func sameSet(want, ids []int) error {
+	if len(unique(ids)) != len(ids) {
+		return errors.New("categories are listed more than once")
+	}
+	if len(ids) != len(want) {
+		return fmt.Errorf("expected all %d categories to be listed, got %d", len(want), len(ids))
+	}
+	in := make(map[int]bool)
+	for _, id := range want {
+		in[id] = true
+	}
+	for _, id := range ids {
+		if !in[id] {
+			return fmt.Errorf("category %d isn't one of those being sorted", id)
+		}
+	}
+	return nil
+}
+
+func unique(ids []int) []int {
+	seen := make(map[int]bool)
+	out := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func without(ids, remove []int) []int {
+	drop := make(map[int]bool)
+	for _, id := range remove {
+		drop[id] = true
+	}
+	out := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !drop[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+type bySort struct {
+	ids   []int
+	nodes map[int]*node
+}
+
+func (s bySort) Len() int      { return len(s.ids) }
+func (s bySort) Swap(i, j int) { s.ids[i], s.ids[j] = s.ids[j], s.ids[i] }
+func (s bySort) Less(i, j int) bool {
+	a, b := s.nodes[s.ids[i]], s.nodes[s.ids[j]]
+	if a.Sort == b.Sort {
+		return a.ID < b.ID
+	}
+	return a.Sort < b.Sort
+}
@@ -0,0 +1,134 @@
+package category
+
+import (
+	"testing"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func testTree() *tree {
+	nodes := []*node{
+		{ID: 1, Identifier: bson.ObjectId("aaaaaaaaaaa1")},
+		{ID: 2, ParentID: 1, Sort: 2},
+		{ID: 3, ParentID: 1, Sort: 1},
+		{ID: 4, ParentID: 3, IsDeleted: true},
+		{ID: 5, Sort: 2},
+		{ID: 6, ParentID: 5},
+	}
+	titles := []string{"Towing", "Hitches", "Class 3", "Old Stuff", "Lighting", "LED"}
+	for i, n := range nodes {
+		n.Title = titles[i]
+		n.Brand.ID = 1
+		n.doc = bson.M{"id": n.ID, "title": "Category", "content": []bson.M{{"text": "kept"}}}
+	}
+	nodes[4].Brand.ID = 3
+	return newTree(nodes)
+}
+
+func TestTree(t *testing.T) {
+	Convey("Testing the category tree", t, func() {
+		tr := testTree()
+
+		So(tr.children[1], ShouldResemble, []int{3, 2})
+		So(tr.ancestors(4), ShouldResemble, []int{3, 1})
+		So(tr.ancestors(1), ShouldBeEmpty)
+
+		So(tr.within(4, 1), ShouldBeTrue)
+		So(tr.within(1, 1), ShouldBeTrue)
+		So(tr.within(1, 4), ShouldBeFalse)
+		So(tr.within(6, 1), ShouldBeFalse)
+
+		Convey("builds documents with their children", func() {
+			doc := tr.subtree(1, make(map[int]bool))
+			So(doc["title"], ShouldEqual, "Category")
+			So(doc["content"], ShouldNotBeNil)
+			So(doc["parent_identifier"], ShouldBeNil)
+
+			children := doc["children"].([]bson.M)
+			So(len(children), ShouldEqual, 2)
+			So(children[0]["id"], ShouldEqual, 3)
+			So(children[0]["parent_identifier"], ShouldEqual, bson.ObjectId("aaaaaaaaaaa1"))
+
+			grandchildren := children[0]["children"].([]bson.M)
+			So(grandchildren[0]["isdeleted"], ShouldEqual, true)
+		})
+
+		Convey("builds materialized paths", func() {
+			doc := tr.subtree(3, make(map[int]bool))
+			So(doc["path"], ShouldEqual, "towing/class-3")
+			So(doc["ancestor_ids"], ShouldResemble, []int{1})
+			So(doc["depth"], ShouldEqual, 1)
+
+			crumbs := tr.breadcrumbs(4)
+			So(len(crumbs), ShouldEqual, 3)
+			So(crumbs[0].Title, ShouldEqual, "Towing")
+			So(crumbs[2].Slug, ShouldEqual, "old-stuff")
+
+			So(tr.descendants(1), ShouldResemble, []int{3, 2, 4})
+			So(tr.descendants(4), ShouldBeEmpty)
+		})
+
+		Convey("moves categories to the end of their new parent", func() {
+			tr.setParent(2, 5)
+			So(tr.children[1], ShouldResemble, []int{3})
+			So(tr.children[5], ShouldResemble, []int{6, 2})
+			So(tr.nodes[2].Sort, ShouldEqual, 1)
+			So(tr.ancestors(2), ShouldResemble, []int{5})
+		})
+
+		Convey("removes categories", func() {
+			tr.remove([]int{3, 4})
+			So(tr.children[1], ShouldResemble, []int{2})
+			So(tr.nodes[3], ShouldBeNil)
+			So(tr.descendants(1), ShouldResemble, []int{2})
+			So(placeholders(3), ShouldEqual, "?,?,?")
+			So(args([]int{3, 4}), ShouldResemble, []interface{}{3, 4})
+		})
+
+		Convey("finds categories of the caller's brands", func() {
+			dtx := &apicontext.DataContext{BrandArray: []int{1}}
+			_, err := tr.find(1, dtx)
+			So(err, ShouldBeNil)
+			_, err = tr.find(5, dtx)
+			So(err, ShouldEqual, ErrNotFound)
+			_, err = tr.find(99, dtx)
+			So(err, ShouldEqual, ErrNotFound)
+		})
+	})
+
+	Convey("Testing treeOrder", t, func() {
+		cats := []Category{
+			{CategoryID: 2, ParentID: 1, Sort: 2},
+			{CategoryID: 3, ParentID: 1, Sort: 1},
+			{CategoryID: 4, ParentID: 3},
+			// under a deleted category that wasn't loaded
+			{CategoryID: 5, ParentID: 9},
+		}
+		var ids []int
+		for _, c := range treeOrder(1, cats) {
+			ids = append(ids, c.CategoryID)
+		}
+		So(ids, ShouldResemble, []int{3, 4, 2})
+	})
+
+	Convey("Testing sameSet", t, func() {
+		So(sameSet([]int{1, 2, 3}, []int{3, 1, 2}), ShouldBeNil)
+		So(sameSet([]int{1, 2, 3}, []int{3, 1}), ShouldNotBeNil)
+		So(sameSet([]int{1, 2}, []int{1, 1}), ShouldNotBeNil)
+		So(sameSet([]int{1, 2}, []int{1, 4}), ShouldNotBeNil)
+	})
+
+	Convey("Testing CategorySlug", t, func() {
+		So(products.CategorySlug("Class 3"), ShouldEqual, "class-3")
+		So(products.CategorySlug("  Hitch & Ball-Mounts "), ShouldEqual, "hitch-ball-mounts")
+		So(products.CategorySlug("5th Wheel"), ShouldEqual, "5th-wheel")
+	})
+
+	Convey("Testing part id helpers", t, func() {
+		So(unique([]int{3, 1, 3, 2, 1}), ShouldResemble, []int{3, 1, 2})
+		So(without([]int{1, 2, 3, 4}, []int{2, 4, 9}), ShouldResemble, []int{1, 3})
+	})
+}
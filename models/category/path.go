@@ -0,0 +1,219 @@
+package category
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/products"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Ancestors returns the categories above a category of the caller's
+// brands, top-level first, without their children.
+func Ancestors(id int, dtx *apicontext.DataContext) ([]Category, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	col := session.DB(database.ProductDatabase).C(database.CategoryCollectionName)
+
+	var c Category
+	err = col.Find(bson.M{"id": id, "isdeleted": false, "brand.id": bson.M{"$in": dtx.BrandArray}}).Select(bson.M{"id": 1, "parent_id": 1, "ancestor_ids": 1}).One(&c)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the categories above a visible one are visible too
+	if ok, err := visible(col, c, dtx.Visibility); err != nil || !ok {
+		if err == nil {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+
+	var found []Category
+	err = col.Find(bson.M{"id": bson.M{"$in": c.AncestorIDs}, "brand.id": bson.M{"$in": dtx.BrandArray}}).Select(bson.M{"children": 0}).All(&found)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]Category, len(found))
+	for _, a := range found {
+		byID[a.CategoryID] = a
+	}
+	cats := make([]Category, 0, len(c.AncestorIDs))
+	for _, aid := range c.AncestorIDs {
+		if a, ok := byID[aid]; ok {
+			cats = append(cats, a)
+		}
+	}
+	return cats, nil
+}
+
+// Descendants returns the subcategories of a category of the caller's
+// brands down to depth levels below it, or every level when depth is 0,
+// without their children. They're listed in tree order: each category
+// followed by its subcategories.
+func Descendants(id, depth int, dtx *apicontext.DataContext) ([]Category, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	col := session.DB(database.ProductDatabase).C(database.CategoryCollectionName)
+
+	var c Category
+	err = col.Find(bson.M{"id": id, "isdeleted": false, "brand.id": bson.M{"$in": dtx.BrandArray}}).Select(bson.M{"id": 1, "parent_id": 1, "ancestor_ids": 1, "depth": 1}).One(&c)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// whether a category is visible can depend on those below it, so
+	// with rules every level is loaded and the depth applied after
+	qry := bson.M{"ancestor_ids": id, "isdeleted": false, "brand.id": bson.M{"$in": dtx.BrandArray}}
+	if depth > 0 && dtx.Visibility.Empty() {
+		qry["depth"] = bson.M{"$lte": c.Depth + depth}
+	}
+	var found []Category
+	if err = col.Find(qry).Select(bson.M{"children": 0}).All(&found); err != nil {
+		return nil, err
+	}
+
+	below := belowIDs(found)
+	if !dtx.Visibility.CategoryVisible(c.pathIDs(), below[id]...) {
+		return nil, ErrNotFound
+	}
+	if !dtx.Visibility.Empty() {
+		visible := make([]Category, 0, len(found))
+		for _, f := range found {
+			if (depth == 0 || f.Depth <= c.Depth+depth) && dtx.Visibility.CategoryVisible(f.pathIDs(), below[f.CategoryID]...) {
+				visible = append(visible, f)
+			}
+		}
+		found = visible
+	}
+
+	return treeOrder(id, found), nil
+}
+
+// belowIDs maps each category to the ids of the categories beneath it,
+// out of cats.
+func belowIDs(cats []Category) map[int][]int {
+	below := make(map[int][]int)
+	for _, c := range cats {
+		for _, a := range c.AncestorIDs {
+			below[a] = append(below[a], c.CategoryID)
+		}
+	}
+	return below
+}
+
+// visible reports whether v lets c be seen, loading the ids of the
+// categories beneath it when the rules need them.
+func visible(col *mgo.Collection, c Category, v *apicontext.Visibility) (bool, error) {
+	if v.Empty() {
+		return true, nil
+	}
+	var cats []Category
+	if err := col.Find(bson.M{"ancestor_ids": c.CategoryID, "isdeleted": false}).Select(bson.M{"id": 1}).All(&cats); err != nil {
+		return false, err
+	}
+	ids := make([]int, 0, len(cats))
+	for _, b := range cats {
+		ids = append(ids, b.CategoryID)
+	}
+	return v.CategoryVisible(c.pathIDs(), ids...), nil
+}
+
+// treeOrder lists the subcategories of id depth first, by sort order.
+// Categories under a deleted one aren't reachable and are left out.
+func treeOrder(id int, cats []Category) []Category {
+	children := make(map[int][]Category)
+	for _, c := range cats {
+		children[c.ParentID] = append(children[c.ParentID], c)
+	}
+
+	out := make([]Category, 0, len(cats))
+	visited := make(map[int]bool)
+	var walk func(int)
+	walk = func(parent int) {
+		kids := children[parent]
+		sort.Sort(categoriesBySort(kids))
+		for _, c := range kids {
+			if visited[c.CategoryID] {
+				continue
+			}
+			visited[c.CategoryID] = true
+			out = append(out, c)
+			walk(c.CategoryID)
+		}
+	}
+	walk(id)
+	return out
+}
+
+// GetByPath finds a visible category of the caller's brands by the slugs
+// of its titles from the top-level category down, e.g.
+// "towing/hitches/class-3".
+func GetByPath(path string, dtx *apicontext.DataContext) (Category, error) {
+	var c Category
+
+	var slugs []string
+	for _, seg := range strings.Split(path, "/") {
+		if s := products.CategorySlug(seg); s != "" {
+			slugs = append(slugs, s)
+		}
+	}
+	if len(slugs) == 0 {
+		return c, ErrNotFound
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return c, err
+	}
+	defer session.Close()
+
+	qry := bson.M{
+		"path":      strings.Join(slugs, "/"),
+		"isdeleted": false,
+		"brand.id":  bson.M{"$in": dtx.BrandArray},
+	}
+	col := session.DB(database.ProductDatabase).C(database.CategoryCollectionName)
+	err = col.Find(qry).Sort("sort", "id").One(&c)
+	if err == mgo.ErrNotFound {
+		return c, ErrNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	if ok, err := visible(col, c, dtx.Visibility); err != nil || !ok {
+		if err == nil {
+			err = ErrNotFound
+		}
+		return Category{}, err
+	}
+	return c, nil
+}
+
+type categoriesBySort []Category
+
+func (s categoriesBySort) Len() int      { return len(s) }
+func (s categoriesBySort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s categoriesBySort) Less(i, j int) bool {
+	if s[i].Sort == s[j].Sort {
+		return s[i].CategoryID < s[j].CategoryID
+	}
+	return s[i].Sort < s[j].Sort
+}
@@ -0,0 +1,73 @@
+package category
+
+import (
+	"testing"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVisibility(t *testing.T) {
+	tree := []Category{
+		{CategoryID: 1, Children: []Category{
+			{CategoryID: 2, ParentID: 1},
+			{CategoryID: 3, ParentID: 1, Children: []Category{
+				{CategoryID: 4, ParentID: 3},
+			}},
+		}},
+		{CategoryID: 5},
+	}
+	var ids func(cats []Category) []int
+	ids = func(cats []Category) []int {
+		var out []int
+		for _, c := range cats {
+			out = append(out, c.CategoryID)
+			out = append(out, ids(c.Children)...)
+		}
+		return out
+	}
+
+	Convey("Testing visibleCategories", t, func() {
+		So(ids(visibleCategories(tree, nil, nil)), ShouldResemble, []int{1, 2, 3, 4, 5})
+
+		v := &apicontext.Visibility{ExcludeCategories: []int{3}}
+		So(ids(visibleCategories(tree, nil, v)), ShouldResemble, []int{1, 2, 5})
+
+		// ancestors of an included category are kept to navigate to it
+		v = &apicontext.Visibility{IncludeCategories: []int{4}}
+		So(ids(visibleCategories(tree, nil, v)), ShouldResemble, []int{1, 3, 4})
+
+		v = &apicontext.Visibility{IncludeCategories: []int{1}, ExcludeCategories: []int{4}}
+		So(ids(visibleCategories(tree, nil, v)), ShouldResemble, []int{1, 2, 3})
+	})
+
+	Convey("Testing part visibility", t, func() {
+		hitch := products.Part{ID: 10, Class: products.Class{Name: "Class III"}, Categories: []products.Category{
+			{CategoryID: 4, Breadcrumbs: []products.Breadcrumb{{ID: 1}, {ID: 3}, {ID: 4}}},
+		}}
+		ball := products.Part{ID: 11, Class: products.Class{Name: "Accessory"}, Categories: []products.Category{
+			{CategoryID: 2, ParentID: 1},
+		}}
+		loose := products.Part{ID: 12}
+
+		visible := func(v *apicontext.Visibility) []int {
+			var out []int
+			for _, p := range products.FilterVisible([]products.Part{hitch, ball, loose}, &apicontext.DataContext{Visibility: v}) {
+				out = append(out, p.ID)
+			}
+			return out
+		}
+
+		So(visible(nil), ShouldResemble, []int{10, 11, 12})
+		So(visible(&apicontext.Visibility{}), ShouldResemble, []int{10, 11, 12})
+		So(visible(&apicontext.Visibility{ExcludeCategories: []int{3}}), ShouldResemble, []int{11, 12})
+		So(visible(&apicontext.Visibility{IncludeCategories: []int{1}}), ShouldResemble, []int{10, 11})
+		So(visible(&apicontext.Visibility{IncludeCategories: []int{2}, IncludeParts: []int{12}}), ShouldResemble, []int{11, 12})
+		So(visible(&apicontext.Visibility{IncludeClasses: []string{"class iii"}}), ShouldResemble, []int{10})
+		So(visible(&apicontext.Visibility{ExcludeClasses: []string{"Accessory"}, ExcludeParts: []int{10}}), ShouldResemble, []int{12})
+
+		So((&apicontext.Visibility{}).PartQuery(), ShouldBeNil)
+		So((&apicontext.Visibility{ExcludeParts: []int{10}}).PartQuery(), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,264 @@
+package compare
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/units"
+	"github.com/curt-labs/API/models/products"
+)
+
+const (
+	// MaxParts is the largest number of parts that can be compared at
+	// once.
+	MaxParts = 10
+
+	// tolerance is how close two converted measurements have to be to
+	// be treated as the same value.
+	tolerance = 0.01
+)
+
+var (
+	// Synonyms maps normalized attribute names to the key they should be
+	// aligned under. Additional entries can be loaded with LoadSynonyms.
+	Synonyms = map[string]string{
+		"gtw":                       "gross trailer weight",
+		"gross trailer weight":      "gross trailer weight",
+		"gross trailer weight gtw":  "gross trailer weight",
+		"max gross trailer weight":  "gross trailer weight",
+		"trailer weight":            "gross trailer weight",
+		"tw":                        "tongue weight",
+		"max tongue weight":         "tongue weight",
+		"tongue weight":             "tongue weight",
+		"tongue weight tw":          "tongue weight",
+		"receiver size":             "receiver size",
+		"receiver opening":          "receiver size",
+		"receiver tube size":        "receiver size",
+		"ball hole diameter":        "ball hole size",
+		"ball hole size":            "ball hole size",
+		"rise":                      "rise",
+		"drop":                      "drop",
+		"weight":                    "product weight",
+		"product weight":            "product weight",
+		"shipping weight":           "shipping weight",
+		"length":                    "length",
+		"overall length":            "length",
+		"finish":                    "finish",
+		"material":                  "material",
+		"weight distribution limit": "weight distribution limit",
+	}
+
+	rxNonWord = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Comparison aligns the attributes of several parts side by side.
+type Comparison struct {
+	Parts []ComparedPart `json:"parts" xml:"parts>part"`
+	Rows  []Row          `json:"attributes" xml:"attributes>attribute"`
+}
+
+// ComparedPart identifies a column of the comparison.
+type ComparedPart struct {
+	ID         int    `json:"id" xml:"id,attr"`
+	PartNumber string `json:"part_number" xml:"part_number,attr"`
+	ShortDesc  string `json:"short_description" xml:"short_description,attr"`
+}
+
+// Row is a single aligned attribute across every compared part. Values
+// are in the same order as Comparison.Parts; a part without the
+// attribute has an empty value.
+type Row struct {
+	Key     string  `json:"key" xml:"key,attr"`
+	Differs bool    `json:"differs" xml:"differs,attr"`
+	Values  []Value `json:"values" xml:"values>value"`
+}
+
+// Value is a part's value for an aligned attribute.
+type Value struct {
+	Name    string   `json:"name,omitempty" xml:"name,attr,omitempty"`
+	Raw     string   `json:"raw,omitempty" xml:"raw,attr,omitempty"`
+	Display string   `json:"display,omitempty" xml:",chardata"`
+	Amount  *float64 `json:"amount,omitempty" xml:"amount,attr,omitempty"`
+	Unit    string   `json:"unit,omitempty" xml:"unit,attr,omitempty"`
+}
+
+// LoadSynonyms merges a JSON object of attribute name to aligned key
+// from the given file into Synonyms.
+func LoadSynonyms(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var m map[string]string
+	if err = json.NewDecoder(f).Decode(&m); err != nil {
+		return err
+	}
+	for k, v := range m {
+		Synonyms[NormalizeKey(k)] = NormalizeKey(v)
+	}
+	return nil
+}
+
+// Parts loads the given part numbers and compares them, converting
+// measurements to the given unit system.
+func Parts(partNumbers []string, system string, dtx *apicontext.DataContext) (Comparison, error) {
+	if len(partNumbers) < 2 {
+		return Comparison{}, errors.New("at least two part numbers are required for a comparison")
+	}
+	if len(partNumbers) > MaxParts {
+		return Comparison{}, errors.New("too many parts to compare")
+	}
+
+	parts, err := products.GetMulti(dtx, partNumbers)
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	// keep the columns in the order they were requested
+	ordered := make([]products.Part, 0, len(parts))
+	for _, pn := range partNumbers {
+		for _, p := range parts {
+			if strings.EqualFold(p.PartNumber, pn) {
+				ordered = append(ordered, p)
+				break
+			}
+		}
+	}
+
+	return Compare(ordered, system), nil
+}
+
+// Compare aligns the attributes of the given parts.
+func Compare(parts []products.Part, system string) Comparison {
+	if !units.ValidSystem(system) {
+		system = units.Imperial
+	}
+
+	var cmp Comparison
+	rows := make(map[string]*Row)
+	var keys []string
+
+	for i, p := range parts {
+		cmp.Parts = append(cmp.Parts, ComparedPart{
+			ID:         p.ID,
+			PartNumber: p.PartNumber,
+			ShortDesc:  p.ShortDesc,
+		})
+
+		for _, attr := range p.Attributes {
+			key := AlignKey(attr.Key)
+			if key == "" {
+				continue
+			}
+			row, ok := rows[key]
+			if !ok {
+				row = &Row{
+					Key:    key,
+					Values: make([]Value, len(parts)),
+				}
+				rows[key] = row
+				keys = append(keys, key)
+			}
+			if row.Values[i].Raw != "" {
+				// first value wins when a part repeats an attribute
+				continue
+			}
+			row.Values[i] = newValue(attr, system)
+		}
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		row := rows[k]
+		row.Differs = differs(row.Values)
+		cmp.Rows = append(cmp.Rows, *row)
+	}
+
+	return cmp
+}
+
+// MarshalCSV renders the comparison with one row per attribute and one
+// column per part.
+func (c Comparison) MarshalCSV() ([][]string, error) {
+	header := []string{"Attribute"}
+	for _, p := range c.Parts {
+		header = append(header, p.PartNumber)
+	}
+	header = append(header, "Differs")
+
+	records := [][]string{header}
+	for _, row := range c.Rows {
+		rec := []string{row.Key}
+		for _, v := range row.Values {
+			rec = append(rec, v.Display)
+		}
+		if row.Differs {
+			rec = append(rec, "yes")
+		} else {
+			rec = append(rec, "no")
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// NormalizeKey lower cases an attribute name and collapses punctuation
+// and whitespace so that "Gross Trailer Weight (GTW):" and
+// "gross trailer weight gtw" are equal.
+func NormalizeKey(key string) string {
+	return strings.TrimSpace(rxNonWord.ReplaceAllString(strings.ToLower(key), " "))
+}
+
+// AlignKey returns the key an attribute name is compared under.
+func AlignKey(key string) string {
+	k := NormalizeKey(key)
+	if syn, ok := Synonyms[k]; ok {
+		return syn
+	}
+	return k
+}
+
+func newValue(attr products.Attribute, system string) Value {
+	v := Value{
+		Name:    attr.Key,
+		Raw:     attr.Value,
+		Display: strings.TrimSpace(attr.Value),
+	}
+	if q, ok := attr.Quantity(); ok {
+		q = q.In(system)
+		amount := q.Value
+		v.Amount = &amount
+		v.Unit = q.Unit.Symbol
+		v.Display = q.String()
+	}
+	return v
+}
+
+func differs(values []Value) bool {
+	var first *Value
+	for i := range values {
+		v := &values[i]
+		if first == nil {
+			first = v
+			continue
+		}
+		if first.Amount != nil && v.Amount != nil && first.Unit == v.Unit {
+			if math.Abs(*first.Amount-*v.Amount) > tolerance {
+				return true
+			}
+			continue
+		}
+		if !strings.EqualFold(first.Display, v.Display) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package compare
+
+import (
+	"testing"
+
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompare(t *testing.T) {
+	parts := []products.Part{
+		{
+			ID:         13100,
+			PartNumber: "13100",
+			Attributes: []products.Attribute{
+				{Key: "Gross Trailer Weight:", Value: "6,000 lbs."},
+				{Key: "Tongue Weight", Value: "600 lbs."},
+				{Key: "Receiver Size", Value: "2\""},
+				{Key: "Finish", Value: "Carbide Black"},
+			},
+		},
+		{
+			ID:         13101,
+			PartNumber: "13101",
+			Attributes: []products.Attribute{
+				{Key: "GTW", Value: "2721.554 kg"},
+				{Key: "Max Tongue Weight", Value: "900 lbs"},
+				{Key: "Receiver Opening", Value: "50.8 mm"},
+				{Key: "finish", Value: "carbide black"},
+				{Key: "Drop", Value: "4 in"},
+			},
+		},
+	}
+
+	Convey("Testing Compare", t, func() {
+		cmp := Compare(parts, "")
+		So(len(cmp.Parts), ShouldEqual, 2)
+		So(cmp.Parts[1].PartNumber, ShouldEqual, "13101")
+
+		rows := make(map[string]Row)
+		for _, row := range cmp.Rows {
+			rows[row.Key] = row
+		}
+		So(len(rows), ShouldEqual, 5)
+
+		gtw := rows["gross trailer weight"]
+		So(gtw.Values[0].Display, ShouldEqual, "6000 lbs")
+		So(gtw.Values[1].Display, ShouldEqual, "6000 lbs")
+		So(gtw.Differs, ShouldBeFalse)
+
+		So(rows["tongue weight"].Differs, ShouldBeTrue)
+		So(rows["receiver size"].Differs, ShouldBeFalse)
+		So(rows["finish"].Differs, ShouldBeFalse)
+
+		drop := rows["drop"]
+		So(drop.Values[0].Raw, ShouldEqual, "")
+		So(drop.Differs, ShouldBeTrue)
+	})
+
+	Convey("Testing Compare in metric", t, func() {
+		cmp := Compare(parts, "metric")
+		for _, row := range cmp.Rows {
+			if row.Key == "receiver size" {
+				So(row.Values[0].Display, ShouldEqual, "50.8 mm")
+				So(row.Values[0].Unit, ShouldEqual, "mm")
+			}
+		}
+	})
+
+	Convey("Testing MarshalCSV", t, func() {
+		records, err := Compare(parts, "").MarshalCSV()
+		So(err, ShouldBeNil)
+		So(records[0], ShouldResemble, []string{"Attribute", "13100", "13101", "Differs"})
+		So(records[1], ShouldResemble, []string{"drop", "", "4 in", "yes"})
+	})
+}
+
+func TestAlignKey(t *testing.T) {
+	Convey("Testing AlignKey", t, func() {
+		So(AlignKey("Gross Trailer Weight (GTW):"), ShouldEqual, "gross trailer weight")
+		So(AlignKey("  Ball Hole Diameter "), ShouldEqual, "ball hole size")
+		So(AlignKey("Warranty"), ShouldEqual, "warranty")
+		So(AlignKey("!!"), ShouldEqual, "")
+	})
+}
@@ -3,6 +3,8 @@ package customer
 import (
 	"github.com/curt-labs/API/helpers/database"
 	"github.com/curt-labs/API/helpers/redis"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/webhook"
 	_ "github.com/go-sql-driver/mysql"
 
 	"database/sql"
@@ -38,6 +40,7 @@ var (
 	getPricesByCustomer  = "SELECT cust_price_id, cust_id, partID, price, isSale, sale_start, sale_end FROM CustomerPricing WHERE cust_id = (select cust_id from Customer where customerID = ?)"
 	getPricesByPart      = "SELECT cust_price_id, cust_id, partID, price, isSale, sale_start, sale_end FROM CustomerPricing WHERE partID = ?"
 	getPricesBySaleRange = "SELECT cust_price_id, cust_id, partID, price, isSale, sale_start, sale_end FROM CustomerPricing WHERE sale_start >= ? AND sale_end <= ? AND cust_id = (select cust_id from Customer where customerID = ?)"
+	getPartPrices        = "SELECT cust_price_id, cust_id, partID, price, isSale, sale_start, sale_end FROM CustomerPricing WHERE cust_id = ? AND partID = ?"
 )
 
 const (
@@ -110,6 +113,12 @@ func (p *Price) Create() error {
 		return err
 	}
 	defer db.Close()
+	if err = p.checkMAP(); err != nil {
+		return err
+	}
+	if err = p.checkSale(db); err != nil {
+		return err
+	}
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -137,6 +146,7 @@ func (p *Price) Create() error {
 	}
 	go redis.Delete(allPricesRedisKey)
 	go redis.Setex("price:"+strconv.Itoa(p.ID), p, 86400)
+	go webhook.Publish(webhook.PriceChanged, p.CustID, p.change())
 	return nil
 }
 func (p *Price) Update() error {
@@ -145,6 +155,12 @@ func (p *Price) Update() error {
 		return err
 	}
 	defer db.Close()
+	if err = p.checkMAP(); err != nil {
+		return err
+	}
+	if err = p.checkSale(db); err != nil {
+		return err
+	}
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -166,9 +182,74 @@ func (p *Price) Update() error {
 	go redis.Setex("price:"+strconv.Itoa(p.ID), p, 86400)
 	go redis.Delete(fmt.Sprintf("prices:part:%d", strconv.Itoa(p.PartID)))
 	go redis.Delete(fmt.Sprintf("customers:prices:%d", strconv.Itoa(p.CustID)))
+	go webhook.Publish(webhook.PriceChanged, p.CustID, p.change())
 	return nil
 }
 
+// change is the price.changed event data of the price.
+func (p *Price) change() webhook.PriceChange {
+	return webhook.PriceChange{PartID: p.PartID, CustomerID: p.CustID, Source: webhook.SourceCustomer, Price: p.Price, Sale: p.IsSale == 1}
+}
+
+// checkMAP rejects a price below its part's enforced MAP price while
+// it's in effect, with a *pricing.Violation.
+func (p *Price) checkMAP() error {
+	policy, err := pricing.LoadMAPPolicy(0, p.PartID)
+	if err != nil {
+		return err
+	}
+	cp := p.customerPrice()
+	if v := policy.Check(p.CustID, p.PartID, p.Price, cp.SaleStart, cp.SaleEnd, time.Now()); v != nil {
+		return v
+	}
+	return nil
+}
+
+// checkSale rejects a sale whose dates overlap another sale the
+// customer has on the part, with a *pricing.SaleOverlap.
+func (p *Price) checkSale(db *sql.DB) error {
+	sale := p.customerPrice()
+	if !sale.Sale() {
+		return nil
+	}
+
+	rows, err := db.Query(getPartPrices, p.CustID, p.PartID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var prices []pricing.CustomerPrice
+	for rows.Next() {
+		var cp pricing.CustomerPrice
+		var isSale *int
+		if err = rows.Scan(&cp.ID, &cp.CustomerID, &cp.PartID, &cp.Price, &isSale, &cp.SaleStart, &cp.SaleEnd); err != nil {
+			return err
+		}
+		cp.IsSale = isSale != nil && *isSale == 1
+		prices = append(prices, cp)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return pricing.CheckSale(sale, prices)
+}
+
+// customerPrice is the price as pricing evaluates it; zero sale dates
+// are no dates.
+func (p *Price) customerPrice() pricing.CustomerPrice {
+	cp := pricing.CustomerPrice{ID: p.ID, CustomerID: p.CustID, PartID: p.PartID, Price: p.Price, IsSale: p.IsSale == 1}
+	if !p.SaleStart.IsZero() {
+		start := p.SaleStart
+		cp.SaleStart = &start
+	}
+	if !p.SaleEnd.IsZero() {
+		end := p.SaleEnd
+		cp.SaleEnd = &end
+	}
+	return cp
+}
+
 func (p *Price) Delete() error {
 	db, err := sql.Open("mysql", database.ConnectionString())
 	if err != nil {
@@ -0,0 +1,133 @@
+package customer
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/pricing"
+)
+
+const (
+	SaleActive   = "active"
+	SaleUpcoming = "upcoming"
+)
+
+var (
+	getSaleCalendar = `select cp.cust_price_id, cp.partID, p.oldPartNumber, cp.price, cp.isSale, cp.sale_start, cp.sale_end,
+		(select max(r.price) from CustomerPricing as r
+			where r.cust_id = cp.cust_id and r.partID = cp.partID
+			and (r.isSale is null or r.isSale = 0) and r.sale_start is null and r.sale_end is null) as regular
+		from CustomerPricing as cp
+		join Part as p on p.partID = cp.partID
+		where cp.cust_id = ?
+		and (cp.isSale = 1 or cp.sale_start is not null or cp.sale_end is not null)
+		and (cp.sale_end is null or cp.sale_end >= date(?))
+		and (cp.sale_start is null or cp.sale_start <= ?)
+		order by cp.sale_start, p.oldPartNumber`
+)
+
+// SaleCalendarEntry is a customer's sale of a part on the sale calendar.
+type SaleCalendarEntry struct {
+	PriceID      int        `json:"priceId" xml:"priceId,attr"`
+	PartID       int        `json:"partId" xml:"partId,attr"`
+	PartNumber   string     `json:"partNumber" xml:"partNumber,attr"`
+	Price        float64    `json:"price" xml:"price,attr"`
+	RegularPrice *float64   `json:"regularPrice,omitempty" xml:"regularPrice,attr,omitempty"`
+	Start        *time.Time `json:"start,omitempty" xml:"start,attr,omitempty"`
+	End          *time.Time `json:"end,omitempty" xml:"end,attr,omitempty"`
+	Status       string     `json:"status" xml:"status,attr"`
+	// Overlaps are the IDs of the customer's other sales of the part that
+	// run at the same time, which were saved before overlaps were rejected.
+	Overlaps []int `json:"overlaps,omitempty" xml:"overlaps>id,omitempty"`
+}
+
+// SaleCalendar lists a customer's sales that are on or start between
+// from and to, active ones first and then by start date. customerID is
+// the customer's cust_id.
+func SaleCalendar(customerID int, from, to time.Time) ([]SaleCalendarEntry, error) {
+	entries := make([]SaleCalendarEntry, 0)
+
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return entries, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(getSaleCalendar, customerID, from, to)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	var sales []pricing.CustomerPrice
+	for rows.Next() {
+		var e SaleCalendarEntry
+		var partNumber *string
+		var isSale *int
+		if err = rows.Scan(&e.PriceID, &e.PartID, &partNumber, &e.Price, &isSale, &e.Start, &e.End, &e.RegularPrice); err != nil {
+			return entries, err
+		}
+		if partNumber != nil {
+			e.PartNumber = *partNumber
+		}
+		sale := pricing.CustomerPrice{
+			ID:         e.PriceID,
+			CustomerID: customerID,
+			PartID:     e.PartID,
+			Price:      e.Price,
+			IsSale:     true,
+			SaleStart:  e.Start,
+			SaleEnd:    e.End,
+		}
+		// the query keeps sales ending on from's day, which run through
+		// it when they end at midnight; those that ended earlier that
+		// day are left out here
+		if !sale.Active(from) && (e.Start == nil || !e.Start.After(from)) {
+			continue
+		}
+		entries = append(entries, e)
+		sales = append(sales, sale)
+	}
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	calendar(entries, sales, time.Now())
+	return entries, nil
+}
+
+// calendar sets the status and overlaps of entries, from their sales at
+// the same index, and orders them.
+func calendar(entries []SaleCalendarEntry, sales []pricing.CustomerPrice, now time.Time) {
+	for i := range entries {
+		entries[i].Status = SaleUpcoming
+		if sales[i].Active(now) {
+			entries[i].Status = SaleActive
+		}
+		for _, other := range sales {
+			if other.ID == sales[i].ID || other.PartID != sales[i].PartID {
+				continue
+			}
+			if _, ok := pricing.CheckSale(sales[i], []pricing.CustomerPrice{other}).(*pricing.SaleOverlap); ok {
+				entries[i].Overlaps = append(entries[i].Overlaps, other.ID)
+			}
+		}
+	}
+	sort.Stable(byStatusAndStart(entries))
+}
+
+type byStatusAndStart []SaleCalendarEntry
+
+func (s byStatusAndStart) Len() int      { return len(s) }
+func (s byStatusAndStart) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byStatusAndStart) Less(i, j int) bool {
+	if s[i].Status != s[j].Status {
+		return s[i].Status == SaleActive
+	}
+	if s[i].Start == nil || s[j].Start == nil {
+		return s[i].Start == nil && s[j].Start != nil
+	}
+	return s[i].Start.Before(*s[j].Start)
+}
@@ -154,6 +154,12 @@ var (
 								where UPPER(akt.type) != ? && UPPER(ak.api_key) = UPPER(?)
 								limit 1`
 
+	privateKeyUser = `select cu.NotCustomer from CustomerUser as cu
+								join ApiKey as ak on cu.id = ak.user_id
+								join ApiKeyType as akt on ak.type_id = akt.id
+								where UPPER(akt.type) = ? && UPPER(ak.api_key) = UPPER(?) && cu.active = 1
+								limit 1`
+
 	customerUserFromId = `select cu.* from CustomerUser as cu
 							join ApiKey as ak on cu.id = ak.user_id
 							join ApiKeyType as akt on ak.type_id = akt.id
@@ -485,6 +491,27 @@ func GetCustomerUserFromKey(key string) (u CustomerUser, err error) {
 	return
 }
 
+// PrivateKeyAccess reports whether the key is the private API key of an
+// active user, and whether that user is internal staff (NotCustomer)
+// rather than a customer's employee.
+func PrivateKeyAccess(key string) (private, staff bool, err error) {
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return false, false, err
+	}
+	defer db.Close()
+
+	var notCustomer sql.NullBool
+	err = db.QueryRow(privateKeyUser, PRIVATE_KEY_TYPE, key).Scan(&notCustomer)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, notCustomer.Valid && notCustomer.Bool, nil
+}
+
 //Takes UUID CustomerID; deletes all CustomerUser with that CustID and their API Keys
 func DeleteCustomerUsersByCustomerID(customerID int) error {
 
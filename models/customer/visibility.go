@@ -0,0 +1,106 @@
+package customer
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/helpers/redis"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	visibilityCollection = "visibility_rules"
+	visibilityPrefix     = "visibility:"
+)
+
+// VisibilityRules are the catalog visibility rules of a customer.
+type VisibilityRules struct {
+	CustomerID            int `bson:"customer_id" json:"customer_id" xml:"customer_id,attr"`
+	apicontext.Visibility `bson:",inline" xml:"rules"`
+}
+
+// GetVisibility returns the visibility rules of a customer, which are
+// empty when none have been set. They are cached in redis, since they
+// are loaded into the data context of every request.
+func GetVisibility(customerID int) (*apicontext.Visibility, error) {
+	redis_key := visibilityPrefix + strconv.Itoa(customerID)
+	var v apicontext.Visibility
+	data, err := redis.Get(redis_key)
+	if err == nil && len(data) > 0 {
+		if err = json.Unmarshal(data, &v); err == nil {
+			return &v, nil
+		}
+	}
+
+	rules, err := getVisibilityRules(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	go redis.Setex(redis_key, rules.Visibility, redis.CacheTimeout)
+	return &rules.Visibility, nil
+}
+
+func getVisibilityRules(customerID int) (VisibilityRules, error) {
+	rules := VisibilityRules{CustomerID: customerID}
+	if err := database.Init(); err != nil {
+		return rules, err
+	}
+	session := database.ProductMongoSession.Copy()
+	defer session.Close()
+
+	err := session.DB(database.ProductDatabase).C(visibilityCollection).Find(bson.M{"customer_id": customerID}).One(&rules)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return rules, err
+}
+
+// Get loads the visibility rules of r.CustomerID.
+func (r *VisibilityRules) Get() error {
+	rules, err := getVisibilityRules(r.CustomerID)
+	if err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
+
+// Save replaces the visibility rules of r.CustomerID.
+func (r *VisibilityRules) Save() error {
+	if err := database.Init(); err != nil {
+		return err
+	}
+	session := database.ProductMongoSession.Copy()
+	defer session.Close()
+
+	_, err := session.DB(database.ProductDatabase).C(visibilityCollection).Upsert(bson.M{"customer_id": r.CustomerID}, r)
+	if err != nil {
+		return err
+	}
+	// cleared before returning, so a request after the save can't
+	// cache the old rules again
+	redis.Delete(visibilityPrefix + strconv.Itoa(r.CustomerID))
+	return nil
+}
+
+// Delete removes the visibility rules of r.CustomerID, so it sees every
+// part of its brands again.
+func (r *VisibilityRules) Delete() error {
+	if err := database.Init(); err != nil {
+		return err
+	}
+	session := database.ProductMongoSession.Copy()
+	defer session.Close()
+
+	err := session.DB(database.ProductDatabase).C(visibilityCollection).Remove(bson.M{"customer_id": r.CustomerID})
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	r.Visibility = apicontext.Visibility{}
+	redis.Delete(visibilityPrefix + strconv.Itoa(r.CustomerID))
+	return nil
+}
@@ -0,0 +1,479 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/products"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// ChangeCollectionName holds one document per detected change.
+	ChangeCollectionName = "part_changes"
+
+	// SnapshotCollectionName holds the last captured state of every part,
+	// which new data is diffed against.
+	SnapshotCollectionName = "part_snapshots"
+
+	Created  = "created"
+	Modified = "modified"
+	Removed  = "removed"
+)
+
+var (
+	hooks     []func(Change)
+	hookMutex sync.Mutex
+)
+
+// Snapshot is the tracked state of a part at a point in time. Pricing
+// and attributes are kept as sorted pairs since their names aren't safe
+// to use as Mongo keys.
+type Snapshot struct {
+	PartID           int       `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	PartNumber       string    `bson:"part_number" json:"part_number" xml:"part_number,attr"`
+	BrandID          int       `bson:"brand_id" json:"brand_id" xml:"brand_id,attr"`
+	Status           int       `bson:"status" json:"status" xml:"status"`
+	ShortDesc        string    `bson:"short_description" json:"short_description" xml:"short_description"`
+	PriceCode        int       `bson:"price_code" json:"price_code" xml:"price_code"`
+	UPC              string    `bson:"upc" json:"upc" xml:"upc"`
+	ReplacedBy       int       `bson:"replaced_by" json:"replaced_by" xml:"replaced_by"`
+	Pricing          []Pair    `bson:"pricing" json:"pricing" xml:"pricing>price"`
+	Attributes       []Pair    `bson:"attributes" json:"attributes" xml:"attributes>attribute"`
+	Vehicles         []string  `bson:"vehicles" json:"vehicles" xml:"vehicles>vehicle"`
+	Categories       []string  `bson:"categories" json:"categories" xml:"categories>category"`
+	PartDateModified time.Time `bson:"part_date_modified" json:"part_date_modified" xml:"part_date_modified"`
+	TakenAt          time.Time `bson:"taken_at" json:"taken_at" xml:"taken_at"`
+}
+
+// Pair is a named value of a snapshot.
+type Pair struct {
+	Key   string `bson:"key" json:"key" xml:"key,attr"`
+	Value string `bson:"value" json:"value" xml:",chardata"`
+}
+
+// FieldChange describes how a single field of a part changed. Scalar
+// fields report Before and After, list fields report what was Added and
+// Removed.
+type FieldChange struct {
+	Field   string   `bson:"field" json:"field" xml:"field,attr"`
+	Before  string   `bson:"before,omitempty" json:"before,omitempty" xml:"before,omitempty"`
+	After   string   `bson:"after,omitempty" json:"after,omitempty" xml:"after,omitempty"`
+	Added   []string `bson:"added,omitempty" json:"added,omitempty" xml:"added>value,omitempty"`
+	Removed []string `bson:"removed,omitempty" json:"removed,omitempty" xml:"removed>value,omitempty"`
+}
+
+// Change is a recorded difference between two snapshots of a part.
+type Change struct {
+	ID         bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	PartID     int           `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	PartNumber string        `bson:"part_number" json:"part_number" xml:"part_number,attr"`
+	BrandID    int           `bson:"brand_id" json:"brand_id" xml:"brand_id,attr"`
+	Type       string        `bson:"type" json:"type" xml:"type,attr"`
+	Source     string        `bson:"source" json:"source" xml:"source,attr"`
+	ChangedAt  time.Time     `bson:"changed_at" json:"changed_at" xml:"changed_at,attr"`
+	Fields     []FieldChange `bson:"fields" json:"fields,omitempty" xml:"fields>field,omitempty"`
+}
+
+// Feed is a page of changes for distributors polling the catalog. The
+// next page starts after Since and After, which are the changed_at and
+// id of the last change on this page.
+type Feed struct {
+	Since   time.Time     `json:"since" xml:"since,attr"`
+	After   bson.ObjectId `json:"after,omitempty" xml:"after,attr,omitempty"`
+	Total   int           `json:"total" xml:"total,attr"`
+	Changes []Change      `json:"changes" xml:"changes>change"`
+}
+
+// Take captures the tracked state of a part.
+func Take(p products.Part) Snapshot {
+	s := Snapshot{
+		PartID:           p.ID,
+		PartNumber:       p.PartNumber,
+		BrandID:          p.Brand.ID,
+		Status:           p.Status,
+		ShortDesc:        p.ShortDesc,
+		PriceCode:        p.PriceCode,
+		UPC:              p.UPC,
+		ReplacedBy:       p.ReplacedBy,
+		PartDateModified: p.DateModified,
+		TakenAt:          time.Now(),
+	}
+
+	for _, pr := range p.Pricing {
+		s.Pricing = append(s.Pricing, Pair{Key: pr.Type, Value: strconv.FormatFloat(pr.Price, 'f', 2, 64)})
+	}
+	for _, a := range p.Attributes {
+		s.Attributes = append(s.Attributes, Pair{Key: a.Key, Value: a.Value})
+	}
+	for _, v := range p.Vehicles {
+		s.Vehicles = append(s.Vehicles, strings.TrimSpace(fmt.Sprintf("%s %s %s %s", v.Year, v.Make, v.Model, v.Style)))
+	}
+	for _, c := range p.Categories {
+		s.Categories = append(s.Categories, strconv.Itoa(c.CategoryID))
+	}
+
+	sort.Sort(byKey(s.Pricing))
+	sort.Sort(byKey(s.Attributes))
+	sort.Strings(s.Vehicles)
+	sort.Strings(s.Categories)
+
+	return s
+}
+
+// Diff lists the fields that differ between two snapshots of a part.
+func Diff(before, after Snapshot) []FieldChange {
+	var changes []FieldChange
+
+	scalar := func(field, b, a string) {
+		if b != a {
+			changes = append(changes, FieldChange{Field: field, Before: b, After: a})
+		}
+	}
+	scalar("status", strconv.Itoa(before.Status), strconv.Itoa(after.Status))
+	scalar("short_description", before.ShortDesc, after.ShortDesc)
+	scalar("price_code", strconv.Itoa(before.PriceCode), strconv.Itoa(after.PriceCode))
+	scalar("upc", before.UPC, after.UPC)
+	scalar("replaced_by", strconv.Itoa(before.ReplacedBy), strconv.Itoa(after.ReplacedBy))
+
+	changes = append(changes, diffPairs("pricing", before.Pricing, after.Pricing)...)
+	changes = append(changes, diffPairs("attributes", before.Attributes, after.Attributes)...)
+
+	if fc, ok := diffSet("vehicle_applications", before.Vehicles, after.Vehicles); ok {
+		changes = append(changes, fc)
+	}
+	if fc, ok := diffSet("categories", before.Categories, after.Categories); ok {
+		changes = append(changes, fc)
+	}
+
+	return changes
+}
+
+// Track diffs each part against its last snapshot and records a change
+// when they differ. Parts that have never been seen are recorded as
+// created. The source names what produced the data, e.g. "sync".
+func Track(parts []products.Part, source string) ([]Change, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var changes []Change
+	for _, p := range parts {
+		var prev Snapshot
+		var prevPtr *Snapshot
+		err = session.DB(database.ProductDatabase).C(SnapshotCollectionName).Find(bson.M{"part_id": p.ID}).One(&prev)
+		switch err {
+		case nil:
+			prevPtr = &prev
+		case mgo.ErrNotFound:
+		default:
+			return changes, err
+		}
+
+		c, err := record(session, prevPtr, Take(p), source)
+		if err != nil {
+			return changes, err
+		}
+		if c != nil {
+			changes = append(changes, *c)
+		}
+	}
+
+	return changes, nil
+}
+
+// Scan compares every part in the catalog with its last snapshot. It
+// picks up changes made by importers that don't call Track, as well as
+// parts that were removed. The first scan only stores the baseline.
+func Scan() (int, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	db := session.DB(database.ProductDatabase)
+
+	snapshots := make(map[int]Snapshot)
+	var snap Snapshot
+	iter := db.C(SnapshotCollectionName).Find(bson.M{}).Iter()
+	for iter.Next(&snap) {
+		snapshots[snap.PartID] = snap
+		snap = Snapshot{}
+	}
+	if err = iter.Close(); err != nil {
+		return 0, err
+	}
+	baseline := len(snapshots) == 0
+
+	var recorded int
+	seen := make(map[int]bool)
+	var p products.Part
+	iter = db.C(database.ProductCollectionName).Find(bson.M{}).Iter()
+	for iter.Next(&p) {
+		seen[p.ID] = true
+		prev, ok := snapshots[p.ID]
+		next := Take(p)
+		p = products.Part{}
+
+		var prevPtr *Snapshot
+		if ok {
+			prevPtr = &prev
+		} else if baseline {
+			if err = saveSnapshot(session, next); err != nil {
+				iter.Close()
+				return recorded, err
+			}
+			continue
+		}
+
+		c, err := record(session, prevPtr, next, "scan")
+		if err != nil {
+			iter.Close()
+			return recorded, err
+		}
+		if c != nil {
+			recorded++
+		}
+	}
+	if err = iter.Close(); err != nil {
+		return recorded, err
+	}
+
+	for id, prev := range snapshots {
+		if seen[id] {
+			continue
+		}
+		c := Change{
+			ID:         bson.NewObjectId(),
+			PartID:     prev.PartID,
+			PartNumber: prev.PartNumber,
+			BrandID:    prev.BrandID,
+			Type:       Removed,
+			Source:     "scan",
+			ChangedAt:  time.Now(),
+		}
+		if err = db.C(ChangeCollectionName).Insert(c); err != nil {
+			return recorded, err
+		}
+		if _, err = db.C(SnapshotCollectionName).RemoveAll(bson.M{"part_id": id}); err != nil {
+			return recorded, err
+		}
+		notify(c)
+		recorded++
+	}
+
+	return recorded, nil
+}
+
+// ForPart returns the changes recorded for a part, newest first.
+func ForPart(partID int, dtx *apicontext.DataContext) ([]Change, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	changes := make([]Change, 0)
+	err = session.DB(database.ProductDatabase).C(ChangeCollectionName).Find(bson.M{
+		"part_id":  partID,
+		"brand_id": bson.M{"$in": dtx.BrandArray},
+	}).Sort("-changed_at").All(&changes)
+
+	return changes, err
+}
+
+// Since returns up to count changes recorded after the given time, oldest
+// first. Changes sharing a changed_at are ordered by id, so a client
+// polls with the since and after of the previous feed (the changed_at and
+// id of the last change it received) without skipping ties.
+func Since(since time.Time, after string, count int, dtx *apicontext.DataContext) (Feed, error) {
+	feed := Feed{
+		Changes: make([]Change, 0),
+	}
+	if since.IsZero() {
+		return feed, errors.New("a since date is required")
+	}
+	if after != "" && !bson.IsObjectIdHex(after) {
+		return feed, errors.New("invalid change id")
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return feed, err
+	}
+	defer session.Close()
+
+	query := bson.M{
+		"changed_at": bson.M{"$gt": since},
+		"brand_id":   bson.M{"$in": dtx.BrandArray},
+	}
+	if after != "" {
+		delete(query, "changed_at")
+		query["$or"] = []bson.M{
+			{"changed_at": bson.M{"$gt": since}},
+			{"changed_at": since, "_id": bson.M{"$gt": bson.ObjectIdHex(after)}},
+		}
+	}
+	col := session.DB(database.ProductDatabase).C(ChangeCollectionName)
+	if feed.Total, err = col.Find(query).Count(); err != nil {
+		return feed, err
+	}
+
+	if err = col.Find(query).Sort("changed_at", "_id").Limit(count).All(&feed.Changes); err != nil {
+		return feed, err
+	}
+
+	feed.Since = since
+	if after != "" {
+		feed.After = bson.ObjectIdHex(after)
+	}
+	if n := len(feed.Changes); n > 0 {
+		feed.Since = feed.Changes[n-1].ChangedAt
+		feed.After = feed.Changes[n-1].ID
+	}
+	return feed, nil
+}
+
+// Schedule scans the catalog for changes on the given interval. It
+// blocks, so it should be started in its own goroutine.
+func Schedule(interval time.Duration) {
+	for {
+		if _, err := Scan(); err != nil {
+			log.Printf("part history scan failed: %s\n", err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// record stores a change between the previous snapshot (nil when the
+// part is new) and the next one, and replaces the stored snapshot.
+func record(session *mgo.Session, prev *Snapshot, next Snapshot, source string) (*Change, error) {
+	c := Change{
+		ID:         bson.NewObjectId(),
+		PartID:     next.PartID,
+		PartNumber: next.PartNumber,
+		BrandID:    next.BrandID,
+		Type:       Created,
+		Source:     source,
+		ChangedAt:  next.TakenAt,
+	}
+	if prev != nil {
+		c.Type = Modified
+		c.Fields = Diff(*prev, next)
+		if len(c.Fields) == 0 {
+			return nil, nil
+		}
+	}
+
+	if err := session.DB(database.ProductDatabase).C(ChangeCollectionName).Insert(c); err != nil {
+		return nil, err
+	}
+	if err := saveSnapshot(session, next); err != nil {
+		return nil, err
+	}
+	notify(c)
+
+	return &c, nil
+}
+
+// OnChange registers fn to be called with every change recorded.
+func OnChange(fn func(c Change)) {
+	hookMutex.Lock()
+	hooks = append(hooks, fn)
+	hookMutex.Unlock()
+}
+
+func notify(c Change) {
+	hookMutex.Lock()
+	fns := make([]func(Change), len(hooks))
+	copy(fns, hooks)
+	hookMutex.Unlock()
+	for _, fn := range fns {
+		fn(c)
+	}
+}
+
+func saveSnapshot(session *mgo.Session, s Snapshot) error {
+	_, err := session.DB(database.ProductDatabase).C(SnapshotCollectionName).Upsert(bson.M{"part_id": s.PartID}, s)
+	return err
+}
+
+func diffPairs(field string, before, after []Pair) []FieldChange {
+	b := make(map[string]string)
+	for _, p := range before {
+		b[p.Key] = p.Value
+	}
+	a := make(map[string]string)
+	for _, p := range after {
+		a[p.Key] = p.Value
+	}
+
+	var keys []string
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []FieldChange
+	for _, k := range keys {
+		if b[k] != a[k] {
+			changes = append(changes, FieldChange{
+				Field:  field + "." + k,
+				Before: b[k],
+				After:  a[k],
+			})
+		}
+	}
+	return changes
+}
+
+func diffSet(field string, before, after []string) (FieldChange, bool) {
+	fc := FieldChange{Field: field}
+
+	b := make(map[string]bool)
+	for _, v := range before {
+		b[v] = true
+	}
+	a := make(map[string]bool)
+	for _, v := range after {
+		a[v] = true
+		if !b[v] {
+			fc.Added = append(fc.Added, v)
+		}
+	}
+	for _, v := range before {
+		if !a[v] {
+			fc.Removed = append(fc.Removed, v)
+		}
+	}
+
+	return fc, len(fc.Added) > 0 || len(fc.Removed) > 0
+}
+
+type byKey []Pair
+
+func (s byKey) Len() int      { return len(s) }
+func (s byKey) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byKey) Less(i, j int) bool {
+	if s[i].Key == s[j].Key {
+		return s[i].Value < s[j].Value
+	}
+	return s[i].Key < s[j].Key
+}
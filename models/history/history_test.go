@@ -0,0 +1,49 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiff(t *testing.T) {
+	before := products.Part{
+		ID:         11000,
+		PartNumber: "11000",
+		Status:     800,
+		ShortDesc:  "Class 1 Trailer Hitch",
+		Pricing:    []products.Price{{Type: "List", Price: 199.99}, {Type: "Jobber", Price: 150}},
+		Attributes: []products.Attribute{{Key: "Finish", Value: "Carbide Black"}, {Key: "GTW", Value: "2,000 lbs."}},
+		Vehicles:   []products.VehicleApplication{{Year: "2015", Make: "Ford", Model: "Focus"}},
+		Categories: []products.Category{{CategoryID: 10}},
+	}
+
+	Convey("Testing Diff with no changes", t, func() {
+		So(Diff(Take(before), Take(before)), ShouldBeEmpty)
+	})
+
+	Convey("Testing Take ordering", t, func() {
+		reordered := before
+		reordered.Pricing = []products.Price{before.Pricing[1], before.Pricing[0]}
+		So(Diff(Take(before), Take(reordered)), ShouldBeEmpty)
+	})
+
+	Convey("Testing Diff", t, func() {
+		after := before
+		after.Status = 900
+		after.Pricing = []products.Price{{Type: "List", Price: 209.99}, {Type: "Jobber", Price: 150}}
+		after.Attributes = []products.Attribute{{Key: "Finish", Value: "Carbide Black"}, {Key: "TW", Value: "200 lbs."}}
+		after.Vehicles = []products.VehicleApplication{{Year: "2016", Make: "Ford", Model: "Focus"}}
+
+		changes := Diff(Take(before), Take(after))
+		So(len(changes), ShouldEqual, 5)
+		So(changes[0], ShouldResemble, FieldChange{Field: "status", Before: "800", After: "900"})
+		So(changes[1], ShouldResemble, FieldChange{Field: "pricing.List", Before: "199.99", After: "209.99"})
+		So(changes[2], ShouldResemble, FieldChange{Field: "attributes.GTW", Before: "2,000 lbs."})
+		So(changes[3], ShouldResemble, FieldChange{Field: "attributes.TW", After: "200 lbs."})
+		So(changes[4].Field, ShouldEqual, "vehicle_applications")
+		So(changes[4].Added, ShouldResemble, []string{"2016 Ford Focus"})
+		So(changes[4].Removed, ShouldResemble, []string{"2015 Ford Focus"})
+	})
+}
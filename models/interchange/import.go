@@ -0,0 +1,312 @@
+package interchange
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/search/index"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const maxErrors = 100
+
+// columns maps the accepted CSV headers to the field they hold.
+var columns = map[string]string{
+	"competitor":             "competitor",
+	"competitor brand":       "competitor",
+	"competitor part":        "competitor_part",
+	"competitor part number": "competitor_part",
+	"part id":                "part_id",
+	"part":                   "part_number",
+	"part number":            "part_number",
+	"quality":                "quality",
+	"match quality":          "quality",
+	"notes":                  "notes",
+}
+
+// ImportResult reports what an import changed and the rows it couldn't
+// use.
+type ImportResult struct {
+	Imported int        `json:"imported" xml:"imported,attr"`
+	Removed  int        `json:"removed" xml:"removed,attr"`
+	Skipped  int        `json:"skipped" xml:"skipped,attr"`
+	Errors   []RowError `json:"errors" xml:"errors>error"`
+}
+
+// Row is an interchange read from a line of the CSV.
+type Row struct {
+	Line int
+	Interchange
+}
+
+// RowError is a problem with a line of the CSV. Lines count the records
+// of the CSV from the header, which is line 1; blank lines aren't
+// counted.
+type RowError struct {
+	Line    int    `json:"line" xml:"line,attr"`
+	Message string `json:"message" xml:",chardata"`
+}
+
+// Parse reads interchanges from a CSV with a header row. Columns are
+// matched by name, ignoring case, spaces and underscores: competitor,
+// competitor_part, part_id or part_number, and the optional quality
+// (defaults to similar) and notes. Parts aren't resolved, so part_id is
+// only set when the CSV has it.
+func Parse(r io.Reader) ([]Row, []RowError, error) {
+	rd := csv.NewReader(r)
+	rd.FieldsPerRecord = -1
+	rd.TrimLeadingSpace = true
+
+	header, err := rd.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the header row: %s", err.Error())
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.Replace(h, "_", " ", -1)))
+		if f, ok := columns[name]; ok {
+			cols[f] = i
+		}
+	}
+	for _, f := range []string{"competitor", "competitor_part"} {
+		if _, ok := cols[f]; !ok {
+			return nil, nil, fmt.Errorf("missing the %s column", f)
+		}
+	}
+	_, hasID := cols["part_id"]
+	_, hasNumber := cols["part_number"]
+	if !hasID && !hasNumber {
+		return nil, nil, errors.New("missing the part_id or part_number column")
+	}
+
+	var rows []Row
+	var errs []RowError
+	line := 1
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+
+		get := func(f string) string {
+			i, ok := cols[f]
+			if !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		ic := Interchange{
+			CompetitorName: get("competitor"),
+			CompetitorPart: get("competitor_part"),
+			PartNumber:     get("part_number"),
+			Quality:        strings.ToLower(get("quality")),
+			Notes:          get("notes"),
+		}
+		ic.Competitor = CompetitorKey(ic.CompetitorName)
+		ic.Normalized = index.NormalizePartNumber(ic.CompetitorPart)
+		if ic.Quality == "" {
+			ic.Quality = Similar
+		}
+
+		switch {
+		case ic.Competitor == "":
+			errs = append(errs, RowError{Line: line, Message: "missing the competitor"})
+			continue
+		case ic.Normalized == "":
+			errs = append(errs, RowError{Line: line, Message: "missing the competitor part number"})
+			continue
+		case !ValidQuality(ic.Quality):
+			errs = append(errs, RowError{Line: line, Message: fmt.Sprintf("unknown quality %q, expected exact, similar or alternative", ic.Quality)})
+			continue
+		}
+
+		if id := get("part_id"); id != "" {
+			ic.PartID, err = strconv.Atoi(id)
+			if err != nil {
+				errs = append(errs, RowError{Line: line, Message: fmt.Sprintf("invalid part id %q", id)})
+				continue
+			}
+		} else if ic.PartNumber == "" {
+			errs = append(errs, RowError{Line: line, Message: "missing the part id or part number"})
+			continue
+		}
+
+		rows = append(rows, Row{Line: line, Interchange: ic})
+	}
+
+	return rows, errs, nil
+}
+
+// Import loads interchanges from a CSV (see Parse), resolving part
+// numbers to our parts. Rows for a competitor part and part that already
+// exist are updated. With replace, the existing interchanges of every
+// competitor in the file are removed first.
+func Import(r io.Reader, replace bool) (*ImportResult, error) {
+	rows, errs, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	res := &ImportResult{
+		Skipped: len(errs),
+		Errors:  errs,
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	parts, err := loadParts(session)
+	if err != nil {
+		return nil, err
+	}
+
+	var valid []Interchange
+	for _, row := range rows {
+		ic := row.Interchange
+		if err := parts.resolve(&ic); err != nil {
+			res.Skipped++
+			res.Errors = append(res.Errors, RowError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+		valid = append(valid, ic)
+	}
+	sort.Stable(byLine(res.Errors))
+	if len(res.Errors) > maxErrors {
+		res.Errors = res.Errors[:maxErrors]
+	}
+
+	c := session.DB(database.ProductDatabase).C(CollectionName)
+	if replace {
+		seen := make(map[string]bool)
+		var comps []string
+		for _, ic := range valid {
+			if !seen[ic.Competitor] {
+				seen[ic.Competitor] = true
+				comps = append(comps, ic.Competitor)
+			}
+		}
+		if len(comps) > 0 {
+			info, err := c.RemoveAll(bson.M{"competitor": bson.M{"$in": comps}})
+			if err != nil {
+				return nil, err
+			}
+			if info != nil {
+				res.Removed = info.Removed
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, ic := range valid {
+		_, err := c.Upsert(bson.M{
+			"competitor": ic.Competitor,
+			"normalized": ic.Normalized,
+			"part_id":    ic.PartID,
+		}, bson.M{"$set": bson.M{
+			"competitor_name": ic.CompetitorName,
+			"competitor_part": ic.CompetitorPart,
+			"part_number":     ic.PartNumber,
+			"brand_id":        ic.BrandID,
+			"quality":         ic.Quality,
+			"notes":           ic.Notes,
+			"imported_at":     now,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		res.Imported++
+	}
+
+	if res.Errors == nil {
+		res.Errors = []RowError{}
+	}
+	return res, nil
+}
+
+type partRef struct {
+	ID         int    `bson:"id"`
+	PartNumber string `bson:"part_number"`
+	Brand      struct {
+		ID int `bson:"id"`
+	} `bson:"brand"`
+}
+
+// partIndex finds our parts by ID and normalized part number.
+type partIndex struct {
+	byID     map[int]partRef
+	byNumber map[string][]partRef
+}
+
+func loadParts(session *mgo.Session) (*partIndex, error) {
+	var refs []partRef
+	err := session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(nil).Select(bson.M{
+		"id":          1,
+		"part_number": 1,
+		"brand.id":    1,
+	}).All(&refs)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPartIndex(refs), nil
+}
+
+func newPartIndex(refs []partRef) *partIndex {
+	pi := &partIndex{
+		byID:     make(map[int]partRef, len(refs)),
+		byNumber: make(map[string][]partRef, len(refs)),
+	}
+	for _, p := range refs {
+		pi.byID[p.ID] = p
+		n := index.NormalizePartNumber(p.PartNumber)
+		pi.byNumber[n] = append(pi.byNumber[n], p)
+	}
+	return pi
+}
+
+// resolve fills in the part ID, number and brand of an interchange.
+func (pi *partIndex) resolve(ic *Interchange) error {
+	var p partRef
+	if ic.PartID != 0 {
+		var ok bool
+		if p, ok = pi.byID[ic.PartID]; !ok {
+			return fmt.Errorf("no part with id %d", ic.PartID)
+		}
+	} else {
+		matches := pi.byNumber[index.NormalizePartNumber(ic.PartNumber)]
+		switch len(matches) {
+		case 0:
+			return fmt.Errorf("no part numbered %q", ic.PartNumber)
+		case 1:
+			p = matches[0]
+		default:
+			return fmt.Errorf("part number %q belongs to %d parts, use part_id instead", ic.PartNumber, len(matches))
+		}
+	}
+
+	ic.PartID = p.ID
+	ic.PartNumber = p.PartNumber
+	ic.BrandID = p.Brand.ID
+	return nil
+}
+
+type byLine []RowError
+
+func (s byLine) Len() int           { return len(s) }
+func (s byLine) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLine) Less(i, j int) bool { return s[i].Line < s[j].Line }
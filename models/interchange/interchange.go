@@ -0,0 +1,156 @@
+package interchange
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/search/index"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// CollectionName holds one document per competitor part and part of
+	// ours it interchanges with.
+	CollectionName = "interchange"
+
+	// Exact parts are drop in replacements for the competitor's part.
+	Exact = "exact"
+	// Similar parts fit the same application with minor differences,
+	// e.g. a different finish or rating.
+	Similar = "similar"
+	// Alternative parts serve the same purpose with a different design.
+	Alternative = "alternative"
+)
+
+var qualityRank = map[string]int{
+	Exact:       0,
+	Similar:     1,
+	Alternative: 2,
+}
+
+// Interchange maps a competitor's part to one of ours.
+type Interchange struct {
+	ID             bson.ObjectId `bson:"_id" json:"-" xml:"-"`
+	Competitor     string        `bson:"competitor" json:"competitor" xml:"competitor,attr"`
+	CompetitorName string        `bson:"competitor_name" json:"competitor_name" xml:"competitor_name,attr"`
+	CompetitorPart string        `bson:"competitor_part" json:"competitor_part" xml:"competitor_part,attr"`
+	Normalized     string        `bson:"normalized" json:"-" xml:"-"`
+	PartID         int           `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	PartNumber     string        `bson:"part_number" json:"part_number" xml:"part_number,attr"`
+	BrandID        int           `bson:"brand_id" json:"brand_id" xml:"brand_id,attr"`
+	Quality        string        `bson:"quality" json:"quality" xml:"quality,attr"`
+	Notes          string        `bson:"notes,omitempty" json:"notes,omitempty" xml:"notes,omitempty"`
+	ImportedAt     time.Time     `bson:"imported_at" json:"imported_at" xml:"imported_at,attr"`
+}
+
+// Competitor is a competitor brand and how many of its parts we
+// interchange with.
+type Competitor struct {
+	Key   string `bson:"_id" json:"key" xml:"key,attr"`
+	Name  string `bson:"name" json:"name" xml:"name,attr"`
+	Parts int    `bson:"parts" json:"parts" xml:"parts,attr"`
+}
+
+// CompetitorKey identifies a competitor brand regardless of case and
+// punctuation, so "B&W" and "b-w" are the same brand.
+func CompetitorKey(name string) string {
+	return strings.ToLower(index.NormalizePartNumber(name))
+}
+
+// ValidQuality reports whether q is a known match quality.
+func ValidQuality(q string) bool {
+	_, ok := qualityRank[q]
+	return ok
+}
+
+// Lookup returns our parts that interchange with a competitor's part,
+// best match first.
+func Lookup(competitor, partNumber string, dtx *apicontext.DataContext) ([]Interchange, error) {
+	key := CompetitorKey(competitor)
+	norm := index.NormalizePartNumber(partNumber)
+	if key == "" || norm == "" {
+		return nil, errors.New("a competitor and part number are required")
+	}
+
+	return find(bson.M{
+		"competitor": key,
+		"normalized": norm,
+		"brand_id":   bson.M{"$in": dtx.BrandArray},
+	})
+}
+
+// ForPart returns the competitor parts that interchange with one of our
+// parts, best match first.
+func ForPart(partID int, dtx *apicontext.DataContext) ([]Interchange, error) {
+	return find(bson.M{
+		"part_id":  partID,
+		"brand_id": bson.M{"$in": dtx.BrandArray},
+	})
+}
+
+// All returns every interchange, for indexing.
+func All() ([]Interchange, error) {
+	return find(nil)
+}
+
+// Competitors lists the competitor brands with interchanges to parts of
+// the caller's brands.
+func Competitors(dtx *apicontext.DataContext) ([]Competitor, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	comps := make([]Competitor, 0)
+	err = session.DB(database.ProductDatabase).C(CollectionName).Pipe([]bson.M{
+		{"$match": bson.M{"brand_id": bson.M{"$in": dtx.BrandArray}}},
+		{"$group": bson.M{
+			"_id":   "$competitor",
+			"name":  bson.M{"$first": "$competitor_name"},
+			"parts": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}).All(&comps)
+
+	return comps, err
+}
+
+func find(qry bson.M) ([]Interchange, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	ics := make([]Interchange, 0)
+	err = session.DB(database.ProductDatabase).C(CollectionName).Find(qry).All(&ics)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byQuality(ics))
+
+	return ics, nil
+}
+
+type byQuality []Interchange
+
+func (s byQuality) Len() int      { return len(s) }
+func (s byQuality) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byQuality) Less(i, j int) bool {
+	if s[i].Quality != s[j].Quality {
+		return qualityRank[s[i].Quality] < qualityRank[s[j].Quality]
+	}
+	if s[i].Competitor != s[j].Competitor {
+		return s[i].Competitor < s[j].Competitor
+	}
+	if s[i].CompetitorPart != s[j].CompetitorPart {
+		return s[i].CompetitorPart < s[j].CompetitorPart
+	}
+	return s[i].PartID < s[j].PartID
+}
@@ -0,0 +1,111 @@
+package interchange
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Testing Parse", t, func() {
+		Convey("with named columns in any order", func() {
+			csv := "Part Number,Competitor,Competitor_Part,Quality,Notes\n" +
+				"13704,B&W,HDRH25,Exact,\n" +
+				"13704,Draw-Tite,75237,,Different finish\n" +
+				"\n" +
+				"13704,,75238,exact,\n" +
+				"13704,Reese,44643,perfect,\n" +
+				",Reese,44644,exact,\n"
+
+			rows, errs, err := Parse(strings.NewReader(csv))
+			So(err, ShouldBeNil)
+			So(len(rows), ShouldEqual, 2)
+
+			So(rows[0].Line, ShouldEqual, 2)
+			So(rows[0].Competitor, ShouldEqual, "bw")
+			So(rows[0].CompetitorName, ShouldEqual, "B&W")
+			So(rows[0].Normalized, ShouldEqual, "HDRH25")
+			So(rows[0].PartNumber, ShouldEqual, "13704")
+			So(rows[0].Quality, ShouldEqual, Exact)
+
+			So(rows[1].Competitor, ShouldEqual, "drawtite")
+			So(rows[1].Quality, ShouldEqual, Similar)
+			So(rows[1].Notes, ShouldEqual, "Different finish")
+
+			So(len(errs), ShouldEqual, 3)
+			So(errs[0].Line, ShouldEqual, 4)
+			So(errs[1].Line, ShouldEqual, 5)
+			So(errs[2].Line, ShouldEqual, 6)
+		})
+
+		Convey("with part ids", func() {
+			rows, errs, err := Parse(strings.NewReader("competitor,competitor part,part id\nReese,44643,12\nReese,44644,abc\n"))
+			So(err, ShouldBeNil)
+			So(len(rows), ShouldEqual, 1)
+			So(rows[0].PartID, ShouldEqual, 12)
+			So(len(errs), ShouldEqual, 1)
+		})
+
+		Convey("without required columns", func() {
+			_, _, err := Parse(strings.NewReader("competitor,part number\nReese,13704\n"))
+			So(err, ShouldNotBeNil)
+
+			_, _, err = Parse(strings.NewReader("competitor,competitor part\nReese,44643\n"))
+			So(err, ShouldNotBeNil)
+
+			_, _, err = Parse(strings.NewReader(""))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestResolve(t *testing.T) {
+	refs := []partRef{
+		{ID: 1, PartNumber: "13704"},
+		{ID: 2, PartNumber: "A-2051"},
+		{ID: 3, PartNumber: "4000"},
+		{ID: 4, PartNumber: "4000"},
+	}
+	refs[0].Brand.ID = 1
+	refs[1].Brand.ID = 3
+	pi := newPartIndex(refs)
+
+	Convey("Testing resolve", t, func() {
+		ic := Interchange{PartNumber: "a2051"}
+		So(pi.resolve(&ic), ShouldBeNil)
+		So(ic.PartID, ShouldEqual, 2)
+		So(ic.PartNumber, ShouldEqual, "A-2051")
+		So(ic.BrandID, ShouldEqual, 3)
+
+		ic = Interchange{PartID: 1}
+		So(pi.resolve(&ic), ShouldBeNil)
+		So(ic.PartNumber, ShouldEqual, "13704")
+		So(ic.BrandID, ShouldEqual, 1)
+
+		So(pi.resolve(&Interchange{PartNumber: "99999"}), ShouldNotBeNil)
+		So(pi.resolve(&Interchange{PartID: 99}), ShouldNotBeNil)
+		So(pi.resolve(&Interchange{PartNumber: "4000"}), ShouldNotBeNil)
+	})
+}
+
+func TestOrder(t *testing.T) {
+	Convey("Testing quality order", t, func() {
+		ics := []Interchange{
+			{Competitor: "reese", CompetitorPart: "1", Quality: Alternative},
+			{Competitor: "reese", CompetitorPart: "2", Quality: Exact},
+			{Competitor: "bw", CompetitorPart: "3", Quality: Similar},
+			{Competitor: "bw", CompetitorPart: "4", Quality: Exact},
+		}
+		sort.Sort(byQuality(ics))
+		So(ics[0].CompetitorPart, ShouldEqual, "4")
+		So(ics[1].CompetitorPart, ShouldEqual, "2")
+		So(ics[2].CompetitorPart, ShouldEqual, "3")
+		So(ics[3].CompetitorPart, ShouldEqual, "1")
+
+		So(CompetitorKey(" Draw-Tite "), ShouldEqual, "drawtite")
+		So(ValidQuality("exact"), ShouldBeTrue)
+		So(ValidQuality("perfect"), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,187 @@
+// Package pricelist generates the printable price lists of customers,
+// as spreadsheets or PDF documents.
+package pricelist
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/brand"
+	"github.com/curt-labs/API/models/customer"
+	"github.com/curt-labs/API/models/pricing"
+	"github.com/curt-labs/API/models/products"
+)
+
+// Uncategorized groups the parts without a category, last.
+const Uncategorized = "Other Parts"
+
+// PriceList is a customer's prices for the parts of its brands, grouped
+// by category.
+type PriceList struct {
+	Customer  string    `json:"customer" xml:"customer,attr"`
+	Brand     string    `json:"brand" xml:"brand,attr"`
+	Color     string    `json:"color,omitempty" xml:"color,attr,omitempty"`
+	Currency  string    `json:"currency" xml:"currency,attr"`
+	AsOf      time.Time `json:"as_of" xml:"as_of,attr"`
+	Generated time.Time `json:"generated" xml:"generated,attr"`
+	Groups    []Group   `json:"groups" xml:"groups>group"`
+}
+
+// Group is the parts of a category, by part number.
+type Group struct {
+	Category string `json:"category" xml:"category,attr"`
+	Lines    []Line `json:"lines" xml:"lines>line"`
+}
+
+// Line is a part's prices. A MAP of 0 means the part has none.
+type Line struct {
+	PartID      int     `json:"part_id" xml:"part_id,attr"`
+	PartNumber  string  `json:"part_number" xml:"part_number,attr"`
+	Description string  `json:"description" xml:"description"`
+	UPC         string  `json:"upc,omitempty" xml:"upc,attr,omitempty"`
+	List        float64 `json:"list" xml:"list,attr"`
+	MAP         float64 `json:"map" xml:"map,attr"`
+	Price       float64 `json:"price" xml:"price,attr"`
+	OnSale      bool    `json:"on_sale,omitempty" xml:"on_sale,attr,omitempty"`
+}
+
+// Generate works out the price list of dtx's customer for the parts of
+// its brands, or those in a category and its subcategories, with the
+// prices in effect at asOf, now when it's zero, in dtx's currency.
+func Generate(dtx *apicontext.DataContext, categoryID int, asOf time.Time) (*PriceList, error) {
+	now := time.Now()
+	pl := &PriceList{Currency: pricing.BaseCurrency, AsOf: asOf, Generated: now}
+	if asOf.IsZero() {
+		pl.AsOf = now
+	}
+	if dtx.Currency != "" {
+		pl.Currency = dtx.Currency
+	}
+	if err := pl.header(dtx); err != nil {
+		return nil, err
+	}
+
+	parts, err := products.PriceListParts(categoryID, dtx)
+	if err != nil {
+		return nil, err
+	}
+	if !asOf.IsZero() {
+		if err = products.PricingAsOf(parts, asOf); err != nil {
+			return nil, err
+		}
+	}
+	res, err := products.ResolvePricesAt(parts, dtx, pl.AsOf, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = products.ConvertParts(parts, dtx); err != nil {
+		return nil, err
+	}
+	if res, err = products.ConvertPrices(res, dtx); err != nil {
+		return nil, err
+	}
+
+	lines := make(map[string][]Line)
+	for i, p := range parts {
+		l := Line{
+			PartID:      p.ID,
+			PartNumber:  p.PartNumber,
+			Description: p.ShortDesc,
+			UPC:         p.UPC,
+			Price:       res[i].Price,
+			OnSale:      res[i].Source == pricing.SourceSale,
+		}
+		for _, pr := range p.Pricing {
+			switch strings.ToLower(pr.Type) {
+			case pricing.List:
+				l.List = pr.Price
+			case pricing.MAP:
+				l.MAP = pr.Price
+			}
+		}
+		cat := category(p, categoryID)
+		lines[cat] = append(lines[cat], l)
+	}
+	pl.Groups = groups(lines)
+	return pl, nil
+}
+
+// header fills in whose price list it is.
+func (pl *PriceList) header(dtx *apicontext.DataContext) error {
+	c := customer.Customer{Id: dtx.CustomerID}
+	if err := c.Basics(dtx.APIKey); err != nil {
+		return err
+	}
+	pl.Customer = c.Name
+
+	if dtx.BrandID > 0 {
+		b := brand.Brand{ID: dtx.BrandID}
+		if err := b.Get(); err != nil {
+			return err
+		}
+		pl.Brand, pl.Color = b.Name, b.PrimaryColor
+		if b.FormalName != "" {
+			pl.Brand = b.FormalName
+		}
+	}
+	return nil
+}
+
+// category is the title of the category a part is listed under: its
+// first one in the filtered category, or its first one.
+func category(p products.Part, filter int) string {
+	if len(p.Categories) == 0 {
+		return Uncategorized
+	}
+	title := p.Categories[0].Title
+	for _, c := range p.Categories {
+		if filter > 0 && inPath(c.Path(), filter) {
+			title = c.Title
+			break
+		}
+	}
+	if title == "" {
+		return Uncategorized
+	}
+	return title
+}
+
+func inPath(path []int, id int) bool {
+	for _, p := range path {
+		if p == id {
+			return true
+		}
+	}
+	return false
+}
+
+// groups sorts the groups of lines by category, leaving parts without
+// one for last, and the lines of each by part number.
+func groups(lines map[string][]Line) []Group {
+	gs := make([]Group, 0, len(lines))
+	for cat, ls := range lines {
+		sort.Sort(byPartNumber(ls))
+		gs = append(gs, Group{Category: cat, Lines: ls})
+	}
+	sort.Sort(byCategory(gs))
+	return gs
+}
+
+type byPartNumber []Line
+
+func (s byPartNumber) Len() int           { return len(s) }
+func (s byPartNumber) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPartNumber) Less(i, j int) bool { return s[i].PartNumber < s[j].PartNumber }
+
+type byCategory []Group
+
+func (s byCategory) Len() int      { return len(s) }
+func (s byCategory) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCategory) Less(i, j int) bool {
+	if (s[i].Category == Uncategorized) != (s[j].Category == Uncategorized) {
+		return s[j].Category == Uncategorized
+	}
+	return s[i].Category < s[j].Category
+}
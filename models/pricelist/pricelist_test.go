@@ -0,0 +1,94 @@
+package pricelist
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/curt-labs/API/helpers/xlsx"
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPriceList(t *testing.T) {
+	Convey("Testing category", t, func() {
+		p := products.Part{Categories: []products.Category{
+			{CategoryID: 10, Title: "Trailer Hitches"},
+			{CategoryID: 21, ParentID: 20, Title: "Ball Mounts"},
+		}}
+		So(category(p, 0), ShouldEqual, "Trailer Hitches")
+		So(category(p, 20), ShouldEqual, "Ball Mounts")
+		So(category(p, 99), ShouldEqual, "Trailer Hitches")
+		So(category(products.Part{}, 0), ShouldEqual, Uncategorized)
+	})
+
+	Convey("Testing groups", t, func() {
+		gs := groups(map[string][]Line{
+			"Wiring":        {{PartNumber: "56070"}},
+			Uncategorized:   {{PartNumber: "1"}},
+			"Ball Mounts":   {{PartNumber: "45036"}, {PartNumber: "45020"}},
+			"Cargo Carrier": {{PartNumber: "18153"}},
+		})
+		So(len(gs), ShouldEqual, 4)
+		So(gs[0].Category, ShouldEqual, "Ball Mounts")
+		So(gs[0].Lines[0].PartNumber, ShouldEqual, "45020")
+		So(gs[2].Category, ShouldEqual, "Wiring")
+		So(gs[3].Category, ShouldEqual, Uncategorized)
+	})
+
+	pl := &PriceList{
+		Customer:  "Hitch Dealer",
+		Brand:     "CURT Manufacturing",
+		Color:     "#c41230",
+		Currency:  "CAD",
+		AsOf:      time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+		Generated: time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC),
+		Groups: []Group{{Category: "Ball Mounts", Lines: []Line{
+			{PartID: 45020, PartNumber: "45020", Description: "Class 3 Ball Mount", UPC: "794632450207", List: 64.99, MAP: 49.99, Price: 44.5, OnSale: true},
+			{PartID: 45036, PartNumber: "45036", Description: "Class 3 Ball Mount (Drop)", List: 1234.5},
+		}}},
+	}
+
+	Convey("Testing WriteXLSX", t, func() {
+		var b bytes.Buffer
+		So(pl.WriteXLSX(&b), ShouldBeNil)
+
+		r, err := xlsx.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+		So(err, ShouldBeNil)
+		var rows [][]string
+		for {
+			row, err := r.Read()
+			if err != nil {
+				break
+			}
+			rows = append(rows, row)
+		}
+		So(len(rows), ShouldEqual, 8)
+		So(rows[0][0], ShouldEqual, "CURT Manufacturing Price List")
+		So(rows[2][0], ShouldEqual, "Prices in CAD as of July 1, 2026")
+		So(rows[4][5], ShouldEqual, "Your Price")
+		So(rows[5][0], ShouldEqual, "Ball Mounts")
+		So(rows[6], ShouldResemble, []string{"45020", "Class 3 Ball Mount", "794632450207", "64.99", "49.99", "44.5", "Yes"})
+		So(rows[7][1], ShouldEqual, "Class 3 Ball Mount (Drop)")
+		So(rows[7][3], ShouldEqual, "1234.5")
+	})
+
+	Convey("Testing WritePDF", t, func() {
+		var b bytes.Buffer
+		So(pl.WritePDF(&b), ShouldBeNil)
+		So(bytes.HasPrefix(b.Bytes(), []byte("%PDF-1.4")), ShouldBeTrue)
+		So(bytes.HasSuffix(b.Bytes(), []byte("%%EOF\n")), ShouldBeTrue)
+		So(pl.pdf().Pages(), ShouldEqual, 1)
+		So(pl.format(1234.5), ShouldEqual, "$1,234.50")
+		So(pl.format(0), ShouldEqual, "")
+
+		long := *pl
+		var lines []Line
+		for i := 0; i < 120; i++ {
+			lines = append(lines, Line{PartNumber: strconv.Itoa(10000 + i), List: 10})
+		}
+		long.Groups = []Group{{Category: "Hitches", Lines: lines}}
+		So(long.pdf().Pages(), ShouldEqual, 3)
+	})
+}
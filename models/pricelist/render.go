@@ -0,0 +1,223 @@
+package pricelist
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/curt-labs/API/helpers/pdf"
+	"github.com/curt-labs/API/helpers/xlsx"
+	"github.com/curt-labs/API/models/pricing"
+)
+
+const dateFormat = "January 2, 2006"
+
+// brandColor is the color of the header when the brand has none.
+var brandColor = pdf.Color{R: 0x1f, G: 0x3a, B: 0x5f}
+
+// Title is the title of the price list.
+func (pl *PriceList) Title() string {
+	if pl.Brand == "" {
+		return "Price List"
+	}
+	return pl.Brand + " Price List"
+}
+
+func (pl *PriceList) subtitle() string {
+	return fmt.Sprintf("Prices in %s as of %s", pl.Currency, pl.AsOf.Format(dateFormat))
+}
+
+// WriteXLSX writes the price list as a spreadsheet, with a row for each
+// category followed by its parts.
+func (pl *PriceList) WriteXLSX(w io.Writer) error {
+	x := xlsx.NewWriter(w, "Price List")
+	x.SetWidths(18, 60, 16, 12, 12, 12, 8)
+
+	x.WriteCells([]xlsx.Cell{xlsx.String(pl.Title(), xlsx.Heading)})
+	x.WriteCells([]xlsx.Cell{xlsx.String(pl.Customer, xlsx.Bold)})
+	x.Write([]string{pl.subtitle()})
+	x.Write(nil)
+
+	header := []string{"Part Number", "Description", "UPC", "List", "MAP", "Your Price", "Sale"}
+	cells := make([]xlsx.Cell, len(header))
+	for i, h := range header {
+		cells[i] = xlsx.String(h, xlsx.Bold)
+	}
+	x.WriteCells(cells)
+
+	for _, g := range pl.Groups {
+		x.WriteCells([]xlsx.Cell{xlsx.String(g.Category, xlsx.Bold)})
+		for _, l := range g.Lines {
+			sale := ""
+			if l.OnSale {
+				sale = "Yes"
+			}
+			x.WriteCells([]xlsx.Cell{
+				xlsx.String(l.PartNumber, xlsx.Plain),
+				xlsx.String(l.Description, xlsx.Plain),
+				xlsx.String(l.UPC, xlsx.Plain),
+				money(l.List),
+				money(l.MAP),
+				money(l.Price),
+				xlsx.String(sale, xlsx.Plain),
+			})
+		}
+	}
+	return x.Close()
+}
+
+func money(amount float64) xlsx.Cell {
+	if amount == 0 {
+		return xlsx.String("", xlsx.Plain)
+	}
+	return xlsx.Number(amount, xlsx.Money)
+}
+
+// the layout of PDF pages, in points
+const (
+	margin    = 36
+	rowHeight = 13
+	textSize  = 8.5
+)
+
+// columns of the PDF table; prices are right aligned at their x.
+var columns = []struct {
+	title string
+	x     float64
+	width float64
+	right bool
+}{
+	{"Part Number", margin, 78, false},
+	{"Description", margin + 80, 210, false},
+	{"UPC", margin + 294, 72, false},
+	{"List", 456, 58, true},
+	{"MAP", 516, 58, true},
+	{"Your Price", 576, 58, true},
+}
+
+// WritePDF writes the price list as a document of letter pages.
+func (pl *PriceList) WritePDF(w io.Writer) error {
+	_, err := pl.pdf().WriteTo(w)
+	return err
+}
+
+func (pl *PriceList) pdf() *pdf.Document {
+	doc := pdf.New(pdf.Letter)
+	doc.Title = pl.Title()
+	color, ok := pdf.ParseColor(pl.Color)
+	if !ok {
+		color = brandColor
+	}
+	size := doc.Size()
+	bottom := size.Height - margin - rowHeight
+
+	var page *pdf.Page
+	var y float64
+	newPage := func() {
+		page = doc.AddPage()
+		y = pl.pageHeader(page, size, color, doc.Pages() == 1)
+	}
+	newPage()
+
+	sales := false
+	for _, g := range pl.Groups {
+		// keep a category's title with its first part
+		if y+2*rowHeight+6 > bottom {
+			newPage()
+		}
+		y += 6
+		page.SetFont(pdf.HelveticaBold, 11)
+		page.SetFill(color)
+		page.Text(margin, y+rowHeight, g.Category)
+		page.SetFill(pdf.Black)
+		y += rowHeight + 4
+
+		for _, l := range g.Lines {
+			if y+rowHeight > bottom {
+				newPage()
+			}
+			y += rowHeight
+			price := pl.format(l.Price)
+			if l.OnSale {
+				price = "*" + price
+				sales = true
+			}
+			page.SetFont(pdf.Helvetica, textSize)
+			for i, v := range []string{l.PartNumber, l.Description, l.UPC, pl.format(l.List), pl.format(l.MAP), price} {
+				c := columns[i]
+				if c.right {
+					page.TextRight(c.x, y, v)
+				} else {
+					page.Text(c.x, y, pdf.Truncate(pdf.Helvetica, textSize, v, c.width))
+				}
+			}
+		}
+	}
+
+	// footers go on once the number of pages is known
+	pages := doc.Pages()
+	for i := 0; i < pages; i++ {
+		page := doc.Page(i)
+		page.SetFont(pdf.Helvetica, 7.5)
+		page.SetFill(pdf.Black)
+		if sales {
+			page.Text(margin, size.Height-margin/2, "* sale price")
+		}
+		footer := "Page " + strconv.Itoa(i+1) + " of " + strconv.Itoa(pages)
+		page.TextRight(size.Width-margin, size.Height-margin/2, footer)
+	}
+	return doc
+}
+
+// pageHeader draws the brand band, the title block on the first page
+// and the column headings, and returns where the table starts.
+func (pl *PriceList) pageHeader(page *pdf.Page, size pdf.Size, color pdf.Color, first bool) float64 {
+	band := 28.0
+	if first {
+		band = 54
+	}
+	page.SetFill(color)
+	page.Rect(0, 0, size.Width, band)
+	page.SetFill(pdf.White)
+	if first {
+		page.SetFont(pdf.HelveticaBold, 20)
+		page.Text(margin, 36, pl.Title())
+	} else {
+		page.SetFont(pdf.HelveticaBold, 11)
+		page.Text(margin, 19, pl.Title())
+	}
+	page.SetFont(pdf.Helvetica, 9)
+	page.TextRight(size.Width-margin, band/2+4, pl.Customer)
+
+	y := band + 18
+	page.SetFill(pdf.Black)
+	if first {
+		page.SetFont(pdf.HelveticaBold, 12)
+		page.Text(margin, y, pl.Customer)
+		page.SetFont(pdf.Helvetica, 9)
+		page.Text(margin, y+14, pl.subtitle())
+		page.TextRight(size.Width-margin, y+14, "Generated "+pl.Generated.Format(dateFormat))
+		y += 32
+	}
+
+	page.SetFont(pdf.HelveticaBold, textSize)
+	for _, c := range columns {
+		if c.right {
+			page.TextRight(c.x, y, c.title)
+		} else {
+			page.Text(c.x, y, c.title)
+		}
+	}
+	page.SetStroke(color)
+	page.Line(margin, y+4, size.Width-margin, y+4, 0.75)
+	return y + 4
+}
+
+// format writes an amount in the list's currency, leaving out prices
+// the part doesn't have.
+func (pl *PriceList) format(amount float64) string {
+	if amount == 0 {
+		return ""
+	}
+	return pricing.FormatMoney("", pl.Currency, amount)
+}
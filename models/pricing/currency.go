@@ -0,0 +1,329 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// BaseCurrency is the currency of list, MAP, jobber and customer
+	// prices.
+	BaseCurrency = "USD"
+
+	// CurrencyPriceCollectionName holds the price lists of currencies
+	// other than the base one.
+	CurrencyPriceCollectionName = "currency_prices"
+)
+
+var (
+	// ErrUnknownCurrency is returned for currencies without an exchange
+	// rate; every currency needs one, price lists or not.
+	ErrUnknownCurrency = errors.New("unknown currency")
+
+	rates      = map[string]float64{BaseCurrency: 1}
+	ratesMutex sync.RWMutex
+
+	// minorUnits are the decimals of currencies that don't have two.
+	minorUnits = map[string]int{"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "OMR": 3, "TND": 3}
+)
+
+// CurrencyPrice is a part's price of a type in the price list of a
+// currency. It wins over converting the part's price at the exchange
+// rate.
+type CurrencyPrice struct {
+	PartID       int       `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	Currency     string    `bson:"currency" json:"currency" xml:"currency,attr"`
+	Type         string    `bson:"type" json:"type" xml:"type,attr"`
+	Price        float64   `bson:"price" json:"price" xml:"price,attr"`
+	DateModified time.Time `bson:"date_modified" json:"date_modified" xml:"date_modified,attr"`
+}
+
+// Converter converts prices in the base currency to another currency,
+// from its price lists or at its exchange rate.
+type Converter struct {
+	Currency string
+	Rate     float64
+	// lists holds the price list prices by part and lower cased type
+	lists map[int]map[string]float64
+}
+
+// LoadRates replaces the exchange rates with those of a JSON file of
+// how much of each currency one US dollar buys, e.g. {"CAD": 1.3612}.
+func LoadRates(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var m map[string]float64
+	if err = json.NewDecoder(f).Decode(&m); err != nil {
+		return err
+	}
+	return SetRates(m)
+}
+
+// SetRates replaces the exchange rates.
+func SetRates(m map[string]float64) error {
+	next := map[string]float64{BaseCurrency: 1}
+	for code, rate := range m {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if rate <= 0 {
+			return fmt.Errorf("the exchange rate of %s must be above 0", code)
+		}
+		if code != BaseCurrency {
+			next[code] = rate
+		}
+	}
+
+	ratesMutex.Lock()
+	defer ratesMutex.Unlock()
+	rates = next
+	return nil
+}
+
+// Rates returns the exchange rates by currency.
+func Rates() map[string]float64 {
+	ratesMutex.RLock()
+	defer ratesMutex.RUnlock()
+	m := make(map[string]float64, len(rates))
+	for code, rate := range rates {
+		m[code] = rate
+	}
+	return m
+}
+
+// NewConverter returns a converter to a currency, with its price list
+// prices of the parts. An empty currency is the base one.
+func NewConverter(currency string, partIDs ...int) (*Converter, error) {
+	c, err := newConverter(currency)
+	if err != nil || c.Currency == BaseCurrency || len(partIDs) == 0 {
+		return c, err
+	}
+
+	prices, err := CurrencyPrices(c.Currency, partIDs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range prices {
+		c.add(p)
+	}
+	return c, nil
+}
+
+func newConverter(currency string) (*Converter, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = BaseCurrency
+	}
+
+	ratesMutex.RLock()
+	rate, ok := rates[currency]
+	ratesMutex.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCurrency
+	}
+	return &Converter{Currency: currency, Rate: rate, lists: make(map[int]map[string]float64)}, nil
+}
+
+func (c *Converter) add(p CurrencyPrice) {
+	if c.lists[p.PartID] == nil {
+		c.lists[p.PartID] = make(map[string]float64)
+	}
+	c.lists[p.PartID][strings.ToLower(p.Type)] = p.Price
+}
+
+// Convert converts an amount in the base currency at the exchange rate.
+func (c *Converter) Convert(amount float64) float64 {
+	if c == nil || c.Currency == BaseCurrency {
+		return amount
+	}
+	return RoundCurrency(c.Currency, amount*c.Rate)
+}
+
+// Price converts a part's price of a type, taking it from the price
+// list when the list has it.
+func (c *Converter) Price(partID int, typ string, amount float64) float64 {
+	if c == nil {
+		return amount
+	}
+	if p, ok := c.lists[partID][strings.ToLower(typ)]; ok {
+		return p
+	}
+	return c.Convert(amount)
+}
+
+// Resolution converts a resolved customer price and what it's based on.
+// A rule's percentage is applied to its base price in the currency, the
+// price list's when it has one, so the price always matches its base.
+func (c *Converter) Resolution(res Resolution) Resolution {
+	if c == nil || c.Currency == BaseCurrency {
+		return res
+	}
+	res.Currency = c.Currency
+
+	// the price of a single one, before any quantity break
+	single := res.Price
+	if res.Quantity > 0 {
+		single = res.UnitPrice
+	}
+	regular := res.RegularPrice == single
+	res.BasePrice = c.Price(res.PartID, res.Base, res.BasePrice)
+	if res.Source == SourceRule && res.Rule != nil && res.BasePrice > 0 {
+		single = RoundCurrency(c.Currency, res.BasePrice*(1+res.Rule.Percent/100))
+	} else {
+		single = c.Convert(single)
+	}
+	if regular {
+		res.RegularPrice = single
+	} else {
+		res.RegularPrice = c.Convert(res.RegularPrice)
+	}
+
+	res.Price = single
+	if res.Quantity > 0 {
+		res.UnitPrice = single
+		if res.QuantityBreak != nil {
+			t := &Tiers{customer: map[int][]Break{res.PartID: {c.Break(*res.QuantityBreak)}}}
+			res.Price, res.QuantityBreak = t.Price(res.PartID, single, res.Quantity)
+		}
+		res.Total = RoundCurrency(c.Currency, res.Price*float64(res.Quantity))
+	}
+	if res.Sale != nil {
+		sale := *res.Sale
+		sale.Price = c.Convert(sale.Price)
+		res.Sale = &sale
+	}
+	res.Breaks = c.breaks(res.Breaks)
+	return res
+}
+
+// Break converts the price of a quantity break; percentages stay.
+func (c *Converter) Break(b Break) Break {
+	if b.Price != 0 {
+		b.Price = c.Convert(b.Price)
+	}
+	return b
+}
+
+func (c *Converter) breaks(breaks []Break) []Break {
+	if breaks == nil {
+		return nil
+	}
+	converted := make([]Break, len(breaks))
+	for i, b := range breaks {
+		converted[i] = c.Break(b)
+	}
+	return converted
+}
+
+// Tiers converts the prices of quantity breaks.
+func (c *Converter) Tiers(t *Tiers) *Tiers {
+	if t == nil || c == nil || c.Currency == BaseCurrency {
+		return t
+	}
+	converted := &Tiers{customer: make(map[int][]Break), dealer: make(map[int][]Break)}
+	for id, breaks := range t.customer {
+		converted.customer[id] = c.breaks(breaks)
+	}
+	for id, breaks := range t.dealer {
+		converted.dealer[id] = c.breaks(breaks)
+	}
+	return converted
+}
+
+// RoundCurrency rounds an amount to the minor unit of its currency,
+// the cent for most.
+func RoundCurrency(currency string, amount float64) float64 {
+	units, ok := minorUnits[strings.ToUpper(currency)]
+	if !ok {
+		return Round(amount)
+	}
+	p := math.Pow(10, float64(units))
+	return math.Floor(amount*p+0.5) / p
+}
+
+// Currencies lists the currencies with an exchange rate.
+func Currencies() []string {
+	ratesMutex.RLock()
+	defer ratesMutex.RUnlock()
+	codes := make([]string, 0, len(rates))
+	for code := range rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// CurrencyPrices returns the price list of a currency, for some parts or
+// every part.
+func CurrencyPrices(currency string, partIDs ...int) ([]CurrencyPrice, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	qry := bson.M{"currency": strings.ToUpper(currency)}
+	if len(partIDs) > 0 {
+		qry["part_id"] = bson.M{"$in": partIDs}
+	}
+	prices := make([]CurrencyPrice, 0)
+	err = session.DB(database.ProductDatabase).C(CurrencyPriceCollectionName).Find(qry).Sort("part_id", "type").All(&prices)
+	return prices, err
+}
+
+// SaveCurrencyPrices sets prices in the price lists of their currencies.
+// A price of 0 takes the part's price of that type off the list.
+func SaveCurrencyPrices(prices []CurrencyPrice) error {
+	for i := range prices {
+		p := &prices[i]
+		p.Currency = strings.ToUpper(strings.TrimSpace(p.Currency))
+		p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+		switch {
+		case p.PartID == 0:
+			return fmt.Errorf("price %d: a part is required", i+1)
+		case p.Currency == "" || p.Currency == BaseCurrency:
+			return fmt.Errorf("price %d: a currency other than %s is required", i+1, BaseCurrency)
+		case p.Type == "":
+			return fmt.Errorf("price %d: a price type is required", i+1)
+		case p.Price < 0:
+			return fmt.Errorf("price %d: the price is negative", i+1)
+		}
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(CurrencyPriceCollectionName)
+
+	now := time.Now()
+	for i := range prices {
+		p := &prices[i]
+		sel := bson.M{"part_id": p.PartID, "currency": p.Currency, "type": p.Type}
+		if p.Price == 0 {
+			if _, err = col.RemoveAll(sel); err != nil {
+				return err
+			}
+			continue
+		}
+		p.DateModified = now
+		if _, err = col.Upsert(sel, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package pricing
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCurrency(t *testing.T) {
+	Convey("Testing SetRates", t, func() {
+		So(SetRates(map[string]float64{"cad": 1.3612, "JPY": 151.2}), ShouldBeNil)
+		So(Currencies(), ShouldResemble, []string{"CAD", "JPY", "USD"})
+		So(SetRates(map[string]float64{"CAD": 0}), ShouldNotBeNil)
+		// a bad table leaves the rates alone
+		So(Rates()["CAD"], ShouldEqual, 1.3612)
+
+		_, err := NewConverter("GBP")
+		So(err, ShouldEqual, ErrUnknownCurrency)
+		c, err := NewConverter("")
+		So(err, ShouldBeNil)
+		So(c.Currency, ShouldEqual, BaseCurrency)
+	})
+
+	Convey("Testing Converter", t, func() {
+		So(SetRates(map[string]float64{"CAD": 1.3612, "JPY": 151.2}), ShouldBeNil)
+		c, err := newConverter("cad")
+		So(err, ShouldBeNil)
+		c.add(CurrencyPrice{PartID: 1, Currency: "CAD", Type: "List", Price: 139.99})
+
+		So(c.Convert(100), ShouldEqual, 136.12)
+		So(c.Price(1, "list", 100), ShouldEqual, 139.99)
+		So(c.Price(1, "map", 100), ShouldEqual, 136.12)
+		So(c.Price(2, "list", 10.5), ShouldEqual, 14.29)
+
+		var nilConverter *Converter
+		So(nilConverter.Price(1, "list", 100), ShouldEqual, 100.0)
+
+		jpy, _ := newConverter("JPY")
+		So(jpy.Convert(19.99), ShouldEqual, 3022.0)
+
+		res := c.Resolution(Resolution{
+			PartID: 1, Price: 90, Source: SourceSale, RegularPrice: 95,
+			Quantity: 10, UnitPrice: 90, Total: 900,
+			Sale:   &Sale{Price: 90, Active: true},
+			Breaks: []Break{{MinQty: 5, Price: 92}, {MinQty: 10, Percent: -5}},
+		})
+		So(res.Currency, ShouldEqual, "CAD")
+		So(res.Price, ShouldEqual, 122.51)
+		So(res.UnitPrice, ShouldEqual, 122.51)
+		So(res.RegularPrice, ShouldEqual, 129.31)
+		So(res.Total, ShouldEqual, 1225.1)
+		So(res.Sale.Price, ShouldEqual, 122.51)
+		So(res.Breaks[0].Price, ShouldEqual, 125.23)
+		So(res.Breaks[1].Percent, ShouldEqual, -5.0)
+
+		// a rule's percentage goes on the price list's base price
+		rule := &Rule{Base: "list", Percent: -10}
+		res = c.Resolution(Resolution{PartID: 1, Price: 90, RegularPrice: 90, Source: SourceRule, Rule: rule, Base: "list", BasePrice: 100})
+		So(res.BasePrice, ShouldEqual, 139.99)
+		So(res.Price, ShouldEqual, 125.99)
+		So(res.RegularPrice, ShouldEqual, 125.99)
+
+		res = c.Resolution(Resolution{
+			PartID: 1, Price: 85.5, RegularPrice: 90, Source: SourceRule, Rule: rule, Base: "list", BasePrice: 100,
+			Quantity: 10, UnitPrice: 90, Total: 855, QuantityBreak: &Break{MinQty: 10, Percent: -5},
+		})
+		So(res.UnitPrice, ShouldEqual, 125.99)
+		So(res.Price, ShouldEqual, 119.69)
+		So(res.Total, ShouldEqual, 1196.9)
+		So(res.QuantityBreak.Percent, ShouldEqual, -5.0)
+
+		tiers := &Tiers{customer: make(map[int][]Break), dealer: make(map[int][]Break)}
+		tiers.add(Tier{CustomerID: 1, PartID: 1, Breaks: []Break{{MinQty: 5, Price: 90}}})
+		price, _ := c.Tiers(tiers).Price(1, 136.12, 5)
+		So(price, ShouldEqual, 122.51)
+		So(tiers.Breaks(1)[0].Price, ShouldEqual, 90.0)
+	})
+
+	Convey("Testing RoundCurrency", t, func() {
+		So(RoundCurrency("USD", 10.005), ShouldEqual, 10.01)
+		So(RoundCurrency("JPY", 1234.5), ShouldEqual, 1235.0)
+		So(RoundCurrency("KWD", 1.23456), ShouldEqual, 1.235)
+	})
+
+	Convey("Testing FormatMoney", t, func() {
+		So(FormatMoney("${{amount}}", "USD", 1234.5), ShouldEqual, "$1,234.50")
+		So(FormatMoney("${{amount}} CAD", "CAD", -1234567.891), ShouldEqual, "$-1,234,567.89 CAD")
+		So(FormatMoney("{{amount_with_comma_separator}} €", "EUR", 1234.5), ShouldEqual, "1.234,50 €")
+		So(FormatMoney("{{amount_with_space_separator}} €", "EUR", 1234.5), ShouldEqual, "1 234,50 €")
+		So(FormatMoney("CHF {{amount_with_apostrophe_separator}}", "CHF", 1234.5), ShouldEqual, "CHF 1'234.50")
+		So(FormatMoney("${{amount_no_decimals}}", "USD", 1234.5), ShouldEqual, "$1,235")
+		So(FormatMoney("¥{{amount}}", "JPY", 1234), ShouldEqual, "¥1,234")
+		// formats without an amount fall back to the currency's
+		So(FormatMoney("$", "CAD", 5), ShouldEqual, "$5.00")
+		So(FormatMoney("", "CHF", 5), ShouldEqual, "5.00 CHF")
+		So(MoneyFormat("CAD", true), ShouldEqual, "${{amount}} CAD")
+	})
+}
@@ -0,0 +1,338 @@
+package pricing
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// ExemptionCollectionName holds the customers and parts allowed to
+	// be priced below an enforced MAP price.
+	ExemptionCollectionName = "map_exemptions"
+
+	// InCart exempts prices only shown once a part is in the cart.
+	InCart    = "in_cart"
+	Closeout  = "closeout"
+	Agreement = "agreement"
+)
+
+var (
+	ErrExemptionNotFound = errors.New("MAP exemption not found")
+
+	exemptionTypes = []string{InCart, Closeout, Agreement}
+
+	mapPolicyFields = `select p.partID, p.brandID, pr.price, pr.enforced from Part as p
+		left join Price as pr on pr.partID = p.partID and pr.priceType = 'Map'`
+)
+
+// Exemption allows prices below an enforced MAP price, for a customer,
+// a part or a customer's price of a part, within a brand or any brand.
+type Exemption struct {
+	ID         bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	Type       string        `bson:"type" json:"type" xml:"type,attr"`
+	CustomerID int           `bson:"customer_id" json:"customer_id,omitempty" xml:"customer_id,attr,omitempty"`
+	BrandID    int           `bson:"brand_id" json:"brand_id,omitempty" xml:"brand_id,attr,omitempty"`
+	PartID     int           `bson:"part_id" json:"part_id,omitempty" xml:"part_id,attr,omitempty"`
+	Reason     string        `bson:"reason" json:"reason,omitempty" xml:"reason,omitempty"`
+	Start      *time.Time    `bson:"start,omitempty" json:"start,omitempty" xml:"start,omitempty"`
+	End        *time.Time    `bson:"end,omitempty" json:"end,omitempty" xml:"end,omitempty"`
+	UserID     string        `bson:"user_id" json:"user_id,omitempty" xml:"user_id,attr,omitempty"`
+	DateAdded  time.Time     `bson:"date_added" json:"date_added" xml:"date_added,attr"`
+}
+
+// Violation is a price below the enforced MAP price of its part. It's
+// returned as the error of a price that isn't allowed.
+type Violation struct {
+	CustomerID  int       `json:"customer_id" xml:"customer_id,attr"`
+	PartID      int       `json:"part_id" xml:"part_id,attr"`
+	Price       float64   `json:"price" xml:"price,attr"`
+	MapPrice    float64   `json:"map_price" xml:"map_price,attr"`
+	Shortfall   float64   `json:"shortfall" xml:"shortfall,attr"`
+	EffectiveAt time.Time `json:"effective_at" xml:"effective_at,attr"`
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("price %.2f of part %d is below its enforced MAP price of %.2f on %s", v.Price, v.PartID, v.MapPrice, v.EffectiveAt.Format("2006-01-02"))
+}
+
+// mapState is a part's MAP price from some time on.
+type mapState struct {
+	from     time.Time
+	price    float64
+	enforced bool
+}
+
+// MAPPolicy checks prices against the enforced MAP prices of a set of
+// parts, including the scheduled ones, and the exemptions from them.
+type MAPPolicy struct {
+	brands     map[int]int
+	states     map[int][]mapState
+	exemptions []Exemption
+}
+
+// LoadMAPPolicy loads the MAP prices of every part of a brand, or of
+// the parts given when brandID is 0.
+func LoadMAPPolicy(brandID int, partIDs ...int) (*MAPPolicy, error) {
+	p := &MAPPolicy{brands: make(map[int]int), states: make(map[int][]mapState)}
+	if brandID == 0 && len(partIDs) == 0 {
+		return p, nil
+	}
+
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var rows *sql.Rows
+	if brandID > 0 {
+		rows, err = db.Query(mapPolicyFields+` where p.brandID = ?`, brandID)
+	} else {
+		args := make([]interface{}, len(partIDs))
+		for i, id := range partIDs {
+			args[i] = id
+		}
+		rows, err = db.Query(mapPolicyFields+` where p.partID in (?`+strings.Repeat(", ?", len(partIDs)-1)+`)`, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id, brand int
+		var price sql.NullFloat64
+		var enforced sql.NullBool
+		if err = rows.Scan(&id, &brand, &price, &enforced); err != nil {
+			return nil, err
+		}
+		p.brands[id] = brand
+		p.states[id] = []mapState{{price: price.Float64, enforced: enforced.Bool}}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var scheduled []ScheduledPrice
+	qry := bson.M{"status": Scheduled, "type": MAP}
+	if brandID == 0 {
+		qry["part_id"] = bson.M{"$in": ids}
+	}
+	err = session.DB(database.ProductDatabase).C(ScheduleCollectionName).Find(qry).Sort("effective_at").All(&scheduled)
+	if err != nil {
+		return nil, err
+	}
+	p.schedule(scheduled)
+
+	err = session.DB(database.ProductDatabase).C(ExemptionCollectionName).Find(nil).All(&p.exemptions)
+	return p, err
+}
+
+// schedule adds pending MAP changes, soonest first, to the parts' MAP
+// prices.
+func (p *MAPPolicy) schedule(scheduled []ScheduledPrice) {
+	for _, s := range scheduled {
+		if states, ok := p.states[s.PartID]; ok {
+			p.states[s.PartID] = append(states, mapState{from: s.EffectiveAt, price: s.Price, enforced: s.Enforced})
+		}
+	}
+}
+
+// Check returns the violation of a customer's price for a part that's in
+// effect from start to end, or nil when the price is allowed. A price
+// without a start takes effect at now; one without an end is checked
+// when it takes effect. Exemptions only allow the price for the times
+// they cover. Parts the policy wasn't loaded with are allowed.
+func (p *MAPPolicy) Check(customerID, partID int, price float64, start, end *time.Time, now time.Time) *Violation {
+	states, ok := p.states[partID]
+	if !ok {
+		return nil
+	}
+
+	from := now
+	if start != nil && start.After(now) {
+		from = *start
+	}
+	to := from
+	if end != nil && end.After(from) {
+		to = *end
+	}
+
+	// the MAP price in effect at from, then every change up to to, each
+	// until the next
+	var worst *Violation
+	current := states[0]
+	for _, s := range states[1:] {
+		if s.from.After(from) {
+			break
+		}
+		current = s
+	}
+	check := func(s mapState, at, until time.Time) {
+		if !s.enforced || price >= s.price || (worst != nil && s.price <= worst.MapPrice) {
+			return
+		}
+		at, ok := p.uncovered(customerID, partID, at, until)
+		if !ok {
+			return
+		}
+		worst = &Violation{
+			CustomerID:  customerID,
+			PartID:      partID,
+			Price:       price,
+			MapPrice:    s.price,
+			Shortfall:   Round(s.price - price),
+			EffectiveAt: at,
+		}
+	}
+	at := from
+	for _, s := range states[1:] {
+		if s.from.After(from) && !s.from.After(to) {
+			check(current, at, s.from)
+			current, at = s, s.from
+		}
+	}
+	check(current, at, to)
+	return worst
+}
+
+// uncovered returns the first time from from until to, or at from when
+// they're the same, that no exemption allows the customer's price of the
+// part, and false when exemptions cover all of it.
+func (p *MAPPolicy) uncovered(customerID, partID int, from, to time.Time) (time.Time, bool) {
+	at := from
+	for {
+		e := p.Exempt(customerID, partID, at)
+		if e == nil {
+			return at, true
+		}
+		if e.End == nil || !e.End.Before(to) {
+			return time.Time{}, false
+		}
+		at = *e.End
+	}
+}
+
+// Exempt returns the exemption allowing a customer to price a part below
+// MAP at a time, or nil.
+func (p *MAPPolicy) Exempt(customerID, partID int, at time.Time) *Exemption {
+	for i, e := range p.exemptions {
+		if e.applies(customerID, partID, p.brands[partID], at) {
+			return &p.exemptions[i]
+		}
+	}
+	return nil
+}
+
+func (e *Exemption) applies(customerID, partID, brandID int, at time.Time) bool {
+	switch {
+	case e.CustomerID != 0 && e.CustomerID != customerID:
+		return false
+	case e.PartID != 0 && e.PartID != partID:
+		return false
+	case e.BrandID != 0 && e.BrandID != brandID:
+		return false
+	case e.Start != nil && at.Before(*e.Start):
+		return false
+	case e.End != nil && !at.Before(*e.End):
+		return false
+	}
+	return true
+}
+
+// Exemptions returns the MAP exemptions of a brand, including those of
+// every brand, or all of them when brandID is 0.
+func Exemptions(brandID int) ([]Exemption, error) {
+	exemptions := make([]Exemption, 0)
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return exemptions, err
+	}
+	defer session.Close()
+
+	var qry bson.M
+	if brandID > 0 {
+		qry = bson.M{"brand_id": bson.M{"$in": []int{0, brandID}}}
+	}
+	err = session.DB(database.ProductDatabase).C(ExemptionCollectionName).Find(qry).Sort("customer_id", "part_id").All(&exemptions)
+	return exemptions, err
+}
+
+// Save validates and inserts or replaces an exemption.
+func (e *Exemption) Save() error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(ExemptionCollectionName)
+
+	if !e.ID.Valid() {
+		e.ID = bson.NewObjectId()
+		e.DateAdded = time.Now()
+		return col.Insert(e)
+	}
+
+	var existing Exemption
+	if err = col.FindId(e.ID).One(&existing); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrExemptionNotFound
+		}
+		return err
+	}
+	e.DateAdded = existing.DateAdded
+	return col.UpdateId(e.ID, e)
+}
+
+// Delete removes an exemption.
+func (e *Exemption) Delete() error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(ExemptionCollectionName).RemoveId(e.ID)
+	if err == mgo.ErrNotFound {
+		return ErrExemptionNotFound
+	}
+	return err
+}
+
+func (e *Exemption) validate() error {
+	e.Type = strings.ToLower(strings.TrimSpace(e.Type))
+	known := false
+	for _, t := range exemptionTypes {
+		known = known || t == e.Type
+	}
+	if !known {
+		return fmt.Errorf("exemption type must be one of %s", strings.Join(exemptionTypes, ", "))
+	}
+	if e.CustomerID == 0 && e.PartID == 0 {
+		return errors.New("an exemption needs a customer, a part or both")
+	}
+	if e.Start != nil && e.End != nil && !e.End.After(*e.Start) {
+		return errors.New("an exemption must end after it starts")
+	}
+	return nil
+}
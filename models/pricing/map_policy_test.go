@@ -0,0 +1,94 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMAPPolicy(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	jul, sep := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	aug, oct := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// part 1 has an enforced MAP of 100 going to 120 in September, part
+	// 2 an unenforced one that becomes enforced in July
+	p := &MAPPolicy{
+		brands: map[int]int{1: 1, 2: 1, 3: 3},
+		states: map[int][]mapState{
+			1: {{price: 100, enforced: true}},
+			2: {{price: 50}},
+			3: {{price: 10, enforced: true}},
+		},
+		exemptions: []Exemption{
+			{Type: InCart, CustomerID: 7, BrandID: 1},
+			{Type: Closeout, PartID: 3, Start: &jul},
+			{Type: Agreement, CustomerID: 8, PartID: 1, End: &aug},
+			{Type: Agreement, CustomerID: 9, PartID: 1, End: &aug},
+			{Type: Closeout, CustomerID: 9, PartID: 1, Start: &aug},
+		},
+	}
+	p.schedule([]ScheduledPrice{
+		{PartID: 2, Type: MAP, Price: 50, Enforced: true, EffectiveAt: jul},
+		{PartID: 1, Type: MAP, Price: 120, Enforced: true, EffectiveAt: sep},
+		{PartID: 9, Type: MAP, Price: 5, Enforced: true, EffectiveAt: jul},
+	})
+
+	Convey("Testing MAPPolicy.Check", t, func() {
+		So(p.Check(1, 1, 100, nil, nil, now), ShouldBeNil)
+		v := p.Check(1, 1, 99.99, nil, nil, now)
+		So(v, ShouldNotBeNil)
+		So(v.MapPrice, ShouldEqual, 100.0)
+		So(v.Shortfall, ShouldEqual, 0.01)
+		So(v.EffectiveAt, ShouldResemble, now)
+
+		// a sale running into September has to stay above the new MAP
+		So(p.Check(1, 1, 110, &jul, &aug, now), ShouldBeNil)
+		v = p.Check(1, 1, 110, &jul, &oct, now)
+		So(v, ShouldNotBeNil)
+		So(v.MapPrice, ShouldEqual, 120.0)
+		So(v.EffectiveAt, ShouldResemble, sep)
+
+		// MAP isn't enforced on part 2 until July
+		So(p.Check(1, 2, 40, nil, nil, now), ShouldBeNil)
+		So(p.Check(1, 2, 40, nil, &aug, now), ShouldNotBeNil)
+		So(p.Check(1, 2, 40, &jul, nil, now), ShouldNotBeNil)
+
+		// parts the policy wasn't loaded with are allowed
+		So(p.Check(1, 9, 1, nil, nil, now), ShouldBeNil)
+	})
+
+	Convey("Testing MAP exemptions", t, func() {
+		So(p.Check(7, 1, 50, nil, nil, now), ShouldBeNil)
+		So(p.Exempt(7, 1, now).Type, ShouldEqual, InCart)
+		So(p.Exempt(7, 3, now), ShouldBeNil)
+
+		So(p.Check(1, 3, 5, nil, nil, now), ShouldNotBeNil)
+		So(p.Check(1, 3, 5, &jul, nil, now), ShouldBeNil)
+
+		// an exemption only allows the part of a sale it covers
+		aug15 := time.Date(2026, 8, 15, 0, 0, 0, 0, time.UTC)
+		So(p.Check(8, 1, 50, &jul, nil, now), ShouldBeNil)
+		So(p.Check(8, 1, 50, &jul, &aug, now), ShouldBeNil)
+		v := p.Check(8, 1, 50, &jul, &aug15, now)
+		So(v, ShouldNotBeNil)
+		So(v.MapPrice, ShouldEqual, 100.0)
+		So(v.EffectiveAt, ShouldResemble, aug)
+		v = p.Check(8, 1, 50, &jul, &oct, now)
+		So(v, ShouldNotBeNil)
+		So(v.MapPrice, ShouldEqual, 120.0)
+		So(v.EffectiveAt, ShouldResemble, sep)
+
+		// exemptions that follow one another cover the sale between them
+		So(p.Check(9, 1, 50, &jul, &oct, now), ShouldBeNil)
+
+		e := Exemption{Type: " In_Cart "}
+		So(e.validate(), ShouldNotBeNil)
+		e.CustomerID = 7
+		So(e.validate(), ShouldBeNil)
+		So(e.Type, ShouldEqual, InCart)
+		e.Type = "friends"
+		So(e.validate(), ShouldNotBeNil)
+	})
+}
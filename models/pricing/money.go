@@ -0,0 +1,85 @@
+package pricing
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// symbols are the signs of the currencies we price in.
+var symbols = map[string]string{
+	"AUD": "$", "CAD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "MXN": "$", "NZD": "$", "USD": "$",
+}
+
+// MoneyFormat is the default format of amounts in a currency, in the
+// form of a shop's money formats.
+func MoneyFormat(currency string, withCurrency bool) string {
+	currency = strings.ToUpper(currency)
+	format := symbols[currency] + "{{amount}}"
+	if withCurrency || symbols[currency] == "" {
+		format += " " + currency
+	}
+	return format
+}
+
+// FormatMoney formats an amount in a currency with a shop money format
+// such as "${{amount}}" or "{{amount_with_comma_separator}} €". A format
+// without an amount is the currency's default.
+func FormatMoney(format, currency string, amount float64) string {
+	if !strings.Contains(format, "{{amount") {
+		format = MoneyFormat(currency, false)
+	}
+	decimals, ok := minorUnits[strings.ToUpper(currency)]
+	if !ok {
+		decimals = 2
+	}
+	amount = RoundCurrency(currency, amount)
+
+	r := strings.NewReplacer(
+		"{{amount_no_decimals_with_comma_separator}}", groupDigits(amount, 0, ".", ","),
+		"{{amount_no_decimals_with_space_separator}}", groupDigits(amount, 0, " ", ","),
+		"{{amount_with_comma_separator}}", groupDigits(amount, decimals, ".", ","),
+		"{{amount_with_space_separator}}", groupDigits(amount, decimals, " ", ","),
+		"{{amount_with_apostrophe_separator}}", groupDigits(amount, decimals, "'", "."),
+		"{{amount_no_decimals}}", groupDigits(amount, 0, ",", "."),
+		"{{amount}}", groupDigits(amount, decimals, ",", "."),
+	)
+	return r.Replace(format)
+}
+
+// groupDigits writes an amount with its thousands grouped by sep and
+// point before the decimals.
+func groupDigits(amount float64, decimals int, sep, point string) string {
+	// FormatFloat rounds halves to even
+	p := math.Pow(10, float64(decimals))
+	s := strconv.FormatFloat(roundHalf(amount*p)/p, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	var b bytes.Buffer
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" {
+		b.WriteString(point + frac)
+	}
+	return sign + b.String()
+}
+
+// roundHalf rounds to the nearest whole number, halves away from zero.
+func roundHalf(x float64) float64 {
+	if x < 0 {
+		return -math.Floor(-x + 0.5)
+	}
+	return math.Floor(x + 0.5)
+}
@@ -0,0 +1,200 @@
+package pricing
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Price types a rule can be based on.
+const (
+	List   = "list"
+	MAP    = "map"
+	Jobber = "jobber"
+)
+
+// Where a resolved price came from.
+const (
+	// SourceCustomer prices are set for the part in CustomerPricing.
+	SourceCustomer = "customer"
+	SourceRule     = "rule"
+	// SourceNone means neither applied, so the price is 0.
+	SourceNone = "none"
+)
+
+// Item is what rules are matched against: a part, its list, MAP and
+// jobber prices keyed by lower cased type, and the paths of its
+// categories from the top-level one down.
+type Item struct {
+	PartID     int
+	PartNumber string
+	BrandID    int
+	Class      string
+	Categories [][]int
+	Prices     map[string]float64
+}
+
+// Resolution is the effective customer price of a part. Trace lists how
+// each rule was considered, for explain requests.
+type Resolution struct {
+	PartID     int     `json:"part_id" xml:"part_id,attr"`
+	PartNumber string  `json:"part_number,omitempty" xml:"part_number,attr,omitempty"`
+	Price      float64 `json:"price" xml:"price,attr"`
+	Source     string  `json:"source" xml:"source,attr"`
+	Rule       *Rule   `json:"rule,omitempty" xml:"rule,omitempty"`
+	Base       string  `json:"base,omitempty" xml:"base,attr,omitempty"`
+	BasePrice  float64 `json:"base_price,omitempty" xml:"base_price,attr,omitempty"`
+	// RegularPrice is the price without a sale that's on.
+	RegularPrice float64 `json:"regular_price,omitempty" xml:"regular_price,attr,omitempty"`
+	Sale         *Sale   `json:"sale,omitempty" xml:"sale,omitempty"`
+	// Currency is set when the prices were converted from USD.
+	Currency string `json:"currency,omitempty" xml:"currency,attr,omitempty"`
+	// With a quantity, Price is the price of each at that quantity,
+	// UnitPrice that of a single one and Total that of all of them.
+	Quantity      int     `json:"quantity,omitempty" xml:"quantity,attr,omitempty"`
+	UnitPrice     float64 `json:"unit_price,omitempty" xml:"unit_price,attr,omitempty"`
+	Total         float64 `json:"total,omitempty" xml:"total,attr,omitempty"`
+	QuantityBreak *Break  `json:"quantity_break,omitempty" xml:"quantity_break,omitempty"`
+	Breaks        []Break `json:"breaks,omitempty" xml:"breaks>break,omitempty"`
+	Trace         []Step  `json:"trace,omitempty" xml:"trace>step,omitempty"`
+}
+
+// Step is one rule considered while resolving a price.
+type Step struct {
+	RuleID  bson.ObjectId `json:"rule_id,omitempty" xml:"rule_id,attr,omitempty"`
+	Name    string        `json:"name,omitempty" xml:"name,attr,omitempty"`
+	Applied bool          `json:"applied" xml:"applied,attr"`
+	Reason  string        `json:"reason" xml:",chardata"`
+}
+
+// Resolve works out the price of an item at a point in time. A price set
+// for the part itself (custom, nil when there is none) wins; otherwise
+// the highest priority rule that matches the item and is in effect is
+// applied to its base price. Equal priorities go to the more specific
+// rule, category over class over brand, then to the newest.
+func Resolve(item Item, custom *float64, rules []Rule, at time.Time, explain bool) Resolution {
+	res := Resolution{PartID: item.PartID, PartNumber: item.PartNumber, Source: SourceNone}
+	trace := func(r *Rule, applied bool, reason string) {
+		if !explain {
+			return
+		}
+		s := Step{Applied: applied, Reason: reason}
+		if r != nil {
+			s.RuleID, s.Name = r.ID, r.Name
+		}
+		res.Trace = append(res.Trace, s)
+	}
+
+	if custom != nil {
+		res.Price, res.Source = *custom, SourceCustomer
+		trace(nil, true, "the customer's price for the part")
+		if !explain {
+			return res
+		}
+	}
+
+	ordered := make([]Rule, len(rules))
+	copy(ordered, rules)
+	sort.Stable(byPrecedence(ordered))
+
+	for i := range ordered {
+		r := &ordered[i]
+		if reason := r.skip(item, at); reason != "" {
+			trace(r, false, reason)
+			continue
+		}
+		base := item.Prices[r.Base]
+		if base <= 0 {
+			trace(r, false, "the part has no "+r.Base+" price")
+			continue
+		}
+		if res.Source != SourceNone {
+			trace(r, false, "matches, but a price was already found")
+			continue
+		}
+
+		res.Price = Round(base * (1 + r.Percent/100))
+		res.Source, res.Rule = SourceRule, r
+		res.Base, res.BasePrice = r.Base, base
+		trace(r, true, strconv.FormatFloat(r.Percent, 'f', -1, 64)+"% of the "+r.Base+" price")
+		if !explain {
+			break
+		}
+	}
+
+	if res.Source == SourceNone {
+		trace(nil, false, "no customer price or rule applies")
+	}
+	return res
+}
+
+// skip gives the reason a rule doesn't apply to an item, or "" when it
+// does.
+func (r *Rule) skip(item Item, at time.Time) string {
+	if r.Start != nil && at.Before(*r.Start) {
+		return "starts " + r.Start.Format(time.RFC3339)
+	}
+	if r.End != nil && !at.Before(*r.End) {
+		return "ended " + r.End.Format(time.RFC3339)
+	}
+	if r.BrandID != 0 && r.BrandID != item.BrandID {
+		return "the part is of another brand"
+	}
+	if r.Class != "" && !strings.EqualFold(r.Class, item.Class) {
+		return "the part is of another class"
+	}
+	if r.CategoryID != 0 && !inCategory(item.Categories, r.CategoryID) {
+		return "the part isn't in the category or its subcategories"
+	}
+	return ""
+}
+
+// specificity ranks rules of equal priority, category over class over
+// brand.
+func (r *Rule) specificity() int {
+	n := 0
+	if r.CategoryID != 0 {
+		n += 4
+	}
+	if r.Class != "" {
+		n += 2
+	}
+	if r.BrandID != 0 {
+		n++
+	}
+	return n
+}
+
+func inCategory(paths [][]int, id int) bool {
+	for _, path := range paths {
+		for _, c := range path {
+			if c == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Round rounds a price to the cent.
+func Round(price float64) float64 {
+	return math.Floor(price*100+0.5) / 100
+}
+
+type byPrecedence []Rule
+
+func (s byPrecedence) Len() int      { return len(s) }
+func (s byPrecedence) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPrecedence) Less(i, j int) bool {
+	if s[i].Priority != s[j].Priority {
+		return s[i].Priority > s[j].Priority
+	}
+	if a, b := s[i].specificity(), s[j].specificity(); a != b {
+		return a > b
+	}
+	return s[i].DateAdded.After(s[j].DateAdded)
+}
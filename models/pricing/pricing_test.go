@@ -0,0 +1,109 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestResolve(t *testing.T) {
+	now := time.Now()
+	yesterday, tomorrow := now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+
+	hitch := Item{
+		PartID:     11000,
+		BrandID:    1,
+		Class:      "Class III",
+		Categories: [][]int{{1, 3, 4}},
+		Prices:     map[string]float64{List: 200, MAP: 150, Jobber: 120},
+	}
+	everything := Rule{ID: bson.NewObjectId(), Name: "everything", Base: List, Percent: -10}
+	hitches := Rule{ID: bson.NewObjectId(), Name: "hitches", CategoryID: 3, Base: MAP, Percent: 5}
+	classIII := Rule{ID: bson.NewObjectId(), Name: "class iii", Class: "class iii", Base: Jobber, Percent: 25}
+	aries := Rule{ID: bson.NewObjectId(), Name: "aries", BrandID: 3, Base: List, Percent: -50, Priority: 10}
+
+	Convey("Testing Resolve", t, func() {
+		res := Resolve(hitch, nil, nil, now, false)
+		So(res.Source, ShouldEqual, SourceNone)
+		So(res.Price, ShouldEqual, 0.0)
+
+		res = Resolve(hitch, nil, []Rule{everything}, now, false)
+		So(res.Source, ShouldEqual, SourceRule)
+		So(res.Price, ShouldEqual, 180.0)
+		So(res.BasePrice, ShouldEqual, 200.0)
+
+		// category beats class beats no target at equal priority
+		res = Resolve(hitch, nil, []Rule{everything, classIII, hitches}, now, false)
+		So(res.Rule.Name, ShouldEqual, "hitches")
+		So(res.Price, ShouldEqual, 157.5)
+
+		res = Resolve(hitch, nil, []Rule{everything, classIII}, now, false)
+		So(res.Rule.Name, ShouldEqual, "class iii")
+		So(res.Price, ShouldEqual, 150.0)
+
+		// priority wins over specificity, but only for matching rules
+		everything.Priority = 5
+		res = Resolve(hitch, nil, []Rule{hitches, everything, aries}, now, false)
+		So(res.Rule.Name, ShouldEqual, "everything")
+		everything.Priority = 0
+
+		custom := 99.99
+		res = Resolve(hitch, &custom, []Rule{everything}, now, false)
+		So(res.Source, ShouldEqual, SourceCustomer)
+		So(res.Price, ShouldEqual, 99.99)
+	})
+
+	Convey("Testing Resolve dates", t, func() {
+		later := hitches
+		later.Start = &tomorrow
+		ended := classIII
+		ended.End = &yesterday
+
+		res := Resolve(hitch, nil, []Rule{later, ended, everything}, now, false)
+		So(res.Rule.Name, ShouldEqual, "everything")
+
+		res = Resolve(hitch, nil, []Rule{later, ended, everything}, tomorrow.Add(time.Hour), false)
+		So(res.Rule.Name, ShouldEqual, "hitches")
+	})
+
+	Convey("Testing Resolve without a base price", t, func() {
+		bare := hitch
+		bare.Prices = map[string]float64{List: 200}
+
+		res := Resolve(bare, nil, []Rule{hitches, everything}, now, false)
+		So(res.Rule.Name, ShouldEqual, "everything")
+	})
+
+	Convey("Testing Resolve explain", t, func() {
+		res := Resolve(hitch, nil, []Rule{everything, hitches, aries}, now, true)
+		So(res.Rule.Name, ShouldEqual, "hitches")
+		So(len(res.Trace), ShouldEqual, 3)
+		So(res.Trace[0].Name, ShouldEqual, "aries")
+		So(res.Trace[0].Applied, ShouldBeFalse)
+		So(res.Trace[1].Applied, ShouldBeTrue)
+		So(res.Trace[2].Applied, ShouldBeFalse)
+
+		custom := 50.0
+		res = Resolve(hitch, &custom, []Rule{everything}, now, true)
+		So(res.Price, ShouldEqual, 50.0)
+		So(len(res.Trace), ShouldEqual, 2)
+		So(res.Trace[0].Applied, ShouldBeTrue)
+	})
+
+	Convey("Testing Rule validation", t, func() {
+		r := Rule{CustomerID: 1, Base: " MAP ", Percent: 10}
+		So(r.validate(), ShouldBeNil)
+		So(r.Base, ShouldEqual, MAP)
+
+		r.Base = "cost"
+		So(r.validate(), ShouldNotBeNil)
+
+		r = Rule{CustomerID: 1, Base: List, Percent: -100}
+		So(r.validate(), ShouldNotBeNil)
+
+		r = Rule{CustomerID: 1, Base: List, Start: &tomorrow, End: &yesterday}
+		So(r.validate(), ShouldNotBeNil)
+	})
+}
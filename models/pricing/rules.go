@@ -0,0 +1,169 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/helpers/redis"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// RuleCollectionName holds the pricing rules of every customer.
+	RuleCollectionName = "pricing_rules"
+
+	rulesPrefix = "pricing:rules:"
+)
+
+// ErrNotFound is returned for rules that don't exist or belong to
+// another customer.
+var ErrNotFound = errors.New("pricing rule not found")
+
+// Rule sets a customer's price for the parts it targets as a percentage
+// above (markup) or below (markdown) their list, MAP or jobber price.
+// Targets narrow each other; a rule without any applies to every part.
+type Rule struct {
+	ID         bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	CustomerID int           `bson:"customer_id" json:"customer_id" xml:"customer_id,attr"`
+	Name       string        `bson:"name" json:"name" xml:"name,attr"`
+	// CategoryID targets the parts of a category and its subcategories.
+	CategoryID int    `bson:"category_id" json:"category_id,omitempty" xml:"category_id,attr,omitempty"`
+	Class      string `bson:"class" json:"class,omitempty" xml:"class,attr,omitempty"`
+	BrandID    int    `bson:"brand_id" json:"brand_id,omitempty" xml:"brand_id,attr,omitempty"`
+	// Base is the price type the percentage applies to.
+	Base string `bson:"base" json:"base" xml:"base,attr"`
+	// Percent is added to the base price, e.g. 10 for a 10% markup or
+	// -15 for a 15% markdown.
+	Percent  float64    `bson:"percent" json:"percent" xml:"percent,attr"`
+	Priority int        `bson:"priority" json:"priority" xml:"priority,attr"`
+	Start    *time.Time `bson:"start,omitempty" json:"start,omitempty" xml:"start,omitempty"`
+	End      *time.Time `bson:"end,omitempty" json:"end,omitempty" xml:"end,omitempty"`
+
+	DateAdded    time.Time `bson:"date_added" json:"date_added" xml:"date_added,attr"`
+	DateModified time.Time `bson:"date_modified" json:"date_modified" xml:"date_modified,attr"`
+}
+
+// CustomerRules returns every rule of a customer. They are cached in
+// redis, since every customer price is resolved against them.
+func CustomerRules(customerID int) ([]Rule, error) {
+	redis_key := rulesPrefix + strconv.Itoa(customerID)
+	var rules []Rule
+	data, err := redis.Get(redis_key)
+	if err == nil && len(data) > 0 {
+		if err = json.Unmarshal(data, &rules); err == nil {
+			return rules, nil
+		}
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	rules = make([]Rule, 0)
+	err = session.DB(database.ProductDatabase).C(RuleCollectionName).Find(bson.M{"customer_id": customerID}).Sort("-priority", "-date_added").All(&rules)
+	if err != nil {
+		return nil, err
+	}
+
+	go redis.Setex(redis_key, rules, redis.CacheTimeout)
+	return rules, nil
+}
+
+// Get loads a rule of r.CustomerID by r.ID.
+func (r *Rule) Get() error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(RuleCollectionName).Find(bson.M{"_id": r.ID, "customer_id": r.CustomerID}).One(r)
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Save creates the rule when it has no ID, and replaces it otherwise.
+func (r *Rule) Save() error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(RuleCollectionName)
+
+	r.DateModified = time.Now()
+	if r.ID == "" {
+		r.ID = bson.NewObjectId()
+		r.DateAdded = r.DateModified
+		err = col.Insert(r)
+	} else {
+		var existing Rule
+		err = col.Find(bson.M{"_id": r.ID, "customer_id": r.CustomerID}).One(&existing)
+		if err == mgo.ErrNotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		r.DateAdded = existing.DateAdded
+		err = col.UpdateId(r.ID, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	go redis.Delete(rulesPrefix + strconv.Itoa(r.CustomerID))
+	return nil
+}
+
+// Delete removes a rule of r.CustomerID.
+func (r *Rule) Delete() error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(RuleCollectionName).Remove(bson.M{"_id": r.ID, "customer_id": r.CustomerID})
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	go redis.Delete(rulesPrefix + strconv.Itoa(r.CustomerID))
+	return nil
+}
+
+func (r *Rule) validate() error {
+	r.Base = strings.ToLower(strings.TrimSpace(r.Base))
+	switch r.Base {
+	case List, MAP, Jobber:
+	default:
+		return errors.New("base must be list, map or jobber")
+	}
+	if r.Percent <= -100 {
+		return errors.New("percent must be above -100")
+	}
+	if r.Start != nil && r.End != nil && !r.Start.Before(*r.End) {
+		return errors.New("start must be before end")
+	}
+	if r.CustomerID == 0 {
+		return errors.New("customer is required")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+)
+
+// SourceSale prices are a customer's sale price for the part.
+const SourceSale = "sale"
+
+// CustomerPrice is a price a customer set for a part: its regular price,
+// or a sale price when it's flagged as one or has sale dates.
+type CustomerPrice struct {
+	ID         int
+	CustomerID int
+	PartID     int
+	Price      float64
+	IsSale     bool
+	SaleStart  *time.Time
+	SaleEnd    *time.Time
+}
+
+// Sale is a sale price of a part and when it runs. End is the last day
+// of the sale when it's a date without a time.
+type Sale struct {
+	PriceID int        `json:"price_id" xml:"price_id,attr"`
+	Price   float64    `json:"price" xml:"price,attr"`
+	Start   *time.Time `json:"start,omitempty" xml:"start,attr,omitempty"`
+	End     *time.Time `json:"end,omitempty" xml:"end,attr,omitempty"`
+	Active  bool       `json:"active" xml:"active,attr"`
+}
+
+// SaleOverlap is the error of a sale whose window overlaps another sale
+// of the same part.
+type SaleOverlap struct {
+	Sale     CustomerPrice
+	Conflict CustomerPrice
+}
+
+func (e *SaleOverlap) Error() string {
+	return fmt.Sprintf("the sale of part %d from %s to %s overlaps its sale %d from %s to %s",
+		e.Sale.PartID, day(e.Sale.SaleStart, "the start"), day(e.Sale.SaleEnd, "no end"),
+		e.Conflict.ID, day(e.Conflict.SaleStart, "the start"), day(e.Conflict.SaleEnd, "no end"))
+}
+
+// Sale tells whether the price is a sale price.
+func (c CustomerPrice) Sale() bool {
+	return c.IsSale || c.SaleStart != nil || c.SaleEnd != nil
+}
+
+// Active tells whether the price is a sale that's on at a time.
+func (c CustomerPrice) Active(at time.Time) bool {
+	if !c.Sale() {
+		return false
+	}
+	from, to := c.window()
+	return !at.Before(from) && at.Before(to)
+}
+
+// window is when a sale runs, from its start up to, not including, the
+// end. A sale without a start has always run, one without an end never
+// stops.
+func (c CustomerPrice) window() (time.Time, time.Time) {
+	from, to := time.Time{}, time.Unix(1<<62, 0)
+	if c.SaleStart != nil && !c.SaleStart.IsZero() {
+		from = *c.SaleStart
+	}
+	if c.SaleEnd != nil && !c.SaleEnd.IsZero() {
+		to = *c.SaleEnd
+		if h, m, s := to.Clock(); h == 0 && m == 0 && s == 0 && to.Nanosecond() == 0 {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+	return from, to
+}
+
+// Effective picks a customer's regular price for a part, nil when it
+// has none, and the sale that's on at a time or else the next one.
+func Effective(prices []CustomerPrice, at time.Time) (*float64, *Sale) {
+	var regular *float64
+	var active, next *CustomerPrice
+	for i := range prices {
+		p := &prices[i]
+		if !p.Sale() {
+			if regular == nil {
+				regular = &p.Price
+			}
+			continue
+		}
+		from, _ := p.window()
+		switch {
+		case p.Active(at):
+			// the latest starting sale is the most specific one
+			if af, _ := window(active); active == nil || from.After(af) {
+				active = p
+			}
+		case from.After(at):
+			if nf, _ := window(next); next == nil || from.Before(nf) {
+				next = p
+			}
+		}
+	}
+
+	if active != nil {
+		return regular, newSale(active, true)
+	}
+	if next != nil {
+		return regular, newSale(next, false)
+	}
+	return regular, nil
+}
+
+func window(p *CustomerPrice) (time.Time, time.Time) {
+	if p == nil {
+		return time.Time{}, time.Time{}
+	}
+	return p.window()
+}
+
+func newSale(p *CustomerPrice, active bool) *Sale {
+	return &Sale{PriceID: p.ID, Price: p.Price, Start: p.SaleStart, End: p.SaleEnd, Active: active}
+}
+
+// CheckSale returns the overlap of a sale with another sale among the
+// customer's prices for the part, or nil. Regular prices and the sale
+// itself, by ID, are ignored.
+func CheckSale(sale CustomerPrice, prices []CustomerPrice) error {
+	if !sale.Sale() {
+		return nil
+	}
+	from, to := sale.window()
+	if !to.After(from) {
+		return fmt.Errorf("the sale of part %d ends before it starts", sale.PartID)
+	}
+	for _, p := range prices {
+		if !p.Sale() || p.PartID != sale.PartID || (sale.ID > 0 && p.ID == sale.ID) {
+			continue
+		}
+		if pf, pt := p.window(); from.Before(pt) && pf.Before(to) {
+			return &SaleOverlap{Sale: sale, Conflict: p}
+		}
+	}
+	return nil
+}
+
+// ResolveCustomer resolves an item's price like Resolve, from the
+// customer's prices for it: a sale that's on wins over the regular
+// price. RegularPrice and Sale are set on the resolution, Sale also for
+// a sale that's yet to come.
+func ResolveCustomer(item Item, prices []CustomerPrice, rules []Rule, at time.Time, explain bool) Resolution {
+	regular, sale := Effective(prices, at)
+	if sale == nil || !sale.Active {
+		res := Resolve(item, regular, rules, at, explain)
+		res.RegularPrice, res.Sale = res.Price, sale
+		return res
+	}
+
+	res := Resolve(item, &sale.Price, rules, at, explain)
+	res.Source, res.Sale = SourceSale, sale
+	if explain && len(res.Trace) > 0 {
+		res.Trace[0].Reason = "the customer's sale price for the part"
+	}
+	res.RegularPrice = Resolve(item, regular, rules, at, false).Price
+	return res
+}
+
+func day(t *time.Time, none string) string {
+	if t == nil || t.IsZero() {
+		return none
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,84 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSales(t *testing.T) {
+	day := func(m time.Month, d int) *time.Time {
+		t := time.Date(2026, m, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	now := time.Date(2026, 7, 10, 12, 0, 0, 0, time.UTC)
+
+	prices := []CustomerPrice{
+		{ID: 1, PartID: 1, Price: 100},
+		{ID: 2, PartID: 1, Price: 90, SaleStart: day(7, 1), SaleEnd: day(7, 10)},
+		{ID: 3, PartID: 1, Price: 80, SaleStart: day(8, 1), SaleEnd: day(8, 31)},
+		{ID: 4, PartID: 1, Price: 70, SaleStart: day(6, 1), SaleEnd: day(6, 30)},
+	}
+
+	Convey("Testing sale windows", t, func() {
+		So(prices[0].Sale(), ShouldBeFalse)
+		So(CustomerPrice{IsSale: true}.Active(now), ShouldBeTrue)
+		// a sale ending on a date runs through that day
+		So(prices[1].Active(now), ShouldBeTrue)
+		So(prices[1].Active(now.AddDate(0, 0, 1)), ShouldBeFalse)
+		So(prices[2].Active(now), ShouldBeFalse)
+	})
+
+	Convey("Testing Effective", t, func() {
+		regular, sale := Effective(prices, now)
+		So(*regular, ShouldEqual, 100.0)
+		So(sale.PriceID, ShouldEqual, 2)
+		So(sale.Active, ShouldBeTrue)
+
+		_, sale = Effective(prices, now.AddDate(0, 0, 1))
+		So(sale.PriceID, ShouldEqual, 3)
+		So(sale.Active, ShouldBeFalse)
+
+		_, sale = Effective(prices, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC))
+		So(sale, ShouldBeNil)
+
+		regular, _ = Effective(prices[1:2], now)
+		So(regular, ShouldBeNil)
+	})
+
+	Convey("Testing CheckSale", t, func() {
+		So(CheckSale(CustomerPrice{PartID: 1, Price: 95}, prices), ShouldBeNil)
+		So(CheckSale(CustomerPrice{PartID: 1, Price: 85, SaleStart: day(7, 11), SaleEnd: day(7, 31)}, prices), ShouldBeNil)
+		So(CheckSale(CustomerPrice{PartID: 2, Price: 85, SaleStart: day(7, 1)}, prices), ShouldBeNil)
+		// updating a sale doesn't overlap itself
+		So(CheckSale(CustomerPrice{ID: 2, PartID: 1, Price: 85, SaleStart: day(7, 1), SaleEnd: day(7, 20)}, prices), ShouldBeNil)
+
+		err := CheckSale(CustomerPrice{PartID: 1, Price: 85, SaleStart: day(7, 10), SaleEnd: day(7, 20)}, prices)
+		So(err, ShouldHaveSameTypeAs, &SaleOverlap{})
+		So(err.(*SaleOverlap).Conflict.ID, ShouldEqual, 2)
+
+		err = CheckSale(CustomerPrice{PartID: 1, Price: 85, SaleStart: day(8, 15)}, prices)
+		So(err.(*SaleOverlap).Conflict.ID, ShouldEqual, 3)
+
+		err = CheckSale(CustomerPrice{PartID: 1, Price: 85, SaleStart: day(7, 20), SaleEnd: day(7, 19)}, prices)
+		So(err, ShouldNotBeNil)
+		_, ok := err.(*SaleOverlap)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Testing ResolveCustomer", t, func() {
+		item := Item{PartID: 1, Prices: map[string]float64{"list": 120}}
+		res := ResolveCustomer(item, prices, nil, now, true)
+		So(res.Price, ShouldEqual, 90.0)
+		So(res.RegularPrice, ShouldEqual, 100.0)
+		So(res.Source, ShouldEqual, SourceSale)
+		So(res.Sale.PriceID, ShouldEqual, 2)
+
+		res = ResolveCustomer(item, prices, nil, now.AddDate(0, 0, 1), false)
+		So(res.Price, ShouldEqual, 100.0)
+		So(res.RegularPrice, ShouldEqual, 100.0)
+		So(res.Source, ShouldNotEqual, SourceSale)
+		So(res.Sale.Active, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,426 @@
+package pricing
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// ScheduleCollectionName holds list, MAP and jobber price changes
+	// that take effect at a later date.
+	ScheduleCollectionName = "price_schedule"
+
+	// HistoryCollectionName holds one document per price that was
+	// replaced.
+	HistoryCollectionName = "price_history"
+
+	Scheduled = "scheduled"
+	Applying  = "applying"
+	Applied   = "applied"
+	Canceled  = "canceled"
+	Failed    = "failed"
+
+	// claimTimeout is how long a price can be applying before it is
+	// taken to have been interrupted.
+	claimTimeout = time.Hour
+)
+
+var (
+	selectPrice = `select price, enforced from Price where partID = ? and priceType = ? for update`
+	updatePrice = `update Price set price = ?, enforced = ?, dateModified = ? where partID = ? and priceType = ?`
+	insertPrice = `insert into Price (partID, priceType, price, enforced, dateModified) values (?, ?, ?, ?, ?)`
+
+	// typeNames are the price types as they're stored in the Price table.
+	typeNames = map[string]string{List: "List", MAP: "Map", Jobber: "Jobber"}
+
+	hooks     []func(partIDs []int)
+	hookMutex sync.Mutex
+)
+
+// ScheduledPrice is a price of a part that replaces its price of the
+// same type once EffectiveAt has passed.
+type ScheduledPrice struct {
+	ID          bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	PartID      int           `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	Type        string        `bson:"type" json:"type" xml:"type,attr"`
+	Price       float64       `bson:"price" json:"price" xml:"price,attr"`
+	Enforced    bool          `bson:"enforced" json:"enforced" xml:"enforced,attr"`
+	EffectiveAt time.Time     `bson:"effective_at" json:"effective_at" xml:"effective_at,attr"`
+	Status      string        `bson:"status" json:"status" xml:"status,attr"`
+	Error       string        `bson:"error,omitempty" json:"error,omitempty" xml:"error,omitempty"`
+	DateAdded   time.Time     `bson:"date_added" json:"date_added" xml:"date_added,attr"`
+	ClaimedAt   *time.Time    `bson:"claimed_at,omitempty" json:"claimed_at,omitempty" xml:"claimed_at,attr,omitempty"`
+	AppliedAt   *time.Time    `bson:"applied_at,omitempty" json:"applied_at,omitempty" xml:"applied_at,attr,omitempty"`
+}
+
+// PriceChange is a price of a part being replaced, by a scheduled price
+// or otherwise.
+type PriceChange struct {
+	ID         bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	PartID     int           `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	Type       string        `bson:"type" json:"type" xml:"type,attr"`
+	OldPrice   float64       `bson:"old_price" json:"old_price" xml:"old_price,attr"`
+	NewPrice   float64       `bson:"new_price" json:"new_price" xml:"new_price,attr"`
+	Enforced   bool          `bson:"enforced" json:"enforced" xml:"enforced,attr"`
+	ChangedAt  time.Time     `bson:"changed_at" json:"changed_at" xml:"changed_at,attr"`
+	ScheduleID bson.ObjectId `bson:"schedule_id,omitempty" json:"schedule_id,omitempty" xml:"schedule_id,attr,omitempty"`
+}
+
+// Timeline is the price history and pending price changes of a part.
+type Timeline struct {
+	Changes   []PriceChange    `json:"history" xml:"history>change"`
+	Scheduled []ScheduledPrice `json:"scheduled" xml:"scheduled>price"`
+}
+
+// SchedulePrices validates and stores price changes, all or none.
+func SchedulePrices(prices []ScheduledPrice) error {
+	if len(prices) == 0 {
+		return errors.New("no prices to schedule")
+	}
+	now := time.Now()
+	docs := make([]interface{}, 0, len(prices))
+	for i := range prices {
+		s := &prices[i]
+		if err := s.validate(now); err != nil {
+			return err
+		}
+		s.ID = bson.NewObjectId()
+		s.Status = Scheduled
+		s.Error = ""
+		s.DateAdded = now
+		s.AppliedAt = nil
+		docs = append(docs, s)
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return session.DB(database.ProductDatabase).C(ScheduleCollectionName).Insert(docs...)
+}
+
+// Pending returns the price changes that haven't been applied yet, of a
+// part or of every part when partID is 0, soonest first.
+func Pending(partID int) ([]ScheduledPrice, error) {
+	prices := make([]ScheduledPrice, 0)
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return prices, err
+	}
+	defer session.Close()
+
+	qry := bson.M{"status": Scheduled}
+	if partID > 0 {
+		qry["part_id"] = partID
+	}
+	err = session.DB(database.ProductDatabase).C(ScheduleCollectionName).Find(qry).Sort("effective_at", "part_id").All(&prices)
+	return prices, err
+}
+
+// CancelScheduled keeps a pending price change from being applied.
+func CancelScheduled(id bson.ObjectId) error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(ScheduleCollectionName).Update(
+		bson.M{"_id": id, "status": Scheduled},
+		bson.M{"$set": bson.M{"status": Canceled}},
+	)
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// PartTimeline loads the price history, oldest first, and pending price
+// changes of a part.
+func PartTimeline(partID int) (Timeline, error) {
+	t := Timeline{Changes: make([]PriceChange, 0)}
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return t, err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(HistoryCollectionName).Find(bson.M{"part_id": partID}).Sort("changed_at").All(&t.Changes)
+	if err != nil {
+		return t, err
+	}
+
+	t.Scheduled, err = Pending(partID)
+	return t, err
+}
+
+// PartTimelines loads the timelines of several parts at once, by part.
+func PartTimelines(partIDs ...int) (map[int]Timeline, error) {
+	timelines := make(map[int]Timeline, len(partIDs))
+	if len(partIDs) == 0 {
+		return timelines, nil
+	}
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return timelines, err
+	}
+	defer session.Close()
+	db := session.DB(database.ProductDatabase)
+
+	var changes []PriceChange
+	if err = db.C(HistoryCollectionName).Find(bson.M{"part_id": bson.M{"$in": partIDs}}).Sort("changed_at").All(&changes); err != nil {
+		return timelines, err
+	}
+	var scheduled []ScheduledPrice
+	if err = db.C(ScheduleCollectionName).Find(bson.M{"part_id": bson.M{"$in": partIDs}, "status": Scheduled}).Sort("effective_at", "part_id").All(&scheduled); err != nil {
+		return timelines, err
+	}
+
+	for _, c := range changes {
+		t := timelines[c.PartID]
+		t.Changes = append(t.Changes, c)
+		timelines[c.PartID] = t
+	}
+	for _, s := range scheduled {
+		t := timelines[s.PartID]
+		t.Scheduled = append(t.Scheduled, s)
+		timelines[s.PartID] = t
+	}
+	return timelines, nil
+}
+
+// PriceAt works out the price of a type that is in effect at a point in
+// time, given its price now. A later date gets the last pending change
+// due by then; an earlier one gets the price the first change after it
+// replaced. ok is false when the part had or will have no such price.
+func (t Timeline) PriceAt(typ string, current float64, at, now time.Time) (price float64, ok bool) {
+	typ = strings.ToLower(typ)
+	price, ok = current, current > 0
+
+	if at.After(now) {
+		for _, s := range t.Scheduled {
+			if s.Type == typ && s.Status == Scheduled && !s.EffectiveAt.After(at) {
+				price, ok = s.Price, true
+			}
+		}
+		return price, ok
+	}
+
+	for _, c := range t.Changes {
+		if c.Type == typ && c.ChangedAt.After(at) {
+			return c.OldPrice, c.OldPrice > 0
+		}
+	}
+	return price, ok
+}
+
+// Types lists the price types of the timeline.
+func (t Timeline) Types() []string {
+	var types []string
+	seen := make(map[string]bool)
+	add := func(typ string) {
+		if !seen[typ] {
+			seen[typ] = true
+			types = append(types, typ)
+		}
+	}
+	for _, c := range t.Changes {
+		add(c.Type)
+	}
+	for _, s := range t.Scheduled {
+		add(s.Type)
+	}
+	return types
+}
+
+// TypeName is how a price type is stored in the Price table, e.g. "Map"
+// for "map".
+func TypeName(typ string) string {
+	if name, ok := typeNames[strings.ToLower(typ)]; ok {
+		return name
+	}
+	return typ
+}
+
+// OnApplied registers fn to be called with the parts whose prices were
+// changed each time scheduled prices are applied, so caches of them can
+// be refreshed.
+func OnApplied(fn func(partIDs []int)) {
+	hookMutex.Lock()
+	hooks = append(hooks, fn)
+	hookMutex.Unlock()
+}
+
+// ApplyDue promotes the scheduled prices that are due to the Price table
+// and the part documents, keeping the prices they replace in the
+// history. Each is claimed by moving it from scheduled to applying
+// first, so API instances running it at the same time don't apply it
+// twice. It returns the number of parts whose prices changed.
+func ApplyDue(now time.Time) (int, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	col := session.DB(database.ProductDatabase).C(ScheduleCollectionName)
+
+	// a claim that was never finished may or may not have changed the
+	// price, so it is left for someone to check rather than retried
+	_, err = col.UpdateAll(
+		bson.M{"status": Applying, "claimed_at": bson.M{"$lt": now.Add(-claimTimeout)}},
+		bson.M{"$set": bson.M{"status": Failed, "error": "interrupted while being applied"}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var applied []int
+	seen := make(map[int]bool)
+	for {
+		var s ScheduledPrice
+		_, err = col.Find(bson.M{"status": Scheduled, "effective_at": bson.M{"$lte": now}}).Sort("effective_at", "date_added").Apply(mgo.Change{
+			Update:    bson.M{"$set": bson.M{"status": Applying, "claimed_at": now}},
+			ReturnNew: true,
+		}, &s)
+		if err == mgo.ErrNotFound {
+			err = nil
+			break
+		}
+		if err != nil {
+			break
+		}
+
+		set := bson.M{"status": Applied, "applied_at": now}
+		if err := s.apply(session, db, now); err != nil {
+			log.Printf("failed to apply scheduled %s price of part %d: %s\n", s.Type, s.PartID, err.Error())
+			set = bson.M{"status": Failed, "error": err.Error()}
+		} else if !seen[s.PartID] {
+			seen[s.PartID] = true
+			applied = append(applied, s.PartID)
+		}
+		if err = col.UpdateId(s.ID, bson.M{"$set": set}); err != nil {
+			break
+		}
+	}
+
+	// prices already applied are announced even when a later one failed
+	if len(applied) > 0 {
+		hookMutex.Lock()
+		fns := make([]func([]int), len(hooks))
+		copy(fns, hooks)
+		hookMutex.Unlock()
+		for _, fn := range fns {
+			fn(applied)
+		}
+	}
+	return len(applied), err
+}
+
+// Schedule applies due prices on the given interval. It blocks, so it
+// should be started in its own goroutine.
+func Schedule(interval time.Duration) {
+	for {
+		if n, err := ApplyDue(time.Now()); err != nil {
+			log.Printf("applying scheduled prices failed: %s\n", err.Error())
+		} else if n > 0 {
+			log.Printf("applied scheduled prices of %d parts\n", n)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// apply replaces the part's price in MySQL, records the replaced one and
+// updates the part document.
+func (s *ScheduledPrice) apply(session *mgo.Session, db *sql.DB, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	change := PriceChange{
+		ID:         bson.NewObjectId(),
+		PartID:     s.PartID,
+		Type:       s.Type,
+		NewPrice:   s.Price,
+		Enforced:   s.Enforced,
+		ChangedAt:  now,
+		ScheduleID: s.ID,
+	}
+	var enforced bool
+	err = tx.QueryRow(selectPrice, s.PartID, s.Type).Scan(&change.OldPrice, &enforced)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec(insertPrice, s.PartID, typeNames[s.Type], s.Price, s.Enforced, now)
+	case err == nil:
+		_, err = tx.Exec(updatePrice, s.Price, s.Enforced, now, s.PartID, s.Type)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = session.DB(database.ProductDatabase).C(HistoryCollectionName).Insert(change); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		session.DB(database.ProductDatabase).C(HistoryCollectionName).RemoveId(change.ID)
+		return err
+	}
+
+	// the catalog sync would copy the price over too, this makes it
+	// visible right away
+	parts := session.DB(database.ProductDatabase).C(database.ProductCollectionName)
+	err = parts.Update(
+		bson.M{"id": s.PartID, "pricing.type": bson.RegEx{Pattern: "^" + s.Type + "$", Options: "i"}},
+		bson.M{"$set": bson.M{"pricing.$.price": s.Price, "pricing.$.enforced": s.Enforced, "pricing.$.datemodified": now}},
+	)
+	if err == mgo.ErrNotFound {
+		err = parts.Update(bson.M{"id": s.PartID}, bson.M{"$push": bson.M{"pricing": bson.M{
+			"partid":       s.PartID,
+			"type":         typeNames[s.Type],
+			"price":        s.Price,
+			"enforced":     s.Enforced,
+			"datemodified": now,
+		}}})
+	}
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *ScheduledPrice) validate(now time.Time) error {
+	s.Type = strings.ToLower(strings.TrimSpace(s.Type))
+	if _, ok := typeNames[s.Type]; !ok {
+		return errors.New("type must be list, map or jobber")
+	}
+	if s.PartID <= 0 {
+		return errors.New("part_id is required")
+	}
+	if s.Price <= 0 {
+		return errors.New("price must be above 0")
+	}
+	if !s.EffectiveAt.After(now) {
+		return errors.New("effective_at must be in the future")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTimeline(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	jan, mar := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	nextJan, nextMar := jan.AddDate(1, 0, 0), mar.AddDate(1, 0, 0)
+
+	// list went 100 -> 110 in January and 110 -> 120 in March, with
+	// 130 and 140 to come; MAP was added in March
+	tl := Timeline{
+		Changes: []PriceChange{
+			{Type: List, OldPrice: 100, NewPrice: 110, ChangedAt: jan},
+			{Type: List, OldPrice: 110, NewPrice: 120, ChangedAt: mar},
+			{Type: MAP, OldPrice: 0, NewPrice: 90, ChangedAt: mar},
+		},
+		Scheduled: []ScheduledPrice{
+			{Type: List, Price: 130, EffectiveAt: nextJan, Status: Scheduled},
+			{Type: List, Price: 140, EffectiveAt: nextMar, Status: Scheduled},
+			{Type: Jobber, Price: 70, EffectiveAt: nextJan, Status: Scheduled},
+		},
+	}
+
+	Convey("Testing Timeline.PriceAt", t, func() {
+		price, ok := tl.PriceAt("List", 120, now, now)
+		So(ok, ShouldBeTrue)
+		So(price, ShouldEqual, 120.0)
+
+		price, _ = tl.PriceAt("List", 120, jan.AddDate(0, 0, -1), now)
+		So(price, ShouldEqual, 100.0)
+		price, _ = tl.PriceAt("List", 120, jan.AddDate(0, 1, 0), now)
+		So(price, ShouldEqual, 110.0)
+
+		price, _ = tl.PriceAt("List", 120, nextJan.AddDate(0, 0, -1), now)
+		So(price, ShouldEqual, 120.0)
+		price, _ = tl.PriceAt("List", 120, nextJan, now)
+		So(price, ShouldEqual, 130.0)
+		price, _ = tl.PriceAt("List", 120, nextMar.AddDate(0, 1, 0), now)
+		So(price, ShouldEqual, 140.0)
+
+		// MAP didn't exist before March, jobber doesn't until next year
+		_, ok = tl.PriceAt("Map", 90, jan, now)
+		So(ok, ShouldBeFalse)
+		_, ok = tl.PriceAt(Jobber, 0, now, now)
+		So(ok, ShouldBeFalse)
+		price, ok = tl.PriceAt(Jobber, 0, nextMar, now)
+		So(ok, ShouldBeTrue)
+		So(price, ShouldEqual, 70.0)
+
+		So(tl.Types(), ShouldResemble, []string{List, MAP, Jobber})
+	})
+
+	Convey("Testing ScheduledPrice validation", t, func() {
+		s := ScheduledPrice{PartID: 11000, Type: " MAP ", Price: 99.99, EffectiveAt: now.Add(time.Hour)}
+		So(s.validate(now), ShouldBeNil)
+		So(s.Type, ShouldEqual, MAP)
+		So(TypeName(s.Type), ShouldEqual, "Map")
+
+		s.EffectiveAt = now
+		So(s.validate(now), ShouldNotBeNil)
+
+		s = ScheduledPrice{PartID: 11000, Type: "cost", Price: 10, EffectiveAt: nextJan}
+		So(s.validate(now), ShouldNotBeNil)
+
+		s = ScheduledPrice{PartID: 11000, Type: List, EffectiveAt: nextJan}
+		So(s.validate(now), ShouldNotBeNil)
+	})
+}
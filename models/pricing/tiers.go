@@ -0,0 +1,301 @@
+package pricing
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TierCollectionName holds the quantity breaks of customers and the
+// defaults of dealer tiers.
+const TierCollectionName = "price_tiers"
+
+var (
+	// ErrTierNotFound is returned for tiers that don't exist.
+	ErrTierNotFound = errors.New("price tier not found")
+
+	getDealerTier = `select tier from Customer where cust_id = ?`
+)
+
+// Break is a quantity break: from MinQty units up each one costs Price,
+// or Percent more than the single unit price, e.g. -5 for 5% off.
+type Break struct {
+	MinQty  int     `bson:"min_qty" json:"min_qty" xml:"min_qty,attr"`
+	Price   float64 `bson:"price,omitempty" json:"price,omitempty" xml:"price,attr,omitempty"`
+	Percent float64 `bson:"percent,omitempty" json:"percent,omitempty" xml:"percent,attr,omitempty"`
+}
+
+// Tier is a set of quantity breaks: a customer's for one of its parts,
+// or the default of a dealer tier (customer.DealerTier) for one part or,
+// without PartID, for every part. A customer's breaks for a part replace
+// the defaults of its dealer tier.
+type Tier struct {
+	ID           bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	CustomerID   int           `bson:"customer_id" json:"customer_id,omitempty" xml:"customer_id,attr,omitempty"`
+	DealerTierID int           `bson:"dealer_tier_id" json:"dealer_tier_id,omitempty" xml:"dealer_tier_id,attr,omitempty"`
+	PartID       int           `bson:"part_id" json:"part_id,omitempty" xml:"part_id,attr,omitempty"`
+	Breaks       []Break       `bson:"breaks" json:"breaks" xml:"breaks>break"`
+
+	DateAdded    time.Time `bson:"date_added" json:"date_added" xml:"date_added,attr"`
+	DateModified time.Time `bson:"date_modified" json:"date_modified" xml:"date_modified,attr"`
+}
+
+// Tiers are the quantity breaks that apply to a customer's parts.
+type Tiers struct {
+	customer map[int][]Break
+	// dealer breaks of part 0 apply to every part
+	dealer map[int][]Break
+}
+
+// CustomerTiers returns a customer's tiers followed by the defaults of
+// its dealer tier.
+func CustomerTiers(customerID int) ([]Tier, error) {
+	dealerTier, err := customerDealerTier(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	tiers := make([]Tier, 0)
+	qry := bson.M{"$or": []bson.M{{"customer_id": customerID}, {"dealer_tier_id": dealerTier, "customer_id": 0}}}
+	err = session.DB(database.ProductDatabase).C(TierCollectionName).Find(qry).Sort("-customer_id", "part_id").All(&tiers)
+	return tiers, err
+}
+
+// LoadTiers loads the quantity breaks that apply to a customer's parts,
+// or to all of its parts without partIDs.
+func LoadTiers(customerID int, partIDs ...int) (*Tiers, error) {
+	t := &Tiers{customer: make(map[int][]Break), dealer: make(map[int][]Break)}
+	dealerTier, err := customerDealerTier(customerID)
+	if err != nil {
+		return t, err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return t, err
+	}
+	defer session.Close()
+
+	cust, dealer := bson.M{"customer_id": customerID}, bson.M{"dealer_tier_id": dealerTier, "customer_id": 0}
+	if len(partIDs) > 0 {
+		cust["part_id"] = bson.M{"$in": partIDs}
+		dealer["part_id"] = bson.M{"$in": append([]int{0}, partIDs...)}
+	}
+	qry := cust
+	if dealerTier > 0 {
+		qry = bson.M{"$or": []bson.M{cust, dealer}}
+	}
+
+	var tiers []Tier
+	if err = session.DB(database.ProductDatabase).C(TierCollectionName).Find(qry).All(&tiers); err != nil {
+		return t, err
+	}
+	for _, tier := range tiers {
+		t.add(tier)
+	}
+	return t, nil
+}
+
+func (t *Tiers) add(tier Tier) {
+	if tier.CustomerID > 0 {
+		t.customer[tier.PartID] = tier.Breaks
+	} else {
+		t.dealer[tier.PartID] = tier.Breaks
+	}
+}
+
+// Breaks returns the quantity breaks of a part, by quantity.
+func (t *Tiers) Breaks(partID int) []Break {
+	if t == nil {
+		return nil
+	}
+	if b, ok := t.customer[partID]; ok {
+		return b
+	}
+	if b, ok := t.dealer[partID]; ok {
+		return b
+	}
+	return t.dealer[0]
+}
+
+// Price is what each of qty units of a part costs, given what a single
+// one does, and the break that made it so; nil when none did. Breaks
+// never raise the price, so a sale below them stands.
+func (t *Tiers) Price(partID int, unit float64, qty int) (float64, *Break) {
+	var brk *Break
+	breaks := t.Breaks(partID)
+	for i := range breaks {
+		if breaks[i].MinQty <= qty {
+			brk = &breaks[i]
+		}
+	}
+	if brk == nil {
+		return unit, nil
+	}
+
+	price := brk.Price
+	if price == 0 {
+		price = Round(unit * (1 + brk.Percent/100))
+	}
+	if price >= unit {
+		return unit, nil
+	}
+	return price, brk
+}
+
+// Apply prices a resolution for qty units of its part. Price becomes
+// the price of each at that quantity, and UnitPrice that of one.
+func (t *Tiers) Apply(res Resolution, qty int) Resolution {
+	if qty < 1 {
+		qty = 1
+	}
+	res.Quantity, res.UnitPrice, res.Breaks = qty, res.Price, t.Breaks(res.PartID)
+
+	price, brk := t.Price(res.PartID, res.Price, qty)
+	if brk != nil && res.Trace != nil {
+		res.Trace = append(res.Trace, Step{Applied: true, Reason: fmt.Sprintf("the quantity break of %d or more", brk.MinQty)})
+	}
+	res.Price, res.QuantityBreak = price, brk
+	res.Total = Round(price * float64(qty))
+	return res
+}
+
+// GetTier loads a tier by ID.
+func GetTier(id bson.ObjectId) (*Tier, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var t Tier
+	err = session.DB(database.ProductDatabase).C(TierCollectionName).FindId(id).One(&t)
+	if err == mgo.ErrNotFound {
+		return nil, ErrTierNotFound
+	}
+	return &t, err
+}
+
+// Save creates the tier when it has no ID, and replaces it otherwise.
+// A customer or dealer tier has one tier per part.
+func (t *Tier) Save() error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(TierCollectionName)
+
+	same := bson.M{"part_id": t.PartID, "customer_id": t.CustomerID}
+	if t.CustomerID == 0 {
+		same = bson.M{"part_id": t.PartID, "dealer_tier_id": t.DealerTierID, "customer_id": 0}
+	}
+	if t.ID != "" {
+		same["_id"] = bson.M{"$ne": t.ID}
+	}
+	if n, err := col.Find(same).Count(); err != nil {
+		return err
+	} else if n > 0 {
+		return errors.New("there are quantity breaks for the part already")
+	}
+
+	t.DateModified = time.Now()
+	if t.ID == "" {
+		t.ID = bson.NewObjectId()
+		t.DateAdded = t.DateModified
+		return col.Insert(t)
+	}
+
+	var existing Tier
+	if err = col.FindId(t.ID).One(&existing); err == mgo.ErrNotFound {
+		return ErrTierNotFound
+	} else if err != nil {
+		return err
+	}
+	t.DateAdded = existing.DateAdded
+	return col.UpdateId(t.ID, t)
+}
+
+// Delete removes the tier.
+func (t *Tier) Delete() error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(TierCollectionName).RemoveId(t.ID)
+	if err == mgo.ErrNotFound {
+		return ErrTierNotFound
+	}
+	return err
+}
+
+func (t *Tier) validate() error {
+	switch {
+	case t.CustomerID == 0 && t.DealerTierID == 0:
+		return errors.New("a customer or dealer tier is required")
+	case t.CustomerID > 0 && t.DealerTierID > 0:
+		return errors.New("a tier is either a customer's or a dealer tier's")
+	case t.CustomerID > 0 && t.PartID == 0:
+		return errors.New("a customer's tier is for a part")
+	case len(t.Breaks) == 0:
+		return errors.New("at least one quantity break is required")
+	}
+
+	sort.Sort(byMinQty(t.Breaks))
+	for i, b := range t.Breaks {
+		switch {
+		case b.MinQty < 2:
+			return errors.New("quantity breaks start at 2 or more")
+		case i > 0 && b.MinQty == t.Breaks[i-1].MinQty:
+			return fmt.Errorf("there are two quantity breaks of %d", b.MinQty)
+		case (b.Price == 0) == (b.Percent == 0):
+			return fmt.Errorf("the quantity break of %d needs either a price or a percent", b.MinQty)
+		case b.Price < 0:
+			return fmt.Errorf("the price of the quantity break of %d is negative", b.MinQty)
+		case b.Percent <= -100:
+			return fmt.Errorf("the percent of the quantity break of %d must be above -100", b.MinQty)
+		}
+	}
+	return nil
+}
+
+// customerDealerTier is the DealerTiers ID of a customer, 0 without one.
+func customerDealerTier(customerID int) (int, error) {
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var tier *int
+	err = db.QueryRow(getDealerTier, customerID).Scan(&tier)
+	if err == sql.ErrNoRows || tier == nil {
+		return 0, nil
+	}
+	return *tier, err
+}
+
+type byMinQty []Break
+
+func (s byMinQty) Len() int           { return len(s) }
+func (s byMinQty) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byMinQty) Less(i, j int) bool { return s[i].MinQty < s[j].MinQty }
@@ -0,0 +1,71 @@
+package pricing
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTiers(t *testing.T) {
+	tiers := &Tiers{customer: make(map[int][]Break), dealer: make(map[int][]Break)}
+	tiers.add(Tier{CustomerID: 1, PartID: 1, Breaks: []Break{{MinQty: 5, Price: 90}, {MinQty: 10, Price: 80}}})
+	tiers.add(Tier{DealerTierID: 2, Breaks: []Break{{MinQty: 10, Percent: -5}}})
+	tiers.add(Tier{DealerTierID: 2, PartID: 3, Breaks: []Break{{MinQty: 2, Percent: -10}}})
+
+	Convey("Testing Tiers.Price", t, func() {
+		price, brk := tiers.Price(1, 100, 4)
+		So(price, ShouldEqual, 100.0)
+		So(brk, ShouldBeNil)
+
+		price, brk = tiers.Price(1, 100, 5)
+		So(price, ShouldEqual, 90.0)
+		So(brk.MinQty, ShouldEqual, 5)
+
+		price, _ = tiers.Price(1, 100, 25)
+		So(price, ShouldEqual, 80.0)
+
+		// the dealer tier's default for every part
+		price, _ = tiers.Price(2, 49.99, 10)
+		So(price, ShouldEqual, 47.49)
+		price, _ = tiers.Price(3, 50, 2)
+		So(price, ShouldEqual, 45.0)
+
+		// a sale below the break stands
+		price, brk = tiers.Price(1, 75, 10)
+		So(price, ShouldEqual, 75.0)
+		So(brk, ShouldBeNil)
+
+		var none *Tiers
+		price, brk = none.Price(1, 100, 10)
+		So(price, ShouldEqual, 100.0)
+		So(brk, ShouldBeNil)
+	})
+
+	Convey("Testing Tiers.Apply", t, func() {
+		res := tiers.Apply(Resolution{PartID: 1, Price: 100, Trace: []Step{}}, 12)
+		So(res.Quantity, ShouldEqual, 12)
+		So(res.UnitPrice, ShouldEqual, 100.0)
+		So(res.Price, ShouldEqual, 80.0)
+		So(res.Total, ShouldEqual, 960.0)
+		So(res.QuantityBreak.MinQty, ShouldEqual, 10)
+		So(len(res.Breaks), ShouldEqual, 2)
+		So(len(res.Trace), ShouldEqual, 1)
+
+		res = tiers.Apply(Resolution{PartID: 4, Price: 10}, 0)
+		So(res.Quantity, ShouldEqual, 1)
+		So(res.Total, ShouldEqual, 10.0)
+	})
+
+	Convey("Testing Tier validation", t, func() {
+		So((&Tier{PartID: 1, Breaks: []Break{{MinQty: 5, Price: 1}}}).validate(), ShouldNotBeNil)
+		So((&Tier{CustomerID: 1, Breaks: []Break{{MinQty: 5, Price: 1}}}).validate(), ShouldNotBeNil)
+		So((&Tier{CustomerID: 1, PartID: 1}).validate(), ShouldNotBeNil)
+		So((&Tier{CustomerID: 1, PartID: 1, Breaks: []Break{{MinQty: 1, Price: 1}}}).validate(), ShouldNotBeNil)
+		So((&Tier{CustomerID: 1, PartID: 1, Breaks: []Break{{MinQty: 5, Price: 1, Percent: -5}}}).validate(), ShouldNotBeNil)
+		So((&Tier{CustomerID: 1, PartID: 1, Breaks: []Break{{MinQty: 5, Price: 1}, {MinQty: 5, Price: 2}}}).validate(), ShouldNotBeNil)
+
+		tier := Tier{DealerTierID: 2, Breaks: []Break{{MinQty: 10, Percent: -10}, {MinQty: 5, Percent: -5}}}
+		So(tier.validate(), ShouldBeNil)
+		So(tier.Breaks[0].MinQty, ShouldEqual, 5)
+	})
+}
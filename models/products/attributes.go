@@ -1,7 +1,134 @@
 package products
 
+import (
+	"strconv"
+
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/helpers/units"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Attribute is a named specification of a part. Measurements such as
+// "5,000 lbs." also carry the parsed amount in the canonical unit of
+// their dimension (pounds or inches) and the unit Value is displayed in.
 type Attribute struct {
-	Key   string `json:"name" xml:"name,attr" bson:"name"`
-	Value string `json:"value" xml:",chardata" bson:"value"`
-	Sort  int    `json:"sort,omitempty" xml:"sort,omitempty" bson:"sort"`
+	Key         string   `json:"name" xml:"name,attr" bson:"name"`
+	Value       string   `json:"value" xml:",chardata" bson:"value"`
+	Sort        int      `json:"sort,omitempty" xml:"sort,omitempty" bson:"sort"`
+	Amount      *float64 `json:"amount,omitempty" xml:"amount,attr,omitempty" bson:"amount,omitempty"`
+	Unit        string   `json:"unit,omitempty" xml:"unit,attr,omitempty" bson:"unit,omitempty"`
+	DisplayUnit string   `json:"display_unit,omitempty" xml:"display_unit,attr,omitempty" bson:"display_unit,omitempty"`
+}
+
+// Attributes is a list of part attributes that can be rendered as CSV.
+type Attributes []Attribute
+
+// Parse fills in the typed fields from Value. Attributes that aren't a
+// single measurement are left untouched.
+func (a *Attribute) Parse() bool {
+	q, ok := units.Parse(a.Value)
+	if !ok {
+		return false
+	}
+
+	base := q.Base()
+	a.Amount = &base.Value
+	a.Unit = base.Unit.Symbol
+	a.DisplayUnit = q.Unit.Symbol
+	return true
+}
+
+// Quantity returns the measurement held by the attribute, parsing Value
+// when the typed fields haven't been stored yet.
+func (a Attribute) Quantity() (units.Quantity, bool) {
+	if a.Amount != nil {
+		if u, ok := units.Lookup(a.Unit); ok {
+			return units.Quantity{Value: *a.Amount, Unit: u}, true
+		}
+	}
+	if !a.Parse() {
+		return units.Quantity{}, false
+	}
+	return a.Quantity()
+}
+
+// In returns a copy of the attribute with Value rewritten in the display
+// unit of the given system. An unknown system keeps the value as entered.
+func (a Attribute) In(system string) Attribute {
+	if !units.ValidSystem(system) {
+		return a
+	}
+	q, ok := a.Quantity()
+	if !ok {
+		return a
+	}
+
+	base := q.Base()
+	display := q.In(system)
+	a.Amount = &base.Value
+	a.Unit = base.Unit.Symbol
+	a.DisplayUnit = display.Unit.Symbol
+	a.Value = display.String()
+	return a
+}
+
+// In converts every measurement in the list to the given system.
+func (attrs Attributes) In(system string) Attributes {
+	if !units.ValidSystem(system) {
+		return attrs
+	}
+	converted := make(Attributes, len(attrs))
+	for i, a := range attrs {
+		converted[i] = a.In(system)
+	}
+	return converted
+}
+
+// MarshalCSV renders one row per attribute.
+func (attrs Attributes) MarshalCSV() ([][]string, error) {
+	records := [][]string{{"Name", "Value", "Amount", "Unit", "Display Unit"}}
+	for _, a := range attrs {
+		var amount string
+		if a.Amount != nil {
+			amount = strconv.FormatFloat(*a.Amount, 'f', -1, 64)
+		}
+		records = append(records, []string{a.Key, a.Value, amount, a.Unit, a.DisplayUnit})
+	}
+	return records, nil
+}
+
+// ParseAttributes walks every part in Mongo and stores the typed fields
+// for attributes that are measurements. It returns the number of parts
+// that were updated.
+func ParseAttributes() (int, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	col := session.DB(database.ProductDatabase).C(database.ProductCollectionName)
+
+	var p Part
+	var updated int
+	iter := col.Find(bson.M{"attributes.value": bson.M{"$exists": true}}).Select(bson.M{"_id": 1, "attributes": 1}).Iter()
+	for iter.Next(&p) {
+		changed := false
+		for i := range p.Attributes {
+			if p.Attributes[i].Amount == nil && p.Attributes[i].Parse() {
+				changed = true
+			}
+		}
+		if changed {
+			if err = col.UpdateId(p.Identifier, bson.M{"$set": bson.M{"attributes": p.Attributes}}); err != nil {
+				iter.Close()
+				return updated, err
+			}
+			updated++
+		}
+		p = Part{}
+	}
+
+	return updated, iter.Close()
 }
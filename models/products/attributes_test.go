@@ -0,0 +1,51 @@
+package products
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAttributes(t *testing.T) {
+	Convey("Testing Attribute Parse", t, func() {
+		a := Attribute{Key: "Gross Trailer Weight", Value: "5,000 lbs."}
+		So(a.Parse(), ShouldBeTrue)
+		So(*a.Amount, ShouldEqual, 5000.0)
+		So(a.Unit, ShouldEqual, "lbs")
+		So(a.DisplayUnit, ShouldEqual, "lbs")
+
+		a = Attribute{Key: "Receiver Opening", Value: "50.8 mm"}
+		So(a.Parse(), ShouldBeTrue)
+		So(*a.Amount, ShouldAlmostEqual, 2.0, 0.0001)
+		So(a.Unit, ShouldEqual, "in")
+		So(a.DisplayUnit, ShouldEqual, "mm")
+
+		a = Attribute{Key: "Finish", Value: "Carbide Black"}
+		So(a.Parse(), ShouldBeFalse)
+		So(a.Amount, ShouldBeNil)
+	})
+
+	Convey("Testing Attributes In", t, func() {
+		attrs := Attributes{
+			{Key: "Gross Trailer Weight", Value: "6,000 lbs."},
+			{Key: "Receiver Size", Value: "2 in"},
+			{Key: "Finish", Value: "Carbide Black"},
+		}
+
+		metric := attrs.In("metric")
+		So(metric[0].Value, ShouldEqual, "2721.55 kg")
+		So(metric[0].Unit, ShouldEqual, "lbs")
+		So(metric[0].DisplayUnit, ShouldEqual, "kg")
+		So(metric[1].Value, ShouldEqual, "50.8 mm")
+		So(metric[2].Value, ShouldEqual, "Carbide Black")
+		So(attrs[0].Value, ShouldEqual, "6,000 lbs.")
+
+		So(attrs.In("")[0].Value, ShouldEqual, "6,000 lbs.")
+		So(metric.In("imperial")[0].Value, ShouldEqual, "6000 lbs")
+	})
+
+	Convey("Testing Attributes MarshalCSV", t, func() {
+		records, err := Attributes{{Key: "Rise", Value: "4 in"}}.In("metric").MarshalCSV()
+		So(err, ShouldBeNil)
+		So(records[1], ShouldResemble, []string{"Rise", "101.6 mm", "4", "in", "mm"})
+	})
+}
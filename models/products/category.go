@@ -6,7 +6,9 @@ import (
 	"gopkg.in/mgo.v2/bson"
 
 	"net/url"
+	"strings"
 	"time"
+	"unicode"
 )
 
 type Category struct {
@@ -38,4 +40,32 @@ type Category struct {
 	ProductListing  *PaginatedProductListing `bson:"product_listing" json:"product_listing" xml:"product_listing"`
 	PDFpath         *url.URL                 `bson:"pdf_path" json:"pdf_path" xml:"pdf_path"`
 	XLSpath         *url.URL                 `bson:"xls_path" json:"xls_path" xml:"xls_path"`
+	Breadcrumbs     []Breadcrumb             `bson:"breadcrumbs" json:"breadcrumbs" xml:"breadcrumbs>breadcrumb"`
+}
+
+// Breadcrumb is one step of the path from a top-level category down to
+// a category, which is the last step.
+type Breadcrumb struct {
+	ID    int    `bson:"id" json:"id" xml:"id,attr"`
+	Title string `bson:"title" json:"title" xml:"title,attr"`
+	Slug  string `bson:"slug" json:"slug" xml:"slug,attr"`
+}
+
+// CategorySlug is the form of a category title used in paths, e.g.
+// "class-3" for "Class 3".
+func CategorySlug(title string) string {
+	var b []byte
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && len(b) > 0 {
+				b = append(b, '-')
+			}
+			b = append(b, byte(r))
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return string(b)
 }
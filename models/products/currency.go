@@ -0,0 +1,78 @@
+package products
+
+import (
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/pricing"
+)
+
+// ConvertParts converts the prices of parts to the currency of the
+// request, leaving them in US dollars when it has none.
+func ConvertParts(parts []Part, dtx *apicontext.DataContext) error {
+	if dtx == nil || dtx.Currency == "" || dtx.Currency == pricing.BaseCurrency {
+		return nil
+	}
+
+	ids := make([]int, 0, len(parts))
+	for _, p := range parts {
+		ids = append(ids, p.ID)
+	}
+	c, err := pricing.NewConverter(dtx.Currency, ids...)
+	if err != nil {
+		return err
+	}
+	for i := range parts {
+		parts[i].Convert(c)
+	}
+	return nil
+}
+
+// Convert converts the part's list, MAP and jobber prices and its
+// customer price.
+func (p *Part) Convert(c *pricing.Converter) {
+	if c == nil || c.Currency == pricing.BaseCurrency {
+		return
+	}
+	p.Currency = c.Currency
+
+	prices := make([]Price, len(p.Pricing))
+	for i, pr := range p.Pricing {
+		pr.Price = c.Price(p.ID, pr.Type, pr.Price)
+		prices[i] = pr
+	}
+	p.Pricing = prices
+
+	// a customer price list has the regular price, not the sale's
+	if p.Customer.Sale != nil && p.Customer.Sale.Active {
+		p.Customer.Price = c.Convert(p.Customer.Price)
+	} else {
+		p.Customer.Price = c.Price(p.ID, "customer", p.Customer.Price)
+	}
+	p.Customer.RegularPrice = c.Price(p.ID, "customer", p.Customer.RegularPrice)
+	if p.Customer.Sale != nil {
+		sale := *p.Customer.Sale
+		sale.Price = c.Convert(sale.Price)
+		p.Customer.Sale = &sale
+	}
+}
+
+// ConvertPrices converts resolved customer prices to the currency of the
+// request.
+func ConvertPrices(res []pricing.Resolution, dtx *apicontext.DataContext) ([]pricing.Resolution, error) {
+	if dtx == nil || dtx.Currency == "" || dtx.Currency == pricing.BaseCurrency {
+		return res, nil
+	}
+
+	ids := make([]int, 0, len(res))
+	for _, r := range res {
+		ids = append(ids, r.PartID)
+	}
+	c, err := pricing.NewConverter(dtx.Currency, ids...)
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]pricing.Resolution, len(res))
+	for i, r := range res {
+		converted[i] = c.Resolution(r)
+	}
+	return converted, nil
+}
@@ -448,7 +448,7 @@ func (c *CurtLookup) GetParts(dtx *apicontext.DataContext, heavyduty bool) error
 		"brand.id": 1,
 	}
 
-	err = col.Find(qry).All(&c.Parts)
+	err = col.Find(VisibleQuery(qry, dtx)).All(&c.Parts)
 
 	return err
 }
@@ -229,7 +229,7 @@ func FindVehicles(v NoSqlVehicle, collection string, dtx *apicontext.DataContext
 	//add parts
 	for _, id := range ids {
 		p := Part{ID: id}
-		if err := p.Get(dtx); err != nil {
+		if err := p.Get(dtx); err != nil || !p.Visible(dtx) {
 			continue
 		}
 		l.Parts = append(l.Parts, p)
@@ -476,7 +476,7 @@ func FindVehiclesWithParts(v NoSqlVehicle, collection string, dtx *apicontext.Da
 	if err != nil {
 		return l, err
 	}
-	l.Parts, err = BindCustomerToSeveralParts(l.Parts, dtx)
+	l.Parts, err = BindCustomerToSeveralParts(FilterVisible(l.Parts, dtx), dtx)
 	if err != nil {
 		return l, err
 	}
@@ -534,6 +534,7 @@ func FindVehiclesFromAllCategories(v NoSqlVehicle, dtx *apicontext.DataContext,
 		if err != nil {
 			continue
 		}
+		l.Parts = FilterVisible(l.Parts, dtx)
 
 		if len(l.Parts) > 0 {
 			var tmp = lookupMap[col]
@@ -577,6 +578,7 @@ func FindPartsFromOneCategory(v NoSqlVehicle, collection string, dtx *apicontext
 	if err != nil {
 		return lookupMap, err
 	}
+	l.Parts = FilterVisible(l.Parts, dtx)
 
 	if len(l.Parts) > 0 {
 		var tmp = lookupMap[collection]
@@ -11,6 +11,7 @@ import (
 	"github.com/curt-labs/API/models/brand"
 	"github.com/curt-labs/API/models/customer"
 	"github.com/curt-labs/API/models/customer/content"
+	"github.com/curt-labs/API/models/pricing"
 	"github.com/curt-labs/API/models/video"
 	_ "github.com/go-sql-driver/mysql"
 	"gopkg.in/mgo.v2"
@@ -57,6 +58,7 @@ type Part struct {
 	Layer             string               `json:"iconLayer" xml:"iconLayer" bson:"iconLayer"`
 	MappedToVehicle   bool                 `json:"mappedToVehicle" xml:"mappedToVehicle" bson:"mappedToVehicle,omitempty"`
 	ComplexPart       *ComplexPart         `bson:"complex_part" json:"complex_part,omitempty" xml:"complex_part,omitempty"`
+	Currency          string               `bson:"-" json:"currency,omitempty" xml:"currency,attr,omitempty"`
 }
 
 type SkuCount struct {
@@ -70,8 +72,12 @@ type ComplexPart struct {
 }
 
 type CustomerPart struct {
-	Price         float64 `json:"price" xml:"price,attr"`
-	CartReference int     `json:"cart_reference" xml:"cart_reference,attr"`
+	// Price is the sale price while a sale is on, RegularPrice the price
+	// without it.
+	Price         float64       `json:"price" xml:"price,attr"`
+	RegularPrice  float64       `json:"regular_price" xml:"regular_price,attr"`
+	CartReference int           `json:"cart_reference" xml:"cart_reference,attr"`
+	Sale          *pricing.Sale `json:"sale,omitempty" xml:"sale,omitempty"`
 }
 
 type PaginatedProductListing struct {
@@ -130,13 +136,16 @@ func (p *Part) Get(dtx *apicontext.DataContext) error {
 	var err error
 	//get brands
 	brands := getBrandsFromDTX(dtx)
+	if err := p.FromDatabase(brands); err != nil {
+		return err
+	}
+	if !p.Visible(dtx) {
+		return mgo.ErrNotFound
+	}
 	parts, err := BindCustomerToSeveralParts([]Part{*p}, dtx)
 	if len(parts) > 0 {
 		*p = parts[0]
 	}
-	if err := p.FromDatabase(brands); err != nil {
-		return err
-	}
 
 	return err
 }
@@ -157,7 +166,7 @@ func GetMulti(dtx *apicontext.DataContext, ids []string) ([]Part, error) {
 	query := bson.M{"part_number": bson.M{"$in": ids}, "brand.id": bson.M{"$in": brands}}
 
 	var parts []Part
-	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(query).All(&parts)
+	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(VisibleQuery(query, dtx)).All(&parts)
 	if err != nil {
 		return nil, err
 	}
@@ -257,6 +266,7 @@ func All(page, count int, dtx *apicontext.DataContext, from time.Time, to time.T
 	} else { //In the case neither "to" or "from" are specified
 		query = bson.M{"brand.id": bson.M{"$in": brands}}
 	}
+	query = VisibleQuery(query, dtx)
 
 	//We get the count here so that we can return it as part of the JSON response
 	total, err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(query).Count()
@@ -332,7 +342,10 @@ func (p *Part) BindCustomer(dtx *apicontext.DataContext) {
 	refChan := make(chan int)
 	contentChan := make(chan int)
 
-	price, _ = customer.GetCustomerPrice(dtx, p.ID)
+	custom, _ := customerPrices(dtx.CustomerID, []string{strconv.Itoa(p.ID)})
+	rules, _ := pricing.CustomerRules(dtx.CustomerID)
+	resolved := pricing.ResolveCustomer(p.priceItem(), custom[p.ID], rules, time.Now(), false)
+	price = resolved.Price
 
 	go func() {
 		ref, _ = customer.GetCustomerCartReference(dtx.APIKey, p.ID)
@@ -360,6 +373,8 @@ func (p *Part) BindCustomer(dtx *apicontext.DataContext) {
 	<-contentChan
 	p.Content = append(p.Content, content...)
 	p.Customer.Price = price
+	p.Customer.RegularPrice = resolved.RegularPrice
+	p.Customer.Sale = resolved.Sale
 	p.Customer.CartReference = ref
 	return
 }
@@ -403,7 +418,6 @@ func BindCustomerToSeveralParts(parts []Part, dtx *apicontext.DataContext) ([]Pa
 	var custPartID, partID *int
 	var price *float64
 	custPartMap := make(map[int]int)
-	custPriceMap := make(map[int]float64)
 
 	for res.Next() {
 		err = res.Scan(
@@ -417,9 +431,6 @@ func BindCustomerToSeveralParts(parts []Part, dtx *apicontext.DataContext) ([]Pa
 		if custPartID != nil && partID != nil {
 			custPartMap[*partID] = *custPartID
 		}
-		if price != nil && partID != nil {
-			custPriceMap[*partID] = *price
-		}
 	}
 
 	custContentMap := make(map[int][]Content)
@@ -433,11 +444,22 @@ func BindCustomerToSeveralParts(parts []Part, dtx *apicontext.DataContext) ([]Pa
 		}
 	}
 
+	rules, err := pricing.CustomerRules(dtx.CustomerID)
+	if err != nil {
+		return parts, err
+	}
+	custPrices, err := customerPrices(dtx.CustomerID, strings.Split(partIDs, ","))
+	if err != nil {
+		return parts, err
+	}
+
+	now := time.Now()
 	for i, part := range parts {
 		var ok bool
-		if _, ok = custPriceMap[part.ID]; ok {
-			parts[i].Customer.Price = custPriceMap[part.ID]
-		}
+		resolved := pricing.ResolveCustomer(parts[i].priceItem(), custPrices[part.ID], rules, now, false)
+		parts[i].Customer.Price = resolved.Price
+		parts[i].Customer.RegularPrice = resolved.RegularPrice
+		parts[i].Customer.Sale = resolved.Sale
 		if _, ok = custPartMap[part.ID]; ok {
 			parts[i].Customer.CartReference = custPartMap[part.ID]
 		}
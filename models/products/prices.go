@@ -1,7 +1,17 @@
 package products
 
 import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/pricing"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 type Price struct {
@@ -12,3 +22,269 @@ type Price struct {
 	Enforced     bool      `json:"enforced,omitempty", xml:"enforced, omitempty"`
 	DateModified time.Time `json:"dateModified,omitempty" xml:"dateModified,omitempty"`
 }
+
+// priceItem is the form of a part pricing rules are matched against.
+func (p *Part) priceItem() pricing.Item {
+	item := pricing.Item{
+		PartID:     p.ID,
+		PartNumber: p.PartNumber,
+		BrandID:    p.Brand.ID,
+		Class:      p.Class.Name,
+		Prices:     make(map[string]float64),
+	}
+	for _, c := range p.Categories {
+		item.Categories = append(item.Categories, c.Path())
+	}
+	for _, pr := range p.Pricing {
+		item.Prices[strings.ToLower(pr.Type)] = pr.Price
+	}
+	return item
+}
+
+// PricingAsOf replaces the part's list, MAP and jobber prices with the
+// ones in effect at a point in time, from its price history and pending
+// price changes.
+func (p *Part) PricingAsOf(at time.Time) error {
+	t, err := pricing.PartTimeline(p.ID)
+	if err != nil {
+		return err
+	}
+	p.pricingAt(t, at, time.Now())
+	return nil
+}
+
+// PricingAsOf replaces the list, MAP and jobber prices of parts with the
+// ones in effect at a point in time.
+func PricingAsOf(parts []Part, at time.Time) error {
+	ids := make([]int, 0, len(parts))
+	for _, p := range parts {
+		ids = append(ids, p.ID)
+	}
+	timelines, err := pricing.PartTimelines(ids...)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range parts {
+		if t, ok := timelines[parts[i].ID]; ok {
+			parts[i].pricingAt(t, at, now)
+		}
+	}
+	return nil
+}
+
+func (p *Part) pricingAt(t pricing.Timeline, at, now time.Time) {
+	// prices of types that never changed are left alone
+	changed := make(map[string]bool)
+	for _, typ := range t.Types() {
+		changed[typ] = true
+	}
+
+	prices := make([]Price, 0, len(p.Pricing))
+	for _, pr := range p.Pricing {
+		typ := strings.ToLower(pr.Type)
+		if !changed[typ] {
+			prices = append(prices, pr)
+			continue
+		}
+		delete(changed, typ)
+		if price, ok := t.PriceAt(typ, pr.Price, at, now); ok {
+			pr.Price = price
+			prices = append(prices, pr)
+		}
+	}
+	for _, typ := range t.Types() {
+		if !changed[typ] {
+			continue
+		}
+		if price, ok := t.PriceAt(typ, 0, at, now); ok {
+			prices = append(prices, Price{PartId: p.ID, Type: pricing.TypeName(typ), Price: price})
+		}
+	}
+	p.Pricing = prices
+}
+
+// PricedParts loads the active parts of dtx's brands to resolve prices
+// for: those listed, or every part in a category and its subcategories.
+func PricedParts(ids []int, categoryID int, dtx *apicontext.DataContext) ([]Part, error) {
+	parts := make([]Part, 0)
+	if len(ids) == 0 && categoryID == 0 {
+		return parts, nil
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return parts, err
+	}
+	defer session.Close()
+
+	qry := bson.M{
+		"brand.id": bson.M{"$in": getBrandsFromDTX(dtx)},
+		"status":   bson.M{"$in": []int{700, 800, 810, 815, 850, 870, 888, 900, 910, 950}},
+	}
+	if len(ids) > 0 {
+		qry["id"] = bson.M{"$in": ids}
+	}
+	if categoryID > 0 {
+		qry["categories"] = bson.M{"$elemMatch": bson.M{"$or": []bson.M{
+			{"id": categoryID},
+			{"parent_id": categoryID},
+			{"breadcrumbs.id": categoryID},
+		}}}
+	}
+
+	fields := bson.M{"id": 1, "part_number": 1, "brand": 1, "class": 1, "categories": 1, "pricing": 1}
+	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(VisibleQuery(qry, dtx)).Select(fields).Sort("id").All(&parts)
+	return parts, err
+}
+
+// PriceListParts loads the active parts of dtx's brands for a price
+// list, of every category or of one and its subcategories.
+func PriceListParts(categoryID int, dtx *apicontext.DataContext) ([]Part, error) {
+	parts := make([]Part, 0)
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return parts, err
+	}
+	defer session.Close()
+
+	qry := bson.M{
+		"brand.id": bson.M{"$in": getBrandsFromDTX(dtx)},
+		"status":   bson.M{"$in": []int{700, 800, 810, 815, 850, 870, 888, 900, 910, 950}},
+	}
+	if categoryID > 0 {
+		qry["categories"] = bson.M{"$elemMatch": bson.M{"$or": []bson.M{
+			{"id": categoryID},
+			{"parent_id": categoryID},
+			{"breadcrumbs.id": categoryID},
+		}}}
+	}
+
+	fields := bson.M{"id": 1, "part_number": 1, "brand": 1, "class": 1, "categories": 1, "pricing": 1, "short_description": 1, "upc": 1}
+	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(VisibleQuery(qry, dtx)).Select(fields).Sort("part_number").All(&parts)
+	return parts, err
+}
+
+// ExportParts loads the content, images and packages of the active parts
+// of dtx's brands that are listed, for cart exports.
+func ExportParts(ids []int, dtx *apicontext.DataContext) ([]Part, error) {
+	parts := make([]Part, 0)
+	if len(ids) == 0 {
+		return parts, nil
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return parts, err
+	}
+	defer session.Close()
+
+	qry := bson.M{
+		"id":       bson.M{"$in": ids},
+		"brand.id": bson.M{"$in": getBrandsFromDTX(dtx)},
+		"status":   bson.M{"$in": []int{700, 800, 810, 815, 850, 870, 888, 900, 910, 950}},
+	}
+	fields := bson.M{"id": 1, "part_number": 1, "brand": 1, "short_description": 1, "content": 1, "images": 1, "packages": 1, "categories": 1, "upc": 1}
+	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(VisibleQuery(qry, dtx)).Select(fields).Sort("id").All(&parts)
+	return parts, err
+}
+
+// ResolvePrices works out the customer price of each part for the
+// customer of dtx, from the prices it set for parts and its pricing
+// rules. explain traces every rule considered.
+func ResolvePrices(parts []Part, dtx *apicontext.DataContext, explain bool) ([]pricing.Resolution, error) {
+	return ResolvePricesAt(parts, dtx, time.Now(), explain)
+}
+
+// ResolvePricesAt works out the customer prices of parts in effect at a
+// point in time, with the sales and rules of that time.
+func ResolvePricesAt(parts []Part, dtx *apicontext.DataContext, at time.Time, explain bool) ([]pricing.Resolution, error) {
+	res := make([]pricing.Resolution, 0, len(parts))
+	if len(parts) == 0 {
+		return res, nil
+	}
+
+	rules, err := pricing.CustomerRules(dtx.CustomerID)
+	if err != nil {
+		return res, err
+	}
+
+	ids := make([]string, 0, len(parts))
+	for _, p := range parts {
+		ids = append(ids, strconv.Itoa(p.ID))
+	}
+	custom, err := customerPrices(dtx.CustomerID, ids)
+	if err != nil {
+		return res, err
+	}
+
+	for i := range parts {
+		res = append(res, pricing.ResolveCustomer(parts[i].priceItem(), custom[parts[i].ID], rules, at, explain))
+	}
+	return res, nil
+}
+
+// CustomerPartPrices resolves the current price of each listed part for
+// a customer, by part ID, for orders placed through a customer's shop.
+// Parts not in the catalog are left out.
+func CustomerPartPrices(customerID int, partIDs []int) (map[int]pricing.Resolution, error) {
+	prices := make(map[int]pricing.Resolution, len(partIDs))
+	if len(partIDs) == 0 {
+		return prices, nil
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return prices, err
+	}
+	defer session.Close()
+
+	var parts []Part
+	fields := bson.M{"id": 1, "part_number": 1, "brand": 1, "class": 1, "categories": 1, "pricing": 1}
+	err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(bson.M{"id": bson.M{"$in": partIDs}}).Select(fields).All(&parts)
+	if err != nil {
+		return prices, err
+	}
+
+	res, err := ResolvePrices(parts, &apicontext.DataContext{CustomerID: customerID}, false)
+	if err != nil {
+		return prices, err
+	}
+	for _, r := range res {
+		prices[r.PartID] = r
+	}
+	return prices, nil
+}
+
+// customerPrices returns the prices a customer set for parts, regular
+// and sale prices, by part.
+func customerPrices(customerID int, partIDs []string) (map[int][]pricing.CustomerPrice, error) {
+	prices := make(map[int][]pricing.CustomerPrice)
+
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return prices, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(fmt.Sprintf(`select cp.cust_price_id, cp.partID, cp.price, cp.isSale, cp.sale_start, cp.sale_end
+		from CustomerPricing as cp
+		where cp.cust_ID = ? and cp.partID in (%s) and cp.price is not null
+		order by cp.cust_price_id`, strings.Join(partIDs, ",")), customerID)
+	if err != nil {
+		return prices, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cp := pricing.CustomerPrice{CustomerID: customerID}
+		var isSale *int
+		if err := rows.Scan(&cp.ID, &cp.PartID, &cp.Price, &isSale, &cp.SaleStart, &cp.SaleEnd); err != nil {
+			return prices, err
+		}
+		cp.IsSale = isSale != nil && *isSale == 1
+		prices[cp.PartID] = append(prices[cp.PartID], cp)
+	}
+	return prices, rows.Err()
+}
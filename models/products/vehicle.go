@@ -194,7 +194,7 @@ func (l *Lookup) LoadParts(ch chan []Part, page int, count int, dtx *apicontext.
 	perChan := make(chan int)
 	for i, p := range pagedParts {
 		go func(j int, prt Part) {
-			if err := prt.Get(dtx); err == nil && prt.ShortDesc != "" {
+			if err := prt.Get(dtx); err == nil && prt.ShortDesc != "" && prt.Visible(dtx) {
 				l.Parts = append(l.Parts, prt)
 			}
 			perChan <- 1
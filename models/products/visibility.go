@@ -0,0 +1,101 @@
+package products
+
+import (
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/customer"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// VisibleQuery narrows a part query to the parts the customer of dtx
+// is allowed to see.
+func VisibleQuery(qry bson.M, dtx *apicontext.DataContext) bson.M {
+	if dtx == nil {
+		return qry
+	}
+	rules := dtx.Visibility.PartQuery()
+	if rules == nil {
+		return qry
+	}
+	return bson.M{"$and": []bson.M{qry, rules}}
+}
+
+// Visible reports whether the customer of dtx is allowed to see the part.
+func (p *Part) Visible(dtx *apicontext.DataContext) bool {
+	if dtx == nil || dtx.Visibility.Empty() {
+		return true
+	}
+	paths := make([][]int, 0, len(p.Categories))
+	for _, c := range p.Categories {
+		paths = append(paths, c.Path())
+	}
+	return dtx.Visibility.PartVisible(p.ID, p.Class.Name, paths)
+}
+
+// FilterVisible drops the parts the customer of dtx isn't allowed to see.
+func FilterVisible(parts []Part, dtx *apicontext.DataContext) []Part {
+	if dtx == nil || dtx.Visibility.Empty() {
+		return parts
+	}
+	visible := make([]Part, 0, len(parts))
+	for i := range parts {
+		if parts[i].Visible(dtx) {
+			visible = append(visible, parts[i])
+		}
+	}
+	return visible
+}
+
+// Audience loads a part to tell which customers may hear of it, for
+// webhooks of catalog events: those whose keys have access to its brand
+// and whose visibility rules show it. Nobody hears of a missing part.
+func Audience(partID int) (func(customerID int, brandIDs []int) bool, error) {
+	if err := database.Init(); err != nil {
+		return nil, err
+	}
+	session := database.ProductMongoSession.Copy()
+	defer session.Close()
+
+	var p Part
+	err := session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(bson.M{"id": partID}).Select(bson.M{"id": 1, "brand": 1, "class": 1, "categories": 1}).One(&p)
+	if err == mgo.ErrNotFound {
+		return func(int, []int) bool { return false }, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return func(customerID int, brandIDs []int) bool {
+		branded := false
+		for _, b := range brandIDs {
+			if b == p.Brand.ID {
+				branded = true
+				break
+			}
+		}
+		if !branded {
+			return false
+		}
+		v, err := customer.GetVisibility(customerID)
+		if err != nil {
+			return false
+		}
+		return p.Visible(&apicontext.DataContext{CustomerID: customerID, Visibility: v})
+	}, nil
+}
+
+// Path is the ids of the categories from the top-level one down to c.
+// Categories synced before breadcrumbs were kept only know their parent.
+func (c Category) Path() []int {
+	if len(c.Breadcrumbs) > 0 {
+		ids := make([]int, 0, len(c.Breadcrumbs))
+		for _, b := range c.Breadcrumbs {
+			ids = append(ids, b.ID)
+		}
+		return ids
+	}
+	if c.ParentID > 0 {
+		return []int{c.ParentID, c.CategoryID}
+	}
+	return []int{c.CategoryID}
+}
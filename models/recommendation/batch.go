@@ -0,0 +1,200 @@
+package recommendation
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/cart"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// maxCoPurchases is the number of co-purchased parts kept per part.
+	maxCoPurchases = 50
+
+	// insertBatch is how many documents are inserted at a time.
+	insertBatch = 500
+)
+
+// Schedule runs the co-purchase batch once a day at the given hour
+// (server local time). It blocks, so it should be started in its own
+// goroutine.
+func Schedule(hour int) {
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.Add(24 * time.Hour)
+		}
+		time.Sleep(next.Sub(now))
+
+		if err := RunBatch(); err != nil {
+			log.Printf("recommendation batch failed: %s\n", err.Error())
+		}
+	}
+}
+
+// RunBatch recomputes the co-purchase documents for every part from the
+// shop orders and swaps them in for the contents of the recommendation
+// collection.
+func RunBatch() error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var sku struct {
+		ID         int    `bson:"id"`
+		PartNumber string `bson:"part_number"`
+	}
+	skuMap := make(map[string]int)
+	iter := session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(bson.M{}).Select(bson.M{"id": 1, "part_number": 1}).Iter()
+	for iter.Next(&sku) {
+		skuMap[strings.ToUpper(sku.PartNumber)] = sku.ID
+	}
+	if err = iter.Close(); err != nil {
+		return err
+	}
+
+	cartSess, err := mgo.DialWithInfo(database.MongoConnectionString())
+	if err != nil {
+		return err
+	}
+	defer cartSess.Close()
+
+	c := newCounter(skuMap)
+	var o cart.Order
+	iter = cartSess.DB("CurtCart").C("order").Find(bson.M{"cancel_reason": ""}).Select(bson.M{"line_items": 1}).Iter()
+	for iter.Next(&o) {
+		c.add(o)
+		o = cart.Order{}
+	}
+	if err = iter.Close(); err != nil {
+		return err
+	}
+	docs := c.docs()
+
+	// readers keep the previous documents until the new ones replace
+	// them in one rename
+	db := session.DB(database.ProductDatabase)
+	next := db.C(CollectionName + "_next")
+	if err = next.DropCollection(); err != nil && !isNamespaceNotFound(err) {
+		return err
+	}
+	for start := 0; start < len(docs); start += insertBatch {
+		end := start + insertBatch
+		if end > len(docs) {
+			end = len(docs)
+		}
+		batch := make([]interface{}, 0, end-start)
+		for _, doc := range docs[start:end] {
+			batch = append(batch, doc)
+		}
+		if err = next.Insert(batch...); err != nil {
+			return err
+		}
+	}
+	if err = next.EnsureIndexKey("part_id"); err != nil {
+		return err
+	}
+
+	return session.Run(bson.D{
+		{Name: "renameCollection", Value: db.Name + "." + next.Name},
+		{Name: "to", Value: db.Name + "." + CollectionName},
+		{Name: "dropTarget", Value: true},
+	}, nil)
+}
+
+func isNamespaceNotFound(err error) bool {
+	return strings.Contains(err.Error(), "ns not found")
+}
+
+// CoOccurrence counts, for every part, how many orders also contained
+// each other part. Line items are matched to parts by SKU; those that
+// match none are left out.
+func CoOccurrence(orders []cart.Order, skuMap map[string]int) []PartCoPurchases {
+	c := newCounter(skuMap)
+	for _, o := range orders {
+		c.add(o)
+	}
+	return c.docs()
+}
+
+// counter counts co-purchases an order at a time, so the batch can
+// stream the orders.
+type counter struct {
+	skus        map[string]int
+	counts      map[int]map[int]int
+	orderCounts map[int]int
+}
+
+func newCounter(skuMap map[string]int) *counter {
+	return &counter{skus: skuMap, counts: make(map[int]map[int]int), orderCounts: make(map[int]int)}
+}
+
+func (c *counter) add(o cart.Order) {
+	inOrder := make(map[int]bool)
+	for _, item := range o.LineItems {
+		if id, ok := c.skus[strings.ToUpper(strings.TrimSpace(item.SKU))]; ok && id > 0 {
+			inOrder[id] = true
+		}
+	}
+
+	for a := range inOrder {
+		c.orderCounts[a]++
+		for b := range inOrder {
+			if a == b {
+				continue
+			}
+			if c.counts[a] == nil {
+				c.counts[a] = make(map[int]int)
+			}
+			c.counts[a][b]++
+		}
+	}
+}
+
+func (c *counter) docs() []PartCoPurchases {
+	now := time.Now()
+	var docs []PartCoPurchases
+	for id, others := range c.counts {
+		doc := PartCoPurchases{
+			PartID:     id,
+			Orders:     c.orderCounts[id],
+			ComputedAt: now,
+		}
+		for other, n := range others {
+			doc.CoPurchases = append(doc.CoPurchases, CoPurchase{PartID: other, Count: n})
+		}
+		sort.Sort(byCount(doc.CoPurchases))
+		if len(doc.CoPurchases) > maxCoPurchases {
+			doc.CoPurchases = doc.CoPurchases[:maxCoPurchases]
+		}
+		docs = append(docs, doc)
+	}
+	sort.Sort(byPart(docs))
+
+	return docs
+}
+
+type byCount []CoPurchase
+
+func (s byCount) Len() int      { return len(s) }
+func (s byCount) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCount) Less(i, j int) bool {
+	if s[i].Count == s[j].Count {
+		return s[i].PartID < s[j].PartID
+	}
+	return s[i].Count > s[j].Count
+}
+
+type byPart []PartCoPurchases
+
+func (s byPart) Len() int           { return len(s) }
+func (s byPart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPart) Less(i, j int) bool { return s[i].PartID < s[j].PartID }
@@ -0,0 +1,289 @@
+package recommendation
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/products"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// CollectionName holds the nightly computed co-purchase documents.
+	CollectionName = "part_recommendations"
+
+	ReasonRelated  = "related"
+	ReasonPurchase = "frequently_bought_together"
+	ReasonCategory = "shared_category"
+	ReasonVehicle  = "shared_vehicle"
+	ReasonClass    = "compatible_class"
+)
+
+var (
+	statuses = []int{700, 800, 810, 815, 850, 870, 888, 900, 910, 950}
+
+	// Weights controls how much each signal contributes to a
+	// recommendation's score.
+	Weights = map[string]float64{
+		ReasonRelated:  5,
+		ReasonPurchase: 4,
+		ReasonClass:    2,
+		ReasonCategory: 1,
+		ReasonVehicle:  1,
+	}
+
+	// ClassCompatibility maps a part class name to the class names of
+	// parts that are typically purchased with it (e.g. a hitch class to
+	// the ball mounts that fit its receiver). Keys and values are
+	// compared case-insensitively.
+	ClassCompatibility = map[string][]string{
+		"class 1": {"class 1 ball mount", "1-1/4\" ball mount"},
+		"class 2": {"class 2 ball mount", "1-1/4\" ball mount"},
+		"class 3": {"class 3 ball mount", "2\" ball mount"},
+		"class 4": {"class 4 ball mount", "2\" ball mount"},
+		"class 5": {"class 5 ball mount", "2-1/2\" ball mount"},
+	}
+
+	// candidateLimit caps how many category, class and fitment
+	// candidates are loaded for scoring a single part.
+	candidateLimit = 200
+
+	// fitmentLimit caps how many of the part's vehicles are matched
+	// against other parts' fitment.
+	fitmentLimit = 50
+)
+
+// Recommendation is a ranked suggestion for a source part.
+type Recommendation struct {
+	PartID  int            `json:"part_id" xml:"part_id,attr"`
+	Score   float64        `json:"score" xml:"score,attr"`
+	Reasons []string       `json:"reasons" xml:"reasons>reason"`
+	Part    *products.Part `json:"part,omitempty" xml:"part,omitempty"`
+}
+
+// CoPurchase is the number of orders a part appeared in alongside
+// another part.
+type CoPurchase struct {
+	PartID int `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	Count  int `bson:"count" json:"count" xml:"count,attr"`
+}
+
+// PartCoPurchases is the document stored per part by the batch job.
+type PartCoPurchases struct {
+	PartID      int          `bson:"part_id" json:"part_id" xml:"part_id,attr"`
+	Orders      int          `bson:"orders" json:"orders" xml:"orders,attr"`
+	CoPurchases []CoPurchase `bson:"co_purchases" json:"co_purchases" xml:"co_purchases"`
+	ComputedAt  time.Time    `bson:"computed_at" json:"computed_at" xml:"computed_at,attr"`
+}
+
+// ForPart returns up to count ranked recommendations for the given part,
+// restricted to the brands available on the data context.
+func ForPart(partID, count int, dtx *apicontext.DataContext) ([]Recommendation, error) {
+	if count <= 0 {
+		count = 10
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	col := session.DB(database.ProductDatabase).C(database.ProductCollectionName)
+
+	var source products.Part
+	err = col.Find(products.VisibleQuery(bson.M{"id": partID, "brand.id": bson.M{"$in": dtx.BrandArray}}, dtx)).One(&source)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored PartCoPurchases
+	err = session.DB(database.ProductDatabase).C(CollectionName).Find(bson.M{"part_id": partID}).One(&stored)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	// curated and co-purchased parts are always candidates; the rest
+	// are capped, since broad categories match thousands of parts
+	ids := append([]int{}, source.Related...)
+	for _, cp := range stored.CoPurchases {
+		ids = append(ids, cp.PartID)
+	}
+
+	var candidates []products.Part
+	if len(ids) > 0 {
+		err = col.Find(products.VisibleQuery(bson.M{
+			"id":       bson.M{"$in": ids, "$ne": partID},
+			"brand.id": bson.M{"$in": dtx.BrandArray},
+			"status":   bson.M{"$in": statuses},
+		}, dtx)).All(&candidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if or := similar(source); len(or) > 0 {
+		var others []products.Part
+		err = col.Find(products.VisibleQuery(bson.M{
+			"$or":      or,
+			"id":       bson.M{"$nin": append(ids, partID)},
+			"brand.id": bson.M{"$in": dtx.BrandArray},
+			"status":   bson.M{"$in": statuses},
+		}, dtx)).Limit(candidateLimit).All(&others)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, others...)
+	}
+
+	recs := Rank(source, candidates, stored)
+	if len(recs) > count {
+		recs = recs[:count]
+	}
+	return recs, nil
+}
+
+// Rank scores every candidate against the source part and returns the
+// candidates with a positive score, highest first.
+func Rank(source products.Part, candidates []products.Part, stored PartCoPurchases) []Recommendation {
+	related := make(map[int]bool)
+	for _, id := range source.Related {
+		related[id] = true
+	}
+
+	purchases := make(map[int]int)
+	maxPurchases := 0
+	for _, cp := range stored.CoPurchases {
+		purchases[cp.PartID] = cp.Count
+		if cp.Count > maxPurchases {
+			maxPurchases = cp.Count
+		}
+	}
+
+	categories := make(map[int]bool)
+	for _, c := range source.Categories {
+		categories[c.CategoryID] = true
+	}
+
+	vehicles := make(map[string]bool)
+	for _, v := range source.Vehicles {
+		vehicles[vehicleKey(v)] = true
+	}
+
+	classes := make(map[string]bool)
+	for _, cl := range compatibleClasses(source.Class.Name) {
+		classes[strings.ToLower(cl)] = true
+	}
+
+	var recs []Recommendation
+	for i := range candidates {
+		c := &candidates[i]
+		if c.ID == source.ID {
+			continue
+		}
+
+		rec := Recommendation{
+			PartID: c.ID,
+			Part:   c,
+		}
+
+		if related[c.ID] {
+			rec.add(ReasonRelated, 1)
+		}
+		if n, ok := purchases[c.ID]; ok && maxPurchases > 0 {
+			rec.add(ReasonPurchase, float64(n)/float64(maxPurchases))
+		}
+		if classes[strings.ToLower(c.Class.Name)] {
+			rec.add(ReasonClass, 1)
+		}
+		for _, cat := range c.Categories {
+			if categories[cat.CategoryID] {
+				rec.add(ReasonCategory, 1)
+				break
+			}
+		}
+		if len(vehicles) > 0 {
+			shared := 0
+			for _, v := range c.Vehicles {
+				if vehicles[vehicleKey(v)] {
+					shared++
+				}
+			}
+			if shared > 0 {
+				rec.add(ReasonVehicle, float64(shared)/float64(len(vehicles)))
+			}
+		}
+
+		if rec.Score > 0 {
+			recs = append(recs, rec)
+		}
+	}
+
+	sort.Sort(byScore(recs))
+	return recs
+}
+
+// similar matches the parts sharing a category, a compatible class or a
+// vehicle with the source part.
+func similar(source products.Part) []bson.M {
+	var or []bson.M
+
+	var catIDs []int
+	for _, c := range source.Categories {
+		catIDs = append(catIDs, c.CategoryID)
+	}
+	if len(catIDs) > 0 {
+		or = append(or, bson.M{"categories.id": bson.M{"$in": catIDs}})
+	}
+
+	if classes := compatibleClasses(source.Class.Name); len(classes) > 0 {
+		var patterns []bson.RegEx
+		for _, cl := range classes {
+			patterns = append(patterns, bson.RegEx{Pattern: "^" + regexp.QuoteMeta(cl) + "$", Options: "i"})
+		}
+		or = append(or, bson.M{"class.name": bson.M{"$in": patterns}})
+	}
+
+	seen := make(map[string]bool)
+	var fitments []bson.M
+	for _, v := range source.Vehicles {
+		if key := vehicleKey(v); !seen[key] && len(fitments) < fitmentLimit {
+			seen[key] = true
+			fitments = append(fitments, bson.M{"year": v.Year, "make": v.Make, "model": v.Model})
+		}
+	}
+	if len(fitments) > 0 {
+		or = append(or, bson.M{"vehicle_applications": bson.M{"$elemMatch": bson.M{"$or": fitments}}})
+	}
+
+	return or
+}
+
+func (r *Recommendation) add(reason string, strength float64) {
+	r.Score += Weights[reason] * strength
+	r.Reasons = append(r.Reasons, reason)
+}
+
+func compatibleClasses(name string) []string {
+	return ClassCompatibility[strings.ToLower(strings.TrimSpace(name))]
+}
+
+func vehicleKey(v products.VehicleApplication) string {
+	return strings.ToLower(v.Year + ":" + v.Make + ":" + v.Model)
+}
+
+type byScore []Recommendation
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Score == s[j].Score {
+		return s[i].PartID < s[j].PartID
+	}
+	return s[i].Score > s[j].Score
+}
@@ -0,0 +1,85 @@
+package recommendation
+
+import (
+	"testing"
+
+	"github.com/curt-labs/API/models/cart"
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestRank(t *testing.T) {
+	Convey("Testing Rank", t, func() {
+		source := products.Part{
+			ID:         11000,
+			Related:    []int{2},
+			Class:      products.Class{Name: "Class 3"},
+			Categories: []products.Category{{CategoryID: 10}},
+			Vehicles:   []products.VehicleApplication{{Year: "2015", Make: "Ford", Model: "F-150"}},
+		}
+		candidates := []products.Part{
+			{ID: 11000},
+			{ID: 2},
+			{ID: 3, Class: products.Class{Name: "class 3 ball mount"}},
+			{ID: 4, Categories: []products.Category{{CategoryID: 10}}},
+			{ID: 5, Vehicles: []products.VehicleApplication{{Year: "2015", Make: "ford", Model: "f-150"}}},
+			{ID: 6},
+		}
+		stored := PartCoPurchases{
+			PartID:      11000,
+			CoPurchases: []CoPurchase{{PartID: 4, Count: 10}, {PartID: 6, Count: 5}},
+		}
+
+		recs := Rank(source, candidates, stored)
+		So(len(recs), ShouldEqual, 5)
+		So(recs[0].PartID, ShouldEqual, 2)
+		So(recs[0].Reasons, ShouldResemble, []string{ReasonRelated})
+		So(recs[1].PartID, ShouldEqual, 4)
+		So(recs[1].Reasons, ShouldResemble, []string{ReasonPurchase, ReasonCategory})
+		So(recs[2].PartID, ShouldEqual, 3)
+		So(recs[3].PartID, ShouldEqual, 6)
+		So(recs[3].Score, ShouldEqual, Weights[ReasonPurchase]/2)
+		So(recs[4].PartID, ShouldEqual, 5)
+	})
+
+	Convey("Testing Rank with no signals", t, func() {
+		recs := Rank(products.Part{ID: 1}, []products.Part{{ID: 2}}, PartCoPurchases{})
+		So(recs, ShouldBeNil)
+	})
+
+	Convey("Testing similar", t, func() {
+		So(similar(products.Part{ID: 1}), ShouldBeEmpty)
+
+		or := similar(products.Part{
+			Categories: []products.Category{{CategoryID: 10}},
+			Vehicles: []products.VehicleApplication{
+				{Year: "2015", Make: "Ford", Model: "F-150", Style: "Short Bed"},
+				{Year: "2015", Make: "Ford", Model: "F-150", Style: "Long Bed"},
+			},
+		})
+		So(len(or), ShouldEqual, 2)
+		fitment := or[1]["vehicle_applications"].(bson.M)["$elemMatch"].(bson.M)["$or"].([]bson.M)
+		So(fitment, ShouldResemble, []bson.M{{"year": "2015", "make": "Ford", "model": "F-150"}})
+	})
+}
+
+func TestCoOccurrence(t *testing.T) {
+	Convey("Testing CoOccurrence", t, func() {
+		skus := map[string]int{"110003": 1, "45600": 2, "40001": 3}
+		orders := []cart.Order{
+			{LineItems: []cart.LineItem{{SKU: "110003"}, {SKU: "45600"}}},
+			{LineItems: []cart.LineItem{{SKU: "110003"}, {SKU: "45600"}, {SKU: "40001"}}},
+			{LineItems: []cart.LineItem{{SKU: "unknown", VariantId: 3}, {SKU: "110003"}, {SKU: "110003"}}},
+		}
+
+		docs := CoOccurrence(orders, skus)
+		So(len(docs), ShouldEqual, 3)
+		So(docs[0].PartID, ShouldEqual, 1)
+		So(docs[0].Orders, ShouldEqual, 3)
+		So(docs[0].CoPurchases, ShouldResemble, []CoPurchase{{PartID: 2, Count: 2}, {PartID: 3, Count: 1}})
+		So(docs[1].CoPurchases, ShouldResemble, []CoPurchase{{PartID: 1, Count: 2}, {PartID: 3, Count: 1}})
+		// variant 3 isn't matched by SKU, so it isn't counted as part 3
+		So(docs[2].Orders, ShouldEqual, 1)
+	})
+}
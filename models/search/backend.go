@@ -0,0 +1,227 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/search/facet"
+	"github.com/curt-labs/API/models/search/index"
+)
+
+const (
+	Elastic = "elastic"
+	Local   = "local"
+
+	defaultCount = 25
+)
+
+var (
+	backends = map[string]Backend{
+		Elastic: elasticBackend{},
+		Local:   localBackend{},
+	}
+
+	backend     Backend
+	backendLock sync.RWMutex
+)
+
+// Query is a search request.
+type Query struct {
+	Term  string
+	Page  int
+	Count int
+	// Brand restricts the search to a single brand, otherwise every
+	// brand of the caller's API key is searched.
+	Brand int
+	// Exact favours results whose part number matches the term.
+	Exact         bool
+	RawPartNumber string
+	// Facets asks for facet counts with the results. Selecting Filters
+	// implies it, and limits the results to parts.
+	Facets  bool
+	Filters facet.Filters
+}
+
+// Backend executes searches.
+type Backend interface {
+	Name() string
+	Search(q Query, dtx *apicontext.DataContext) (*Result, error)
+	// Candidates returns up to limit of the best matches of a query,
+	// with parts' Data set to a *products.Part.
+	Candidates(q Query, dtx *apicontext.DataContext, limit int) ([]Hit, error)
+}
+
+// SetBackend selects the backend searches run against. An empty name
+// picks Elasticsearch when ELASTICSEARCH_IP is configured and the local
+// index otherwise.
+func SetBackend(name string) error {
+	if name == "" {
+		name = Local
+		if os.Getenv("ELASTICSEARCH_IP") != "" {
+			name = Elastic
+		}
+	}
+
+	b, ok := backends[name]
+	if !ok {
+		return fmt.Errorf("unknown search backend %q", name)
+	}
+
+	backendLock.Lock()
+	backend = b
+	backendLock.Unlock()
+	return nil
+}
+
+// CurrentBackend returns the backend searches run against.
+func CurrentBackend() Backend {
+	backendLock.RLock()
+	b := backend
+	backendLock.RUnlock()
+
+	if b == nil {
+		SetBackend("")
+		return CurrentBackend()
+	}
+	return b
+}
+
+// Search runs the query against the current backend.
+func Search(q Query, dtx *apicontext.DataContext) (*Result, error) {
+	if q.Term == "" {
+		return nil, errors.New("cannot execute a search on an empty query")
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.Count <= 0 {
+		q.Count = defaultCount
+	}
+
+	var res *Result
+	var err error
+	if q.faceted() {
+		res, err = facetedSearch(q, dtx)
+	} else {
+		res, err = CurrentBackend().Search(q, dtx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	localLock.RLock()
+	pn, idx := numbers, local
+	localLock.RUnlock()
+	if pn == nil {
+		return res, nil
+	}
+
+	var matches []PartNumber
+	if index.LooksLikePartNumber(q.Term) && len(q.Filters) == 0 {
+		matches = visibleMatches(pn.lookup(q.Term, q.brands(dtx)), idx, dtx)
+	}
+	pinPartNumbers(res, matches)
+	if len(matches) == 0 {
+		res.Suggestions = suggest(q, res, pn, idx, dtx)
+	}
+
+	return res, nil
+}
+
+// suggest offers close part numbers for a part number that matched no
+// part, and a spelling corrected query when nothing matched at all.
+// Spelling corrections need the local index.
+func suggest(q Query, res *Result, pn *partNumbers, idx *index.Index, dtx *apicontext.DataContext) []string {
+	brands := q.brands(dtx)
+	if index.LooksLikePartNumber(q.Term) {
+		if s := visibleNumbers(pn.similar(q.Term, brands), pn, idx, brands, dtx); len(s) > 0 {
+			return s
+		}
+	}
+	if res.Total > 0 || idx == nil {
+		return nil
+	}
+
+	c, ok := idx.Correct(q.Term)
+	if ok && idx.Search(c, index.Options{Brands: brands, Filter: visibleDoc(dtx), Size: 1}).Total > 0 {
+		return []string{c}
+	}
+	return nil
+}
+
+// brands is the set of brands a query may return.
+func (q Query) brands(dtx *apicontext.DataContext) []int {
+	if q.Brand != 0 {
+		return []int{q.Brand}
+	}
+	return dtx.BrandArray
+}
+
+func (q Query) from() int {
+	return (q.Page - 1) * q.Count
+}
+
+type elasticBackend struct{}
+
+func (elasticBackend) Name() string {
+	return Elastic
+}
+
+func (elasticBackend) Search(q Query, dtx *apicontext.DataContext) (*Result, error) {
+	var res *Result
+	var err error
+	if q.Exact {
+		res, err = ExactAndCloseDsl(q.Term, q.Page, q.Count, q.Brand, dtx)
+	} else {
+		res, err = Dsl(q.Term, q.Page, q.Count, q.Brand, dtx, q.RawPartNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hideHits(res, dtx)
+	return res, nil
+}
+
+func (q Query) result(backend string) *Result {
+	return &Result{
+		Query:   q.Term,
+		Backend: backend,
+		Page:    q.Page,
+		Count:   q.Count,
+		Hits:    []Hit{},
+	}
+}
+
+func (elasticBackend) Candidates(q Query, dtx *apicontext.DataContext, limit int) ([]Hit, error) {
+	q.Page, q.Count = 1, limit
+	res, err := elasticBackend{}.Search(q, dtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, h := range res.Hits {
+		if id, err := strconv.Atoi(h.ID); err == nil && h.Type == index.Part {
+			ids = append(ids, id)
+		}
+	}
+	parts := make(map[int]*products.Part)
+	for _, p := range fetchParts(ids) {
+		part := p
+		parts[p.ID] = &part
+	}
+
+	for i, h := range res.Hits {
+		if id, err := strconv.Atoi(h.ID); err == nil && h.Type == index.Part {
+			if p, ok := parts[id]; ok {
+				res.Hits[i].Data = p
+			}
+		}
+	}
+	return res.Hits, nil
+}
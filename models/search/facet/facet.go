@@ -0,0 +1,383 @@
+package facet
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/curt-labs/API/models/products"
+)
+
+// Facet names, which are also the query parameters that select them.
+// Attribute facets are named AttributePrefix + the attribute name.
+const (
+	Brand           = "brand"
+	Category        = "category"
+	Class           = "class"
+	Price           = "price"
+	Year            = "year"
+	Make            = "make"
+	Model           = "model"
+	AttributePrefix = "attr."
+
+	// PriceBand is the width of the list price ranges.
+	PriceBand = 50
+	// MaxAttributes is how many attribute facets are returned, those
+	// most parts have first.
+	MaxAttributes = 10
+)
+
+// Facet is a way of narrowing search results and the values it can take.
+type Facet struct {
+	Name    string   `json:"name" xml:"name,attr"`
+	Key     string   `json:"key" xml:"key,attr"`
+	Options []Option `json:"options" xml:"options>option"`
+}
+
+// Option is a value of a facet and how many results have it.
+type Option struct {
+	Value    string `json:"value" xml:"value,attr"`
+	Label    string `json:"label" xml:"label,attr"`
+	Count    int    `json:"count" xml:"count,attr"`
+	Selected bool   `json:"selected" xml:"selected,attr"`
+}
+
+// Filters are the selected values of each facet, keyed by facet key.
+// A part must have one of the selected values of every facet.
+type Filters map[string][]string
+
+// ParseFilters reads facet selections from a query string. Parameters
+// may be repeated to select several values.
+func ParseFilters(qs url.Values) Filters {
+	f := make(Filters)
+	for k, vals := range qs {
+		switch {
+		case k == Brand, k == Category, k == Class, k == Price, k == Year, k == Make, k == Model:
+		case strings.HasPrefix(k, AttributePrefix) && len(k) > len(AttributePrefix):
+		default:
+			continue
+		}
+		for _, v := range vals {
+			if v = strings.TrimSpace(v); v != "" {
+				f[k] = append(f[k], v)
+			}
+		}
+	}
+	return f
+}
+
+func (f Filters) selected(key, value string) bool {
+	for _, v := range f[key] {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filters) any(key string, values []string) bool {
+	for _, v := range values {
+		if f.selected(key, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether a part has a selected value of every facet.
+func (f Filters) Match(p *products.Part) bool {
+	for key, vals := range f {
+		if len(vals) == 0 {
+			continue
+		}
+		switch {
+		case key == Brand:
+			if !f.selected(key, strconv.Itoa(p.Brand.ID)) {
+				return false
+			}
+		case key == Category:
+			if !f.any(key, categoryIDs(p)) {
+				return false
+			}
+		case key == Class:
+			if !f.selected(key, className(p)) {
+				return false
+			}
+		case key == Price:
+			band, ok := priceBand(p)
+			if !ok || !f.selected(key, band) {
+				return false
+			}
+		case key == Year, key == Make, key == Model:
+			// checked together below so they apply to the same vehicle
+		case strings.HasPrefix(key, AttributePrefix):
+			if !f.any(key, attributeValues(p, strings.TrimPrefix(key, AttributePrefix))) {
+				return false
+			}
+		}
+	}
+
+	if len(f[Year]) == 0 && len(f[Make]) == 0 && len(f[Model]) == 0 {
+		return true
+	}
+	for _, v := range p.Vehicles {
+		if (len(f[Year]) == 0 || f.selected(Year, v.Year)) &&
+			(len(f[Make]) == 0 || f.selected(Make, v.Make)) &&
+			(len(f[Model]) == 0 || f.selected(Model, v.Model)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compute counts the values of each facet across the parts. Selected
+// values are always listed so they can be cleared. Attributes named in
+// excluded aren't offered as facets, and a vehicle's models are only
+// offered once a make is selected.
+func Compute(parts []*products.Part, f Filters, excluded map[string]bool) []Facet {
+	brands := newCounter(Brand, "Brand")
+	cats := newCounter(Category, "Category")
+	classes := newCounter(Class, "Class")
+	prices := newCounter(Price, "Price")
+	years := newCounter(Year, "Year")
+	makes := newCounter(Make, "Make")
+	models := newCounter(Model, "Model")
+	attrs := make(map[string]*counter)
+
+	for _, p := range parts {
+		brands.add(strconv.Itoa(p.Brand.ID), p.Brand.Name)
+		for _, c := range p.Categories {
+			cats.add(strconv.Itoa(c.CategoryID), c.Title)
+		}
+		classes.add(className(p), className(p))
+		if band, ok := priceBand(p); ok {
+			prices.add(band, priceLabel(band))
+		}
+		for _, v := range p.Vehicles {
+			years.add(v.Year, v.Year)
+			makes.add(v.Make, v.Make)
+			if len(f[Make]) > 0 && f.selected(Make, v.Make) {
+				models.add(v.Model, v.Model)
+			}
+		}
+		for _, a := range p.Attributes {
+			if a.Key == "" || a.Value == "" || excluded[a.Key] {
+				continue
+			}
+			c, ok := attrs[a.Key]
+			if !ok {
+				c = newCounter(AttributePrefix+a.Key, a.Key)
+				attrs[a.Key] = c
+			}
+			c.add(a.Value, a.Value)
+		}
+		for _, c := range []*counter{brands, cats, classes, prices, years, makes, models} {
+			c.next()
+		}
+		for _, c := range attrs {
+			c.next()
+		}
+	}
+
+	facets := []Facet{
+		brands.facet(f, byLabel),
+		cats.facet(f, byLabel),
+		classes.facet(f, byLabel),
+		prices.facet(f, byNumber),
+		years.facet(f, byNumberDesc),
+		makes.facet(f, byLabel),
+	}
+	if len(f[Make]) > 0 {
+		facets = append(facets, models.facet(f, byLabel))
+	}
+
+	// offer the attributes that tell the most parts apart
+	var keys []*counter
+	for _, c := range attrs {
+		if len(c.counts) > 1 || len(f[c.key]) > 0 {
+			keys = append(keys, c)
+		}
+	}
+	sort.Sort(byCoverage(keys))
+	for i, c := range keys {
+		if i >= MaxAttributes && len(f[c.key]) == 0 {
+			continue
+		}
+		facets = append(facets, c.facet(f, byLabel))
+	}
+
+	out := facets[:0]
+	for _, fc := range facets {
+		if len(fc.Options) > 0 {
+			out = append(out, fc)
+		}
+	}
+	return out
+}
+
+// counter counts how many parts have each value of a facet, counting a
+// part once per value.
+type counter struct {
+	key    string
+	name   string
+	counts map[string]int
+	values map[string]string
+	labels map[string]string
+	seen   map[string]bool
+	parts  int
+}
+
+func newCounter(key, name string) *counter {
+	return &counter{
+		key:    key,
+		name:   name,
+		counts: make(map[string]int),
+		values: make(map[string]string),
+		labels: make(map[string]string),
+		seen:   make(map[string]bool),
+	}
+}
+
+func (c *counter) add(value, label string) {
+	if value == "" {
+		return
+	}
+	k := strings.ToLower(value)
+	if c.seen[k] {
+		return
+	}
+	c.seen[k] = true
+	if _, ok := c.values[k]; !ok {
+		c.values[k] = value
+		c.labels[k] = label
+	}
+	c.counts[k]++
+}
+
+// next moves on to the next part.
+func (c *counter) next() {
+	if len(c.seen) > 0 {
+		c.parts++
+		c.seen = make(map[string]bool)
+	}
+}
+
+func (c *counter) facet(f Filters, order func([]Option) sort.Interface) Facet {
+	fc := Facet{
+		Name:    c.name,
+		Key:     c.key,
+		Options: make([]Option, 0, len(c.counts)),
+	}
+	for k, n := range c.counts {
+		fc.Options = append(fc.Options, Option{
+			Value:    c.values[k],
+			Label:    c.labels[k],
+			Count:    n,
+			Selected: f.selected(c.key, c.values[k]),
+		})
+	}
+	for _, v := range f[c.key] {
+		if _, ok := c.counts[strings.ToLower(v)]; !ok {
+			label := v
+			if c.key == Price {
+				label = priceLabel(v)
+			}
+			fc.Options = append(fc.Options, Option{Value: v, Label: label, Selected: true})
+		}
+	}
+	sort.Sort(order(fc.Options))
+	return fc
+}
+
+func categoryIDs(p *products.Part) []string {
+	ids := make([]string, 0, len(p.Categories))
+	for _, c := range p.Categories {
+		ids = append(ids, strconv.Itoa(c.CategoryID))
+	}
+	return ids
+}
+
+func className(p *products.Part) string {
+	if p.Class.Name == "" {
+		return "Other"
+	}
+	return p.Class.Name
+}
+
+func attributeValues(p *products.Part, name string) []string {
+	var vals []string
+	for _, a := range p.Attributes {
+		if strings.EqualFold(a.Key, name) {
+			vals = append(vals, a.Value)
+		}
+	}
+	return vals
+}
+
+// priceBand is the list price range of a part, e.g. "50-100".
+func priceBand(p *products.Part) (string, bool) {
+	for _, pr := range p.Pricing {
+		if pr.Type == "List" && pr.Price > 0 {
+			low := int(pr.Price) / PriceBand * PriceBand
+			return fmt.Sprintf("%d-%d", low, low+PriceBand), true
+		}
+	}
+	return "", false
+}
+
+func priceLabel(band string) string {
+	segs := strings.SplitN(band, "-", 2)
+	if len(segs) != 2 {
+		return band
+	}
+	return fmt.Sprintf("$%s - $%s", segs[0], segs[1])
+}
+
+func leadingNumber(s string) int {
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(s)
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
+type optionSort struct {
+	opts []Option
+	less func(a, b Option) bool
+}
+
+func (s optionSort) Len() int           { return len(s.opts) }
+func (s optionSort) Swap(i, j int)      { s.opts[i], s.opts[j] = s.opts[j], s.opts[i] }
+func (s optionSort) Less(i, j int) bool { return s.less(s.opts[i], s.opts[j]) }
+
+func byLabel(opts []Option) sort.Interface {
+	return optionSort{opts, func(a, b Option) bool {
+		return strings.ToLower(a.Label) < strings.ToLower(b.Label)
+	}}
+}
+
+func byNumber(opts []Option) sort.Interface {
+	return optionSort{opts, func(a, b Option) bool {
+		return leadingNumber(a.Value) < leadingNumber(b.Value)
+	}}
+}
+
+func byNumberDesc(opts []Option) sort.Interface {
+	return optionSort{opts, func(a, b Option) bool {
+		return leadingNumber(a.Value) > leadingNumber(b.Value)
+	}}
+}
+
+type byCoverage []*counter
+
+func (s byCoverage) Len() int      { return len(s) }
+func (s byCoverage) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCoverage) Less(i, j int) bool {
+	if s[i].parts != s[j].parts {
+		return s[i].parts > s[j].parts
+	}
+	return s[i].name < s[j].name
+}
@@ -0,0 +1,154 @@
+package facet
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/curt-labs/API/models/brand"
+	"github.com/curt-labs/API/models/products"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testParts() []*products.Part {
+	return []*products.Part{
+		{
+			ID:         1,
+			Brand:      brand.Brand{ID: 1, Name: "CURT"},
+			Class:      products.Class{Name: "Class III"},
+			Categories: []products.Category{{CategoryID: 10, Title: "Trailer Hitches"}},
+			Pricing:    []products.Price{{Type: "List", Price: 189.99}},
+			Attributes: []products.Attribute{{Key: "Finish", Value: "Black"}, {Key: "UPC", Value: "1"}},
+			Vehicles: []products.VehicleApplication{
+				{Year: "2012", Make: "Ford", Model: "F-150"},
+				{Year: "2013", Make: "Ram", Model: "1500"},
+			},
+		},
+		{
+			ID:         2,
+			Brand:      brand.Brand{ID: 1, Name: "CURT"},
+			Class:      products.Class{Name: "Class III"},
+			Categories: []products.Category{{CategoryID: 10, Title: "Trailer Hitches"}},
+			Pricing:    []products.Price{{Type: "List", Price: 160}},
+			Attributes: []products.Attribute{{Key: "Finish", Value: "Chrome"}, {Key: "UPC", Value: "2"}},
+			Vehicles:   []products.VehicleApplication{{Year: "2012", Make: "Ram", Model: "1500"}},
+		},
+		{
+			ID:         3,
+			Brand:      brand.Brand{ID: 3, Name: "ARIES"},
+			Categories: []products.Category{{CategoryID: 20, Title: "Running Boards"}},
+			Pricing:    []products.Price{{Type: "Jobber", Price: 20}},
+		},
+	}
+}
+
+func find(facets []Facet, key string) *Facet {
+	for i := range facets {
+		if facets[i].Key == key {
+			return &facets[i]
+		}
+	}
+	return nil
+}
+
+func TestParseFilters(t *testing.T) {
+	Convey("Testing ParseFilters", t, func() {
+		qs, _ := url.ParseQuery("key=abc&page=2&category=10&category=20&make=Ford&attr.Finish=Black&attr.=x&class=")
+		f := ParseFilters(qs)
+		So(len(f), ShouldEqual, 3)
+		So(f[Category], ShouldResemble, []string{"10", "20"})
+		So(f[Make], ShouldResemble, []string{"Ford"})
+		So(f["attr.Finish"], ShouldResemble, []string{"Black"})
+	})
+}
+
+func TestMatch(t *testing.T) {
+	parts := testParts()
+
+	Convey("Testing Match", t, func() {
+		So(Filters{}.Match(parts[0]), ShouldBeTrue)
+
+		f := Filters{Category: {"10", "20"}}
+		So(f.Match(parts[0]), ShouldBeTrue)
+		So(f.Match(parts[2]), ShouldBeTrue)
+
+		f = Filters{Class: {"class iii"}, Price: {"150-200"}}
+		So(f.Match(parts[0]), ShouldBeTrue)
+		So(f.Match(parts[1]), ShouldBeTrue)
+		So(f.Match(parts[2]), ShouldBeFalse)
+
+		f = Filters{Class: {"Other"}}
+		So(f.Match(parts[2]), ShouldBeTrue)
+
+		f = Filters{"attr.finish": {"Black"}}
+		So(f.Match(parts[0]), ShouldBeTrue)
+		So(f.Match(parts[1]), ShouldBeFalse)
+
+		Convey("vehicle selections apply to the same vehicle", func() {
+			f := Filters{Year: {"2012"}, Make: {"Ram"}}
+			So(f.Match(parts[0]), ShouldBeFalse)
+			So(f.Match(parts[1]), ShouldBeTrue)
+			So(f.Match(parts[2]), ShouldBeFalse)
+		})
+	})
+}
+
+func TestCompute(t *testing.T) {
+	parts := testParts()
+
+	Convey("Testing Compute", t, func() {
+		facets := Compute(parts, Filters{}, map[string]bool{"UPC": true})
+
+		b := find(facets, Brand)
+		So(b, ShouldNotBeNil)
+		So(len(b.Options), ShouldEqual, 2)
+		So(b.Options[0].Label, ShouldEqual, "ARIES")
+		So(b.Options[1].Count, ShouldEqual, 2)
+
+		c := find(facets, Class)
+		So(c.Options[0].Value, ShouldEqual, "Class III")
+		So(c.Options[0].Count, ShouldEqual, 2)
+		So(c.Options[1].Value, ShouldEqual, "Other")
+
+		p := find(facets, Price)
+		So(len(p.Options), ShouldEqual, 1)
+		So(p.Options[0].Value, ShouldEqual, "150-200")
+		So(p.Options[0].Label, ShouldEqual, "$150 - $200")
+		So(p.Options[0].Count, ShouldEqual, 2)
+
+		y := find(facets, Year)
+		So(y.Options[0].Value, ShouldEqual, "2013")
+		So(y.Options[1].Value, ShouldEqual, "2012")
+		So(y.Options[1].Count, ShouldEqual, 2)
+
+		m := find(facets, Make)
+		So(len(m.Options), ShouldEqual, 2)
+		So(find(facets, Model), ShouldBeNil)
+
+		fin := find(facets, "attr.Finish")
+		So(fin, ShouldNotBeNil)
+		So(len(fin.Options), ShouldEqual, 2)
+		So(find(facets, "attr.UPC"), ShouldBeNil)
+	})
+
+	Convey("Testing Compute with selections", t, func() {
+		f := Filters{Make: {"Ram"}, Price: {"500-550"}}
+		facets := Compute(parts[:2], f, nil)
+
+		m := find(facets, Model)
+		So(m, ShouldNotBeNil)
+		So(len(m.Options), ShouldEqual, 1)
+		So(m.Options[0].Value, ShouldEqual, "1500")
+		So(m.Options[0].Count, ShouldEqual, 2)
+
+		mk := find(facets, Make)
+		for _, o := range mk.Options {
+			So(o.Selected, ShouldEqual, o.Value == "Ram")
+		}
+
+		p := find(facets, Price)
+		last := p.Options[len(p.Options)-1]
+		So(last.Value, ShouldEqual, "500-550")
+		So(last.Count, ShouldEqual, 0)
+		So(last.Selected, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/search/facet"
+	"github.com/curt-labs/API/models/search/index"
+)
+
+// maxCandidates is how many of the best matches faceted searches filter
+// and count.
+const maxCandidates = 1000
+
+// excludedAttributes are the attributes that aren't offered as facets.
+var excludedAttributes map[string]bool
+
+func (q Query) faceted() bool {
+	return q.Facets || len(q.Filters) > 0
+}
+
+// facetedSearch filters the best matches of a query by the selected
+// facets, counts the facets of what's left and returns a page of it.
+func facetedSearch(q Query, dtx *apicontext.DataContext) (*Result, error) {
+	backend := CurrentBackend()
+	hits, err := backend.Candidates(q, dtx, maxCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []Hit
+	var parts []*products.Part
+	for _, h := range hits {
+		p, ok := h.Data.(*products.Part)
+		if h.Type != index.Part || !ok {
+			// only parts have facets
+			if len(q.Filters) == 0 {
+				kept = append(kept, h)
+			}
+			continue
+		}
+		if q.Filters.Match(p) {
+			kept = append(kept, h)
+			parts = append(parts, p)
+		}
+	}
+
+	localLock.RLock()
+	excluded := excludedAttributes
+	localLock.RUnlock()
+
+	res := q.result(backend.Name())
+	res.Total = len(kept)
+	res.Facets = facet.Compute(parts, q.Filters, excluded)
+
+	from := q.from()
+	if from < len(kept) {
+		end := from + q.Count
+		if end > len(kept) {
+			end = len(kept)
+		}
+		res.Hits = kept[from:end]
+	}
+
+	return res, nil
+}
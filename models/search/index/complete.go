@@ -0,0 +1,185 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Completion types besides parts and categories.
+const (
+	Make  = "make"
+	Model = "model"
+)
+
+// maxScan bounds how many keys a completion looks at, so that one or
+// two character prefixes stay fast.
+const maxScan = 5000
+
+// Completion is something a partly typed query can be completed to.
+type Completion struct {
+	Text string `json:"text" xml:"text,attr"`
+	Type string `json:"type" xml:"type,attr"`
+	ID   string `json:"id,omitempty" xml:"id,attr,omitempty"`
+	// Brands are the brands the completion belongs to; empty belongs to
+	// every brand.
+	Brands []int `json:"-" xml:"-"`
+	// Weight ranks completions that match equally well, e.g. the number
+	// of parts in a category.
+	Weight int `json:"-" xml:"-"`
+	// Data is the completed object, when there is one.
+	Data interface{} `json:"-" xml:"-"`
+}
+
+type completionKey struct {
+	key   string
+	entry int
+	// start is set for keys from the beginning of the text, which rank
+	// above matches of a later word.
+	start bool
+}
+
+// Completer finds completions by prefix. Every word of a completion's
+// text can be typed first, and punctuation and spacing are ignored.
+type Completer struct {
+	entries []Completion
+	keys    []completionKey
+}
+
+// NewCompleter indexes the given completions.
+func NewCompleter(cs []Completion) *Completer {
+	c := &Completer{entries: cs}
+	for i, e := range cs {
+		key := foldKey(e.Text)
+		if key == "" {
+			continue
+		}
+		c.add(key, i, true)
+		for j := 1; j < len(key); j++ {
+			if key[j-1] == ' ' {
+				c.add(key[j:], i, false)
+			}
+		}
+	}
+	sort.Sort(byKey(c.keys))
+	return c
+}
+
+// add keys an entry by a suffix of its text, with and without spaces so
+// that "f150" finds "F-150".
+func (c *Completer) add(key string, entry int, start bool) {
+	c.keys = append(c.keys, completionKey{key: key, entry: entry, start: start})
+	if compact := strings.Replace(key, " ", "", -1); compact != key {
+		c.keys = append(c.keys, completionKey{key: compact, entry: entry, start: start})
+	}
+}
+
+// Len is the number of indexed completions.
+func (c *Completer) Len() int {
+	return len(c.entries)
+}
+
+// Complete returns up to limit completions of prefix for the given
+// brands (empty for all): those starting with the prefix before those
+// with a later word starting with it, then by weight and length. keep,
+// when set, drops the completions it returns false for.
+func (c *Completer) Complete(prefix string, brands []int, limit int, keep func(*Completion) bool) []Completion {
+	out := make([]Completion, 0)
+
+	key := foldKey(prefix)
+	if key == "" || limit <= 0 {
+		return out
+	}
+
+	allowed := make(map[int]bool)
+	for _, b := range brands {
+		allowed[b] = true
+	}
+
+	// found maps entries to their position in matches, or -1 when kept
+	// out
+	found := make(map[int]int)
+	var matches []match
+	probe := func(k string) {
+		i := sort.Search(len(c.keys), func(i int) bool { return c.keys[i].key >= k })
+		for n := 0; i < len(c.keys) && n < maxScan && strings.HasPrefix(c.keys[i].key, k); i, n = i+1, n+1 {
+			ck := c.keys[i]
+			e := &c.entries[ck.entry]
+			if len(allowed) > 0 && len(e.Brands) > 0 && !anyAllowed(e.Brands, allowed) {
+				continue
+			}
+			if m, ok := found[ck.entry]; ok {
+				if m < 0 {
+					continue
+				}
+				matches[m].start = matches[m].start || ck.start
+				continue
+			}
+			if keep != nil && !keep(e) {
+				found[ck.entry] = -1
+				continue
+			}
+			found[ck.entry] = len(matches)
+			matches = append(matches, match{start: ck.start, c: e})
+		}
+	}
+	probe(key)
+	if compact := strings.Replace(key, " ", "", -1); compact != key {
+		probe(compact)
+	}
+
+	sort.Sort(byRank(matches))
+	for _, m := range matches {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, *m.c)
+	}
+	return out
+}
+
+// foldKey lower cases text and collapses everything but letters and
+// digits into single spaces.
+func foldKey(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func anyAllowed(brands []int, allowed map[int]bool) bool {
+	for _, b := range brands {
+		if allowed[b] {
+			return true
+		}
+	}
+	return false
+}
+
+type match struct {
+	start bool
+	c     *Completion
+}
+
+type byRank []match
+
+func (s byRank) Len() int      { return len(s) }
+func (s byRank) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRank) Less(i, j int) bool {
+	a, b := s[i], s[j]
+	if a.start != b.start {
+		return a.start
+	}
+	if a.c.Weight != b.c.Weight {
+		return a.c.Weight > b.c.Weight
+	}
+	if len(a.c.Text) != len(b.c.Text) {
+		return len(a.c.Text) < len(b.c.Text)
+	}
+	return a.c.Text < b.c.Text
+}
+
+type byKey []completionKey
+
+func (s byKey) Len() int           { return len(s) }
+func (s byKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byKey) Less(i, j int) bool { return s[i].key < s[j].key }
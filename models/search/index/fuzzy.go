@@ -0,0 +1,114 @@
+package index
+
+import (
+	"strings"
+)
+
+// Distance is the number of single character insertions, deletions,
+// substitutions and adjacent transpositions needed to turn a into b.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	// three rows are enough to check for transpositions
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+// MaxDistance is how many typos a term of this length may have and still
+// be corrected.
+func MaxDistance(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 7:
+		return 1
+	}
+	return 2
+}
+
+// Correct replaces the words of a query that aren't in the index with
+// the closest indexed term, preferring the most common one on ties. It
+// reports whether anything was replaced.
+func (idx *Index) Correct(query string) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(rxTags.ReplaceAllString(query, " ")), isSeparator)
+
+	changed := false
+	for i, w := range words {
+		if stopwords[w] || len(idx.postings[Stem(w)]) > 0 {
+			continue
+		}
+		if t, ok := idx.closest(Stem(w)); ok {
+			words[i] = t
+			changed = true
+		}
+	}
+
+	return strings.Join(words, " "), changed
+}
+
+func (idx *Index) closest(term string) (string, bool) {
+	max := MaxDistance(term)
+	if max == 0 {
+		return "", false
+	}
+
+	best, bestDist, bestDF := "", max+1, 0
+	for t, postings := range idx.postings {
+		if strings.HasPrefix(t, partNumberPrefix) || abs(len(t)-len(term)) > max {
+			continue
+		}
+		d := Distance(term, t)
+		if d > max {
+			continue
+		}
+		if d < bestDist || (d == bestDist && (len(postings) > bestDF || (len(postings) == bestDF && t < best))) {
+			best, bestDist, bestDF = t, d, len(postings)
+		}
+	}
+
+	return best, best != ""
+}
+
+func minInt(n ...int) int {
+	m := n[0]
+	for _, v := range n[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,264 @@
+package index
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	Part     = "part"
+	Category = "category"
+	Content  = "content"
+	News     = "news"
+
+	// BM25 parameters
+	k1 = 1.2
+	b  = 0.75
+
+	// partNumberPrefix marks the terms that hold normalized part numbers
+	// so they can't collide with words.
+	partNumberPrefix = "pn:"
+)
+
+// Weights is how much a term occurring in each field counts towards a
+// document's term frequency.
+var Weights = struct {
+	Title      float64
+	Text       float64
+	PartNumber float64
+}{
+	Title:      3,
+	Text:       1,
+	PartNumber: 10,
+}
+
+// Document is something that can be found by a search.
+type Document struct {
+	ID          string
+	Type        string
+	Ref         int
+	Brands      []int
+	Title       string
+	Text        string
+	PartNumbers []string
+	Data        interface{}
+}
+
+// Options narrows and pages a search.
+type Options struct {
+	// Brands restricts results to documents of these brands; empty
+	// doesn't restrict.
+	Brands []int
+	// Types restricts results to these document types; empty doesn't
+	// restrict.
+	Types []string
+	// Filter, when set, drops the documents it returns false for.
+	Filter func(d *Document) bool
+	From   int
+	Size   int
+}
+
+// Hit is a matched document and its relevance.
+type Hit struct {
+	Doc   *Document
+	Score float64
+}
+
+// Results is a page of hits and the number of documents that matched.
+type Results struct {
+	Total int
+	Hits  []Hit
+}
+
+type posting struct {
+	doc int
+	tf  float64
+}
+
+// Index is an immutable inverted index. Build a new one to pick up
+// changes.
+type Index struct {
+	docs     []Document
+	lengths  []float64
+	avgLen   float64
+	postings map[string][]posting
+	byID     map[string]int
+}
+
+// New indexes the given documents.
+func New(docs []Document) *Index {
+	idx := &Index{
+		docs:     docs,
+		lengths:  make([]float64, len(docs)),
+		postings: make(map[string][]posting),
+		byID:     make(map[string]int, len(docs)),
+	}
+
+	var total float64
+	for i, d := range docs {
+		idx.byID[d.ID] = i
+
+		tf := make(map[string]float64)
+		for _, t := range Tokenize(d.Title) {
+			tf[t] += Weights.Title
+		}
+		for _, t := range Tokenize(d.Text) {
+			tf[t] += Weights.Text
+		}
+		numbers := make(map[string]bool)
+		for _, pn := range d.PartNumbers {
+			n := NormalizePartNumber(pn)
+			if n == "" || numbers[n] {
+				continue
+			}
+			numbers[n] = true
+			tf[partNumberPrefix+n] += Weights.PartNumber
+			for _, t := range Tokenize(pn) {
+				tf[t] += Weights.Title
+			}
+		}
+
+		var length float64
+		for t, f := range tf {
+			idx.postings[t] = append(idx.postings[t], posting{doc: i, tf: f})
+			length += f
+		}
+		idx.lengths[i] = length
+		total += length
+	}
+	if len(docs) > 0 {
+		idx.avgLen = total / float64(len(docs))
+	}
+
+	return idx
+}
+
+// Len is the number of indexed documents.
+func (idx *Index) Len() int {
+	return len(idx.docs)
+}
+
+// Get returns the document with the given ID, or nil.
+func (idx *Index) Get(id string) *Document {
+	i, ok := idx.byID[id]
+	if !ok {
+		return nil
+	}
+	return &idx.docs[i]
+}
+
+// WithData returns a copy of the index in which the documents with the
+// given IDs carry new data. Their terms aren't read again, so it only
+// suits changes that don't affect what a document is found by, like the
+// prices of a part.
+func (idx *Index) WithData(data map[string]interface{}) *Index {
+	docs := make([]Document, len(idx.docs))
+	copy(docs, idx.docs)
+	for id, d := range data {
+		if i, ok := idx.byID[id]; ok {
+			docs[i].Data = d
+		}
+	}
+	cp := *idx
+	cp.docs = docs
+	return &cp
+}
+
+// Search ranks the documents matching any term of the query with BM25.
+func (idx *Index) Search(query string, opts Options) Results {
+	return idx.rank(idx.queryTerms(query), opts)
+}
+
+func (idx *Index) queryTerms(query string) []string {
+	terms := Tokenize(query)
+	if LooksLikePartNumber(query) {
+		terms = append(terms, partNumberPrefix+NormalizePartNumber(query))
+	}
+	return terms
+}
+
+func (idx *Index) rank(terms []string, opts Options) Results {
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	n := float64(len(idx.docs))
+
+	for _, t := range terms {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		postings := idx.postings[t]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for _, p := range postings {
+			norm := 1 - b + b*idx.lengths[p.doc]/idx.avgLen
+			scores[p.doc] += idf * p.tf * (k1 + 1) / (p.tf + k1*norm)
+		}
+	}
+
+	brands := make(map[int]bool)
+	for _, br := range opts.Brands {
+		brands[br] = true
+	}
+	types := make(map[string]bool)
+	for _, t := range opts.Types {
+		types[t] = true
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for i, score := range scores {
+		d := &idx.docs[i]
+		if len(types) > 0 && !types[d.Type] {
+			continue
+		}
+		if len(brands) > 0 && !inBrands(d.Brands, brands) {
+			continue
+		}
+		if opts.Filter != nil && !opts.Filter(d) {
+			continue
+		}
+		hits = append(hits, Hit{Doc: d, Score: score})
+	}
+	sort.Sort(byScore(hits))
+
+	return page(hits, opts)
+}
+
+func page(hits []Hit, opts Options) Results {
+	res := Results{Total: len(hits)}
+	if opts.From >= len(hits) {
+		res.Hits = []Hit{}
+		return res
+	}
+	end := len(hits)
+	if opts.Size > 0 && opts.From+opts.Size < end {
+		end = opts.From + opts.Size
+	}
+	res.Hits = hits[opts.From:end]
+	return res
+}
+
+func inBrands(docBrands []int, brands map[int]bool) bool {
+	for _, br := range docBrands {
+		if brands[br] {
+			return true
+		}
+	}
+	return false
+}
+
+type byScore []Hit
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Score == s[j].Score {
+		return s[i].Doc.ID < s[j].Doc.ID
+	}
+	return s[i].Score > s[j].Score
+}
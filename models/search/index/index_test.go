@@ -0,0 +1,207 @@
+package index
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenize(t *testing.T) {
+	Convey("Testing Tokenize", t, func() {
+		So(Tokenize("The <b>Trailer</b> Hitches, for trucks!"), ShouldResemble, []string{"trailer", "hitch", "truck"})
+		So(Tokenize("2-5/16\" Ball"), ShouldResemble, []string{"2", "5", "16", "ball"})
+		So(Tokenize(""), ShouldBeEmpty)
+	})
+
+	Convey("Testing Stem", t, func() {
+		So(Stem("hitches"), ShouldEqual, "hitch")
+		So(Stem("accessories"), ShouldEqual, "accessory")
+		So(Stem("boxes"), ShouldEqual, "box")
+		So(Stem("mounts"), ShouldEqual, "mount")
+		So(Stem("brass"), ShouldEqual, "brass")
+		So(Stem("bus"), ShouldEqual, "bus")
+		So(Stem("5000lbs"), ShouldEqual, "5000lbs")
+	})
+
+	Convey("Testing NormalizePartNumber", t, func() {
+		So(NormalizePartNumber("c-11000.3"), ShouldEqual, "C110003")
+		So(NormalizePartNumber(" 13 704 "), ShouldEqual, "13704")
+	})
+
+	Convey("Testing LooksLikePartNumber", t, func() {
+		So(LooksLikePartNumber("13704"), ShouldBeTrue)
+		So(LooksLikePartNumber("C-110003"), ShouldBeTrue)
+		So(LooksLikePartNumber("hitch"), ShouldBeFalse)
+		So(LooksLikePartNumber("12"), ShouldBeFalse)
+		So(LooksLikePartNumber("class 3 hitch for a 2012 ford"), ShouldBeFalse)
+	})
+}
+
+func TestSearch(t *testing.T) {
+	idx := New([]Document{
+		{ID: "part:1", Type: Part, Ref: 1, Brands: []int{1}, Title: "Class 3 Trailer Hitch", Text: "Receiver hitch for trucks", PartNumbers: []string{"13704"}},
+		{ID: "part:2", Type: Part, Ref: 2, Brands: []int{1}, Title: "Hitch Ball", Text: "2 inch ball mount", PartNumbers: []string{"40002"}},
+		{ID: "part:3", Type: Part, Ref: 3, Brands: []int{3}, Title: "Running Boards", Text: "Aluminum running boards", PartNumbers: []string{"A-2051"}},
+		{ID: "category:10", Type: Category, Ref: 10, Brands: []int{1}, Title: "Trailer Hitches", Text: "Hitches for every vehicle"},
+		{ID: "news:5", Type: News, Ref: 5, Brands: []int{1, 3}, Title: "New running boards", Text: "We launched a line of boards"},
+	})
+
+	Convey("Testing Search", t, func() {
+		So(idx.Len(), ShouldEqual, 5)
+
+		Convey("ranks title matches first", func() {
+			res := idx.Search("trailer hitches", Options{})
+			So(res.Total, ShouldEqual, 3)
+			So(res.Hits[0].Doc.ID, ShouldEqual, "category:10")
+			So(res.Hits[1].Doc.ID, ShouldEqual, "part:1")
+			So(res.Hits[0].Score, ShouldBeGreaterThan, res.Hits[1].Score)
+		})
+
+		Convey("matches part numbers however they're punctuated", func() {
+			res := idx.Search("a2051", Options{})
+			So(res.Total, ShouldEqual, 1)
+			So(res.Hits[0].Doc.Ref, ShouldEqual, 3)
+
+			res = idx.Search("137-04", Options{})
+			So(res.Total, ShouldEqual, 1)
+			So(res.Hits[0].Doc.Ref, ShouldEqual, 1)
+		})
+
+		Convey("filters by brand and type", func() {
+			res := idx.Search("running boards", Options{Brands: []int{1}})
+			So(res.Total, ShouldEqual, 1)
+			So(res.Hits[0].Doc.ID, ShouldEqual, "news:5")
+
+			res = idx.Search("running boards", Options{Types: []string{Part}})
+			So(res.Total, ShouldEqual, 1)
+			So(res.Hits[0].Doc.ID, ShouldEqual, "part:3")
+
+			res = idx.Search("hitch", Options{Filter: func(d *Document) bool { return d.Type != Part }})
+			So(res.Total, ShouldEqual, 1)
+			So(res.Hits[0].Doc.ID, ShouldEqual, "category:10")
+		})
+
+		Convey("pages results", func() {
+			res := idx.Search("hitch", Options{From: 1, Size: 1})
+			So(res.Total, ShouldEqual, 3)
+			So(len(res.Hits), ShouldEqual, 1)
+
+			res = idx.Search("hitch", Options{From: 5, Size: 1})
+			So(res.Total, ShouldEqual, 3)
+			So(res.Hits, ShouldBeEmpty)
+		})
+
+		Convey("returns nothing for unknown terms", func() {
+			res := idx.Search("snowplow", Options{})
+			So(res.Total, ShouldEqual, 0)
+			So(res.Hits, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestFuzzy(t *testing.T) {
+	Convey("Testing Distance", t, func() {
+		So(Distance("hitch", "hitch"), ShouldEqual, 0)
+		So(Distance("hitch", "hich"), ShouldEqual, 1)
+		So(Distance("hitch", "htich"), ShouldEqual, 1)
+		So(Distance("13704", "13740"), ShouldEqual, 1)
+		So(Distance("", "abc"), ShouldEqual, 3)
+		So(Distance("C110003", "110003"), ShouldEqual, 1)
+	})
+
+	Convey("Testing MaxDistance", t, func() {
+		So(MaxDistance("box"), ShouldEqual, 0)
+		So(MaxDistance("hitch"), ShouldEqual, 1)
+		So(MaxDistance("receiver"), ShouldEqual, 2)
+	})
+
+	Convey("Testing Correct", t, func() {
+		idx := New([]Document{
+			{ID: "part:1", Type: Part, Title: "Trailer Hitch Receiver"},
+			{ID: "part:2", Type: Part, Title: "Hitch Ball"},
+		})
+
+		c, ok := idx.Correct("trialer hich")
+		So(ok, ShouldBeTrue)
+		So(c, ShouldEqual, "trailer hitch")
+
+		c, ok = idx.Correct("the hitch")
+		So(ok, ShouldBeFalse)
+		So(c, ShouldEqual, "the hitch")
+
+		_, ok = idx.Correct("snowplow")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Testing Get", t, func() {
+		idx := New([]Document{{ID: "part:1", Type: Part, Title: "Hitch"}})
+		So(idx.Get("part:1").Title, ShouldEqual, "Hitch")
+		So(idx.Get("part:2"), ShouldBeNil)
+	})
+
+	Convey("Testing WithData", t, func() {
+		idx := New([]Document{{ID: "part:1", Type: Part, Title: "Hitch", Data: 1}})
+		next := idx.WithData(map[string]interface{}{"part:1": 2, "part:9": 3})
+		So(next.Get("part:1").Data, ShouldEqual, 2)
+		So(next.Get("part:9"), ShouldBeNil)
+		So(idx.Get("part:1").Data, ShouldEqual, 1)
+		So(next.Search("hitch", Options{}).Total, ShouldEqual, 1)
+	})
+}
+
+func TestComplete(t *testing.T) {
+	c := NewCompleter([]Completion{
+		{Text: "C-11000.3", Type: Part, ID: "1", Brands: []int{1}},
+		{Text: "11003", Type: Part, ID: "2", Brands: []int{1}},
+		{Text: "Trailer Hitches", Type: Category, ID: "10", Brands: []int{1}, Weight: 40},
+		{Text: "Trailer Wiring", Type: Category, ID: "11", Brands: []int{1}, Weight: 60},
+		{Text: "Ford", Type: Make, Brands: []int{1, 3}, Weight: 90},
+		{Text: "Ford F-150", Type: Model, Brands: []int{1}, Weight: 30},
+		{Text: "Ford Focus", Type: Model, Brands: []int{3}, Weight: 5},
+	})
+
+	texts := func(cs []Completion) []string {
+		out := make([]string, 0, len(cs))
+		for _, c := range cs {
+			out = append(out, c.Text)
+		}
+		return out
+	}
+
+	Convey("Testing Complete", t, func() {
+		So(c.Len(), ShouldEqual, 7)
+
+		Convey("ranks by weight then length", func() {
+			So(texts(c.Complete("tra", nil, 10, nil)), ShouldResemble, []string{"Trailer Wiring", "Trailer Hitches"})
+			So(texts(c.Complete("fo", nil, 10, nil)), ShouldResemble, []string{"Ford", "Ford F-150", "Ford Focus"})
+			So(texts(c.Complete("fo", nil, 2, nil)), ShouldResemble, []string{"Ford", "Ford F-150"})
+		})
+
+		Convey("matches later words after the start", func() {
+			So(texts(c.Complete("hitch", nil, 10, nil)), ShouldResemble, []string{"Trailer Hitches"})
+			So(texts(c.Complete("f", nil, 10, nil)), ShouldResemble, []string{"Ford", "Ford F-150", "Ford Focus"})
+			So(texts(c.Complete("F-1", nil, 10, nil)), ShouldResemble, []string{"Ford F-150"})
+			So(texts(c.Complete("f150", nil, 10, nil)), ShouldResemble, []string{"Ford F-150"})
+		})
+
+		Convey("ignores punctuation in part numbers", func() {
+			So(texts(c.Complete("c1100", nil, 10, nil)), ShouldResemble, []string{"C-11000.3"})
+			So(texts(c.Complete("1100", nil, 10, nil)), ShouldResemble, []string{"11003", "C-11000.3"})
+		})
+
+		Convey("limits to brands", func() {
+			So(texts(c.Complete("ford", []int{3}, 10, nil)), ShouldResemble, []string{"Ford", "Ford Focus"})
+			So(c.Complete("trailer", []int{2}, 10, nil), ShouldBeEmpty)
+		})
+
+		Convey("drops what keep rejects", func() {
+			keep := func(e *Completion) bool { return e.ID != "11" }
+			So(texts(c.Complete("tra", nil, 10, keep)), ShouldResemble, []string{"Trailer Hitches"})
+		})
+
+		Convey("returns nothing for empty queries", func() {
+			So(c.Complete(" - ", nil, 10, nil), ShouldBeEmpty)
+			So(c.Complete("zzz", nil, 10, nil), ShouldBeEmpty)
+		})
+	})
+}
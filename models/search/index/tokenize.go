@@ -0,0 +1,81 @@
+package index
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	stopwords = map[string]bool{
+		"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+		"be": true, "by": true, "for": true, "from": true, "in": true, "is": true,
+		"it": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+		"this": true, "to": true, "with": true,
+	}
+
+	rxTags = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Tokenize splits text into lower cased, stemmed terms, dropping
+// punctuation, markup and stopwords.
+func Tokenize(text string) []string {
+	text = rxTags.ReplaceAllString(text, " ")
+
+	fields := strings.FieldsFunc(strings.ToLower(text), isSeparator)
+
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if stopwords[f] {
+			continue
+		}
+		terms = append(terms, Stem(f))
+	}
+	return terms
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Stem strips common English plural endings so "hitches" and "hitch"
+// index to the same term. Terms with digits are left alone since they
+// are usually sizes or part numbers.
+func Stem(term string) string {
+	if len(term) <= 3 || strings.IndexFunc(term, unicode.IsDigit) >= 0 {
+		return term
+	}
+	switch {
+	case strings.HasSuffix(term, "ies") && len(term) > 4:
+		return term[:len(term)-3] + "y"
+	case strings.HasSuffix(term, "ches"), strings.HasSuffix(term, "shes"),
+		strings.HasSuffix(term, "sses"), strings.HasSuffix(term, "xes"):
+		return term[:len(term)-2]
+	case strings.HasSuffix(term, "ss"), strings.HasSuffix(term, "us"):
+		return term
+	case strings.HasSuffix(term, "s"):
+		return term[:len(term)-1]
+	}
+	return term
+}
+
+// NormalizePartNumber upper cases a part number and drops everything
+// but letters and digits, so "c-11000.3" and "C 110003" are equal.
+func NormalizePartNumber(pn string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, pn)
+}
+
+// LooksLikePartNumber reports whether a query is plausibly a part
+// number: short, and made of digits with optional letters.
+func LooksLikePartNumber(q string) bool {
+	n := NormalizePartNumber(q)
+	if len(n) < 3 || len(n) > 20 {
+		return false
+	}
+	return strings.IndexFunc(n, unicode.IsDigit) >= 0 && len(strings.Fields(q)) <= 3
+}
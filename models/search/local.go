@@ -0,0 +1,560 @@
+package search
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/interchange"
+	"github.com/curt-labs/API/models/news"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/search/index"
+	"github.com/curt-labs/API/models/site"
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	rxTags = regexp.MustCompile(`<[^>]*>`)
+
+	statuses = []int{700, 800, 810, 815, 850, 870, 888, 900, 910, 950}
+
+	siteContent = `select s.contentID, s.page_title, s.meta_description, s.keywords, s.slug, wub.brandID,
+		(select scr.content_text from SiteContentRevision as scr
+			where scr.contentID = s.contentID && scr.active = 1
+			order by scr.createdOn desc limit 1) as text
+		from SiteContent as s
+		join WebsiteToBrand as wub on wub.WebsiteID = s.websiteID
+		where s.active = 1 && s.published = 1 && s.requireAuthentication = 0`
+	excludedAttributeTypes = `select distinct field from PartAttribute where canFilter = 0`
+	legacyNumbers          = `select partID, oldPartNumber from Part where oldPartNumber is not null && oldPartNumber != ''`
+	newsItems              = `select ni.newsItemID, ni.title, ni.lead, ni.content, ni.slug, nib.brandID
+		from NewsItem as ni
+		join NewsItemToBrand as nib on nib.newsItemID = ni.newsItemID
+		where ni.active = 1`
+
+	local     *index.Index
+	localLock sync.RWMutex
+
+	// ErrIndexing is returned by local searches before the first index
+	// build has finished.
+	ErrIndexing = errors.New("the search index is still being built")
+)
+
+type localBackend struct{}
+
+func (localBackend) Name() string {
+	return Local
+}
+
+func (localBackend) Search(q Query, dtx *apicontext.DataContext) (*Result, error) {
+	localLock.RLock()
+	idx := local
+	localLock.RUnlock()
+	if idx == nil {
+		return nil, ErrIndexing
+	}
+
+	res := idx.Search(q.Term, index.Options{
+		Brands: q.brands(dtx),
+		Filter: visibleDoc(dtx),
+		From:   q.from(),
+		Size:   q.Count,
+	})
+
+	result := q.result(Local)
+	result.Total = res.Total
+	for _, h := range res.Hits {
+		result.Hits = append(result.Hits, localHit(h))
+	}
+
+	return result, nil
+}
+
+func (localBackend) Candidates(q Query, dtx *apicontext.DataContext, limit int) ([]Hit, error) {
+	localLock.RLock()
+	idx := local
+	localLock.RUnlock()
+	if idx == nil {
+		return nil, ErrIndexing
+	}
+
+	res := idx.Search(q.Term, index.Options{
+		Brands: q.brands(dtx),
+		Filter: visibleDoc(dtx),
+		Size:   limit,
+	})
+
+	hits := make([]Hit, 0, len(res.Hits))
+	for _, h := range res.Hits {
+		hits = append(hits, localHit(h))
+	}
+	return hits, nil
+}
+
+func localHit(h index.Hit) Hit {
+	hit := Hit{
+		Type:        h.Doc.Type,
+		ID:          strconv.Itoa(h.Doc.Ref),
+		Score:       h.Score,
+		Title:       h.Doc.Title,
+		Description: summary(h.Doc.Text),
+		Data:        h.Doc.Data,
+	}
+	if len(h.Doc.PartNumbers) > 0 {
+		hit.PartNumber = h.Doc.PartNumbers[0]
+	}
+	return hit
+}
+
+// Rebuild loads the numbers parts can be found by and the typeahead
+// completions and, when searching locally, indexes the catalog, site
+// content and news. The new data is swapped in for searches.
+func Rebuild() (int, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	db, err := sql.Open("mysql", database.ConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	parts, pn, err := loadParts(session, db)
+	if err != nil {
+		return 0, err
+	}
+
+	excluded, err := loadExcludedAttributes(db)
+	if err != nil {
+		return 0, err
+	}
+
+	cats, err := loadCategories(session)
+	if err != nil {
+		return 0, err
+	}
+
+	comp, err := buildCompleter(parts, cats)
+	if err != nil {
+		return 0, err
+	}
+
+	if CurrentBackend().Name() != Local {
+		localLock.Lock()
+		numbers = pn
+		excludedAttributes = excluded
+		completer = comp
+		localLock.Unlock()
+		return 0, nil
+	}
+
+	docs := make([]index.Document, 0, len(parts))
+	for _, p := range parts {
+		docs = append(docs, PartDocument(p, pn.aliases(p.ID)...))
+	}
+
+	for _, c := range cats {
+		docs = append(docs, CategoryDocument(c))
+	}
+
+	content, err := contentDocuments(db)
+	if err != nil {
+		return 0, err
+	}
+	docs = append(docs, content...)
+
+	items, err := newsDocuments(db)
+	if err != nil {
+		return 0, err
+	}
+	docs = append(docs, items...)
+
+	idx := index.New(docs)
+
+	localLock.Lock()
+	local = idx
+	numbers = pn
+	excludedAttributes = excluded
+	completer = comp
+	localLock.Unlock()
+
+	return idx.Len(), nil
+}
+
+// RefreshParts reloads parts into the local index without rebuilding it,
+// for changes like their prices that don't affect what they're found by.
+// Parts that aren't indexed are left out.
+func RefreshParts(ids []int) error {
+	if len(ids) == 0 || CurrentBackend().Name() != Local {
+		return nil
+	}
+	localLock.RLock()
+	idx := local
+	localLock.RUnlock()
+	if idx == nil {
+		return nil
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var parts []products.Part
+	if err = session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(bson.M{"id": bson.M{"$in": ids}}).All(&parts); err != nil {
+		return err
+	}
+	data := make(map[string]interface{}, len(parts))
+	for i := range parts {
+		data[index.Part+":"+strconv.Itoa(parts[i].ID)] = &parts[i]
+	}
+
+	localLock.Lock()
+	local = local.WithData(data)
+	localLock.Unlock()
+	return nil
+}
+
+// Schedule rebuilds the local index every interval.
+func Schedule(interval time.Duration) {
+	for {
+		start := time.Now()
+		if n, err := Rebuild(); err != nil {
+			log.Printf("search index build failed: %s\n", err.Error())
+		} else {
+			log.Printf("indexed %d search documents in %s\n", n, time.Since(start))
+		}
+		if interval <= 0 {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+// loadParts returns the active parts and every number they can be found
+// by: their own, their UPC, the numbers of the parts they replaced, their
+// legacy numbers from MySQL and the competitor parts they interchange
+// with.
+func loadParts(session *mgo.Session, db *sql.DB) ([]*products.Part, *partNumbers, error) {
+	active := make(map[int]bool)
+	for _, s := range statuses {
+		active[s] = true
+	}
+
+	var parts []*products.Part
+	replaced := make(map[int]products.Part)
+
+	iter := session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(nil).Iter()
+	var p products.Part
+	for iter.Next(&p) {
+		part := p
+		p = products.Part{}
+
+		if active[part.Status] {
+			parts = append(parts, &part)
+		} else if part.ReplacedBy != 0 {
+			replaced[part.ID] = products.Part{
+				ID:         part.ID,
+				PartNumber: part.PartNumber,
+				ReplacedBy: part.ReplacedBy,
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	pn := newPartNumbers()
+	for _, p := range parts {
+		pn.add(PartNumber{Number: p.PartNumber, Kind: Current, PartID: p.ID, PartNumber: p.PartNumber, BrandID: p.Brand.ID})
+	}
+	for _, p := range parts {
+		if p.UPC != "" {
+			pn.add(PartNumber{Number: p.UPC, Kind: CrossReference, PartID: p.ID, PartNumber: p.PartNumber, BrandID: p.Brand.ID})
+		}
+	}
+
+	// follow chains of replacements to the active part
+	for _, old := range replaced {
+		target := old.ReplacedBy
+		for hops := 0; hops < 10; hops++ {
+			if cur, ok := pn.current(target); ok {
+				pn.add(PartNumber{Number: old.PartNumber, Kind: Superseded, PartID: cur.PartID, PartNumber: cur.PartNumber, BrandID: cur.BrandID})
+				break
+			}
+			next, ok := replaced[target]
+			if !ok {
+				break
+			}
+			target = next.ReplacedBy
+		}
+	}
+
+	rows, err := db.Query(legacyNumbers)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var number string
+		if err := rows.Scan(&id, &number); err != nil {
+			return nil, nil, err
+		}
+		if cur, ok := pn.current(id); ok {
+			pn.add(PartNumber{Number: number, Kind: Legacy, PartID: id, PartNumber: cur.PartNumber, BrandID: cur.BrandID})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	ics, err := interchange.All()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ic := range ics {
+		if cur, ok := pn.current(ic.PartID); ok {
+			pn.add(PartNumber{
+				Number:     ic.CompetitorPart,
+				Kind:       Interchange,
+				PartID:     cur.PartID,
+				PartNumber: cur.PartNumber,
+				BrandID:    cur.BrandID,
+				Competitor: ic.CompetitorName,
+				Quality:    ic.Quality,
+			})
+		}
+	}
+
+	return parts, pn, nil
+}
+
+// PartDocument is the searchable form of a part. Aliases are other
+// numbers the part can be found by.
+func PartDocument(p *products.Part, aliases ...string) index.Document {
+	var text []string
+	for _, c := range p.Content {
+		text = append(text, c.Text)
+	}
+	for _, c := range p.Categories {
+		text = append(text, c.Title)
+	}
+	text = append(text, p.Class.Name)
+	for _, a := range p.Attributes {
+		text = append(text, a.Key, a.Value)
+	}
+
+	return index.Document{
+		ID:          index.Part + ":" + strconv.Itoa(p.ID),
+		Type:        index.Part,
+		Ref:         p.ID,
+		Brands:      []int{p.Brand.ID},
+		Title:       p.ShortDesc,
+		Text:        strings.Join(text, " "),
+		PartNumbers: append([]string{p.PartNumber}, aliases...),
+		Data:        p,
+	}
+}
+
+// loadExcludedAttributes returns the attributes that can't be used to
+// filter parts.
+func loadExcludedAttributes(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query(excludedAttributeTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	excluded := make(map[string]bool)
+	for rows.Next() {
+		var field string
+		if err := rows.Scan(&field); err != nil {
+			return nil, err
+		}
+		excluded[field] = true
+	}
+	return excluded, rows.Err()
+}
+
+// loadCategories returns every category that isn't deleted.
+func loadCategories(session *mgo.Session) ([]products.Category, error) {
+	var cats []products.Category
+	qry := bson.M{"isdeleted": false}
+	err := session.DB(database.ProductDatabase).C(database.CategoryCollectionName).Find(qry).All(&cats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every category is stored once on its own and again inside each of
+	// its ancestors, so only keep the first copy.
+	var out []products.Category
+	seen := make(map[int]bool)
+	var walk func([]products.Category)
+	walk = func(cs []products.Category) {
+		for _, c := range cs {
+			if !seen[c.CategoryID] {
+				seen[c.CategoryID] = true
+				out = append(out, c)
+			}
+			walk(c.Children)
+		}
+	}
+	walk(cats)
+
+	return out, nil
+}
+
+// CategoryDocument is the searchable form of a category. Its children
+// and part ids are left out of the indexed data.
+func CategoryDocument(c products.Category) index.Document {
+	text := []string{c.ShortDesc, c.LongDesc, c.MetaDescription, c.MetaKeywords}
+	for _, ct := range c.Content {
+		text = append(text, ct.Text)
+	}
+
+	c.Children = nil
+	c.PartIDs = nil
+	c.ProductListing = nil
+
+	return index.Document{
+		ID:     index.Category + ":" + strconv.Itoa(c.CategoryID),
+		Type:   index.Category,
+		Ref:    c.CategoryID,
+		Brands: []int{c.Brand.ID},
+		Title:  c.Title,
+		Text:   strings.Join(text, " "),
+		Data:   &c,
+	}
+}
+
+func contentDocuments(db *sql.DB) ([]index.Document, error) {
+	rows, err := db.Query(siteContent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]*index.Document)
+	var docs []*index.Document
+	for rows.Next() {
+		var c site.Content
+		var title, desc, keywords, slug, text *string
+		var brandID int
+		if err := rows.Scan(&c.Id, &title, &desc, &keywords, &slug, &brandID, &text); err != nil {
+			return nil, err
+		}
+		if d, ok := byID[c.Id]; ok {
+			d.Brands = append(d.Brands, brandID)
+			continue
+		}
+
+		c.Title = deref(title)
+		c.MetaDescription = deref(desc)
+		c.Keywords = deref(keywords)
+		c.Slug = deref(slug)
+		d := &index.Document{
+			ID:     index.Content + ":" + strconv.Itoa(c.Id),
+			Type:   index.Content,
+			Ref:    c.Id,
+			Brands: []int{brandID},
+			Title:  c.Title,
+			Text:   strings.Join([]string{c.MetaDescription, c.Keywords, deref(text)}, " "),
+			Data:   &c,
+		}
+		byID[c.Id] = d
+		docs = append(docs, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return flatten(docs), nil
+}
+
+func newsDocuments(db *sql.DB) ([]index.Document, error) {
+	rows, err := db.Query(newsItems)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]*index.Document)
+	var docs []*index.Document
+	for rows.Next() {
+		var n news_model.News
+		var lead, content, slug *string
+		var brandID int
+		if err := rows.Scan(&n.ID, &n.Title, &lead, &content, &slug, &brandID); err != nil {
+			return nil, err
+		}
+		if d, ok := byID[n.ID]; ok {
+			d.Brands = append(d.Brands, brandID)
+			continue
+		}
+
+		n.Lead = deref(lead)
+		n.Slug = deref(slug)
+		n.Active = true
+		d := &index.Document{
+			ID:     index.News + ":" + strconv.Itoa(n.ID),
+			Type:   index.News,
+			Ref:    n.ID,
+			Brands: []int{brandID},
+			Title:  n.Title,
+			Text:   n.Lead + " " + deref(content),
+			Data:   &n,
+		}
+		byID[n.ID] = d
+		docs = append(docs, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return flatten(docs), nil
+}
+
+func flatten(docs []*index.Document) []index.Document {
+	out := make([]index.Document, len(docs))
+	for i, d := range docs {
+		out[i] = *d
+	}
+	return out
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// summary is the start of a document's text, for display with a hit.
+func summary(text string) string {
+	const max = 200
+
+	text = strings.Join(strings.Fields(rxTags.ReplaceAllString(text, " ")), " ")
+	if len(text) <= max {
+		return text
+	}
+	if i := strings.LastIndex(text[:max], " "); i > 0 {
+		return text[:i] + "..."
+	}
+	return text[:max] + "..."
+}
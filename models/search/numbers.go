@@ -0,0 +1,338 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/search/index"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The ways a number can refer to a part.
+const (
+	Current        = "current"
+	Legacy         = "legacy"
+	Superseded     = "superseded"
+	CrossReference = "cross_reference"
+	Interchange    = "interchange"
+
+	maxSuggestions = 5
+)
+
+var numbers *partNumbers
+
+// PartNumber is a number that finds a part, and the part's current
+// number.
+type PartNumber struct {
+	Number     string `json:"number" xml:"number,attr"`
+	Kind       string `json:"kind" xml:"kind,attr"`
+	PartID     int    `json:"part_id" xml:"part_id,attr"`
+	PartNumber string `json:"part_number" xml:"part_number,attr"`
+	BrandID    int    `json:"brand_id" xml:"brand_id,attr"`
+	// Competitor and Quality describe interchange matches.
+	Competitor string `json:"competitor,omitempty" xml:"competitor,attr,omitempty"`
+	Quality    string `json:"quality,omitempty" xml:"quality,attr,omitempty"`
+}
+
+// partNumbers is every number parts can be found by, keyed by the
+// normalized number.
+type partNumbers struct {
+	byNumber map[string][]PartNumber
+	byPart   map[int][]PartNumber
+}
+
+func newPartNumbers() *partNumbers {
+	return &partNumbers{
+		byNumber: make(map[string][]PartNumber),
+		byPart:   make(map[int][]PartNumber),
+	}
+}
+
+// add registers a number for a part. A number already registered for the
+// part is ignored, so add current numbers first.
+func (pn *partNumbers) add(n PartNumber) {
+	key := index.NormalizePartNumber(n.Number)
+	if key == "" {
+		return
+	}
+	for _, existing := range pn.byNumber[key] {
+		if existing.PartID == n.PartID {
+			return
+		}
+	}
+
+	pn.byNumber[key] = append(pn.byNumber[key], n)
+	pn.byPart[n.PartID] = append(pn.byPart[n.PartID], n)
+}
+
+// current returns the current number of a part.
+func (pn *partNumbers) current(partID int) (PartNumber, bool) {
+	for _, n := range pn.byPart[partID] {
+		if n.Kind == Current {
+			return n, true
+		}
+	}
+	return PartNumber{}, false
+}
+
+// aliases is every number of a part, current number first.
+func (pn *partNumbers) aliases(partID int) []string {
+	var out []string
+	for _, n := range pn.byPart[partID] {
+		out = append(out, n.Number)
+	}
+	return out
+}
+
+// lookup returns the parts of the given brands a number refers to,
+// current numbers first.
+func (pn *partNumbers) lookup(number string, brands []int) []PartNumber {
+	var out []PartNumber
+	for _, n := range pn.byNumber[index.NormalizePartNumber(number)] {
+		if inBrands(n.BrandID, brands) {
+			out = append(out, n)
+		}
+	}
+	sort.Stable(byKind(out))
+	return out
+}
+
+// similar returns the current part numbers within a few typos of the
+// given number, closest first.
+func (pn *partNumbers) similar(number string, brands []int) []string {
+	key := index.NormalizePartNumber(number)
+	max := index.MaxDistance(key)
+	if max == 0 {
+		return nil
+	}
+
+	dist := make(map[string]int)
+	for k, ns := range pn.byNumber {
+		if abs(len(k)-len(key)) > max {
+			continue
+		}
+		d := index.Distance(key, k)
+		if d == 0 || d > max {
+			continue
+		}
+		for _, n := range ns {
+			if !inBrands(n.BrandID, brands) {
+				continue
+			}
+			if prev, ok := dist[n.PartNumber]; !ok || d < prev {
+				dist[n.PartNumber] = d
+			}
+		}
+	}
+
+	sugs := make(suggestions, 0, len(dist))
+	for n, d := range dist {
+		sugs = append(sugs, suggestion{number: n, dist: d})
+	}
+	sort.Sort(sugs)
+
+	var out []string
+	for _, s := range sugs {
+		if len(out) == maxSuggestions {
+			break
+		}
+		out = append(out, s.number)
+	}
+	return out
+}
+
+// LookupPartNumber returns the parts a current, legacy, superseded,
+// cross reference or competitor number refers to.
+func LookupPartNumber(number string, dtx *apicontext.DataContext) ([]PartNumber, error) {
+	localLock.RLock()
+	pn, idx := numbers, local
+	localLock.RUnlock()
+	if pn == nil {
+		return nil, ErrIndexing
+	}
+
+	return visibleMatches(pn.lookup(number, dtx.BrandArray), idx, dtx), nil
+}
+
+// pinPartNumbers moves parts whose number matches the query to the top
+// of the first page, adding them when the backend didn't find them, and
+// drops them from later pages.
+func pinPartNumbers(res *Result, matches []PartNumber) {
+	if len(matches) == 0 {
+		return
+	}
+
+	matched := make(map[string]PartNumber)
+	for _, m := range matches {
+		id := strconv.Itoa(m.PartID)
+		if _, ok := matched[id]; !ok {
+			matched[id] = m
+		}
+	}
+
+	var pinned, rest []Hit
+	found := make(map[string]bool)
+	for _, h := range res.Hits {
+		m, ok := matched[h.ID]
+		if !ok || h.Type != index.Part {
+			rest = append(rest, h)
+			continue
+		}
+		h.Match = &m
+		found[h.ID] = true
+		if res.Page == 1 {
+			pinned = append(pinned, h)
+		}
+	}
+	if res.Page > 1 {
+		res.Hits = append([]Hit{}, rest...)
+		return
+	}
+
+	// keep the pinned hits in match order
+	var missing []PartNumber
+	for _, m := range matches {
+		if !found[strconv.Itoa(m.PartID)] {
+			missing = append(missing, m)
+			found[strconv.Itoa(m.PartID)] = true
+		}
+	}
+	added := partHits(missing)
+	res.Total += len(added)
+	pinned = append(pinned, added...)
+	sort.Stable(byMatch(pinned))
+
+	top := 0.0
+	if len(res.Hits) > 0 {
+		top = res.Hits[0].Score
+	}
+	for i := range pinned {
+		if pinned[i].Score < top {
+			pinned[i].Score = top
+		}
+	}
+
+	res.Hits = append(pinned, rest...)
+	if len(res.Hits) > res.Count {
+		res.Hits = res.Hits[:res.Count]
+	}
+}
+
+// partHits builds hits for matched parts, from the local index when
+// there is one and Mongo otherwise.
+func partHits(matches []PartNumber) []Hit {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	localLock.RLock()
+	idx := local
+	localLock.RUnlock()
+
+	data := make(map[int]*products.Part)
+	if idx == nil {
+		var ids []int
+		for _, m := range matches {
+			ids = append(ids, m.PartID)
+		}
+		for _, p := range fetchParts(ids) {
+			part := p
+			data[p.ID] = &part
+		}
+	}
+
+	hits := make([]Hit, 0, len(matches))
+	for _, m := range matches {
+		match := m
+		h := Hit{
+			Type:       index.Part,
+			ID:         strconv.Itoa(m.PartID),
+			PartNumber: m.PartNumber,
+			Match:      &match,
+		}
+		if idx != nil {
+			if d := idx.Get(index.Part + ":" + h.ID); d != nil {
+				h.Title = d.Title
+				h.Description = summary(d.Text)
+				h.Data = d.Data
+			}
+		} else if p, ok := data[m.PartID]; ok {
+			h.Title = p.ShortDesc
+			h.Data = p
+		}
+		hits = append(hits, h)
+	}
+	return hits
+}
+
+func fetchParts(ids []int) []products.Part {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil
+	}
+	defer session.Close()
+
+	var parts []products.Part
+	qry := bson.M{"id": bson.M{"$in": ids}}
+	session.DB(database.ProductDatabase).C(database.ProductCollectionName).Find(qry).All(&parts)
+	return parts
+}
+
+func inBrands(brand int, brands []int) bool {
+	if len(brands) == 0 {
+		return true
+	}
+	for _, b := range brands {
+		if b == brand {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+var kindRank = map[string]int{
+	Current:        0,
+	Superseded:     1,
+	Legacy:         2,
+	CrossReference: 3,
+	Interchange:    4,
+}
+
+type byKind []PartNumber
+
+func (s byKind) Len() int           { return len(s) }
+func (s byKind) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byKind) Less(i, j int) bool { return kindRank[s[i].Kind] < kindRank[s[j].Kind] }
+
+type byMatch []Hit
+
+func (s byMatch) Len() int           { return len(s) }
+func (s byMatch) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byMatch) Less(i, j int) bool { return kindRank[s[i].Match.Kind] < kindRank[s[j].Match.Kind] }
+
+type suggestion struct {
+	number string
+	dist   int
+}
+
+type suggestions []suggestion
+
+func (s suggestions) Len() int      { return len(s) }
+func (s suggestions) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s suggestions) Less(i, j int) bool {
+	if s[i].dist == s[j].dist {
+		return s[i].number < s[j].number
+	}
+	return s[i].dist < s[j].dist
+}
@@ -0,0 +1,68 @@
+package search
+
+import (
+	"encoding/json"
+
+	"github.com/curt-labs/API/models/search/facet"
+)
+
+// Result is a page of search hits, independent of the backend that
+// produced it.
+type Result struct {
+	Query   string `json:"query" xml:"query,attr"`
+	Backend string `json:"backend" xml:"backend,attr"`
+	Total   int    `json:"total" xml:"total,attr"`
+	Page    int    `json:"page" xml:"page,attr"`
+	Count   int    `json:"count" xml:"count,attr"`
+	Hits    []Hit  `json:"hits" xml:"hits>hit"`
+	// Suggestions are corrected queries ("did you mean") offered when
+	// nothing matched the query well.
+	Suggestions []string `json:"suggestions,omitempty" xml:"suggestions>suggestion,omitempty"`
+	// Facets are the ways the results can be narrowed, when they were
+	// asked for.
+	Facets []facet.Facet `json:"facets,omitempty" xml:"facets>facet,omitempty"`
+}
+
+// Hit is a single search result. Data holds the matched object: a part,
+// category, news item or site content.
+type Hit struct {
+	Type        string      `json:"type" xml:"type,attr"`
+	ID          string      `json:"id" xml:"id,attr"`
+	Score       float64     `json:"score" xml:"score,attr"`
+	Title       string      `json:"title,omitempty" xml:"title,omitempty"`
+	PartNumber  string      `json:"part_number,omitempty" xml:"part_number,attr,omitempty"`
+	Description string      `json:"description,omitempty" xml:"description,omitempty"`
+	Data        interface{} `json:"data,omitempty" xml:"-"`
+	// Match is the part number the query matched, for parts found by
+	// number.
+	Match *PartNumber `json:"match,omitempty" xml:"match,omitempty"`
+}
+
+// esSource pulls the display fields out of an Elasticsearch document.
+type esSource struct {
+	PartNumber string `json:"part_number"`
+	ShortDesc  string `json:"short_description"`
+	Title      string `json:"title"`
+}
+
+func esHit(id, typ string, score float64, source *json.RawMessage) Hit {
+	h := Hit{
+		Type:  typ,
+		ID:    id,
+		Score: score,
+	}
+	if source == nil {
+		return h
+	}
+
+	var src esSource
+	if err := json.Unmarshal(*source, &src); err == nil {
+		h.PartNumber = src.PartNumber
+		h.Title = src.Title
+		if h.Title == "" {
+			h.Title = src.ShortDesc
+		}
+	}
+	h.Data = source
+	return h
+}
@@ -42,68 +42,55 @@ func newConn() (*elastic.Client, error) {
 	return elastic.NewSimpleClient(funcs...)
 }
 
-func Dsl(query string, page int, count int, brand int, dtx *apicontext.DataContext, rawPartNumber string) (*elastic.SearchResult, error) {
-
-	if page == 1 {
-		page = 0
-	}
-	if count == 0 {
-		count = 25
-	}
+func Dsl(query string, page int, count int, brand int, dtx *apicontext.DataContext, rawPartNumber string) (*Result, error) {
 	if query == "" {
 		return nil, errors.New("cannot execute a search on an empty query")
 	}
+	q := Query{Term: query, Page: page, Count: count, Brand: brand, RawPartNumber: rawPartNumber}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.Count <= 0 {
+		q.Count = defaultCount
+	}
 
 	c, err := newConn()
 	if err != nil {
 		return nil, err
 	}
 
-	// from := strconv.Itoa(page * count)
-	// size := strconv.Itoa(count)
-
-	return c.Search(findIndex(brand, dtx)).From(page * count).Size(count).Query(elastic.NewQueryStringQuery(query)).Do()
-
-	// var con *elastigo.Conn
-	// if host := os.Getenv("ELASTICSEARCH_IP"); host != "" {
-	// 	con = &elastigo.Conn{
-	// 		Protocol: elastigo.DefaultProtocol,
-	// 		Domain:   host,
-	// 		Port:     os.Getenv("ELASTIC_PORT"),
-	// 		Username: os.Getenv("ELASTIC_USER"),
-	// 		Password: os.Getenv("ELASTIC_PASS"),
-	// 	}
-	// }
-	// if con == nil {
-	// 	return nil, errors.New("failed to connect to elasticsearch")
-	// }
-	//
-	// from := strconv.Itoa(page * count)
-	// size := strconv.Itoa(count)
-	//
-	// filter := elastigo.Filter()
-	// if rawPartNumber != "" {
-	// 	filter.Terms("raw_part", rawPartNumber)
-	// }
-	// index := findIndex(brand, dtx)
-	//
-	// res, err := elastigo.Search(index).Query(
-	// 	elastigo.Query().Search(query),
-	// ).Filter(filter).From(from).Size(size).Result(con)
-	// return res, err
-}
-
-func ExactAndCloseDsl(query string, page int, count int, brand int, dtx *apicontext.DataContext) (*elastigo.SearchResult, error) {
+	res, err := c.Search(findIndex(brand, dtx)).From(q.from()).Size(q.Count).Query(elastic.NewQueryStringQuery(query)).Do()
+	if err != nil {
+		return nil, err
+	}
 
-	if page == 1 {
-		page = 0
+	result := q.result(Elastic)
+	if res.Hits == nil {
+		return result, nil
 	}
-	if count == 0 {
-		count = 25
+	result.Total = int(res.Hits.TotalHits)
+	for _, h := range res.Hits.Hits {
+		var score float64
+		if h.Score != nil {
+			score = *h.Score
+		}
+		result.Hits = append(result.Hits, esHit(h.Id, h.Type, score, h.Source))
 	}
+
+	return result, nil
+}
+
+func ExactAndCloseDsl(query string, page int, count int, brand int, dtx *apicontext.DataContext) (*Result, error) {
 	if query == "" {
 		return nil, errors.New("cannot execute a search on an empty query")
 	}
+	q := Query{Term: query, Page: page, Count: count, Brand: brand, Exact: true}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.Count <= 0 {
+		q.Count = defaultCount
+	}
 
 	var con *elastigo.Conn
 	if host := os.Getenv("ELASTICSEARCH_IP"); host != "" {
@@ -119,8 +106,8 @@ func ExactAndCloseDsl(query string, page int, count int, brand int, dtx *apicont
 		return nil, errors.New("failed to connect to elasticsearch")
 	}
 
-	from := strconv.Itoa(page * count)
-	size := strconv.Itoa(count)
+	from := strconv.Itoa(q.from())
+	size := strconv.Itoa(q.Count)
 
 	index := findIndex(brand, dtx)
 
@@ -146,7 +133,17 @@ func ExactAndCloseDsl(query string, page int, count int, brand int, dtx *apicont
 		},
 	}
 	res, err := con.Search(index, "", nil, args)
-	return &res, err
+	if err != nil {
+		return nil, err
+	}
+
+	result := q.result(Elastic)
+	result.Total = res.Hits.Total
+	for _, h := range res.Hits.Hits {
+		result.Hits = append(result.Hits, esHit(h.Id, h.Type, float64(h.Score), h.Source))
+	}
+
+	return result, nil
 }
 
 func findIndex(brand int, dtx *apicontext.DataContext) string {
@@ -0,0 +1,188 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/helpers/database"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/search/index"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// ariesBrand is the brand of the vehicles in the ARIES lookup.
+	ariesBrand = 3
+
+	// MaxSuggestions caps how many completions Suggest returns.
+	MaxSuggestions = 50
+)
+
+var completer *index.Completer
+
+// Suggest completes a partly typed query to part numbers, category
+// titles and vehicle makes and models of the caller's brands.
+func Suggest(term string, count int, dtx *apicontext.DataContext) ([]index.Completion, error) {
+	localLock.RLock()
+	comp := completer
+	localLock.RUnlock()
+	if comp == nil {
+		return nil, ErrIndexing
+	}
+
+	if count <= 0 {
+		count = 10
+	}
+	if count > MaxSuggestions {
+		count = MaxSuggestions
+	}
+
+	return comp.Complete(term, Query{}.brands(dtx), count, visibleCompletion(dtx)), nil
+}
+
+// vehicle collects a make or model across parts and the lookup.
+type vehicle struct {
+	text   string
+	typ    string
+	brands map[int]bool
+	weight int
+}
+
+// buildCompleter gathers the typeahead completions: the number of every
+// active part, every category weighted by its part count, and the makes
+// and models parts fit and the ARIES lookup holds, weighted by how many
+// parts or lookup entries have them.
+func buildCompleter(parts []*products.Part, cats []products.Category) (*index.Completer, error) {
+	var cs []index.Completion
+
+	for _, p := range parts {
+		cs = append(cs, index.Completion{
+			Text:   p.PartNumber,
+			Type:   index.Part,
+			ID:     strconv.Itoa(p.ID),
+			Brands: []int{p.Brand.ID},
+			Data:   p,
+		})
+	}
+
+	for _, c := range cats {
+		// only kept to check visibility
+		cat := c
+		cat.Children, cat.PartIDs = nil, nil
+		cs = append(cs, index.Completion{
+			Text:   c.Title,
+			Type:   index.Category,
+			ID:     strconv.Itoa(c.CategoryID),
+			Brands: []int{c.Brand.ID},
+			Weight: len(c.PartIDs),
+			Data:   &cat,
+		})
+	}
+
+	vehicles := make(map[string]*vehicle)
+	var order []string
+	add := func(typ, text string, brand, weight int) {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		key := typ + ":" + strings.ToLower(text)
+		v, ok := vehicles[key]
+		if !ok {
+			v = &vehicle{text: text, typ: typ, brands: make(map[int]bool)}
+			vehicles[key] = v
+			order = append(order, key)
+		}
+		v.brands[brand] = true
+		v.weight += weight
+	}
+
+	for _, p := range parts {
+		// count each part once per make and model
+		seen := make(map[string]bool)
+		for _, app := range p.Vehicles {
+			mk := strings.TrimSpace(app.Make)
+			if mk == "" {
+				continue
+			}
+			model := strings.TrimSpace(mk + " " + app.Model)
+			for typ, text := range map[string]string{index.Make: mk, index.Model: model} {
+				key := typ + ":" + strings.ToLower(text)
+				if typ == index.Model && model == mk || seen[key] {
+					continue
+				}
+				seen[key] = true
+				add(typ, text, p.Brand.ID, 1)
+			}
+		}
+	}
+
+	aries, err := ariesVehicles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range aries {
+		mk := strings.Title(v.ID.Make)
+		add(index.Make, mk, ariesBrand, v.Count)
+		if v.ID.Model != "" {
+			add(index.Model, mk+" "+strings.Title(v.ID.Model), ariesBrand, v.Count)
+		}
+	}
+
+	for _, key := range order {
+		v := vehicles[key]
+		c := index.Completion{
+			Text:   v.text,
+			Type:   v.typ,
+			Weight: v.weight,
+		}
+		for b := range v.brands {
+			c.Brands = append(c.Brands, b)
+		}
+		cs = append(cs, c)
+	}
+
+	return index.NewCompleter(cs), nil
+}
+
+type ariesVehicle struct {
+	ID struct {
+		Make  string `bson:"make"`
+		Model string `bson:"model"`
+	} `bson:"_id"`
+	Count int `bson:"count"`
+}
+
+// ariesVehicles counts the lookup entries of each make and model across
+// the ARIES lookup collections.
+func ariesVehicles() ([]ariesVehicle, error) {
+	session, err := mgo.DialWithInfo(database.AriesMongoConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	cols, err := products.GetAriesVehicleCollections(session)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []ariesVehicle
+	for _, col := range cols {
+		var vs []ariesVehicle
+		err := session.DB(products.AriesDb).C(col).Pipe([]bson.M{
+			{"$match": bson.M{"make": bson.M{"$ne": ""}}},
+			{"$group": bson.M{
+				"_id":   bson.M{"make": "$make", "model": "$model"},
+				"count": bson.M{"$sum": 1},
+			}},
+		}).All(&vs)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, vs...)
+	}
+	return all, nil
+}
@@ -0,0 +1,150 @@
+package search
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/curt-labs/API/helpers/apicontext"
+	"github.com/curt-labs/API/models/products"
+	"github.com/curt-labs/API/models/search/index"
+)
+
+// visibleDoc is the index filter for the documents the customer of dtx
+// may see, or nil when it may see everything.
+func visibleDoc(dtx *apicontext.DataContext) func(*index.Document) bool {
+	if dtx == nil || dtx.Visibility.Empty() {
+		return nil
+	}
+	return func(d *index.Document) bool {
+		return visibleData(d.Data, dtx)
+	}
+}
+
+// visibleCompletion is the completer filter for the completions the
+// customer of dtx may see, or nil when it may see everything.
+func visibleCompletion(dtx *apicontext.DataContext) func(*index.Completion) bool {
+	if dtx == nil || dtx.Visibility.Empty() {
+		return nil
+	}
+	return func(c *index.Completion) bool {
+		return visibleData(c.Data, dtx)
+	}
+}
+
+// visibleData reports whether the customer of dtx may see a part or
+// category. Anything else is always visible.
+func visibleData(data interface{}, dtx *apicontext.DataContext) bool {
+	switch d := data.(type) {
+	case *products.Part:
+		return d.Visible(dtx)
+	case *products.Category:
+		return dtx.Visibility.CategoryVisible(d.Path())
+	}
+	return true
+}
+
+// visibleMatches drops the part number matches of parts the customer of
+// dtx may not see.
+func visibleMatches(matches []PartNumber, idx *index.Index, dtx *apicontext.DataContext) []PartNumber {
+	if len(matches) == 0 || dtx == nil || dtx.Visibility.Empty() {
+		return matches
+	}
+
+	var ids []int
+	for _, m := range matches {
+		ids = append(ids, m.PartID)
+	}
+	visible := visibleParts(ids, idx, dtx)
+
+	var out []PartNumber
+	for _, m := range matches {
+		if visible[m.PartID] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// visibleNumbers drops the suggested part numbers of parts the customer
+// of dtx may not see.
+func visibleNumbers(nums []string, pn *partNumbers, idx *index.Index, brands []int, dtx *apicontext.DataContext) []string {
+	if dtx == nil || dtx.Visibility.Empty() {
+		return nums
+	}
+	var out []string
+	for _, n := range nums {
+		if len(visibleMatches(pn.lookup(n, brands), idx, dtx)) > 0 {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// visibleParts returns which of the given parts the customer of dtx may
+// see, judged from the local index when there is one and Mongo
+// otherwise.
+func visibleParts(ids []int, idx *index.Index, dtx *apicontext.DataContext) map[int]bool {
+	visible := make(map[int]bool)
+	if idx != nil {
+		for _, id := range ids {
+			if d := idx.Get(index.Part + ":" + strconv.Itoa(id)); d != nil {
+				visible[id] = visibleData(d.Data, dtx)
+			}
+		}
+		return visible
+	}
+
+	parts := fetchParts(ids)
+	for i := range parts {
+		visible[parts[i].ID] = parts[i].Visible(dtx)
+	}
+	return visible
+}
+
+// esCategory is the part of an Elasticsearch category document needed
+// to tell whether it's visible.
+type esCategory struct {
+	ID          int                   `json:"id"`
+	ParentID    int                   `json:"parent_id"`
+	Breadcrumbs []products.Breadcrumb `json:"breadcrumbs"`
+}
+
+// hideHits drops the Elasticsearch hits of parts and categories the
+// customer of dtx may not see, and takes them off the total.
+func hideHits(res *Result, dtx *apicontext.DataContext) {
+	if dtx == nil || dtx.Visibility.Empty() {
+		return
+	}
+
+	var ids []int
+	for _, h := range res.Hits {
+		if id, err := strconv.Atoi(h.ID); err == nil && h.Type == index.Part {
+			ids = append(ids, id)
+		}
+	}
+	visible := visibleParts(ids, nil, dtx)
+
+	kept := make([]Hit, 0, len(res.Hits))
+	for _, h := range res.Hits {
+		switch h.Type {
+		case index.Part:
+			if id, err := strconv.Atoi(h.ID); err == nil && !visible[id] {
+				res.Total--
+				continue
+			}
+		case index.Category:
+			if src, ok := h.Data.(*json.RawMessage); ok && src != nil {
+				var c esCategory
+				if err := json.Unmarshal(*src, &c); err == nil {
+					cat := products.Category{CategoryID: c.ID, ParentID: c.ParentID, Breadcrumbs: c.Breadcrumbs}
+					if !dtx.Visibility.CategoryVisible(cat.Path()) {
+						res.Total--
+						continue
+					}
+				}
+			}
+		}
+		kept = append(kept, h)
+	}
+	res.Hits = kept
+}
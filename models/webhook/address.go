@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// blocked are the networks deliveries may not go to, where they'd
+	// reach the API's own network instead of a customer's endpoint:
+	// private, shared, loopback, link-local and unspecified addresses.
+	blocked = networks(
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+		"169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+		"::/128", "::1/128", "fc00::/7", "fe80::/10",
+	)
+
+	errNoAddress = errors.New("the webhook host has no address")
+
+	// lookupIP resolves hosts, swapped out by tests.
+	lookupIP = net.LookupIP
+)
+
+func networks(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range blocked {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// hostOf is the host of a URL's host and port, without brackets.
+func hostOf(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return h
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+// resolve returns a host's addresses, unless any of them isn't public.
+func resolve(host string) ([]net.IP, error) {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = lookupIP(host); err != nil {
+			return nil, err
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errNoAddress
+	}
+	for _, ip := range ips {
+		if !public(ip) {
+			return nil, fmt.Errorf("%s is at %s, which is not a public address", host, ip)
+		}
+	}
+	return ips, nil
+}
+
+// dial connects deliveries, redirects included, to the addresses the
+// host resolves to as they're sent, so a host that was public when it
+// was subscribed can't be pointed at the API's network later.
+func dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolve(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
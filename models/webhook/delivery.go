@@ -0,0 +1,304 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DeliveryCollectionName is the delivery log.
+	DeliveryCollectionName = "webhook_deliveries"
+
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+
+	// MaxAttempts is how many times a delivery is sent before it fails.
+	MaxAttempts = 8
+
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+	// lease is how long a worker has a delivery before others may send it
+	lease = time.Minute
+)
+
+var (
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+	// client has no proxy, so every connection goes through dial.
+	client = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dial,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+	}
+)
+
+// Delivery is an event sent, or to be sent, to a subscription.
+type Delivery struct {
+	ID             bson.ObjectId  `bson:"_id" json:"id" xml:"id,attr"`
+	SubscriptionID bson.ObjectId  `bson:"subscription_id" json:"subscription_id" xml:"subscription_id,attr"`
+	CustomerID     int            `bson:"customer_id" json:"customer_id" xml:"customer_id,attr"`
+	EventID        bson.ObjectId  `bson:"event_id" json:"event_id" xml:"event_id,attr"`
+	Event          string         `bson:"event" json:"event" xml:"event,attr"`
+	URL            string         `bson:"url" json:"url" xml:"url,attr"`
+	Payload        string         `bson:"payload" json:"payload" xml:"payload"`
+	Status         string         `bson:"status" json:"status" xml:"status,attr"`
+	AttemptCount   int            `bson:"attempt_count" json:"attempt_count" xml:"attempt_count,attr"`
+	Attempts       []Attempt      `bson:"attempts" json:"attempts" xml:"attempts>attempt"`
+	NextAttempt    *time.Time     `bson:"next_attempt,omitempty" json:"next_attempt,omitempty" xml:"next_attempt,attr,omitempty"`
+	ReplayOf       *bson.ObjectId `bson:"replay_of,omitempty" json:"replay_of,omitempty" xml:"replay_of,attr,omitempty"`
+	CreatedAt      time.Time      `bson:"created_at" json:"created_at" xml:"created_at,attr"`
+	DeliveredAt    *time.Time     `bson:"delivered_at,omitempty" json:"delivered_at,omitempty" xml:"delivered_at,attr,omitempty"`
+}
+
+// Attempt is one time a delivery was sent.
+type Attempt struct {
+	At         time.Time `bson:"at" json:"at" xml:"at,attr"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty" xml:"status_code,attr,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty" xml:"error,omitempty"`
+	Duration   int64     `bson:"duration_ms" json:"duration_ms" xml:"duration_ms,attr"`
+}
+
+func newDelivery(s Subscription, e Event, payload string) *Delivery {
+	now := time.Now()
+	return &Delivery{
+		ID:             bson.NewObjectId(),
+		SubscriptionID: s.ID,
+		CustomerID:     s.CustomerID,
+		EventID:        e.ID,
+		Event:          e.Type,
+		URL:            s.URL,
+		Payload:        payload,
+		Status:         StatusPending,
+		Attempts:       make([]Attempt, 0),
+		NextAttempt:    &now,
+		CreatedAt:      now,
+	}
+}
+
+// Sign is the signature of a delivery body sent at a Unix timestamp:
+// "sha256=" and the hex HMAC-SHA256, keyed with the subscription's
+// secret, of the timestamp, a dot and the body.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells whether a signature is that of a body sent at timestamp.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// backoff is how long to wait after the nth failed attempt, doubling
+// from 30 seconds up to 6 hours.
+func backoff(n int) time.Duration {
+	d := firstRetry
+	for i := 1; i < n && d < maxRetry; i++ {
+		d *= 2
+	}
+	if d > maxRetry {
+		d = maxRetry
+	}
+	return d
+}
+
+// GetDelivery loads a customer's delivery.
+func GetDelivery(id bson.ObjectId, customerID int) (*Delivery, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var d Delivery
+	err = session.DB(database.ProductDatabase).C(DeliveryCollectionName).Find(bson.M{"_id": id, "customer_id": customerID}).One(&d)
+	if err == mgo.ErrNotFound {
+		return nil, ErrDeliveryNotFound
+	}
+	return &d, err
+}
+
+// Deliveries lists a customer's deliveries newest first, of a
+// subscription and in a status when they're given.
+func Deliveries(customerID int, subscriptionID bson.ObjectId, status string, page, count int) ([]Delivery, error) {
+	if count <= 0 || count > 100 {
+		count = 25
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	qry := bson.M{"customer_id": customerID}
+	if subscriptionID != "" {
+		qry["subscription_id"] = subscriptionID
+	}
+	if status != "" {
+		qry["status"] = strings.ToLower(status)
+	}
+	deliveries := make([]Delivery, 0)
+	err = session.DB(database.ProductDatabase).C(DeliveryCollectionName).Find(qry).Sort("-created_at").Skip((page - 1) * count).Limit(count).All(&deliveries)
+	return deliveries, err
+}
+
+// Replay sends a delivery's event again, to the subscription's current
+// URL, as a new delivery.
+func Replay(id bson.ObjectId, customerID int) (*Delivery, error) {
+	original, err := GetDelivery(id, customerID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := GetSubscription(original.SubscriptionID, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := newDelivery(*sub, Event{ID: original.EventID, Type: original.Event}, original.Payload)
+	d.ReplayOf = &original.ID
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	if err = session.DB(database.ProductDatabase).C(DeliveryCollectionName).Insert(d); err != nil {
+		return nil, err
+	}
+	enqueue(d.ID)
+	return d, nil
+}
+
+// deliver sends a pending delivery that's due, unless another worker
+// has it, and records how it went.
+func deliver(id bson.ObjectId) error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	db := session.DB(database.ProductDatabase)
+
+	now := time.Now()
+	var d Delivery
+	_, err = db.C(DeliveryCollectionName).Find(bson.M{
+		"_id":          id,
+		"status":       StatusPending,
+		"next_attempt": bson.M{"$lte": now},
+	}).Apply(mgo.Change{Update: bson.M{"$set": bson.M{"next_attempt": now.Add(lease)}}}, &d)
+	if err == mgo.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var sub Subscription
+	if err = db.C(SubscriptionCollectionName).FindId(d.SubscriptionID).One(&sub); err == mgo.ErrNotFound || (err == nil && !sub.Wants(d.Event)) {
+		return db.C(DeliveryCollectionName).UpdateId(d.ID, bson.M{
+			"$set":   bson.M{"status": StatusFailed},
+			"$unset": bson.M{"next_attempt": 1},
+			"$push":  bson.M{"attempts": Attempt{At: now, Error: "the subscription was removed, disabled or dropped the event"}},
+		})
+	} else if err != nil {
+		return err
+	}
+
+	attempt := send(&d, sub.Secret)
+	set := bson.M{}
+	update := bson.M{"$push": bson.M{"attempts": attempt}, "$inc": bson.M{"attempt_count": 1}, "$set": set}
+	switch {
+	case attempt.Error == "":
+		set["status"] = StatusDelivered
+		set["delivered_at"] = attempt.At
+		update["$unset"] = bson.M{"next_attempt": 1}
+	case d.AttemptCount+1 >= MaxAttempts:
+		set["status"] = StatusFailed
+		update["$unset"] = bson.M{"next_attempt": 1}
+	default:
+		set["next_attempt"] = attempt.At.Add(backoff(d.AttemptCount + 1))
+	}
+	return db.C(DeliveryCollectionName).UpdateId(d.ID, update)
+}
+
+// send posts a delivery's payload, signed with secret. Any 2xx answer
+// delivers it.
+func send(d *Delivery, secret string) Attempt {
+	start := time.Now()
+	a := Attempt{At: start}
+
+	body := []byte(d.Payload)
+	req, err := http.NewRequest("POST", d.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CURT-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", d.ID.Hex())
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set("X-Webhook-Signature", Sign(secret, start.Unix(), body))
+
+	resp, err := client.Do(req)
+	a.Duration = int64(time.Since(start) / time.Millisecond)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Error = fmt.Sprintf("the endpoint answered %s", resp.Status)
+	}
+	return a
+}
+
+// due returns the IDs of pending deliveries that are due.
+func due(now time.Time, limit int) ([]bson.ObjectId, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var docs []struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	err = session.DB(database.ProductDatabase).C(DeliveryCollectionName).Find(bson.M{
+		"status":       StatusPending,
+		"next_attempt": bson.M{"$lte": now},
+	}).Select(bson.M{"_id": 1}).Sort("next_attempt").Limit(limit).All(&docs)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]bson.ObjectId, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
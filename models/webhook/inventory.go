@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"log"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// LowInventoryCollectionName holds the parts inventory.low was sent for,
+// so it's sent once each time a part runs low.
+const LowInventoryCollectionName = "webhook_low_inventory"
+
+// LowInventory is the data of inventory.low events.
+type LowInventory struct {
+	PartID     int       `bson:"part_id" json:"part_id"`
+	PartNumber string    `bson:"part_number" json:"part_number"`
+	Available  int       `bson:"available" json:"available"`
+	Threshold  int       `bson:"threshold" json:"threshold"`
+	Since      time.Time `bson:"since" json:"since"`
+}
+
+// CheckInventory publishes inventory.low for parts with warehouse
+// inventory that ran down to threshold or below since the last check,
+// and forgets the parts that were restocked. It returns how many parts
+// ran low.
+func CheckInventory(threshold int) (int, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	db := session.DB(database.ProductDatabase)
+
+	var parts []struct {
+		ID         int    `bson:"id"`
+		PartNumber string `bson:"part_number"`
+		Inventory  struct {
+			TotalAvailability int `bson:"totalavailability"`
+		} `bson:"inventory"`
+	}
+	err = db.C(database.ProductCollectionName).Find(bson.M{
+		"inventory.warehouses.0":      bson.M{"$exists": true},
+		"inventory.totalavailability": bson.M{"$lte": threshold},
+	}).Select(bson.M{"id": 1, "part_number": 1, "inventory.totalavailability": 1}).All(&parts)
+	if err != nil {
+		return 0, err
+	}
+
+	var flagged []LowInventory
+	if err = db.C(LowInventoryCollectionName).Find(nil).All(&flagged); err != nil {
+		return 0, err
+	}
+	seen := make(map[int]bool, len(flagged))
+	for _, f := range flagged {
+		seen[f.PartID] = true
+	}
+
+	now := time.Now()
+	low := make([]int, 0, len(parts))
+	n := 0
+	for _, p := range parts {
+		low = append(low, p.ID)
+		if seen[p.ID] {
+			continue
+		}
+		l := LowInventory{PartID: p.ID, PartNumber: p.PartNumber, Available: p.Inventory.TotalAvailability, Threshold: threshold, Since: now}
+		if err = db.C(LowInventoryCollectionName).Insert(l); err != nil {
+			return n, err
+		}
+		if err = PublishPart(InventoryLow, p.ID, l); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	_, err = db.C(LowInventoryCollectionName).RemoveAll(bson.M{"part_id": bson.M{"$nin": low}})
+	return n, err
+}
+
+// WatchInventory checks inventory every interval.
+func WatchInventory(interval time.Duration, threshold int) {
+	for {
+		if n, err := CheckInventory(threshold); err != nil {
+			log.Printf("checking inventory for webhooks failed: %s\n", err.Error())
+		} else if n > 0 {
+			log.Printf("%d parts ran low on inventory\n", n)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/curt-labs/API/helpers/rabbitmq"
+	"github.com/streadway/amqp"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// sweepInterval is how often deliveries that are due, to be retried or
+// that didn't make it onto the queue, are queued.
+const sweepInterval = 15 * time.Second
+
+var (
+	errQueueFull = errors.New("the webhook queue is full")
+
+	queue      Queue
+	queueMutex sync.RWMutex
+)
+
+// Queue holds the IDs of deliveries to send, for the workers to take.
+type Queue interface {
+	Push(id bson.ObjectId) error
+	Consume(handle func(id bson.ObjectId)) error
+}
+
+// memoryQueue is the in-process queue, for when there's no RabbitMQ.
+type memoryQueue chan bson.ObjectId
+
+func (q memoryQueue) Push(id bson.ObjectId) error {
+	select {
+	case q <- id:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (q memoryQueue) Consume(handle func(id bson.ObjectId)) error {
+	go func() {
+		for id := range q {
+			handle(id)
+		}
+	}()
+	return nil
+}
+
+// rabbitQueue shares deliveries among the API's instances through
+// RabbitMQ.
+type rabbitQueue struct {
+	producer *rabbitmq.Producer
+	mutex    sync.Mutex
+	exchange rabbitmq.Exchange
+}
+
+func newRabbitQueue() (*rabbitQueue, error) {
+	ex := rabbitmq.Exchange{Name: "webhooks", Type: "direct", RoutingKey: "delivery"}
+	p, err := rabbitmq.NewProducer(ex, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &rabbitQueue{producer: p, exchange: ex}, nil
+}
+
+func (q *rabbitQueue) Push(id bson.ObjectId) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.producer.SendMessage([]byte(id.Hex()))
+}
+
+func (q *rabbitQueue) Consume(handle func(id bson.ObjectId)) error {
+	c, err := rabbitmq.NewConsumer("webhook-worker-"+bson.NewObjectId().Hex(), "webhook_deliveries", q.exchange, nil)
+	if err != nil {
+		return err
+	}
+	c.AddHandler(rabbitmq.HandlerFunc(func(m *amqp.Delivery) error {
+		if id := string(m.Body); bson.IsObjectIdHex(id) {
+			handle(bson.ObjectIdHex(id))
+		}
+		return nil
+	}))
+	return nil
+}
+
+// Start sends deliveries with a number of workers, taking them from
+// RabbitMQ when AMQP_HOST is set and from an in-process queue
+// otherwise, or when RabbitMQ can't be published to or consumed from,
+// and queues the ones that come due for a retry.
+func Start(workers int) {
+	handle := func(id bson.ObjectId) {
+		if err := deliver(id); err != nil {
+			log.Printf("delivering webhook %s failed: %s\n", id.Hex(), err.Error())
+		}
+	}
+
+	var q Queue
+	if os.Getenv("AMQP_HOST") != "" {
+		rq, err := newRabbitQueue()
+		if err == nil {
+			err = consume(rq, workers, handle)
+		}
+		if err != nil {
+			log.Printf("webhooks fall back to the in-process queue: %s\n", err.Error())
+		} else {
+			q = rq
+		}
+	}
+	if q == nil {
+		mq := make(memoryQueue, 1024)
+		consume(mq, workers, handle)
+		q = mq
+	}
+
+	queueMutex.Lock()
+	queue = q
+	queueMutex.Unlock()
+
+	go sweep(sweepInterval)
+}
+
+// consume starts the workers on a queue, failing when any can't start.
+func consume(q Queue, workers int, handle func(id bson.ObjectId)) error {
+	for i := 0; i < workers; i++ {
+		if err := q.Consume(handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue queues a delivery. Without a queue, or when pushing fails,
+// the sweep queues it once a worker runs.
+func enqueue(id bson.ObjectId) {
+	queueMutex.RLock()
+	q := queue
+	queueMutex.RUnlock()
+	if q == nil {
+		return
+	}
+	if err := q.Push(id); err != nil {
+		log.Printf("queueing webhook %s failed: %s\n", id.Hex(), err.Error())
+	}
+}
+
+func sweep(interval time.Duration) {
+	for {
+		ids, err := due(time.Now(), 500)
+		if err != nil {
+			log.Printf("finding due webhooks failed: %s\n", err.Error())
+		}
+		for _, id := range ids {
+			enqueue(id)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,296 @@
+// Package webhook delivers catalog, price and order events to the
+// endpoints customers subscribe, signed with each subscription's secret
+// and retried with exponential backoff.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/curt-labs/API/helpers/database"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// SubscriptionCollectionName holds the endpoints customers registered.
+	SubscriptionCollectionName = "webhook_subscriptions"
+
+	PartUpdated    = "part.updated"
+	PriceChanged   = "price.changed"
+	OrderCreated   = "order.created"
+	OrderFulfilled = "order.fulfilled"
+	InventoryLow   = "inventory.low"
+)
+
+var (
+	// Events are the event types that can be subscribed to.
+	Events = []string{PartUpdated, PriceChanged, OrderCreated, OrderFulfilled, InventoryLow}
+
+	ErrNotFound = errors.New("webhook subscription not found")
+
+	errNoAudience = errors.New("no audience is set for part events")
+
+	audience Audience
+)
+
+// Subscription is an endpoint of a customer and the events it gets, of
+// the brands its customer's key has access to. The secret is only shown
+// when it's set.
+type Subscription struct {
+	ID           bson.ObjectId `bson:"_id" json:"id" xml:"id,attr"`
+	CustomerID   int           `bson:"customer_id" json:"customer_id" xml:"customer_id,attr"`
+	BrandIDs     []int         `bson:"brand_ids" json:"brand_ids" xml:"brand_ids>brand_id"`
+	URL          string        `bson:"url" json:"url" xml:"url,attr"`
+	Events       []string      `bson:"events" json:"events" xml:"events>event"`
+	Secret       string        `bson:"secret" json:"secret,omitempty" xml:"secret,omitempty"`
+	Active       bool          `bson:"active" json:"active" xml:"active,attr"`
+	DateAdded    time.Time     `bson:"date_added" json:"date_added" xml:"date_added,attr"`
+	DateModified time.Time     `bson:"date_modified" json:"date_modified" xml:"date_modified,attr"`
+}
+
+// Event is the body of every delivery.
+type Event struct {
+	ID        bson.ObjectId `json:"id"`
+	Type      string        `json:"type"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      interface{}   `json:"data"`
+}
+
+// PriceChange is the data of price.changed events: a part's list, MAP
+// or jobber prices changed on schedule, or a customer's price of it did.
+type PriceChange struct {
+	PartID     int     `json:"part_id"`
+	CustomerID int     `json:"customer_id,omitempty"`
+	Source     string  `json:"source"`
+	Price      float64 `json:"price,omitempty"`
+	Sale       bool    `json:"sale,omitempty"`
+}
+
+const (
+	// SourceSchedule is the source of list, MAP and jobber price changes.
+	SourceSchedule = "schedule"
+	// SourceCustomer is the source of a customer's price changes.
+	SourceCustomer = "customer"
+)
+
+// Audience loads a part to tell whether a customer, with keys to some
+// brands, may hear of it.
+type Audience func(partID int) (func(customerID int, brandIDs []int) bool, error)
+
+// SetAudience sets who hears of the part events PublishPart publishes.
+func SetAudience(a Audience) {
+	audience = a
+}
+
+// Subscriptions returns a customer's subscriptions.
+func Subscriptions(customerID int) ([]Subscription, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	subs := make([]Subscription, 0)
+	err = session.DB(database.ProductDatabase).C(SubscriptionCollectionName).Find(bson.M{"customer_id": customerID}).Sort("date_added").All(&subs)
+	return subs, err
+}
+
+// GetSubscription loads a customer's subscription.
+func GetSubscription(id bson.ObjectId, customerID int) (*Subscription, error) {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var s Subscription
+	err = session.DB(database.ProductDatabase).C(SubscriptionCollectionName).Find(bson.M{"_id": id, "customer_id": customerID}).One(&s)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return &s, err
+}
+
+// Save creates the subscription when it has no ID, with a random secret
+// unless it has one, and replaces it otherwise, keeping its secret
+// unless a new one is given.
+func (s *Subscription) Save() error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	col := session.DB(database.ProductDatabase).C(SubscriptionCollectionName)
+
+	s.DateModified = time.Now()
+	if s.ID == "" {
+		if s.Secret == "" {
+			if s.Secret, err = newSecret(); err != nil {
+				return err
+			}
+		}
+		s.ID = bson.NewObjectId()
+		s.DateAdded = s.DateModified
+		return col.Insert(s)
+	}
+
+	var existing Subscription
+	if err = col.Find(bson.M{"_id": s.ID, "customer_id": s.CustomerID}).One(&existing); err == mgo.ErrNotFound {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	s.DateAdded = existing.DateAdded
+	if s.Secret == "" {
+		s.Secret = existing.Secret
+	}
+	return col.UpdateId(s.ID, s)
+}
+
+// Delete removes the subscription. Its delivery log stays.
+func (s *Subscription) Delete() error {
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.DB(database.ProductDatabase).C(SubscriptionCollectionName).Remove(bson.M{"_id": s.ID, "customer_id": s.CustomerID})
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Wants tells whether the subscription gets an event type.
+func (s *Subscription) Wants(event string) bool {
+	if !s.Active {
+		return false
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("an http or https url is required")
+	}
+	if _, err = resolve(hostOf(u.Host)); err != nil {
+		return err
+	}
+	if len(s.Events) == 0 {
+		return fmt.Errorf("at least one event is required, of %s", strings.Join(Events, ", "))
+	}
+
+	seen := make(map[string]bool)
+	events := make([]string, 0, len(s.Events))
+	for _, e := range s.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !known(e) {
+			return fmt.Errorf("unknown event %q, use one of %s", e, strings.Join(Events, ", "))
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	s.Events = events
+	return nil
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Publish queues a delivery of an event to every active subscription
+// of a customer to it.
+func Publish(event string, customerID int, data interface{}) error {
+	if customerID <= 0 {
+		return fmt.Errorf("%s events need a customer, or a part to publish them to its audience", event)
+	}
+	return publish(event, bson.M{"customer_id": customerID}, data, nil)
+}
+
+// PublishPart queues a delivery of an event about a part to every
+// active subscription to it whose customer is in the part's audience.
+func PublishPart(event string, partID int, data interface{}) error {
+	if audience == nil {
+		return errNoAudience
+	}
+	hears, err := audience(partID)
+	if err != nil {
+		return err
+	}
+	return publish(event, bson.M{}, data, func(s Subscription) bool {
+		return hears(s.CustomerID, s.BrandIDs)
+	})
+}
+
+// publish queues an event for the active subscriptions to it that qry
+// matches and, when it's given, to lets through.
+func publish(event string, qry bson.M, data interface{}, to func(Subscription) bool) error {
+	if !known(event) {
+		return fmt.Errorf("unknown event %q", event)
+	}
+
+	session, err := mgo.DialWithInfo(database.MongoPartConnectionString())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	db := session.DB(database.ProductDatabase)
+
+	qry["active"] = true
+	qry["events"] = event
+	var subs []Subscription
+	if err = db.C(SubscriptionCollectionName).Find(qry).All(&subs); err != nil || len(subs) == 0 {
+		return err
+	}
+
+	e := Event{ID: bson.NewObjectId(), Type: event, CreatedAt: time.Now(), Data: data}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range subs {
+		if to != nil && !to(s) {
+			continue
+		}
+		d := newDelivery(s, e, string(payload))
+		if err = db.C(DeliveryCollectionName).Insert(d); err != nil {
+			return err
+		}
+		enqueue(d.ID)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebhook(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		switch host {
+		case "example.com":
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		case "intranet.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.1.2.3")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	Convey("Testing Sign", t, func() {
+		body := []byte(`{"type":"part.updated"}`)
+		sig := Sign("secret", 1700000000, body)
+		So(sig, ShouldStartWith, "sha256=")
+		So(len(sig), ShouldEqual, len("sha256=")+64)
+		So(Verify("secret", 1700000000, body, sig), ShouldBeTrue)
+		So(Verify("other", 1700000000, body, sig), ShouldBeFalse)
+		So(Verify("secret", 1700000001, body, sig), ShouldBeFalse)
+		So(Verify("secret", 1700000000, []byte(`{}`), sig), ShouldBeFalse)
+	})
+
+	Convey("Testing backoff", t, func() {
+		So(backoff(1), ShouldEqual, 30*time.Second)
+		So(backoff(2), ShouldEqual, time.Minute)
+		So(backoff(4), ShouldEqual, 4*time.Minute)
+		So(backoff(MaxAttempts), ShouldBeLessThanOrEqualTo, maxRetry)
+		So(backoff(20), ShouldEqual, maxRetry)
+	})
+
+	Convey("Testing subscription validation", t, func() {
+		s := Subscription{URL: "https://example.com/hooks", Events: []string{" Price.Changed", "price.changed", OrderCreated}}
+		So(s.validate(), ShouldBeNil)
+		So(s.Events, ShouldResemble, []string{PriceChanged, OrderCreated})
+
+		So((&Subscription{URL: "ftp://example.com", Events: []string{PartUpdated}}).validate(), ShouldNotBeNil)
+		So((&Subscription{URL: "/hooks", Events: []string{PartUpdated}}).validate(), ShouldNotBeNil)
+		So((&Subscription{URL: "https://example.com"}).validate(), ShouldNotBeNil)
+		So((&Subscription{URL: "https://example.com", Events: []string{"part.deleted"}}).validate(), ShouldNotBeNil)
+	})
+
+	Convey("Testing private addresses", t, func() {
+		for _, u := range []string{
+			"http://127.0.0.1/hooks", "http://localhost:8080", "http://10.0.0.1", "http://172.20.1.1",
+			"http://192.168.1.10", "http://169.254.169.254/latest/meta-data", "http://[::1]:80",
+			"http://[fd00::1]", "http://0.0.0.0", "http://[::ffff:127.0.0.1]", "https://intranet.example.com",
+		} {
+			So((&Subscription{URL: u, Events: []string{PartUpdated}}).validate(), ShouldNotBeNil)
+		}
+		So((&Subscription{URL: "http://8.8.8.8:8080/hooks", Events: []string{PartUpdated}}).validate(), ShouldBeNil)
+
+		_, err := dial(context.Background(), "tcp", "127.0.0.1:80")
+		So(err, ShouldNotBeNil)
+		_, err = dial(context.Background(), "tcp", "intranet.example.com:443")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Testing Publish without a customer or audience", t, func() {
+		So(Publish(PartUpdated, 0, nil), ShouldNotBeNil)
+		So(PublishPart(PartUpdated, 11000, nil), ShouldEqual, errNoAudience)
+	})
+
+	Convey("Testing Wants", t, func() {
+		s := Subscription{Active: true, Events: []string{PriceChanged}}
+		So(s.Wants(PriceChanged), ShouldBeTrue)
+		So(s.Wants(PartUpdated), ShouldBeFalse)
+		s.Active = false
+		So(s.Wants(PriceChanged), ShouldBeFalse)
+	})
+}